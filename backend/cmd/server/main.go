@@ -6,10 +6,21 @@ import (
 	"log/slog"
 	"net/http"
 	"os"
+	"time"
+	_ "time/tzdata" // validates profile time zones on hosts without zoneinfo
 
+	"github.com/alecdray/waffle-talkie/internal/audio"
+	"github.com/alecdray/waffle-talkie/internal/auth"
+	"github.com/alecdray/waffle-talkie/internal/compilation"
 	"github.com/alecdray/waffle-talkie/internal/config"
 	"github.com/alecdray/waffle-talkie/internal/database"
+	"github.com/alecdray/waffle-talkie/internal/email"
+	"github.com/alecdray/waffle-talkie/internal/logging"
+	"github.com/alecdray/waffle-talkie/internal/metrics"
+	"github.com/alecdray/waffle-talkie/internal/notify"
+	"github.com/alecdray/waffle-talkie/internal/ratelimit"
 	"github.com/alecdray/waffle-talkie/internal/server"
+	"github.com/alecdray/waffle-talkie/internal/storage"
 )
 
 func main() {
@@ -17,7 +28,16 @@ func main() {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	logLevel, err := logging.ParseLevel(config.Config.LogLevel)
+	if err != nil {
+		slog.Error("failed to parse log level", "error", err)
+		os.Exit(1)
+	}
+	logger, err := logging.New(os.Stdout, logging.Format(config.Config.LogFormat), logLevel)
+	if err != nil {
+		slog.Error("failed to create logger", "error", err)
+		os.Exit(1)
+	}
 	slog.SetDefault(logger)
 
 	db, queries, err := database.InitDB(config.Config.DatabasePath)
@@ -27,14 +47,120 @@ func main() {
 	}
 	defer db.Close()
 
-	taskManager := server.NewTaskManager(queries, config.Config.AudioDirectory)
+	var emailSender email.Sender
+	if config.Config.SMTPAddress != "" {
+		emailSender = &email.SMTPSender{
+			Addr:     config.Config.SMTPAddress,
+			From:     config.Config.EmailFrom,
+			Username: config.Config.SMTPUsername,
+			Password: config.Config.SMTPPassword,
+		}
+	}
+
+	var notificationChannels []notify.Channel
+	if config.Config.NotifyWebhookURL != "" {
+		notificationChannels = append(notificationChannels, &notify.Webhook{URL: config.Config.NotifyWebhookURL})
+	}
+
+	var audioDecoders []audio.Decoder
+	if config.Config.FFmpegPath != "" {
+		audioDecoders = append(audioDecoders, audio.FFmpegDecoder{Path: config.Config.FFmpegPath})
+	}
+	var audioFilters []audio.Filter
+	if config.Config.AudioTrimSilence {
+		audioFilters = append(audioFilters, audio.TrimSilence())
+	}
+	if config.Config.AudioTargetLUFS != 0 {
+		audioFilters = append(audioFilters, audio.Normalize(float64(config.Config.AudioTargetLUFS)))
+	}
+	pipeline := server.NewPipeline(queries, notify.New(queries, notificationChannels...), server.PipelineOptions{
+		AudioDirectory:   config.Config.AudioDirectory,
+		AudioDecoders:    audioDecoders,
+		Transcoder:       audio.NewTranscoder(config.Config.FFmpegPath),
+		AudioFilters:     audioFilters,
+		Transcriber:      audio.NewTranscriber(config.Config.WhisperPath, config.Config.WhisperModel, config.Config.WhisperLanguage),
+		CompilationWeeks: config.Config.CompilationWeeks,
+	})
+
+	taskManager := server.NewTaskManager(queries, server.TaskOptions{
+		AudioDirectory:       config.Config.AudioDirectory,
+		PendingUserTTL:       time.Duration(config.Config.PendingUserTTLHours) * time.Hour,
+		AuditRetention:       time.Duration(config.Config.AuditRetentionDays) * 24 * time.Hour,
+		InactivityThreshold:  time.Duration(config.Config.InactivityDays) * 24 * time.Hour,
+		EmailSender:          emailSender,
+		NotificationChannels: notificationChannels,
+		EmailLinks:           email.NewLinks(config.Config.JWTSecret, config.Config.PublicURL),
+		Pipeline:             pipeline,
+		CompilationWeeks:     config.Config.CompilationWeeks,
+		CompilationEncoder:   compilation.NewEncoder(config.Config.FFmpegPath),
+	})
 	err = taskManager.Start(ctx)
 	if err != nil {
 		slog.Error("failed to start task manager", "error", err)
 		os.Exit(1)
 	}
 
-	mux := server.NewMux(queries, config.Config.JWTSecret, config.Config.AudioDirectory)
+	if config.Config.MetricsAddress != "" {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", metrics.Handler())
+		go func() {
+			slog.Info("starting metrics server", "address", config.Config.MetricsAddress)
+			err := http.ListenAndServe(config.Config.MetricsAddress, metricsMux)
+			if err != nil {
+				slog.Error("failed to start metrics server", "error", err)
+			}
+		}()
+	}
+
+	trustedProxies, err := ratelimit.ParsePrefixes(config.Config.TrustedProxies)
+	if err != nil {
+		slog.Error("failed to parse trusted proxies", "error", err)
+		os.Exit(1)
+	}
+
+	mux := server.NewMux(db, queries, server.Options{
+		JWTSecret:       config.Config.JWTSecret,
+		AudioDirectory:  config.Config.AudioDirectory,
+		AvatarDirectory: config.Config.AvatarDirectory,
+		AuthRateLimit: ratelimit.Rate{
+			PerMinute: float64(config.Config.AuthRateLimitPerMinute),
+			Burst:     config.Config.AuthRateLimitBurst,
+		},
+		APIRateLimit: ratelimit.Rate{
+			PerMinute: float64(config.Config.APIRateLimitPerMinute),
+			Burst:     config.Config.APIRateLimitBurst,
+		},
+		EmailRateLimit: ratelimit.Rate{
+			PerMinute: float64(config.Config.EmailRateLimitPerMinute),
+			Burst:     config.Config.EmailRateLimitBurst,
+		},
+		FeedRateLimit: ratelimit.Rate{
+			PerMinute: float64(config.Config.FeedRateLimitPerMinute),
+			Burst:     config.Config.FeedRateLimitBurst,
+		},
+		TrustedProxies: trustedProxies,
+		Registration: auth.RegistrationPolicy{
+			RequireInvite:   config.Config.RegistrationMode == config.RegistrationInvite,
+			MaxPendingUsers: config.Config.MaxPendingUsers,
+		},
+		EmailSender:          emailSender,
+		NotificationChannels: notificationChannels,
+		PublicURL:            config.Config.PublicURL,
+		Pipeline:             pipeline,
+
+		UnsendUndoWindow: time.Duration(config.Config.UnsendUndoSeconds) * time.Second,
+		StorageQuotas: storage.Quotas{
+			User: storage.Limits{
+				Bytes:   int64(config.Config.UserQuotaMB) << 20,
+				Seconds: int64(config.Config.UserQuotaMinutes) * 60,
+			},
+			Instance: storage.Limits{
+				Bytes:   int64(config.Config.InstanceQuotaMB) << 20,
+				Seconds: int64(config.Config.InstanceQuotaMinutes) * 60,
+			},
+			MinFreeBytes: int64(config.Config.MinFreeDiskMB) << 20,
+		},
+	})
 	serverAddress := fmt.Sprintf("%s:%s", "", config.Config.Port)
 	slog.Info("starting server", "address", serverAddress)
 	err = http.ListenAndServe(serverAddress, mux)
@@ -0,0 +1,47 @@
+package account
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// confirmationTTL is how long a deletion confirmation token stays valid.
+const confirmationTTL = 10 * time.Minute
+
+var errConfirmationInvalid = errors.New("invalid or expired confirmation token")
+
+// newConfirmationToken returns a token that authorizes deleting userID until
+// it expires. It is an HMAC rather than a JWT so it can never be mistaken for
+// a bearer token.
+func newConfirmationToken(secretKey, userID string, now time.Time) (string, time.Time) {
+	expiresAt := now.Add(confirmationTTL).Truncate(time.Second)
+	expiry := strconv.FormatInt(expiresAt.Unix(), 10)
+	return expiry + "." + confirmationMAC(secretKey, userID, expiry), expiresAt
+}
+
+// verifyConfirmationToken checks that token was issued for userID and has not expired.
+func verifyConfirmationToken(secretKey, userID, token string, now time.Time) error {
+	expiry, mac, ok := strings.Cut(token, ".")
+	if !ok {
+		return errConfirmationInvalid
+	}
+	if !hmac.Equal([]byte(mac), []byte(confirmationMAC(secretKey, userID, expiry))) {
+		return errConfirmationInvalid
+	}
+	unix, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || now.After(time.Unix(unix, 0)) {
+		return errConfirmationInvalid
+	}
+	return nil
+}
+
+func confirmationMAC(secretKey, userID, expiry string) string {
+	h := hmac.New(sha256.New, []byte(secretKey))
+	h.Write([]byte("account-deletion\x00" + userID + "\x00" + expiry))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,194 @@
+package account
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/alecdray/waffle-talkie/internal/apierror"
+	"github.com/alecdray/waffle-talkie/internal/audit"
+	"github.com/alecdray/waffle-talkie/internal/auth"
+)
+
+type exportProfile struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Role       string     `json:"role"`
+	Approved   bool       `json:"approved"`
+	Timezone   *string    `json:"timezone"`
+	StatusText *string    `json:"status_text"`
+	Email      *string    `json:"email"`
+	LastActive *time.Time `json:"last_active"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type exportMessage struct {
+	ID        string    `json:"id"`
+	Duration  int64     `json:"duration"`
+	CreatedAt time.Time `json:"created_at"`
+	// File is the path of the audio inside the archive, empty if the file is gone.
+	File string `json:"file"`
+}
+
+type exportReceipt struct {
+	AudioMessageID string    `json:"audio_message_id"`
+	ReceivedAt     time.Time `json:"received_at"`
+}
+
+// HandleExportMe streams a zip of the authenticated user's data.
+func (h *Handler) HandleExportMe(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized")
+		return
+	}
+	h.export(w, r, userID)
+}
+
+// HandleExportUser streams a zip of a user's data on their behalf.
+func (h *Handler) HandleExportUser(w http.ResponseWriter, r *http.Request) {
+	h.export(w, r, r.PathValue("id"))
+}
+
+// export writes profile.json, messages.json, receipts.json and the audio
+// files the user sent. Everything is read before the response starts so
+// database errors can still be reported; audio files are streamed.
+func (h *Handler) export(w http.ResponseWriter, r *http.Request, userID string) {
+	user, err := h.queries.GetUser(r.Context(), userID)
+	if err == sql.ErrNoRows {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeUserNotFound, "User not found")
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get user", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Internal server error")
+		return
+	}
+
+	messages, err := h.queries.ListAudioMessagesBySender(r.Context(), userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to list sent messages", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to export account")
+		return
+	}
+	receipts, err := h.queries.ListReceiptsByUser(r.Context(), userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to list receipts", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to export account")
+		return
+	}
+
+	profile := exportProfile{
+		ID:        user.ID,
+		Name:      user.Name,
+		Role:      user.Role,
+		Approved:  user.Approved,
+		CreatedAt: user.CreatedAt,
+	}
+	if user.Timezone.Valid {
+		profile.Timezone = &user.Timezone.String
+	}
+	if user.StatusText.Valid {
+		profile.StatusText = &user.StatusText.String
+	}
+	if user.LastActive.Valid {
+		profile.LastActive = &user.LastActive.Time
+	}
+	if stored, err := h.queries.GetUserEmail(r.Context(), userID); err == nil {
+		profile.Email = &stored.Address
+	} else if err != sql.ErrNoRows {
+		slog.ErrorContext(r.Context(), "failed to get email address", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to export account")
+		return
+	}
+
+	exportMessages := make([]exportMessage, 0, len(messages))
+	for _, message := range messages {
+		exportMessages = append(exportMessages, exportMessage{
+			ID:        message.ID,
+			Duration:  message.Duration,
+			CreatedAt: message.CreatedAt,
+			File:      "audio/" + message.ID + filepath.Ext(message.FilePath),
+		})
+	}
+
+	exportReceipts := make([]exportReceipt, 0, len(receipts))
+	for _, receipt := range receipts {
+		exportReceipts = append(exportReceipts, exportReceipt{
+			AudioMessageID: receipt.AudioMessageID,
+			ReceivedAt:     receipt.ReceivedAt,
+		})
+	}
+
+	actorID, _ := auth.GetUserIDFromContext(r.Context())
+	h.audit.Record(r, audit.Event{
+		Action:      audit.ActionUserExported,
+		ActorUserID: actorID,
+		TargetType:  audit.TargetUser,
+		TargetID:    userID,
+	})
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="waffle-talkie-%s.zip"`, userID))
+
+	zw := zip.NewWriter(w)
+	for i, message := range messages {
+		if err := writeFile(zw, exportMessages[i].File, message.FilePath); err != nil {
+			slog.WarnContext(r.Context(), "skipping audio file in export", "message_id", message.ID, "error", err)
+			exportMessages[i].File = ""
+		}
+	}
+	documents := []struct {
+		name string
+		v    any
+	}{
+		{"profile.json", profile},
+		{"messages.json", exportMessages},
+		{"receipts.json", exportReceipts},
+	}
+	for _, doc := range documents {
+		if err := writeJSON(zw, doc.name, doc.v); err != nil {
+			slog.ErrorContext(r.Context(), "failed to write export", "file", doc.name, "error", err)
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		slog.ErrorContext(r.Context(), "failed to finish export", "error", err)
+	}
+}
+
+func writeJSON(zw *zip.Writer, name string, v any) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// writeFile copies the file at path into the archive. A missing file is
+// reported before anything is written so the entry can be skipped.
+func writeFile(zw *zip.Writer, name, path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := zw.CreateHeader(&zip.FileHeader{
+		Name:   name,
+		Method: zip.Store, // audio is already compressed
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	return err
+}
@@ -0,0 +1,237 @@
+package account
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/alecdray/waffle-talkie/internal/apierror"
+	"github.com/alecdray/waffle-talkie/internal/audit"
+	"github.com/alecdray/waffle-talkie/internal/auth"
+	"github.com/alecdray/waffle-talkie/internal/database"
+	"github.com/alecdray/waffle-talkie/internal/users"
+)
+
+// Handler manages a user's own account: profile, deletion and data export.
+type Handler struct {
+	db              *sql.DB
+	queries         *database.Queries
+	secretKey       string
+	avatarDirectory string
+	audit           *audit.Logger
+}
+
+// NewHandler creates an account handler. db is used to delete accounts in a
+// single transaction.
+func NewHandler(db *sql.DB, queries *database.Queries, secretKey, avatarDirectory string, auditLog *audit.Logger) *Handler {
+	return &Handler{
+		db:              db,
+		queries:         queries,
+		secretKey:       secretKey,
+		avatarDirectory: avatarDirectory,
+		audit:           auditLog,
+	}
+}
+
+// RegisterRoutes registers the routes acting on the authenticated user.
+func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /v1/me", h.HandleGetMe)
+	mux.HandleFunc("PATCH /v1/me", h.HandleUpdateMe)
+	mux.HandleFunc("PUT /v1/me/avatar", h.HandleUploadAvatar)
+	mux.HandleFunc("DELETE /v1/me/avatar", h.HandleDeleteAvatar)
+	mux.HandleFunc("POST /v1/me/deletion-token", h.HandleCreateDeletionToken)
+	mux.HandleFunc("DELETE /v1/me", h.HandleDeleteMe)
+	mux.HandleFunc("GET /v1/me/export", h.HandleExportMe)
+}
+
+// RegisterAdminRoutes registers the routes admins use on behalf of a user.
+func (h *Handler) RegisterAdminRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("DELETE /v1/users/{id}", h.HandleDeleteUser)
+	mux.HandleFunc("GET /v1/users/{id}/export", h.HandleExportUser)
+}
+
+type DeletionTokenResponse struct {
+	ConfirmationToken string    `json:"confirmation_token"`
+	ExpiresAt         time.Time `json:"expires_at"`
+}
+
+// HandleCreateDeletionToken issues the short-lived token that DELETE /v1/me
+// requires, so a single mistaken request cannot delete an account.
+func (h *Handler) HandleCreateDeletionToken(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized")
+		return
+	}
+
+	token, expiresAt := newConfirmationToken(h.secretKey, userID, time.Now())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(DeletionTokenResponse{
+		ConfirmationToken: token,
+		ExpiresAt:         expiresAt.UTC(),
+	})
+}
+
+type DeleteAccountRequest struct {
+	ConfirmationToken string `json:"confirmation_token"`
+}
+
+// LogValue keeps the confirmation token out of logs if the request is ever logged whole.
+func (req DeleteAccountRequest) LogValue() slog.Value {
+	return slog.GroupValue()
+}
+
+// HandleDeleteMe deletes the authenticated user's account and everything
+// they sent.
+func (h *Handler) HandleDeleteMe(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req DeleteAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidBody, "Invalid request body")
+		return
+	}
+	if req.ConfirmationToken == "" {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "confirmation_token is required")
+		return
+	}
+	if err := verifyConfirmationToken(h.secretKey, userID, req.ConfirmationToken, time.Now()); err != nil {
+		apierror.Write(w, http.StatusForbidden, apierror.CodeConfirmationInvalid, "Confirmation token is invalid or expired")
+		return
+	}
+
+	h.deleteAccount(w, r, userID)
+}
+
+// HandleDeleteUser deletes a user's account on their behalf.
+func (h *Handler) HandleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	userID := r.PathValue("id")
+
+	if _, err := h.queries.GetUser(r.Context(), userID); err == sql.ErrNoRows {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeUserNotFound, "User not found")
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get user", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Internal server error")
+		return
+	}
+
+	h.deleteAccount(w, r, userID)
+}
+
+func (h *Handler) deleteAccount(w http.ResponseWriter, r *http.Request, userID string) {
+	files, err := h.deleteUserData(r.Context(), userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to delete account", "target_user_id", userID, "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to delete account")
+		return
+	}
+
+	// Files are removed only once the rows are gone for good. A file that
+	// fails to delete is orphaned rather than left referenced.
+	for _, path := range files {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			slog.ErrorContext(r.Context(), "failed to remove audio file", "path", path, "error", err)
+		}
+	}
+	if err := users.RemoveAvatar(h.avatarDirectory, userID); err != nil {
+		slog.ErrorContext(r.Context(), "failed to remove avatar", "target_user_id", userID, "error", err)
+	}
+
+	slog.InfoContext(r.Context(), "account deleted", "target_user_id", userID, "files", len(files))
+	actorID, _ := auth.GetUserIDFromContext(r.Context())
+	h.audit.Record(r, audit.Event{
+		Action:      audit.ActionUserDeleted,
+		ActorUserID: actorID,
+		TargetType:  audit.TargetUser,
+		TargetID:    userID,
+		Detail:      map[string]any{"audio_files": len(files)},
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteUserData removes the user and everything that refers to them in one
+// transaction. Foreign keys are not enforced, so nothing cascades on its own.
+// The messages they sent go with their receipts, pending alerts, transcripts,
+// compilation clips and queued jobs. Their own receipts, invites, mutes and
+// notification, email and feed settings go too, as do other users' mutes of
+// them. It returns the audio files to remove from disk.
+func (h *Handler) deleteUserData(ctx context.Context, userID string) ([]string, error) {
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	qtx := h.queries.WithTx(tx)
+
+	files, err := qtx.ListAudioFilePathsBySender(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audio files: %w", err)
+	}
+	clips, err := qtx.ListCompilationClipPathsBySender(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list compilation clips: %w", err)
+	}
+	files = append(files, clips...)
+	if err := qtx.DeleteCompilationClipsBySender(ctx, userID); err != nil {
+		return nil, fmt.Errorf("failed to delete compilation clips: %w", err)
+	}
+	if err := qtx.DeleteReceiptsBySender(ctx, userID); err != nil {
+		return nil, fmt.Errorf("failed to delete receipts for sent messages: %w", err)
+	}
+	if err := qtx.DeleteReceiptsByUser(ctx, userID); err != nil {
+		return nil, fmt.Errorf("failed to delete receipts: %w", err)
+	}
+	if err := qtx.DeletePendingNotificationsBySender(ctx, userID); err != nil {
+		return nil, fmt.Errorf("failed to delete notifications for sent messages: %w", err)
+	}
+	if err := qtx.DeleteTranscriptSegmentsBySender(ctx, userID); err != nil {
+		return nil, fmt.Errorf("failed to delete transcript segments: %w", err)
+	}
+	if err := qtx.DeleteTranscriptsBySender(ctx, userID); err != nil {
+		return nil, fmt.Errorf("failed to delete transcripts: %w", err)
+	}
+	if err := qtx.DeleteJobsBySender(ctx, userID); err != nil {
+		return nil, fmt.Errorf("failed to delete jobs for sent messages: %w", err)
+	}
+	if err := qtx.DeleteAudioMessagesBySender(ctx, userID); err != nil {
+		return nil, fmt.Errorf("failed to delete audio messages: %w", err)
+	}
+	if err := qtx.DeleteInviteCodesByCreator(ctx, userID); err != nil {
+		return nil, fmt.Errorf("failed to delete invite codes: %w", err)
+	}
+	if err := qtx.DeletePendingNotificationsByUser(ctx, userID); err != nil {
+		return nil, fmt.Errorf("failed to delete pending notifications: %w", err)
+	}
+	if err := qtx.DeleteMutesByUser(ctx, userID); err != nil {
+		return nil, fmt.Errorf("failed to delete mutes: %w", err)
+	}
+	if err := qtx.DeleteNotificationPreferencesByUser(ctx, userID); err != nil {
+		return nil, fmt.Errorf("failed to delete notification preferences: %w", err)
+	}
+	if err := qtx.DeleteUserEmail(ctx, userID); err != nil {
+		return nil, fmt.Errorf("failed to delete email address: %w", err)
+	}
+	if _, err := qtx.DeleteFeedToken(ctx, userID); err != nil {
+		return nil, fmt.Errorf("failed to delete feed token: %w", err)
+	}
+	if err := qtx.DeleteUser(ctx, userID); err != nil {
+		return nil, fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return files, nil
+}
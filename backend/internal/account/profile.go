@@ -0,0 +1,219 @@
+package account
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/alecdray/waffle-talkie/internal/apierror"
+	"github.com/alecdray/waffle-talkie/internal/auth"
+	"github.com/alecdray/waffle-talkie/internal/database"
+	"github.com/alecdray/waffle-talkie/internal/users"
+)
+
+const (
+	maxNameLength       = 64
+	maxStatusTextLength = 140
+)
+
+// Profile is the authenticated user's own view of their account.
+type Profile struct {
+	users.User
+	Role users.UserRole `json:"role"`
+}
+
+func newProfile(user database.User) Profile {
+	return Profile{
+		User: users.NewUser(user),
+		Role: users.UserRole(user.Role),
+	}
+}
+
+// UpdateProfileRequest changes only the fields that are present. An empty
+// timezone or status_text clears it.
+type UpdateProfileRequest struct {
+	Name       *string `json:"name"`
+	Timezone   *string `json:"timezone"`
+	StatusText *string `json:"status_text"`
+}
+
+// HandleGetMe returns the authenticated user's profile.
+func (h *Handler) HandleGetMe(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newProfile(user))
+}
+
+// HandleUpdateMe updates the authenticated user's display name, timezone and
+// status line.
+func (h *Handler) HandleUpdateMe(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req UpdateProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidBody, "Invalid request body")
+		return
+	}
+
+	params := database.UpdateUserProfileParams{
+		ID:         user.ID,
+		Name:       user.Name,
+		Timezone:   user.Timezone,
+		StatusText: user.StatusText,
+	}
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" || utf8.RuneCountInString(name) > maxNameLength {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "name must be 1 to 64 characters")
+			return
+		}
+		params.Name = name
+	}
+
+	if req.Timezone != nil {
+		if *req.Timezone != "" {
+			// LoadLocation also accepts "" and "Local", which are not portable names.
+			if _, err := time.LoadLocation(*req.Timezone); err != nil || *req.Timezone == "Local" {
+				apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "timezone must be an IANA time zone name such as Europe/London")
+				return
+			}
+		}
+		params.Timezone = sql.NullString{String: *req.Timezone, Valid: *req.Timezone != ""}
+	}
+
+	if req.StatusText != nil {
+		statusText := strings.TrimSpace(*req.StatusText)
+		if utf8.RuneCountInString(statusText) > maxStatusTextLength {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "status_text must be at most 140 characters")
+			return
+		}
+		params.StatusText = sql.NullString{String: statusText, Valid: statusText != ""}
+	}
+
+	updated, err := h.queries.UpdateUserProfile(r.Context(), params)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to update profile", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update profile")
+		return
+	}
+
+	slog.InfoContext(r.Context(), "profile updated")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newProfile(updated))
+}
+
+// maxAvatarUploadBytes caps the size of an avatar upload request body.
+const maxAvatarUploadBytes = 5 << 20
+
+// HandleUploadAvatar replaces the authenticated user's avatar with the image
+// in the "avatar" multipart field and returns the updated profile.
+func (h *Handler) HandleUploadAvatar(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxAvatarUploadBytes)
+	if err := r.ParseMultipartForm(maxAvatarUploadBytes); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			apierror.Write(w, http.StatusRequestEntityTooLarge, apierror.CodePayloadTooLarge, "Avatar upload is too large")
+			return
+		}
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Failed to parse multipart form")
+		return
+	}
+
+	file, _, err := r.FormFile("avatar")
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Avatar file is required")
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Failed to read avatar file")
+		return
+	}
+
+	if err := users.SaveAvatar(h.avatarDirectory, user.ID, data); errors.Is(err, users.ErrInvalidImage) {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidImage, "Avatar must be a JPEG, PNG or GIF image no larger than 4096x4096")
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to save avatar", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to save avatar")
+		return
+	}
+
+	updated, err := h.queries.SetUserAvatarUpdatedAt(r.Context(), database.SetUserAvatarUpdatedAtParams{
+		ID:              user.ID,
+		AvatarUpdatedAt: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to update avatar", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to save avatar")
+		return
+	}
+
+	slog.InfoContext(r.Context(), "avatar updated")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newProfile(updated))
+}
+
+// HandleDeleteAvatar removes the authenticated user's avatar.
+func (h *Handler) HandleDeleteAvatar(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := h.queries.SetUserAvatarUpdatedAt(r.Context(), database.SetUserAvatarUpdatedAtParams{
+		ID: user.ID,
+	}); err != nil {
+		slog.ErrorContext(r.Context(), "failed to clear avatar", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to remove avatar")
+		return
+	}
+	if err := users.RemoveAvatar(h.avatarDirectory, user.ID); err != nil {
+		slog.ErrorContext(r.Context(), "failed to remove avatar files", "error", err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// currentUser loads the authenticated user, writing an error response if it cannot.
+func (h *Handler) currentUser(w http.ResponseWriter, r *http.Request) (database.User, bool) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "User ID not found")
+		return database.User{}, false
+	}
+
+	user, err := h.queries.GetUser(r.Context(), userID)
+	if err == sql.ErrNoRows {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeUserNotFound, "User not found")
+		return database.User{}, false
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get user", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Internal server error")
+		return database.User{}, false
+	}
+	return user, true
+}
@@ -4,6 +4,8 @@ import (
 	"net/http"
 
 	"github.com/alecdray/waffle-talkie/internal/database"
+	"github.com/alecdray/waffle-talkie/internal/metrics"
+	"github.com/alecdray/waffle-talkie/internal/routes"
 )
 
 type Handler struct {
@@ -15,5 +17,8 @@ func NewHandler(queries *database.Queries) *Handler {
 }
 
 func (h *Handler) RegisterRoutes(router *http.ServeMux) {
+	router.Handle("GET /v1/metrics", metrics.Handler())
 
+	// Deprecated unversioned route kept for existing scrape configs.
+	router.Handle("GET /metrics", routes.Deprecated("/admin/v1/metrics", metrics.Handler().ServeHTTP))
 }
@@ -3,6 +3,7 @@ package admin
 import (
 	"net/http"
 
+	"github.com/alecdray/waffle-talkie/internal/apierror"
 	"github.com/alecdray/waffle-talkie/internal/auth"
 	"github.com/alecdray/waffle-talkie/internal/database"
 	"github.com/alecdray/waffle-talkie/internal/users"
@@ -13,20 +14,20 @@ func IsAdminMiddleware(next http.Handler, queries *database.Queries) http.Handle
 		ctx := r.Context()
 		userID, ok := auth.GetUserIDFromContext(ctx)
 		if !ok {
-			http.Error(w, "User ID not found", http.StatusUnauthorized)
+			apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "User ID not found")
 			return
 		}
 
 		user, err := queries.GetUser(ctx, userID)
 		if err != nil {
-			http.Error(w, "Failed to get user", http.StatusInternalServerError)
+			apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to get user")
 			return
 		}
 
 		userRole := users.UserRole(user.Role)
 
 		if !userRole.IsAdmin() {
-			http.Error(w, "User is not an admin", http.StatusForbidden)
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "User is not an admin")
 			return
 		}
 
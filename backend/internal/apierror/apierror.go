@@ -0,0 +1,84 @@
+package apierror
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Code is a stable, machine-readable error identifier that clients can switch on.
+// Codes are part of the API contract: add new ones freely, never rename or reuse them.
+type Code string
+
+const (
+	// Generic request errors
+	CodeBadRequest       Code = "bad_request"
+	CodeInvalidBody      Code = "invalid_body"
+	CodeMethodNotAllowed Code = "method_not_allowed"
+	CodeNotFound         Code = "not_found"
+	CodePayloadTooLarge  Code = "payload_too_large"
+	CodeNotAcceptable    Code = "not_acceptable"
+	CodeInvalidImage     Code = "invalid_image"
+	CodeRateLimited      Code = "rate_limited"
+	CodeInternal         Code = "internal_error"
+	CodeEmailUnavailable Code = "email_unavailable"
+
+	// Authentication and authorization
+	CodeUnauthorized        Code = "unauthorized"
+	CodeTokenExpired        Code = "token_expired"
+	CodeTokenInvalid        Code = "token_invalid"
+	CodeTokenRevoked        Code = "token_revoked"
+	CodeDeviceNotRegistered Code = "device_not_registered"
+	CodeNotApproved         Code = "not_approved"
+	CodeUserSuspended       Code = "user_suspended"
+	CodeForbidden           Code = "forbidden"
+	CodeConfirmationInvalid Code = "confirmation_invalid"
+	CodeLinkInvalid         Code = "link_invalid"
+
+	// Registration
+	CodeInviteRequired      Code = "invite_required"
+	CodeInviteInvalid       Code = "invite_invalid"
+	CodePendingLimitReached Code = "pending_limit_reached"
+
+	// Resources
+	CodeUserNotFound        Code = "user_not_found"
+	CodeMessageNotFound     Code = "message_not_found"
+	CodeAudioFileNotFound   Code = "audio_file_not_found"
+	CodeInviteNotFound      Code = "invite_not_found"
+	CodeAvatarNotFound      Code = "avatar_not_found"
+	CodeFeedNotFound        Code = "feed_not_found"
+	CodeCompilationNotFound Code = "compilation_not_found"
+
+	// Audio processing
+	CodeMessageNotReady          Code = "message_not_ready"
+	CodeTranscriptionUnavailable Code = "transcription_unavailable"
+
+	// Unsending
+	CodeUndoUnavailable Code = "undo_unavailable"
+
+	// Storage
+	CodeQuotaExceeded       Code = "quota_exceeded"
+	CodeInsufficientStorage Code = "insufficient_storage"
+)
+
+// Response is the JSON envelope written for every error.
+type Response struct {
+	Error Body `json:"error"`
+}
+
+type Body struct {
+	Code    Code   `json:"code"`
+	Message string `json:"message"`
+}
+
+// Write sends an error response with the given status, code and human-readable message.
+func Write(w http.ResponseWriter, status int, code Code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Response{
+		Error: Body{
+			Code:    code,
+			Message: message,
+		},
+	})
+}
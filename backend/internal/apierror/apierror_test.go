@@ -0,0 +1,105 @@
+package apierror_test
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/alecdray/waffle-talkie/internal/openapi"
+)
+
+// declaredCodes returns every Code constant in apierror.go, in order.
+func declaredCodes(t *testing.T) []string {
+	t.Helper()
+	file, err := parser.ParseFile(token.NewFileSet(), "apierror.go", nil, 0)
+	if err != nil {
+		t.Fatalf("failed to parse apierror.go: %v", err)
+	}
+	var codes []string
+	ast.Inspect(file, func(n ast.Node) bool {
+		spec, ok := n.(*ast.ValueSpec)
+		if !ok {
+			return true
+		}
+		if ident, ok := spec.Type.(*ast.Ident); !ok || ident.Name != "Code" {
+			return true
+		}
+		for _, v := range spec.Values {
+			if lit, ok := v.(*ast.BasicLit); ok {
+				code, _ := strconv.Unquote(lit.Value)
+				codes = append(codes, code)
+			}
+		}
+		return true
+	})
+	if len(codes) == 0 {
+		t.Fatal("found no codes in apierror.go")
+	}
+	return codes
+}
+
+// TestCodesDocumented checks that the OpenAPI spec lists exactly the
+// declared codes.
+func TestCodesDocumented(t *testing.T) {
+	var spec struct {
+		Components struct {
+			Schemas struct {
+				ErrorResponse struct {
+					Properties struct {
+						Error struct {
+							Properties struct {
+								Code struct {
+									Enum []string `json:"enum"`
+								} `json:"code"`
+							} `json:"properties"`
+						} `json:"error"`
+					} `json:"properties"`
+				} `json:"ErrorResponse"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(openapi.Spec, &spec); err != nil {
+		t.Fatalf("failed to parse OpenAPI spec: %v", err)
+	}
+	compareCodes(t, "openapi.json", declaredCodes(t), spec.Components.Schemas.ErrorResponse.Properties.Error.Properties.Code.Enum)
+}
+
+// TestCodesInMobileClient checks that the app's ApiErrorCode union lists
+// exactly the declared codes.
+func TestCodesInMobileClient(t *testing.T) {
+	source, err := os.ReadFile("../../../mobile/src/api/client.ts")
+	if os.IsNotExist(err) {
+		t.Skip("mobile app not checked out alongside the backend")
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	union := regexp.MustCompile(`(?s)export type ApiErrorCode =(.*?);`).FindSubmatch(source)
+	if union == nil {
+		t.Fatal("ApiErrorCode not found in client.ts")
+	}
+	var codes []string
+	for _, m := range regexp.MustCompile(`"([a-z_]+)"`).FindAllSubmatch(union[1], -1) {
+		codes = append(codes, string(m[1]))
+	}
+	compareCodes(t, "client.ts", declaredCodes(t), codes)
+}
+
+func compareCodes(t *testing.T, where string, declared, listed []string) {
+	t.Helper()
+	for _, code := range declared {
+		if !slices.Contains(listed, code) {
+			t.Errorf("%s is missing %q", where, code)
+		}
+	}
+	for _, code := range listed {
+		if !slices.Contains(declared, code) {
+			t.Errorf("%s lists %q, which apierror does not declare", where, code)
+		}
+	}
+}
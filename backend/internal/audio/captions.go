@@ -0,0 +1,79 @@
+package audio
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	maxTitleLength   = 100
+	maxCaptionLength = 1000
+)
+
+var (
+	errTitleTooLong   = errors.New("title must be at most 100 characters")
+	errCaptionTooLong = errors.New("caption must be at most 1000 characters")
+)
+
+// cleanText makes user text safe to store and show: invalid UTF-8, control
+// and formatting characters (such as bidi overrides) are dropped and the rest
+// trimmed. A single line has every run of whitespace collapsed to one space;
+// otherwise line breaks are kept, at most one blank line in a row.
+func cleanText(text string, multiline bool) string {
+	text = strings.ToValidUTF8(text, "")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+
+	var b strings.Builder
+	newlines, space := 0, false
+	for _, r := range text {
+		switch {
+		case r == '\n' && multiline:
+			newlines++
+			space = false
+			continue
+		case unicode.IsSpace(r):
+			space = true
+			continue
+		case unicode.IsControl(r) || unicode.Is(unicode.Cf, r):
+			continue
+		}
+		if b.Len() > 0 {
+			if newlines > 0 {
+				b.WriteString(strings.Repeat("\n", min(newlines, 2)))
+			} else if space {
+				b.WriteByte(' ')
+			}
+		}
+		newlines, space = 0, false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// cleanTitle returns the stored form of a title, invalid when empty.
+func cleanTitle(title string) (sql.NullString, error) {
+	title = cleanText(title, false)
+	if utf8.RuneCountInString(title) > maxTitleLength {
+		return sql.NullString{}, errTitleTooLong
+	}
+	return sql.NullString{String: title, Valid: title != ""}, nil
+}
+
+// cleanCaption returns the stored form of a caption, invalid when empty.
+func cleanCaption(caption string) (sql.NullString, error) {
+	caption = cleanText(caption, true)
+	if utf8.RuneCountInString(caption) > maxCaptionLength {
+		return sql.NullString{}, errCaptionTooLong
+	}
+	return sql.NullString{String: caption, Valid: caption != ""}, nil
+}
+
+func nullStringPtr(s sql.NullString) *string {
+	if !s.Valid {
+		return nil
+	}
+	return &s.String
+}
@@ -0,0 +1,212 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// PCM is decoded audio as interleaved samples in [-1, 1].
+type PCM struct {
+	SampleRate int
+	Channels   int
+	Samples    []float32
+}
+
+// Frames returns the number of samples per channel.
+func (p PCM) Frames() int {
+	if p.Channels == 0 {
+		return 0
+	}
+	return len(p.Samples) / p.Channels
+}
+
+// Duration returns the length of the audio.
+func (p PCM) Duration() time.Duration {
+	if p.SampleRate == 0 {
+		return 0
+	}
+	return time.Duration(p.Frames()) * time.Second / time.Duration(p.SampleRate)
+}
+
+// Decoder decodes one or more audio formats. Decoders are tried in order, so
+// a catch-all decoder such as FFmpegDecoder belongs last.
+type Decoder interface {
+	// Sniff reports whether the decoder handles a file starting with header.
+	Sniff(header []byte) bool
+	Decode(ctx context.Context, path string) (PCM, error)
+}
+
+// ErrUnsupportedFormat is returned when no decoder handles a file.
+var ErrUnsupportedFormat = errors.New("unsupported audio format")
+
+// sniffLength is how much of a file decoders get to recognize it by.
+const sniffLength = 64
+
+// Decode decodes the file at path with the first decoder that recognizes it.
+func Decode(ctx context.Context, path string, decoders []Decoder) (PCM, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return PCM{}, fmt.Errorf("failed to open audio file: %w", err)
+	}
+	header := make([]byte, sniffLength)
+	n, err := io.ReadFull(f, header)
+	f.Close()
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return PCM{}, fmt.Errorf("failed to read audio file: %w", err)
+	}
+
+	for _, decoder := range decoders {
+		if decoder.Sniff(header[:n]) {
+			return decoder.Decode(ctx, path)
+		}
+	}
+	return PCM{}, ErrUnsupportedFormat
+}
+
+// WAVDecoder decodes RIFF WAVE files holding 8, 16, 24 or 32-bit integer or
+// 32-bit float PCM.
+type WAVDecoder struct{}
+
+func (WAVDecoder) Sniff(header []byte) bool {
+	return len(header) >= 12 && string(header[0:4]) == "RIFF" && string(header[8:12]) == "WAVE"
+}
+
+// WAVE format tags.
+const (
+	wavFormatPCM        = 1
+	wavFormatFloat      = 3
+	wavFormatExtensible = 0xFFFE
+)
+
+func (WAVDecoder) Decode(ctx context.Context, path string) (PCM, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return PCM{}, fmt.Errorf("failed to read audio file: %w", err)
+	}
+	if len(data) < 12 {
+		return PCM{}, fmt.Errorf("truncated WAV header")
+	}
+
+	var (
+		format, channels, bits int
+		rate                   int
+		samples                []byte
+		haveFormat             bool
+	)
+	for pos := 12; pos+8 <= len(data); {
+		id := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		body := data[pos+8 : min(pos+8+size, len(data))]
+		switch id {
+		case "fmt ":
+			if len(body) < 16 {
+				return PCM{}, fmt.Errorf("truncated WAV format chunk")
+			}
+			format = int(binary.LittleEndian.Uint16(body[0:2]))
+			channels = int(binary.LittleEndian.Uint16(body[2:4]))
+			rate = int(binary.LittleEndian.Uint32(body[4:8]))
+			bits = int(binary.LittleEndian.Uint16(body[14:16]))
+			if format == wavFormatExtensible && len(body) >= 26 {
+				// The subformat GUID starts with the real format tag.
+				format = int(binary.LittleEndian.Uint16(body[24:26]))
+			}
+			haveFormat = true
+		case "data":
+			samples = body
+		}
+		// Chunks are padded to an even length.
+		pos += 8 + size + size%2
+	}
+	if !haveFormat || samples == nil {
+		return PCM{}, fmt.Errorf("WAV file has no format or data chunk")
+	}
+	if channels == 0 || rate == 0 {
+		return PCM{}, fmt.Errorf("WAV file has %d channels at %d Hz", channels, rate)
+	}
+
+	width := bits / 8
+	var convert func([]byte) float32
+	switch {
+	case format == wavFormatPCM && bits == 8:
+		convert = func(b []byte) float32 { return (float32(b[0]) - 128) / 128 }
+	case format == wavFormatPCM && bits == 16:
+		convert = func(b []byte) float32 { return float32(int16(binary.LittleEndian.Uint16(b))) / (1 << 15) }
+	case format == wavFormatPCM && bits == 24:
+		convert = func(b []byte) float32 {
+			v := int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24) >> 8
+			return float32(v) / (1 << 23)
+		}
+	case format == wavFormatPCM && bits == 32:
+		convert = func(b []byte) float32 { return float32(int32(binary.LittleEndian.Uint32(b))) / (1 << 31) }
+	case format == wavFormatFloat && bits == 32:
+		convert = func(b []byte) float32 { return math.Float32frombits(binary.LittleEndian.Uint32(b)) }
+	default:
+		return PCM{}, fmt.Errorf("%w: WAV format %d with %d bits", ErrUnsupportedFormat, format, bits)
+	}
+
+	// A trailing partial frame is dropped.
+	frameWidth := width * channels
+	samples = samples[:len(samples)/frameWidth*frameWidth]
+	pcm := PCM{
+		SampleRate: rate,
+		Channels:   channels,
+		Samples:    make([]float32, 0, len(samples)/width),
+	}
+	for i := 0; i < len(samples); i += width {
+		pcm.Samples = append(pcm.Samples, convert(samples[i:i+width]))
+	}
+	return pcm, nil
+}
+
+// FFmpegDecoder decodes any format ffmpeg understands, such as AAC in MP4 as
+// recorded by the app, or Opus. It recognizes every file, so it belongs last.
+type FFmpegDecoder struct {
+	// Path is the ffmpeg binary.
+	Path string
+	// SampleRate is the rate audio is resampled to; zero means 16 kHz, plenty
+	// for speech.
+	SampleRate int
+}
+
+func (FFmpegDecoder) Sniff(header []byte) bool {
+	return true
+}
+
+func (d FFmpegDecoder) Decode(ctx context.Context, path string) (PCM, error) {
+	rate := d.SampleRate
+	if rate == 0 {
+		rate = 16000
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, d.Path,
+		"-nostdin", "-hide_banner", "-loglevel", "error",
+		"-i", path,
+		"-f", "f32le", "-ac", "1", "-ar", fmt.Sprint(rate),
+		"pipe:1",
+	)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return PCM{}, fmt.Errorf("ffmpeg failed: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	raw := stdout.Bytes()
+	pcm := PCM{
+		SampleRate: rate,
+		Channels:   1,
+		Samples:    make([]float32, len(raw)/4),
+	}
+	for i := range pcm.Samples {
+		pcm.Samples[i] = math.Float32frombits(binary.LittleEndian.Uint32(raw[i*4:]))
+	}
+	return pcm, nil
+}
@@ -0,0 +1,53 @@
+package audio
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+)
+
+// WriteWAV stores pcm at path as a 16-bit PCM WAV file, the form every
+// decoder and transcoder accepts.
+func WriteWAV(path string, pcm PCM) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := writeWAV(bufio.NewWriter(f), pcm); err != nil {
+		f.Close()
+		os.Remove(path)
+		return fmt.Errorf("failed to write WAV: %w", err)
+	}
+	return f.Close()
+}
+
+func writeWAV(w *bufio.Writer, pcm PCM) error {
+	const bytesPerSample = 2
+	dataSize := uint32(len(pcm.Samples) * bytesPerSample)
+	blockAlign := uint16(pcm.Channels * bytesPerSample)
+
+	header := []any{
+		[4]byte{'R', 'I', 'F', 'F'}, 36 + dataSize, [4]byte{'W', 'A', 'V', 'E'},
+		[4]byte{'f', 'm', 't', ' '}, uint32(16),
+		uint16(wavFormatPCM), uint16(pcm.Channels), uint32(pcm.SampleRate),
+		uint32(pcm.SampleRate) * uint32(blockAlign), blockAlign, uint16(bytesPerSample * 8),
+		[4]byte{'d', 'a', 't', 'a'}, dataSize,
+	}
+	for _, v := range header {
+		if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+
+	buf := make([]byte, bytesPerSample)
+	for _, s := range pcm.Samples {
+		v := math.Round(math.Max(-1, math.Min(1, float64(s))) * math.MaxInt16)
+		binary.LittleEndian.PutUint16(buf, uint16(int16(v)))
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
@@ -0,0 +1,217 @@
+package audio
+
+import (
+	"math"
+	"slices"
+	"time"
+)
+
+// Filter transforms decoded audio before it is encoded for playback.
+type Filter func(PCM) PCM
+
+// Loudness measurement follows ITU-R BS.1770: K-weighted mean square over
+// 400 ms blocks overlapping by 75%, gated at -70 LUFS and then 10 LU below
+// the loudness of the blocks that remain.
+const (
+	loudnessBlock    = 400 * time.Millisecond
+	loudnessStep     = 100 * time.Millisecond
+	absoluteGateLUFS = -70
+	relativeGateLU   = -10
+)
+
+// IntegratedLoudness returns the programme loudness of pcm in LUFS, or -Inf
+// for silence. Every channel is weighted equally.
+func IntegratedLoudness(pcm PCM) float64 {
+	frames := pcm.Frames()
+	if frames == 0 {
+		return math.Inf(-1)
+	}
+	weighted := kWeight(pcm)
+
+	blockFrames := max(1, min(frames, int(int64(pcm.SampleRate)*int64(loudnessBlock)/int64(time.Second))))
+	stepFrames := max(1, int(int64(pcm.SampleRate)*int64(loudnessStep)/int64(time.Second)))
+	var blocks []float64
+	for start := 0; start+blockFrames <= frames; start += stepFrames {
+		var sum float64
+		for _, s := range weighted[start*pcm.Channels : (start+blockFrames)*pcm.Channels] {
+			sum += s * s
+		}
+		blocks = append(blocks, sum/float64(blockFrames))
+	}
+
+	gated := func(threshold float64) (float64, bool) {
+		var sum float64
+		var n int
+		for _, z := range blocks {
+			if blockLoudness(z) > threshold {
+				sum += z
+				n++
+			}
+		}
+		if n == 0 {
+			return 0, false
+		}
+		return sum / float64(n), true
+	}
+	mean, ok := gated(absoluteGateLUFS)
+	if !ok {
+		return math.Inf(-1)
+	}
+	mean, ok = gated(blockLoudness(mean) + relativeGateLU)
+	if !ok {
+		return math.Inf(-1)
+	}
+	return blockLoudness(mean)
+}
+
+func blockLoudness(meanSquare float64) float64 {
+	return -0.691 + 10*math.Log10(meanSquare)
+}
+
+// kWeight applies the BS.1770 pre-filter, a high shelf modelling the head
+// followed by a high-pass, designed for pcm's sample rate.
+func kWeight(pcm PCM) []float64 {
+	shelf := highShelf(float64(pcm.SampleRate), 1681.974450955533, 3.999843853973347, 0.7071752369554196)
+	highPass := highPass(float64(pcm.SampleRate), 38.13547087602444, 0.5003270373238773)
+
+	out := make([]float64, len(pcm.Samples))
+	for ch := range pcm.Channels {
+		var s1, s2 biquadState
+		for i := ch; i < len(pcm.Samples); i += pcm.Channels {
+			out[i] = highPass.process(&s2, shelf.process(&s1, float64(pcm.Samples[i])))
+		}
+	}
+	return out
+}
+
+// biquad holds normalized second-order filter coefficients.
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+}
+
+type biquadState struct {
+	x1, x2, y1, y2 float64
+}
+
+func (f biquad) process(s *biquadState, x float64) float64 {
+	y := f.b0*x + f.b1*s.x1 + f.b2*s.x2 - f.a1*s.y1 - f.a2*s.y2
+	s.x2, s.x1 = s.x1, x
+	s.y2, s.y1 = s.y1, y
+	return y
+}
+
+func newBiquad(b0, b1, b2, a0, a1, a2 float64) biquad {
+	return biquad{b0: b0 / a0, b1: b1 / a0, b2: b2 / a0, a1: a1 / a0, a2: a2 / a0}
+}
+
+// highShelf and highPass use the bilinear designs the BS.1770 parameters
+// were fitted to, which reproduce the 48 kHz reference coefficients exactly.
+func highShelf(rate, freq, gainDB, q float64) biquad {
+	k := math.Tan(math.Pi * freq / rate)
+	vh := math.Pow(10, gainDB/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	return newBiquad(vh+vb*k/q+k*k, 2*(k*k-vh), vh-vb*k/q+k*k, 1+k/q+k*k, 2*(k*k-1), 1-k/q+k*k)
+}
+
+func highPass(rate, freq, q float64) biquad {
+	k := math.Tan(math.Pi * freq / rate)
+	return newBiquad(1, -2, 1, 1+k/q+k*k, 2*(k*k-1), 1-k/q+k*k)
+}
+
+// Normalization limits: gain is capped so near-silent recordings are not
+// turned into loud hiss, and lowered so no sample peaks above -1 dBFS.
+const (
+	maxGainDB     = 20
+	peakCeilingDB = -1
+)
+
+// Normalize applies gain toward targetLUFS integrated loudness.
+func Normalize(targetLUFS float64) Filter {
+	return func(pcm PCM) PCM {
+		loudness := IntegratedLoudness(pcm)
+		if math.IsInf(loudness, -1) {
+			return pcm
+		}
+		gain := math.Pow(10, min(targetLUFS-loudness, maxGainDB)/20)
+
+		var peak float64
+		for _, s := range pcm.Samples {
+			peak = max(peak, math.Abs(float64(s)))
+		}
+		if ceiling := math.Pow(10, peakCeilingDB/20.0); peak*gain > ceiling {
+			gain = ceiling / peak
+		}
+
+		out := pcm
+		out.Samples = make([]float32, len(pcm.Samples))
+		for i, s := range pcm.Samples {
+			out.Samples[i] = float32(float64(s) * gain)
+		}
+		return out
+	}
+}
+
+// Silence detection works on 20 ms frames. A frame is voiced when its energy
+// is well above the recording's noise floor and within range of its loudest
+// frame; speech starts at the first run of voiced frames long enough not to
+// be a click, and ends after the last one.
+const (
+	vadFrame          = 20 * time.Millisecond
+	vadMinVoiced      = 3
+	vadAboveNoiseDB   = 12
+	vadBelowPeakDB    = 35
+	vadSilenceDBFS    = -60
+	vadPadding        = 200 * time.Millisecond
+	noiseFloorCentile = 0.1
+)
+
+// TrimSilence removes leading and trailing silence, keeping a little padding
+// around the speech. Recordings with no detectable speech are left alone.
+func TrimSilence() Filter {
+	return func(pcm PCM) PCM {
+		frameLen := max(1, int(int64(pcm.SampleRate)*int64(vadFrame)/int64(time.Second)))
+		energies := make([]float64, pcm.Frames()/frameLen)
+		for i := range energies {
+			var sum float64
+			for _, s := range pcm.Samples[i*frameLen*pcm.Channels : (i+1)*frameLen*pcm.Channels] {
+				sum += float64(s) * float64(s)
+			}
+			energies[i] = 10 * math.Log10(sum/float64(frameLen*pcm.Channels)+1e-12)
+		}
+		if len(energies) == 0 {
+			return pcm
+		}
+
+		sorted := slices.Clone(energies)
+		slices.Sort(sorted)
+		noiseFloor := sorted[int(float64(len(sorted)-1)*noiseFloorCentile)]
+		loudest := sorted[len(sorted)-1]
+		threshold := max(noiseFloor+vadAboveNoiseDB, loudest-vadBelowPeakDB, vadSilenceDBFS)
+
+		first, last := -1, -1
+		run := 0
+		for i, energy := range energies {
+			if energy < threshold {
+				run = 0
+				continue
+			}
+			run++
+			if run >= vadMinVoiced {
+				if first < 0 {
+					first = i - run + 1
+				}
+				last = i
+			}
+		}
+		if first < 0 {
+			return pcm
+		}
+
+		padding := int(int64(pcm.SampleRate) * int64(vadPadding) / int64(time.Second))
+		start := max(0, first*frameLen-padding)
+		end := min(pcm.Frames(), (last+1)*frameLen+padding)
+		out := pcm
+		out.Samples = pcm.Samples[start*pcm.Channels : end*pcm.Channels]
+		return out
+	}
+}
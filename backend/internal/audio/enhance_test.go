@@ -0,0 +1,213 @@
+package audio
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+const testRate = 48000
+
+// tone is a segment of a synthetic recording: a 997 Hz sine at a peak level
+// in dBFS, or silence when the level is -Inf.
+type tone struct {
+	length time.Duration
+	dBFS   float64
+}
+
+func synth(rate, channels int, segments ...tone) PCM {
+	pcm := PCM{SampleRate: rate, Channels: channels}
+	var n int
+	for _, seg := range segments {
+		amplitude := math.Pow(10, seg.dBFS/20)
+		frames := int(int64(rate) * int64(seg.length) / int64(time.Second))
+		for range frames {
+			s := float32(amplitude * math.Sin(2*math.Pi*997*float64(n)/float64(rate)))
+			for range channels {
+				pcm.Samples = append(pcm.Samples, s)
+			}
+			n++
+		}
+	}
+	return pcm
+}
+
+func peakDBFS(pcm PCM) float64 {
+	var peak float64
+	for _, s := range pcm.Samples {
+		peak = max(peak, math.Abs(float64(s)))
+	}
+	return 20 * math.Log10(peak)
+}
+
+func TestIntegratedLoudness(t *testing.T) {
+	silent := math.Inf(-1)
+	for _, tc := range []struct {
+		name      string
+		pcm       PCM
+		want      float64
+		tolerance float64
+	}{
+		// BS.1770 calibrates a full-scale 997 Hz sine in one channel to -3.01 LUFS.
+		{name: "full-scale sine", pcm: synth(testRate, 1, tone{3 * time.Second, 0}), want: -3.01, tolerance: 0.05},
+		{name: "level follows gain", pcm: synth(testRate, 1, tone{3 * time.Second, -20}), want: -23.01, tolerance: 0.05},
+		{name: "channels add up", pcm: synth(testRate, 2, tone{3 * time.Second, -20}), want: -20, tolerance: 0.05},
+		{name: "other sample rates", pcm: synth(16000, 1, tone{3 * time.Second, -20}), want: -23.01, tolerance: 0.2},
+		{name: "shorter than a block", pcm: synth(testRate, 1, tone{200 * time.Millisecond, -20}), want: -23.01, tolerance: 0.2},
+		// Blocks below -70 LUFS are dropped by the absolute gate, and those more
+		// than 10 LU under the rest by the relative gate; without gating these
+		// would measure about -27.8. The few blocks straddling the change in
+		// level still count, pulling the result slightly under the loud part.
+		{name: "absolute gate", pcm: synth(testRate, 1, tone{4 * time.Second, -20}, tone{8 * time.Second, -90}), want: -23.2, tolerance: 0.15},
+		{name: "relative gate", pcm: synth(testRate, 1, tone{4 * time.Second, -20}, tone{8 * time.Second, -40}), want: -23.2, tolerance: 0.15},
+		// while quieter passages within it still pull the average down.
+		{name: "ungated quiet passage", pcm: synth(testRate, 1, tone{3 * time.Second, -20}, tone{3 * time.Second, -26}), want: -25.0, tolerance: 0.3},
+		{name: "silence", pcm: synth(testRate, 1, tone{time.Second, silent}), want: silent},
+		{name: "below the absolute gate", pcm: synth(testRate, 1, tone{time.Second, -80}), want: silent},
+		{name: "empty", pcm: PCM{SampleRate: testRate, Channels: 1}, want: silent},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := IntegratedLoudness(tc.pcm)
+			if math.IsInf(tc.want, -1) {
+				if !math.IsInf(got, -1) {
+					t.Errorf("expected -Inf, got %.2f LUFS", got)
+				}
+				return
+			}
+			if math.Abs(got-tc.want) > tc.tolerance {
+				t.Errorf("expected %.2f LUFS, got %.2f", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	ceiling := float64(peakCeilingDB)
+	for _, tc := range []struct {
+		name   string
+		pcm    PCM
+		target float64
+		// wantLUFS is the loudness after normalizing, or NaN when only the
+		// peak is checked.
+		wantLUFS float64
+	}{
+		{name: "raise to target", pcm: synth(testRate, 1, tone{3 * time.Second, -30}), target: -16, wantLUFS: -16},
+		{name: "lower to target", pcm: synth(testRate, 1, tone{3 * time.Second, -3}), target: -16, wantLUFS: -16},
+		// A recording 40 LU under target only gets the maximum 20 dB of gain.
+		{name: "gain cap", pcm: synth(testRate, 1, tone{3 * time.Second, -53}), target: -16, wantLUFS: -36.01},
+		// Reaching -3 LUFS would put the peak at 0 dBFS, so the gain stops at
+		// the ceiling instead.
+		{name: "peak ceiling", pcm: synth(testRate, 1, tone{3 * time.Second, -12}), target: -3, wantLUFS: -4.01},
+		{name: "ceiling on a short peak", pcm: synth(testRate, 1, tone{3 * time.Second, -30}, tone{20 * time.Millisecond, -6}), target: -16, wantLUFS: math.NaN()},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			out := Normalize(tc.target)(tc.pcm)
+			if len(out.Samples) != len(tc.pcm.Samples) || out.SampleRate != tc.pcm.SampleRate || out.Channels != tc.pcm.Channels {
+				t.Fatalf("expected the format kept, got %d Hz, %d channels and %d samples", out.SampleRate, out.Channels, len(out.Samples))
+			}
+			if peak := peakDBFS(out); peak > ceiling+0.01 {
+				t.Errorf("expected peaks at most %.0f dBFS, got %.2f", ceiling, peak)
+			}
+			if math.IsNaN(tc.wantLUFS) {
+				if peak := peakDBFS(out); math.Abs(peak-ceiling) > 0.01 {
+					t.Errorf("expected the peak held at the ceiling, got %.2f dBFS", peak)
+				}
+				return
+			}
+			if got := IntegratedLoudness(out); math.Abs(got-tc.wantLUFS) > 0.05 {
+				t.Errorf("expected %.2f LUFS, got %.2f", tc.wantLUFS, got)
+			}
+		})
+	}
+
+	t.Run("silence", func(t *testing.T) {
+		pcm := synth(testRate, 1, tone{time.Second, math.Inf(-1)})
+		out := Normalize(-16)(pcm)
+		if &out.Samples[0] != &pcm.Samples[0] {
+			t.Error("expected silence returned as is")
+		}
+	})
+}
+
+func TestTrimSilence(t *testing.T) {
+	silence := math.Inf(-1)
+	padding := vadPadding
+	for _, tc := range []struct {
+		name string
+		pcm  PCM
+		// want is the length left, and offset where it starts in the input.
+		want, offset time.Duration
+	}{
+		{
+			name:   "leading and trailing silence",
+			pcm:    synth(testRate, 1, tone{time.Second, silence}, tone{time.Second, -20}, tone{2 * time.Second, silence}),
+			want:   time.Second + 2*padding,
+			offset: time.Second - padding,
+		},
+		{
+			name:   "background noise",
+			pcm:    synth(testRate, 2, tone{time.Second, -55}, tone{time.Second, -15}, tone{time.Second, -55}),
+			want:   time.Second + 2*padding,
+			offset: time.Second - padding,
+		},
+		{
+			name: "padding stops at the edges",
+			pcm:  synth(testRate, 1, tone{100 * time.Millisecond, silence}, tone{time.Second, -20}, tone{100 * time.Millisecond, silence}),
+			want: 1200 * time.Millisecond,
+		},
+		// Pauses between words are kept.
+		{
+			name:   "pause in speech",
+			pcm:    synth(testRate, 1, tone{time.Second, silence}, tone{500 * time.Millisecond, -20}, tone{time.Second, silence}, tone{500 * time.Millisecond, -20}, tone{time.Second, silence}),
+			want:   2*time.Second + 2*padding,
+			offset: time.Second - padding,
+		},
+		// A click too short to be speech neither starts nor ends it.
+		{
+			name:   "click before speech",
+			pcm:    synth(testRate, 1, tone{500 * time.Millisecond, silence}, tone{40 * time.Millisecond, -6}, tone{460 * time.Millisecond, silence}, tone{time.Second, -20}, tone{time.Second, silence}),
+			want:   time.Second + 2*padding,
+			offset: time.Second - padding,
+		},
+		{
+			name: "no silence",
+			pcm:  synth(testRate, 1, tone{time.Second, -20}),
+			want: time.Second,
+		},
+		{
+			name: "all silence",
+			pcm:  synth(testRate, 1, tone{2 * time.Second, silence}),
+			want: 2 * time.Second,
+		},
+		{
+			name: "only a click",
+			pcm:  synth(testRate, 1, tone{time.Second, silence}, tone{20 * time.Millisecond, -6}, tone{time.Second, silence}),
+			want: 2020 * time.Millisecond,
+		},
+		{
+			name: "shorter than a frame",
+			pcm:  synth(testRate, 1, tone{10 * time.Millisecond, -20}),
+			want: 10 * time.Millisecond,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			out := TrimSilence()(tc.pcm)
+			if got := out.Duration(); got != tc.want {
+				t.Errorf("expected %v left, got %v", tc.want, got)
+			}
+			if len(out.Samples) == 0 {
+				return
+			}
+			offset := time.Duration(0)
+			for i := range tc.pcm.Samples {
+				if &tc.pcm.Samples[i] == &out.Samples[0] {
+					offset = time.Duration(int64(i/tc.pcm.Channels) * int64(time.Second) / int64(tc.pcm.SampleRate))
+					break
+				}
+			}
+			if offset != tc.offset {
+				t.Errorf("expected the trimmed audio to start at %v, got %v", tc.offset, offset)
+			}
+		})
+	}
+}
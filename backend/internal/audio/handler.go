@@ -1,8 +1,10 @@
 package audio
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -10,9 +12,17 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/alecdray/waffle-talkie/internal/apierror"
+	"github.com/alecdray/waffle-talkie/internal/audit"
 	"github.com/alecdray/waffle-talkie/internal/auth"
 	"github.com/alecdray/waffle-talkie/internal/database"
+	"github.com/alecdray/waffle-talkie/internal/jobs"
+	"github.com/alecdray/waffle-talkie/internal/routes"
+	"github.com/alecdray/waffle-talkie/internal/storage"
+	"github.com/alecdray/waffle-talkie/internal/users"
 	"github.com/google/uuid"
 )
 
@@ -20,10 +30,20 @@ import (
 type Handler struct {
 	queries        *database.Queries
 	audioDirectory string
+	presence       *users.Presence
+	pipeline       *Pipeline
+	queue          *jobs.Queue
+	purger         *Purger
+	undoWindow     time.Duration
+	audit          *audit.Logger
+	guard          *storage.Guard
 }
 
 // NewHandler creates an audio handler with database access and storage path.
-func NewHandler(queries *database.Queries, audioDirectory string) *Handler {
+// Downloads are reported to presence as open streams, uploads are handed to
+// pipeline for processing, and unsent messages can be restored for
+// undoWindow. Uploads that guard rejects are refused before they are written.
+func NewHandler(queries *database.Queries, audioDirectory string, presence *users.Presence, pipeline *Pipeline, undoWindow time.Duration, auditLog *audit.Logger, guard *storage.Guard) *Handler {
 	if err := os.MkdirAll(audioDirectory, 0755); err != nil {
 		slog.Error("failed to create audio directory", "error", err)
 		panic("failed to create audio directory")
@@ -32,94 +52,190 @@ func NewHandler(queries *database.Queries, audioDirectory string) *Handler {
 	return &Handler{
 		queries:        queries,
 		audioDirectory: audioDirectory,
+		presence:       presence,
+		pipeline:       pipeline,
+		queue:          jobs.NewQueue(queries),
+		purger:         NewPurger(queries, auditLog),
+		undoWindow:     undoWindow,
+		audit:          auditLog,
+		guard:          guard,
 	}
 }
 
+// RegisterRoutes registers the audio message routes with the provided ServeMux.
 func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
-	mux.HandleFunc("/audio-messages", h.HandleGetMessages)
-	mux.HandleFunc("/audio-messages/upload", h.HandleUpload)
-	mux.HandleFunc("/audio-messages/download", h.HandleDownload)
-	mux.HandleFunc("/audio-messages/received", h.HandleMarkReceived)
+	mux.HandleFunc("GET /v1/audio-messages", h.HandleGetMessages)
+	mux.HandleFunc("POST /v1/audio-messages", h.HandleUpload)
+	mux.HandleFunc("GET /v1/audio-messages/{id}", h.HandleDownload)
+	mux.HandleFunc("PATCH /v1/audio-messages/{id}", h.HandleUpdateMessage)
+	mux.HandleFunc("DELETE /v1/audio-messages/{id}", h.HandleUnsend)
+	mux.HandleFunc("POST /v1/audio-messages/{id}/restore", h.HandleUndoUnsend)
+	mux.HandleFunc("POST /v1/audio-messages/{id}/receipt", h.HandleMarkReceived)
+
+	// Deprecated unversioned routes kept for older app builds.
+	mux.Handle("GET /audio-messages", routes.Deprecated("/api/v1/audio-messages", h.HandleGetMessages))
+	mux.Handle("POST /audio-messages/upload", routes.Deprecated("/api/v1/audio-messages", h.HandleUpload))
+	mux.Handle("GET /audio-messages/download", routes.Deprecated("/api/v1/audio-messages/{id}", h.HandleDownload))
+	mux.Handle("POST /audio-messages/received", routes.Deprecated("/api/v1/audio-messages/{id}/receipt", h.HandleMarkReceived))
 }
 
+// RegisterAdminRoutes registers the routes admins use to manage processing.
+func (h *Handler) RegisterAdminRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("POST /v1/audio-messages/{id}/transcript", h.HandleRetryTranscript)
+}
+
+// maxUploadBytes caps the size of an upload request body.
+const maxUploadBytes = 10 << 20
+
 type UploadResponse struct {
 	MessageID string `json:"message_id"`
-	Message   string `json:"message"`
+	// ProcessingStatus is processing while the message is hidden from
+	// recipients, or ready.
+	ProcessingStatus string `json:"processing_status"`
+	Message          string `json:"message"`
 }
 
-// HandleUpload accepts audio file uploads and creates a message record.
+// HandleUpload accepts audio file uploads and creates a message record, with
+// the optional title and caption form fields. Uploads that would break the
+// storage quotas are refused.
 func (h *Handler) HandleUpload(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
+	start := time.Now()
 
 	userID, ok := auth.GetUserIDFromContext(r.Context())
 	if !ok {
-		http.Error(w, "User ID not found", http.StatusUnauthorized)
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "User ID not found")
 		return
 	}
 
-	if err := r.ParseMultipartForm(10 << 20); err != nil {
-		http.Error(w, "Failed to parse multipart form", http.StatusBadRequest)
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadBytes)
+	if err := r.ParseMultipartForm(maxUploadBytes); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			apierror.Write(w, http.StatusRequestEntityTooLarge, apierror.CodePayloadTooLarge, "Audio upload is too large")
+			return
+		}
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Failed to parse multipart form")
 		return
 	}
 
 	file, header, err := r.FormFile("audio")
 	if err != nil {
-		http.Error(w, "Audio file is required", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Audio file is required")
 		return
 	}
 	defer file.Close()
 
 	durationStr := r.FormValue("duration")
 	if durationStr == "" {
-		http.Error(w, "Duration is required", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Duration is required")
 		return
 	}
 
 	duration, err := strconv.ParseInt(durationStr, 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid duration format", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid duration format")
+		return
+	}
+	if duration <= 0 {
+		// A negative duration would lower the sender's usage.
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Duration must be a positive number of seconds")
 		return
 	}
 
+	title, err := cleanTitle(r.FormValue("title"))
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error())
+		return
+	}
+	caption, err := cleanCaption(r.FormValue("caption"))
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error())
+		return
+	}
+
+	// The reservation lasts until the message is stored, so concurrent
+	// uploads cannot each fit the same room under the quotas.
+	reservation, err := h.guard.Reserve(r.Context(), userID, header.Size, duration)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrLowDisk):
+			uploadRejections.Inc("low_disk")
+			apierror.Write(w, http.StatusInsufficientStorage, apierror.CodeInsufficientStorage, "The server is low on disk space, try again later")
+		case errors.Is(err, storage.ErrUserQuota):
+			uploadRejections.Inc("user_quota")
+			apierror.Write(w, http.StatusRequestEntityTooLarge, apierror.CodeQuotaExceeded, "Upload would exceed your storage quota")
+		case errors.Is(err, storage.ErrInstanceQuota):
+			uploadRejections.Inc("instance_quota")
+			apierror.Write(w, http.StatusRequestEntityTooLarge, apierror.CodeQuotaExceeded, "Upload would exceed the server's storage quota")
+		default:
+			slog.ErrorContext(r.Context(), "failed to check storage quotas", "error", err)
+			apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to save audio file")
+		}
+		return
+	}
+	defer reservation.Release()
+
 	messageID := uuid.New().String()
 	filename := fmt.Sprintf("%s%s", messageID, filepath.Ext(header.Filename))
 	filePath := filepath.Join(h.audioDirectory, filename)
 
 	dst, err := os.Create(filePath)
 	if err != nil {
-		slog.Error("failed to create file", "error", err)
-		http.Error(w, "Failed to save audio file", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "failed to create file", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to save audio file")
 		return
 	}
 	defer dst.Close()
 
-	if _, err := io.Copy(dst, file); err != nil {
-		slog.Error("failed to write file", "error", err)
-		http.Error(w, "Failed to save audio file", http.StatusInternalServerError)
+	written, err := io.Copy(dst, file)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to write file", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to save audio file")
 		return
 	}
 
-	audioMessage, err := h.queries.CreateAudioMessage(r.Context(), database.CreateAudioMessageParams{
-		ID:           messageID,
-		SenderUserID: userID,
-		FilePath:     filePath,
-		Duration:     duration,
+	var audioMessage database.AudioMessage
+	err = reservation.Commit(func() (err error) {
+		audioMessage, err = h.queries.CreateAudioMessage(r.Context(), database.CreateAudioMessageParams{
+			ID:               messageID,
+			SenderUserID:     userID,
+			FilePath:         filePath,
+			Size:             written,
+			Duration:         duration,
+			ProcessingStatus: h.pipeline.InitialStatus(),
+			Title:            title,
+			Caption:          caption,
+		})
+		return err
 	})
 	if err != nil {
-		slog.Error("failed to create audio message", "error", err)
+		slog.ErrorContext(r.Context(), "failed to create audio message", "error", err)
 		os.Remove(filePath)
-		http.Error(w, "Failed to create message record", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to create message record")
 		return
 	}
 
-	slog.Info("audio message created", "message_id", audioMessage.ID, "sender_id", userID)
+	if err := h.pipeline.Start(r.Context(), audioMessage); err != nil {
+		slog.ErrorContext(r.Context(), "failed to start processing audio message", "error", err)
+		if err := h.queries.DeleteAudioMessage(r.Context(), audioMessage.ID); err != nil {
+			slog.ErrorContext(r.Context(), "failed to delete unprocessed audio message", "error", err)
+		}
+		os.Remove(filePath)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to create message record")
+		return
+	}
+
+	uploadBytes.Add(float64(written))
+	uploadSize.Observe(float64(written))
+	uploadDuration.ObserveDuration(start)
+	messageLength.Observe(float64(duration))
+
+	slog.InfoContext(r.Context(), "audio message created", "message_id", audioMessage.ID, "sender_id", userID)
 
 	resp := UploadResponse{
-		MessageID: audioMessage.ID,
-		Message:   "Audio uploaded successfully",
+		MessageID:        audioMessage.ID,
+		ProcessingStatus: audioMessage.ProcessingStatus,
+		Message:          "Audio uploaded successfully",
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -127,70 +243,194 @@ func (h *Handler) HandleUpload(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(resp)
 }
 
+// Message is an audio message with its sender's public profile, waveform and
+// transcript. Sender is null if the sender's account no longer exists, Peaks
+// until the waveform is generated or if the audio could not be decoded, and
+// Transcript until the message is transcribed. Title and Caption are null
+// unless the sender wrote them, and EditedAt until the sender changes either.
+type Message struct {
+	database.AudioMessage
+	Sender *users.User `json:"sender"`
+	// Peaks holds PeakCount levels from 0 to 255.
+	Peaks      []int       `json:"peaks"`
+	Transcript *Transcript `json:"transcript"`
+	Title      *string     `json:"title"`
+	Caption    *string     `json:"caption"`
+	EditedAt   *time.Time  `json:"edited_at"`
+}
+
+// Transcript is the text of a message, whole and as timed segments.
+type Transcript struct {
+	Text      string              `json:"text"`
+	Segments  []TranscriptSegment `json:"segments"`
+	CreatedAt time.Time           `json:"created_at"`
+}
+
+// TranscriptSegment is a phrase spoken between two offsets into the playback
+// rendition.
+type TranscriptSegment struct {
+	StartMs int64  `json:"start_ms"`
+	EndMs   int64  `json:"end_ms"`
+	Text    string `json:"text"`
+}
+
 type MessagesResponse struct {
-	Messages []database.AudioMessage `json:"messages"`
+	Messages []Message `json:"messages"`
+	// Retracted lists the IDs of messages unsent in the last week that the
+	// user could have fetched, newest first, so clients can drop any copies
+	// they hold.
+	Retracted []string `json:"retracted"`
 }
 
-// HandleGetMessages returns unread messages for the authenticated user.
+// HandleGetMessages returns unread messages for the authenticated user. Their
+// own messages are included while still processing or if processing failed.
 func (h *Handler) HandleGetMessages(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	userID, ok := auth.GetUserIDFromContext(r.Context())
 	if !ok {
-		http.Error(w, "User ID not found", http.StatusUnauthorized)
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "User ID not found")
 		return
 	}
 
 	messages, err := h.queries.GetUnreceivedMessagesByUser(r.Context(), userID)
 	if err != nil {
-		slog.Error("failed to get messages", "error", err)
-		http.Error(w, "Failed to retrieve messages", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "failed to get messages", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve messages")
+		return
+	}
+
+	dbUsers, err := h.queries.ListUsers(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to list users", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve messages")
+		return
+	}
+	senders := make(map[string]users.User, len(dbUsers))
+	for _, user := range dbUsers {
+		senders[user.ID] = users.NewUser(user)
+	}
+
+	retracted, err := h.queries.ListRetractedAudioMessageIDs(r.Context(), database.ListRetractedAudioMessageIDsParams{
+		Since:  sql.NullTime{Time: time.Now().UTC().Add(-retractionRetention), Valid: true},
+		UserID: userID,
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to list retracted messages", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve messages")
 		return
 	}
 
 	resp := MessagesResponse{
-		Messages: messages,
+		Messages:  make([]Message, len(messages)),
+		Retracted: retracted,
+	}
+	for i, message := range messages {
+		if resp.Messages[i], err = h.message(r.Context(), message, senders); err != nil {
+			slog.ErrorContext(r.Context(), "failed to get transcript", "message_id", message.ID, "error", err)
+			apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve messages")
+			return
+		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
 
-// HandleDownload serves the audio file for a message.
-func (h *Handler) HandleDownload(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+// message adds the sender from senders, the waveform and the transcript to a
+// stored message.
+func (h *Handler) message(ctx context.Context, message database.AudioMessage, senders map[string]users.User) (Message, error) {
+	m := Message{
+		AudioMessage: message,
+		Title:        nullStringPtr(message.Title),
+		Caption:      nullStringPtr(message.Caption),
+	}
+	if message.Peaks != nil {
+		m.Peaks = make([]int, len(message.Peaks))
+		for j, peak := range message.Peaks {
+			m.Peaks[j] = int(peak)
+		}
+	}
+	if sender, ok := senders[message.SenderUserID]; ok {
+		m.Sender = &sender
+	}
+	if message.EditedAt.Valid {
+		m.EditedAt = &message.EditedAt.Time
+	}
+	transcript, err := h.transcript(ctx, message.ID)
+	if err != nil {
+		return Message{}, err
 	}
+	m.Transcript = transcript
+	return m, nil
+}
+
+// transcript loads a message's transcript, or nil if it has none yet.
+func (h *Handler) transcript(ctx context.Context, messageID string) (*Transcript, error) {
+	stored, err := h.queries.GetTranscript(ctx, messageID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	segments, err := h.queries.ListTranscriptSegments(ctx, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	transcript := &Transcript{
+		Segments:  make([]TranscriptSegment, len(segments)),
+		CreatedAt: stored.CreatedAt,
+	}
+	texts := make([]string, len(segments))
+	for i, segment := range segments {
+		transcript.Segments[i] = TranscriptSegment{StartMs: segment.StartMs, EndMs: segment.EndMs, Text: segment.Text}
+		texts[i] = segment.Text
+	}
+	transcript.Text = strings.Join(texts, " ")
+	return transcript, nil
+}
 
+// HandleDownload serves the audio file for a message: the rendition named by
+// the format query parameter, otherwise the one the Accept header prefers.
+func (h *Handler) HandleDownload(w http.ResponseWriter, r *http.Request) {
 	userID, ok := auth.GetUserIDFromContext(r.Context())
 	if !ok {
-		http.Error(w, "User ID not found", http.StatusUnauthorized)
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "User ID not found")
 		return
 	}
 
-	messageID := r.URL.Query().Get("id")
+	messageID := r.PathValue("id")
+	if messageID == "" {
+		// Deprecated route passes the ID as a query parameter.
+		messageID = r.URL.Query().Get("id")
+	}
 	if messageID == "" {
-		http.Error(w, "Message ID is required", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Message ID is required")
 		return
 	}
 
 	message, err := h.queries.GetAudioMessage(r.Context(), messageID)
-	if err == sql.ErrNoRows {
-		http.Error(w, "Message not found", http.StatusNotFound)
+	if err == sql.ErrNoRows || (err == nil && !visibleTo(message, userID)) {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeMessageNotFound, "Message not found")
 		return
 	} else if err != nil {
-		slog.Error("failed to get message", "error", err)
-		http.Error(w, "Failed to retrieve message", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "failed to get message", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve message")
+		return
+	}
+
+	w.Header().Add("Vary", "Accept")
+	rendition, err := negotiate(message, r.URL.Query().Get("format"), r.Header.Get("Accept"))
+	if errors.Is(err, errUnknownFormat) {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "format must be playback or original")
+		return
+	} else if errors.Is(err, errNotAcceptable) {
+		apierror.Write(w, http.StatusNotAcceptable, apierror.CodeNotAcceptable, "No acceptable audio format")
 		return
 	}
 
-	if _, err := os.Stat(message.FilePath); os.IsNotExist(err) {
-		slog.Error("audio file not found", "path", message.FilePath)
-		http.Error(w, "Audio file not found", http.StatusNotFound)
+	if _, err := os.Stat(rendition.Path); os.IsNotExist(err) {
+		slog.ErrorContext(r.Context(), "audio file not found", "path", rendition.Path)
+		apierror.Write(w, http.StatusNotFound, apierror.CodeAudioFileNotFound, "Audio file not found")
 		return
 	}
 
@@ -203,11 +443,164 @@ func (h *Handler) HandleDownload(w http.ResponseWriter, r *http.Request) {
 			AudioMessageID: messageID,
 			UserID:         userID,
 		}); err != nil {
-			slog.Error("failed to create receipt", "error", err)
+			slog.ErrorContext(r.Context(), "failed to create receipt", "error", err)
 		}
 	}
 
-	http.ServeFile(w, r, message.FilePath)
+	activeStreams.Inc("download")
+	defer activeStreams.Dec("download")
+	defer h.presence.StreamOpened(userID)()
+
+	w.Header().Set("Content-Type", rendition.ContentType)
+	http.ServeFile(w, r, rendition.Path)
+}
+
+// UpdateMessageRequest changes only the fields that are present. An empty
+// title or caption clears it.
+type UpdateMessageRequest struct {
+	Title   *string `json:"title"`
+	Caption *string `json:"caption"`
+}
+
+// HandleUpdateMessage lets the sender change the title and caption of their
+// message, and returns the updated message.
+func (h *Handler) HandleUpdateMessage(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "User ID not found")
+		return
+	}
+
+	message, err := h.queries.GetAudioMessage(r.Context(), r.PathValue("id"))
+	if err == sql.ErrNoRows || (err == nil && !visibleTo(message, userID)) {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeMessageNotFound, "Message not found")
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get message", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve message")
+		return
+	}
+	if message.SenderUserID != userID {
+		apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Only the sender can edit a message")
+		return
+	}
+
+	var req UpdateMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidBody, "Invalid request body")
+		return
+	}
+
+	params := database.UpdateAudioMessageTextParams{
+		ID:       message.ID,
+		Title:    message.Title,
+		Caption:  message.Caption,
+		EditedAt: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+	}
+	fields := []string{}
+	if req.Title != nil {
+		if params.Title, err = cleanTitle(*req.Title); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error())
+			return
+		}
+		fields = append(fields, "title")
+	}
+	if req.Caption != nil {
+		if params.Caption, err = cleanCaption(*req.Caption); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error())
+			return
+		}
+		fields = append(fields, "caption")
+	}
+
+	updated, err := h.queries.UpdateAudioMessageText(r.Context(), params)
+	if err == sql.ErrNoRows {
+		// Deleted since it was loaded.
+		apierror.Write(w, http.StatusNotFound, apierror.CodeMessageNotFound, "Message not found")
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to update message", "message_id", message.ID, "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update message")
+		return
+	}
+
+	senders := make(map[string]users.User, 1)
+	if sender, err := h.queries.GetUser(r.Context(), userID); err == nil {
+		senders[userID] = users.NewUser(sender)
+	}
+	resp, err := h.message(r.Context(), updated, senders)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get transcript", "message_id", message.ID, "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve message")
+		return
+	}
+
+	slog.InfoContext(r.Context(), "audio message edited", "message_id", message.ID)
+	// The history of edits records which fields changed, not their text.
+	h.audit.Record(r, audit.Event{
+		Action:      audit.ActionAudioMessageEdited,
+		ActorUserID: userID,
+		TargetType:  audit.TargetAudioMessage,
+		TargetID:    message.ID,
+		Detail:      map[string]any{"fields": fields},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// visibleTo reports whether userID may see message: recipients only once it
+// is ready, its sender always.
+func visibleTo(message database.AudioMessage, userID string) bool {
+	return message.ProcessingStatus == StatusReady || message.SenderUserID == userID
+}
+
+type RetryTranscriptResponse struct {
+	JobID   int64  `json:"job_id"`
+	Message string `json:"message"`
+}
+
+// HandleRetryTranscript queues a message to be transcribed again, replacing
+// any transcript it has once the job succeeds.
+func (h *Handler) HandleRetryTranscript(w http.ResponseWriter, r *http.Request) {
+	message, err := h.queries.GetAudioMessage(r.Context(), r.PathValue("id"))
+	if err == sql.ErrNoRows {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeMessageNotFound, "Message not found")
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get message", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve message")
+		return
+	}
+
+	job, err := h.pipeline.Rerun(r.Context(), message, "transcribe")
+	if errors.Is(err, ErrUnknownStep) {
+		apierror.Write(w, http.StatusServiceUnavailable, apierror.CodeTranscriptionUnavailable, "Transcription is not configured on this server")
+		return
+	} else if errors.Is(err, ErrNotReady) {
+		apierror.Write(w, http.StatusConflict, apierror.CodeMessageNotReady, "Message has not finished processing")
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to queue transcription", "message_id", message.ID, "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to queue transcription")
+		return
+	}
+
+	actorID, _ := auth.GetUserIDFromContext(r.Context())
+	h.audit.Record(r, audit.Event{
+		Action:      audit.ActionTranscriptRequested,
+		ActorUserID: actorID,
+		TargetType:  audit.TargetAudioMessage,
+		TargetID:    message.ID,
+		Detail:      map[string]any{"job_id": job.ID},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(RetryTranscriptResponse{
+		JobID:   job.ID,
+		Message: "Transcription queued",
+	})
 }
 
 type MarkReceivedRequest struct {
@@ -220,35 +613,33 @@ type MarkReceivedResponse struct {
 
 // HandleMarkReceived marks a message as received by the user.
 func (h *Handler) HandleMarkReceived(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	userID, ok := auth.GetUserIDFromContext(r.Context())
 	if !ok {
-		http.Error(w, "User ID not found", http.StatusUnauthorized)
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "User ID not found")
 		return
 	}
 
-	var req MarkReceivedRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
+	req := MarkReceivedRequest{MessageID: r.PathValue("id")}
+	if req.MessageID == "" {
+		// Deprecated route passes the ID in the JSON body.
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidBody, "Invalid request body")
+			return
+		}
 	}
 
 	if req.MessageID == "" {
-		http.Error(w, "message_id is required", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "message_id is required")
 		return
 	}
 
 	message, err := h.queries.GetAudioMessage(r.Context(), req.MessageID)
-	if err == sql.ErrNoRows {
-		http.Error(w, "Message not found", http.StatusNotFound)
+	if err == sql.ErrNoRows || (err == nil && !visibleTo(message, userID)) {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeMessageNotFound, "Message not found")
 		return
 	} else if err != nil {
-		slog.Error("failed to get message", "error", err)
-		http.Error(w, "Failed to retrieve message", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "failed to get message", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve message")
 		return
 	}
 
@@ -257,8 +648,8 @@ func (h *Handler) HandleMarkReceived(w http.ResponseWriter, r *http.Request) {
 		UserID:         userID,
 	})
 	if err != nil {
-		slog.Error("failed to create receipt", "error", err)
-		http.Error(w, "Failed to mark message as received", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "failed to create receipt", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to mark message as received")
 		return
 	}
 
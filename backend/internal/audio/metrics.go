@@ -0,0 +1,59 @@
+package audio
+
+import "github.com/alecdray/waffle-talkie/internal/metrics"
+
+var (
+	uploadBytes = metrics.NewCounter(
+		"waffle_audio_upload_bytes_total",
+		"Bytes of audio accepted by uploads.",
+	)
+	uploadSize = metrics.NewHistogram(
+		"waffle_audio_upload_size_bytes",
+		"Size of uploaded audio files.",
+		[]float64{16 << 10, 64 << 10, 256 << 10, 1 << 20, 2 << 20, 5 << 20, 10 << 20},
+	)
+	uploadDuration = metrics.NewHistogram(
+		"waffle_audio_upload_duration_seconds",
+		"Time spent receiving and storing an upload.",
+		metrics.DefaultBuckets,
+	)
+	uploadRejections = metrics.NewCounter(
+		"waffle_audio_upload_rejections_total",
+		"Uploads rejected by the storage guard, by reason.",
+		"reason",
+	)
+	messageLength = metrics.NewHistogram(
+		"waffle_audio_message_length_seconds",
+		"Reported length of uploaded audio messages.",
+		[]float64{5, 15, 30, 60, 120, 300, 600},
+	)
+	activeStreams = metrics.NewGauge(
+		"waffle_active_streams",
+		"Open streaming connections, by kind.",
+		"kind",
+	)
+	cleanupRuns = metrics.NewCounter(
+		"waffle_cleanup_runs_total",
+		"Audio cleanup job runs, by result.",
+		"result",
+	)
+	waveformResults = metrics.NewCounter(
+		"waffle_waveforms_total",
+		"Waveform generation attempts, by result.",
+		"result",
+	)
+	transcodeResults = metrics.NewCounter(
+		"waffle_transcodes_total",
+		"Playback transcoding attempts, by result.",
+		"result",
+	)
+	transcriptionResults = metrics.NewCounter(
+		"waffle_transcriptions_total",
+		"Transcription attempts, by result.",
+		"result",
+	)
+	cleanupFilesDeleted = metrics.NewCounter(
+		"waffle_cleanup_files_deleted_total",
+		"Audio files removed by the cleanup job.",
+	)
+)
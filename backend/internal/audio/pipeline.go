@@ -0,0 +1,202 @@
+package audio
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/alecdray/waffle-talkie/internal/database"
+	"github.com/alecdray/waffle-talkie/internal/jobs"
+	"github.com/alecdray/waffle-talkie/internal/notify"
+)
+
+// Processing statuses of a message. Recipients only see ready messages.
+const (
+	StatusProcessing = "processing"
+	StatusReady      = "ready"
+	StatusFailed     = "failed"
+)
+
+// JobProcess runs a message's required steps.
+const JobProcess = "audio.process"
+
+// Step is one stage of processing an upload.
+type Step struct {
+	// Name identifies the step; optional steps run as jobs of kind
+	// "audio.<name>".
+	Name string
+	// Required steps run in order before the message is shown to recipients,
+	// and if one fails for good the message is never shown. Optional steps run
+	// once it is ready, each as a separate job.
+	Required bool
+	Run      func(ctx context.Context, message database.AudioMessage) error
+}
+
+// Pipeline processes uploads through a job queue.
+type Pipeline struct {
+	queries  *database.Queries
+	queue    *jobs.Queue
+	notifier *notify.Notifier
+	steps    []Step
+}
+
+func NewPipeline(queries *database.Queries, notifier *notify.Notifier, steps ...Step) *Pipeline {
+	return &Pipeline{
+		queries:  queries,
+		queue:    jobs.NewQueue(queries),
+		notifier: notifier,
+		steps:    steps,
+	}
+}
+
+// InitialStatus is the status new messages are stored with: processing when
+// there are required steps, otherwise ready straight away.
+func (p *Pipeline) InitialStatus() string {
+	for _, step := range p.steps {
+		if step.Required {
+			return StatusProcessing
+		}
+	}
+	return StatusReady
+}
+
+// Start begins processing a newly stored message.
+func (p *Pipeline) Start(ctx context.Context, message database.AudioMessage) error {
+	if message.ProcessingStatus == StatusReady {
+		p.ready(ctx, message)
+		return nil
+	}
+	_, err := p.queue.Enqueue(ctx, JobProcess, messagePayload{MessageID: message.ID})
+	return err
+}
+
+// Register adds the pipeline's job handlers to pool.
+func (p *Pipeline) Register(pool *jobs.Pool) {
+	pool.Register(JobProcess, p)
+	for _, step := range p.steps {
+		if !step.Required {
+			pool.Register(stepKind(step), stepHandler{pipeline: p, step: step})
+		}
+	}
+}
+
+var (
+	// ErrUnknownStep is returned by Rerun for a step the pipeline lacks.
+	ErrUnknownStep = errors.New("unknown audio step")
+	// ErrNotReady is returned by Rerun for a message still being processed,
+	// or whose processing failed.
+	ErrNotReady = errors.New("audio message is not ready")
+)
+
+// Rerun queues the optional step named name for a ready message again.
+func (p *Pipeline) Rerun(ctx context.Context, message database.AudioMessage, name string) (database.Job, error) {
+	for _, step := range p.steps {
+		if step.Required || step.Name != name {
+			continue
+		}
+		if message.ProcessingStatus != StatusReady {
+			return database.Job{}, ErrNotReady
+		}
+		return p.queue.Enqueue(ctx, stepKind(step), messagePayload{MessageID: message.ID})
+	}
+	return database.Job{}, ErrUnknownStep
+}
+
+type messagePayload struct {
+	MessageID string `json:"message_id"`
+}
+
+func stepKind(step Step) string {
+	return "audio." + step.Name
+}
+
+// Handle runs the required steps of a processing message and makes it ready.
+// Steps see the message as left by the step before.
+func (p *Pipeline) Handle(ctx context.Context, job database.Job) error {
+	message, err := p.message(ctx, job)
+	if err != nil || message == nil || message.ProcessingStatus != StatusProcessing {
+		return err
+	}
+
+	for _, step := range p.steps {
+		if !step.Required {
+			continue
+		}
+		if err := step.Run(ctx, *message); err != nil {
+			return fmt.Errorf("%s: %w", step.Name, err)
+		}
+		if message, err = p.message(ctx, job); err != nil || message == nil {
+			return err
+		}
+	}
+
+	if err := p.queries.SetAudioMessageProcessingStatus(ctx, database.SetAudioMessageProcessingStatusParams{
+		ProcessingStatus: StatusReady,
+		ID:               message.ID,
+	}); err != nil {
+		return fmt.Errorf("failed to mark message ready: %w", err)
+	}
+	message.ProcessingStatus = StatusReady
+	slog.InfoContext(ctx, "audio message processed", "message_id", message.ID)
+	p.ready(ctx, *message)
+	return nil
+}
+
+// Failed keeps a message whose required steps failed hidden for good.
+func (p *Pipeline) Failed(ctx context.Context, job database.Job, err error) {
+	var payload messagePayload
+	if jobs.Decode(job, &payload) != nil {
+		return
+	}
+	slog.ErrorContext(ctx, "audio message processing failed", "message_id", payload.MessageID, "error", err)
+	if err := p.queries.SetAudioMessageProcessingStatus(ctx, database.SetAudioMessageProcessingStatusParams{
+		ProcessingStatus: StatusFailed,
+		ID:               payload.MessageID,
+	}); err != nil {
+		slog.ErrorContext(ctx, "failed to mark message processing failed", "message_id", payload.MessageID, "error", err)
+	}
+}
+
+// ready notifies recipients of a message and queues its optional steps.
+func (p *Pipeline) ready(ctx context.Context, message database.AudioMessage) {
+	go p.notifier.MessageSent(context.WithoutCancel(ctx), message)
+	for _, step := range p.steps {
+		if step.Required {
+			continue
+		}
+		if _, err := p.queue.Enqueue(ctx, stepKind(step), messagePayload{MessageID: message.ID}); err != nil {
+			slog.ErrorContext(ctx, "failed to queue audio step", "message_id", message.ID, "step", step.Name, "error", err)
+		}
+	}
+}
+
+// message loads the job's message, or nil if it has since been deleted.
+func (p *Pipeline) message(ctx context.Context, job database.Job) (*database.AudioMessage, error) {
+	var payload messagePayload
+	if err := jobs.Decode(job, &payload); err != nil {
+		return nil, err
+	}
+	message, err := p.queries.GetAudioMessage(ctx, payload.MessageID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get message: %w", err)
+	}
+	return &message, nil
+}
+
+// stepHandler runs an optional step as its own job.
+type stepHandler struct {
+	pipeline *Pipeline
+	step     Step
+}
+
+func (h stepHandler) Handle(ctx context.Context, job database.Job) error {
+	message, err := h.pipeline.message(ctx, job)
+	if err != nil || message == nil {
+		return err
+	}
+	return h.step.Run(ctx, *message)
+}
@@ -0,0 +1,139 @@
+package audio
+
+import (
+	"errors"
+	"mime"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/alecdray/waffle-talkie/internal/database"
+)
+
+// Rendition is a stored encoding of a message's audio.
+type Rendition struct {
+	Path        string
+	ContentType string
+}
+
+// Rendition names accepted by the download format parameter.
+const (
+	FormatPlayback = "playback"
+	FormatOriginal = "original"
+)
+
+// contentTypes covers the formats the app records and uploads, which the
+// standard library does not know.
+var contentTypes = map[string]string{
+	".m4a":  "audio/mp4",
+	".mp4":  "audio/mp4",
+	".aac":  "audio/aac",
+	".mp3":  "audio/mpeg",
+	".wav":  "audio/wav",
+	".ogg":  "audio/ogg",
+	".opus": "audio/ogg",
+	".webm": "audio/webm",
+	".caf":  "audio/x-caf",
+	".3gp":  "audio/3gpp",
+}
+
+// ContentType returns the MIME type of an audio file from its extension,
+// assuming MP4 audio, which both mobile platforms record by default, when it
+// is unknown.
+func ContentType(path string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	if t, ok := contentTypes[ext]; ok {
+		return t
+	}
+	if t := mime.TypeByExtension(ext); strings.HasPrefix(t, "audio/") {
+		return t
+	}
+	return "audio/mp4"
+}
+
+// Original returns the file as uploaded.
+func Original(message database.AudioMessage) Rendition {
+	return Rendition{Path: message.FilePath, ContentType: ContentType(message.FilePath)}
+}
+
+// Playback returns the canonical rendition for playback, or the original
+// until it has been transcoded.
+func Playback(message database.AudioMessage) Rendition {
+	if !message.PlaybackPath.Valid {
+		return Original(message)
+	}
+	return Rendition{Path: message.PlaybackPath.String, ContentType: message.PlaybackContentType.String}
+}
+
+var (
+	errUnknownFormat = errors.New("unknown format")
+	errNotAcceptable = errors.New("no acceptable rendition")
+)
+
+// negotiate picks the rendition of message to serve. An explicit format wins;
+// otherwise the Accept header chooses, preferring playback when both are
+// equally acceptable.
+func negotiate(message database.AudioMessage, format, accept string) (Rendition, error) {
+	switch format {
+	case FormatPlayback:
+		return Playback(message), nil
+	case FormatOriginal:
+		return Original(message), nil
+	case "":
+	default:
+		return Rendition{}, errUnknownFormat
+	}
+
+	best, bestQuality := Rendition{}, 0.0
+	for _, rendition := range []Rendition{Playback(message), Original(message)} {
+		if q := acceptQuality(accept, rendition.ContentType); q > bestQuality {
+			best, bestQuality = rendition, q
+		}
+	}
+	if bestQuality == 0 {
+		return Rendition{}, errNotAcceptable
+	}
+	return best, nil
+}
+
+// acceptQuality returns the quality an Accept header gives contentType, using
+// the most specific matching media range. No header accepts everything.
+func acceptQuality(accept, contentType string) float64 {
+	if strings.TrimSpace(accept) == "" {
+		return 1
+	}
+	mainType, _, _ := strings.Cut(contentType, "/")
+
+	quality, specificity := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		mediaRange, params, _ := strings.Cut(part, ";")
+		mediaRange = strings.ToLower(strings.TrimSpace(mediaRange))
+
+		var s int
+		switch {
+		case mediaRange == contentType:
+			s = 2
+		case mediaRange == mainType+"/*":
+			s = 1
+		case mediaRange == "*/*":
+			s = 0
+		default:
+			continue
+		}
+		if s <= specificity {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(key, "q") {
+				if v, err := strconv.ParseFloat(value, 64); err == nil && v >= 0 && v <= 1 {
+					q = v
+				}
+			}
+		}
+		quality, specificity = q, s
+	}
+	return quality
+}
@@ -2,21 +2,26 @@ package audio
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
+	"os"
 	"time"
 
+	"github.com/alecdray/waffle-talkie/internal/audit"
 	"github.com/alecdray/waffle-talkie/internal/database"
 )
 
 type TaskManager struct {
 	queries        *database.Queries
 	audioDirectory string
+	audit          *audit.Logger
 }
 
-func NewTaskManager(queries *database.Queries, audioDirectory string) *TaskManager {
+func NewTaskManager(queries *database.Queries, audioDirectory string, auditLog *audit.Logger) *TaskManager {
 	return &TaskManager{
 		queries:        queries,
 		audioDirectory: audioDirectory,
+		audit:          auditLog,
 	}
 }
 
@@ -30,7 +35,10 @@ func (tm *TaskManager) Start(ctx context.Context) error {
 			case <-time.After(time.Minute):
 				err := tm.CleanUpAudioFiles(ctx)
 				if err != nil {
+					cleanupRuns.Inc("error")
 					slog.Error("failed to clean up audio files", "error", err)
+				} else {
+					cleanupRuns.Inc("success")
 				}
 			}
 		}
@@ -38,6 +46,53 @@ func (tm *TaskManager) Start(ctx context.Context) error {
 	return nil
 }
 
+// CleanUpAudioFiles removes the files and transcripts of messages that are
+// expired or have been received by every approved user, then soft deletes
+// their records.
 func (tm *TaskManager) CleanUpAudioFiles(ctx context.Context) error {
+	messages, err := tm.queries.GetOldOrFullyReceivedMessages(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list messages for cleanup: %w", err)
+	}
+
+	for _, message := range messages {
+		if err := removeMessageData(ctx, tm.queries, message); err != nil {
+			slog.Error("failed to remove audio message data", "message_id", message.ID, "error", err)
+			continue
+		}
+		if err := tm.queries.SoftDeleteAudioMessage(ctx, message.ID); err != nil {
+			slog.Error("failed to soft delete audio message", "message_id", message.ID, "error", err)
+			continue
+		}
+		cleanupFilesDeleted.Inc()
+		slog.Info("audio message cleaned up", "message_id", message.ID)
+		tm.audit.RecordContext(ctx, audit.Event{
+			Action:     audit.ActionAudioMessagePurged,
+			TargetType: audit.TargetAudioMessage,
+			TargetID:   message.ID,
+			Detail:     map[string]any{"sender_user_id": message.SenderUserID},
+		})
+	}
+
+	return nil
+}
+
+// removeMessageData removes a message's audio files and transcript, leaving
+// its record.
+func removeMessageData(ctx context.Context, queries *database.Queries, message database.AudioMessage) error {
+	if err := os.Remove(message.FilePath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove audio file: %w", err)
+	}
+	if playback := Playback(message).Path; playback != message.FilePath {
+		if err := os.Remove(playback); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove playback audio file: %w", err)
+		}
+	}
+	if err := queries.DeleteTranscript(ctx, message.ID); err != nil {
+		return fmt.Errorf("failed to delete transcript: %w", err)
+	}
+	if err := queries.DeleteTranscriptSegments(ctx, message.ID); err != nil {
+		return fmt.Errorf("failed to delete transcript segments: %w", err)
+	}
 	return nil
 }
@@ -0,0 +1,118 @@
+package audio
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecdray/waffle-talkie/internal/audit"
+	"github.com/alecdray/waffle-talkie/internal/database"
+)
+
+func TestCleanUpAudioFiles(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	sqlDB, queries, err := database.InitDB(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("failed to init database: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+
+	for _, user := range []database.CreateUserParams{
+		{ID: "sender", Name: "Sender", DeviceIDHash: "sender", Approved: true},
+		{ID: "listener", Name: "Listener", DeviceIDHash: "listener", Approved: true},
+		// Neither pending nor suspended users hold messages back.
+		{ID: "pending", Name: "Pending", DeviceIDHash: "pending"},
+		{ID: "suspended", Name: "Suspended", DeviceIDHash: "suspended", Approved: true},
+	} {
+		if _, err := queries.CreateUser(ctx, user); err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+	}
+	if _, err := sqlDB.Exec("UPDATE users SET status = 'suspended' WHERE id = 'suspended'"); err != nil {
+		t.Fatal(err)
+	}
+
+	// send stores a message with a recording and a playback rendition.
+	send := func(id string) (string, string) {
+		t.Helper()
+		original := filepath.Join(dir, id+".m4a")
+		playback := filepath.Join(dir, id+".playback.m4a")
+		for _, path := range []string{original, playback} {
+			if err := os.WriteFile(path, []byte(id), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := queries.CreateAudioMessage(ctx, database.CreateAudioMessageParams{
+			ID: id, SenderUserID: "sender", FilePath: original, Duration: 1, ProcessingStatus: "ready",
+		}); err != nil {
+			t.Fatalf("failed to create message: %v", err)
+		}
+		if _, err := sqlDB.Exec("UPDATE audio_messages SET playback_path = ?, playback_content_type = 'audio/mp4' WHERE id = ?", playback, id); err != nil {
+			t.Fatal(err)
+		}
+		return original, playback
+	}
+	receive := func(id, userID string) {
+		t.Helper()
+		if _, err := queries.CreateReceipt(ctx, database.CreateReceiptParams{AudioMessageID: id, UserID: userID}); err != nil {
+			t.Fatalf("failed to create receipt: %v", err)
+		}
+	}
+
+	heardOriginal, heardPlayback := send("heard")
+	receive("heard", "sender")
+	receive("heard", "listener")
+
+	expiredOriginal, expiredPlayback := send("expired")
+	if _, err := sqlDB.Exec("UPDATE audio_messages SET created_at = datetime('now', '-8 days') WHERE id = 'expired'"); err != nil {
+		t.Fatal(err)
+	}
+
+	unheardOriginal, unheardPlayback := send("unheard")
+	receive("unheard", "sender")
+
+	tm := NewTaskManager(queries, dir, audit.New(queries, nil))
+	if err := tm.CleanUpAudioFiles(ctx); err != nil {
+		t.Fatalf("cleanup failed: %v", err)
+	}
+
+	for _, path := range []string{heardOriginal, heardPlayback, expiredOriginal, expiredPlayback} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("expected %s removed, got %v", filepath.Base(path), err)
+		}
+	}
+	for _, path := range []string{unheardOriginal, unheardPlayback} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("expected %s kept, got %v", filepath.Base(path), err)
+		}
+	}
+	for id, deleted := range map[string]bool{"heard": true, "expired": true, "unheard": false} {
+		var isDeleted bool
+		if err := sqlDB.QueryRow("SELECT deleted_at IS NOT NULL FROM audio_messages WHERE id = ?", id).Scan(&isDeleted); err != nil {
+			t.Fatalf("failed to read message %s: %v", id, err)
+		}
+		if isDeleted != deleted {
+			t.Errorf("message %s: expected deleted %v, got %v", id, deleted, isDeleted)
+		}
+	}
+	var purged int
+	if err := sqlDB.QueryRow("SELECT COUNT(*) FROM audit_events WHERE action = ?", audit.ActionAudioMessagePurged).Scan(&purged); err != nil {
+		t.Fatal(err)
+	}
+	if purged != 2 {
+		t.Errorf("expected 2 purges audited, got %d", purged)
+	}
+
+	// A second run finds nothing more to do.
+	if err := tm.CleanUpAudioFiles(ctx); err != nil {
+		t.Fatalf("cleanup failed: %v", err)
+	}
+	if err := sqlDB.QueryRow("SELECT COUNT(*) FROM audit_events WHERE action = ?", audit.ActionAudioMessagePurged).Scan(&purged); err != nil {
+		t.Fatal(err)
+	}
+	if purged != 2 {
+		t.Errorf("expected cleaned up messages left alone, got %d purges", purged)
+	}
+}
@@ -0,0 +1,193 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/alecdray/waffle-talkie/internal/database"
+)
+
+// Transcoder produces the playback rendition of uploads.
+type Transcoder interface {
+	// Transcode returns the playback rendition of the audio at src. New files
+	// are written to base plus an extension, next to the original.
+	Transcode(ctx context.Context, src, base string) (Rendition, error)
+}
+
+// NewTranscoder returns an FFmpegTranscoder using the ffmpeg binary at path,
+// or a PassthroughTranscoder when path is empty or not executable.
+func NewTranscoder(path string) Transcoder {
+	if path == "" {
+		return PassthroughTranscoder{}
+	}
+	if _, err := exec.LookPath(path); err != nil {
+		slog.Warn("ffmpeg not found, serving uploads as recorded", "path", path, "error", err)
+		return PassthroughTranscoder{}
+	}
+	return FFmpegTranscoder{Path: path}
+}
+
+// PassthroughTranscoder serves uploads as recorded.
+type PassthroughTranscoder struct{}
+
+func (PassthroughTranscoder) Transcode(ctx context.Context, src, base string) (Rendition, error) {
+	return Rendition{Path: src, ContentType: ContentType(src)}, nil
+}
+
+// FFmpegTranscoder encodes uploads as low-bitrate mono AAC in MP4, which
+// plays natively on both mobile platforms and in browsers.
+type FFmpegTranscoder struct {
+	// Path is the ffmpeg binary.
+	Path string
+	// Bitrate is the AAC bitrate; empty means 32k, plenty for speech.
+	Bitrate string
+}
+
+func (t FFmpegTranscoder) Transcode(ctx context.Context, src, base string) (Rendition, error) {
+	bitrate := t.Bitrate
+	if bitrate == "" {
+		bitrate = "32k"
+	}
+
+	// Written under a temporary name and renamed, so a rerun job never
+	// serves a partial file.
+	dst := base + ".m4a"
+	tmp := base + ".tmp.m4a"
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, t.Path,
+		"-nostdin", "-hide_banner", "-loglevel", "error", "-y",
+		"-i", src,
+		"-vn", "-map_metadata", "-1",
+		"-ac", "1", "-ar", "24000", "-c:a", "aac", "-b:a", bitrate,
+		"-movflags", "+faststart", "-f", "mp4",
+		tmp,
+	)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		os.Remove(tmp)
+		return Rendition{}, fmt.Errorf("ffmpeg failed: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return Rendition{}, fmt.Errorf("failed to store transcoded audio: %w", err)
+	}
+	return Rendition{Path: dst, ContentType: "audio/mp4"}, nil
+}
+
+// TranscodeStep is an optional step that stores the message's playback
+// rendition. Until it has run, the original is played.
+//
+// With filters, the original is decoded, filtered and transcoded from the
+// result, and the message's duration and peaks are updated to match what now
+// plays; the original file is left as uploaded. Formats no decoder handles
+// are transcoded unfiltered.
+func TranscodeStep(queries *database.Queries, transcoder Transcoder, decoders []Decoder, filters []Filter) Step {
+	return Step{
+		Name: "transcode",
+		Run: func(ctx context.Context, message database.AudioMessage) error {
+			base := strings.TrimSuffix(message.FilePath, filepath.Ext(message.FilePath)) + ".playback"
+			rendition, pcm, err := transcodeMessage(ctx, transcoder, decoders, filters, message, base)
+			if err != nil {
+				transcodeResults.Inc("error")
+				return err
+			}
+			transcodeResults.Inc("success")
+			size, err := filesSize(message.FilePath, rendition.Path)
+			if err != nil {
+				return err
+			}
+			if err := queries.SetAudioMessagePlayback(ctx, database.SetAudioMessagePlaybackParams{
+				PlaybackPath:        sql.NullString{String: rendition.Path, Valid: true},
+				PlaybackContentType: sql.NullString{String: rendition.ContentType, Valid: true},
+				Size:                size,
+				ID:                  message.ID,
+			}); err != nil {
+				return fmt.Errorf("failed to store playback rendition: %w", err)
+			}
+			if pcm == nil {
+				return nil
+			}
+
+			if err := queries.SetAudioMessageDuration(ctx, database.SetAudioMessageDurationParams{
+				Duration: max(1, int64(math.Round(pcm.Duration().Seconds()))),
+				ID:       message.ID,
+			}); err != nil {
+				return fmt.Errorf("failed to store duration: %w", err)
+			}
+			if err := queries.SetAudioMessagePeaks(ctx, database.SetAudioMessagePeaksParams{
+				Peaks: Peaks(*pcm, PeakCount),
+				ID:    message.ID,
+			}); err != nil {
+				return fmt.Errorf("failed to store peaks: %w", err)
+			}
+			waveformResults.Inc("success")
+			return nil
+		},
+	}
+}
+
+// transcodeMessage produces the playback rendition of message, returning the
+// filtered audio it was encoded from, or nil if it was not filtered.
+func transcodeMessage(ctx context.Context, transcoder Transcoder, decoders []Decoder, filters []Filter, message database.AudioMessage, base string) (Rendition, *PCM, error) {
+	if len(filters) == 0 {
+		rendition, err := transcoder.Transcode(ctx, message.FilePath, base)
+		return rendition, nil, err
+	}
+
+	pcm, err := Decode(ctx, message.FilePath, decoders)
+	if errors.Is(err, ErrUnsupportedFormat) {
+		slog.WarnContext(ctx, "cannot decode upload, transcoding without filters", "message_id", message.ID, "error", err)
+		rendition, err := transcoder.Transcode(ctx, message.FilePath, base)
+		return rendition, nil, err
+	} else if err != nil {
+		return Rendition{}, nil, err
+	}
+	for _, filter := range filters {
+		pcm = filter(pcm)
+	}
+
+	filtered := base + ".filtered.wav"
+	if err := WriteWAV(filtered, pcm); err != nil {
+		return Rendition{}, nil, err
+	}
+	rendition, err := transcoder.Transcode(ctx, filtered, base)
+	if err != nil {
+		os.Remove(filtered)
+		return Rendition{}, nil, err
+	}
+	if rendition.Path == filtered {
+		// Served as written; give it a name that no rerun overwrites mid-read.
+		rendition.Path = base + ".wav"
+		if err := os.Rename(filtered, rendition.Path); err != nil {
+			os.Remove(filtered)
+			return Rendition{}, nil, fmt.Errorf("failed to store filtered audio: %w", err)
+		}
+	} else {
+		os.Remove(filtered)
+	}
+	return rendition, &pcm, nil
+}
+
+// filesSize returns the bytes taken by a message's recording and its playback
+// rendition, which may be the same file.
+func filesSize(recording, playback string) (int64, error) {
+	var size int64
+	for _, path := range slices.Compact([]string{recording, playback}) {
+		info, err := os.Stat(path)
+		if err != nil {
+			return 0, fmt.Errorf("failed to measure audio file: %w", err)
+		}
+		size += info.Size()
+	}
+	return size, nil
+}
@@ -0,0 +1,219 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/alecdray/waffle-talkie/internal/database"
+	"github.com/alecdray/waffle-talkie/internal/jobs"
+)
+
+// Segment is a timed phrase of a transcript.
+type Segment struct {
+	Start time.Duration
+	End   time.Duration
+	Text  string
+}
+
+// Transcriber turns speech into text.
+type Transcriber interface {
+	// Transcribe returns the phrases spoken in pcm, in order, timed from its
+	// start. Silence yields no segments.
+	Transcribe(ctx context.Context, pcm PCM) ([]Segment, error)
+}
+
+// NewTranscriber returns a WhisperTranscriber running the whisper.cpp binary
+// at path with the model file at model, or nil, disabling transcription, when
+// either is empty or the binary is not executable.
+func NewTranscriber(path, model, language string) Transcriber {
+	if path == "" || model == "" {
+		return nil
+	}
+	if _, err := exec.LookPath(path); err != nil {
+		slog.Warn("whisper not found, transcription disabled", "path", path, "error", err)
+		return nil
+	}
+	return WhisperTranscriber{Path: path, Model: model, Language: language}
+}
+
+// WhisperTranscriber runs a whisper.cpp command line binary, such as
+// whisper-cli, on each message.
+type WhisperTranscriber struct {
+	// Path is the whisper.cpp binary.
+	Path string
+	// Model is the ggml model file.
+	Model string
+	// Language is the spoken language code; empty detects it.
+	Language string
+}
+
+// whisperSampleRate is the only rate whisper.cpp accepts.
+const whisperSampleRate = 16000
+
+func (t WhisperTranscriber) Transcribe(ctx context.Context, pcm PCM) ([]Segment, error) {
+	language := t.Language
+	if language == "" {
+		language = "auto"
+	}
+
+	dir, err := os.MkdirTemp("", "waffle-whisper-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create working directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	input := filepath.Join(dir, "input.wav")
+	if err := WriteWAV(input, Resample(Mono(pcm), whisperSampleRate)); err != nil {
+		return nil, err
+	}
+	output := filepath.Join(dir, "output")
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, t.Path,
+		"-m", t.Model,
+		"-l", language,
+		"-f", input,
+		"-oj", "-of", output,
+		"-np",
+	)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("whisper failed: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	data, err := os.ReadFile(output + ".json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read whisper output: %w", err)
+	}
+	var result struct {
+		Transcription []struct {
+			Offsets struct {
+				From int64 `json:"from"`
+				To   int64 `json:"to"`
+			} `json:"offsets"`
+			Text string `json:"text"`
+		} `json:"transcription"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse whisper output: %w", err)
+	}
+
+	var segments []Segment
+	for _, s := range result.Transcription {
+		text := strings.TrimSpace(s.Text)
+		if text == "" {
+			continue
+		}
+		segments = append(segments, Segment{
+			Start: time.Duration(s.Offsets.From) * time.Millisecond,
+			End:   time.Duration(s.Offsets.To) * time.Millisecond,
+			Text:  text,
+		})
+	}
+	return segments, nil
+}
+
+// Mono averages the channels of pcm.
+func Mono(pcm PCM) PCM {
+	if pcm.Channels <= 1 {
+		return pcm
+	}
+	out := PCM{SampleRate: pcm.SampleRate, Channels: 1, Samples: make([]float32, pcm.Frames())}
+	for i := range out.Samples {
+		var sum float32
+		for _, s := range pcm.Samples[i*pcm.Channels : (i+1)*pcm.Channels] {
+			sum += s
+		}
+		out.Samples[i] = sum / float32(pcm.Channels)
+	}
+	return out
+}
+
+// Resample converts mono pcm to rate by linear interpolation, which is plenty
+// for speech.
+func Resample(pcm PCM, rate int) PCM {
+	if pcm.SampleRate == rate || len(pcm.Samples) == 0 {
+		return pcm
+	}
+	n := int(int64(len(pcm.Samples)) * int64(rate) / int64(pcm.SampleRate))
+	out := PCM{SampleRate: rate, Channels: 1, Samples: make([]float32, n)}
+	step := float64(pcm.SampleRate) / float64(rate)
+	for i := range out.Samples {
+		pos := float64(i) * step
+		j := int(pos)
+		if j+1 >= len(pcm.Samples) {
+			out.Samples[i] = pcm.Samples[len(pcm.Samples)-1]
+			continue
+		}
+		frac := float32(pos - float64(j))
+		out.Samples[i] = pcm.Samples[j]*(1-frac) + pcm.Samples[j+1]*frac
+	}
+	return out
+}
+
+// TranscribeStep is an optional step that stores a transcript of the message.
+// The original is decoded and run through filters, the same as the playback
+// rendition, so segment times match what plays.
+func TranscribeStep(queries *database.Queries, transcriber Transcriber, decoders []Decoder, filters []Filter) Step {
+	return Step{
+		Name: "transcribe",
+		Run: func(ctx context.Context, message database.AudioMessage) error {
+			segments, err := transcribe(ctx, transcriber, decoders, filters, message)
+			if err != nil {
+				transcriptionResults.Inc("error")
+				if errors.Is(err, ErrUnsupportedFormat) {
+					// No retry will make the file decodable.
+					return jobs.Permanent(err)
+				}
+				return err
+			}
+			transcriptionResults.Inc("success")
+			return storeTranscript(ctx, queries, message.ID, segments)
+		},
+	}
+}
+
+func transcribe(ctx context.Context, transcriber Transcriber, decoders []Decoder, filters []Filter, message database.AudioMessage) ([]Segment, error) {
+	pcm, err := Decode(ctx, message.FilePath, decoders)
+	if err != nil {
+		return nil, err
+	}
+	for _, filter := range filters {
+		pcm = filter(pcm)
+	}
+	return transcriber.Transcribe(ctx, pcm)
+}
+
+// storeTranscript replaces the message's transcript. The transcript row is
+// written last, so a transcript is only shown once all its segments are.
+func storeTranscript(ctx context.Context, queries *database.Queries, messageID string, segments []Segment) error {
+	if err := queries.DeleteTranscript(ctx, messageID); err != nil {
+		return fmt.Errorf("failed to delete transcript: %w", err)
+	}
+	if err := queries.DeleteTranscriptSegments(ctx, messageID); err != nil {
+		return fmt.Errorf("failed to delete transcript segments: %w", err)
+	}
+	for i, segment := range segments {
+		if err := queries.CreateTranscriptSegment(ctx, database.CreateTranscriptSegmentParams{
+			AudioMessageID: messageID,
+			Position:       int64(i),
+			StartMs:        segment.Start.Milliseconds(),
+			EndMs:          segment.End.Milliseconds(),
+			Text:           segment.Text,
+		}); err != nil {
+			return fmt.Errorf("failed to store transcript segment: %w", err)
+		}
+	}
+	if err := queries.CreateTranscript(ctx, messageID); err != nil {
+		return fmt.Errorf("failed to store transcript: %w", err)
+	}
+	return nil
+}
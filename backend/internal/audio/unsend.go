@@ -0,0 +1,292 @@
+package audio
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/alecdray/waffle-talkie/internal/apierror"
+	"github.com/alecdray/waffle-talkie/internal/audit"
+	"github.com/alecdray/waffle-talkie/internal/auth"
+	"github.com/alecdray/waffle-talkie/internal/database"
+	"github.com/alecdray/waffle-talkie/internal/jobs"
+	"github.com/alecdray/waffle-talkie/internal/notify"
+	"github.com/alecdray/waffle-talkie/internal/users"
+)
+
+// Jobs queued when a message is unsent.
+const (
+	// JobPurge removes the files of an unsent message once it can no longer
+	// be restored.
+	JobPurge = "audio.purge"
+	// JobRetract tells recipients a message was unsent.
+	JobRetract = "audio.retract"
+)
+
+// retractionRetention is how long unsent messages are listed as retracted:
+// the longest a message is kept before cleanup, so no client still holds one.
+const retractionRetention = 7 * 24 * time.Hour
+
+type unsendPayload struct {
+	MessageID string `json:"message_id"`
+	// DeletedAt identifies the unsend, so a job queued before the message
+	// was restored, and perhaps unsent again, does nothing.
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// unsentMessage loads the message payload names if it is still unsent by the
+// same unsend.
+func unsentMessage(ctx context.Context, queries *database.Queries, payload unsendPayload) (database.AudioMessage, bool, error) {
+	message, err := queries.GetAudioMessageWithDeleted(ctx, payload.MessageID)
+	if err == sql.ErrNoRows {
+		return database.AudioMessage{}, false, nil
+	} else if err != nil {
+		return database.AudioMessage{}, false, fmt.Errorf("failed to get message: %w", err)
+	}
+	if !message.DeletedAt.Valid || !message.DeletedAt.Time.Equal(payload.DeletedAt) {
+		return database.AudioMessage{}, false, nil
+	}
+	return message, true, nil
+}
+
+// Purger runs purge jobs.
+type Purger struct {
+	queries *database.Queries
+	audit   *audit.Logger
+}
+
+func NewPurger(queries *database.Queries, auditLog *audit.Logger) *Purger {
+	return &Purger{queries: queries, audit: auditLog}
+}
+
+func (p *Purger) Handle(ctx context.Context, job database.Job) error {
+	var payload unsendPayload
+	if err := jobs.Decode(job, &payload); err != nil {
+		return err
+	}
+	return p.purge(ctx, payload)
+}
+
+// purge removes the files and transcript of an unsent message. Marking it
+// purged first ends the undo window, so it is never restored without them.
+func (p *Purger) purge(ctx context.Context, payload unsendPayload) error {
+	message, unsent, err := unsentMessage(ctx, p.queries, payload)
+	if err != nil || !unsent {
+		return err
+	}
+	if !message.PurgedAt.Valid {
+		purged, err := p.queries.MarkAudioMessagePurged(ctx, database.MarkAudioMessagePurgedParams{
+			PurgedAt:  sql.NullTime{Time: time.Now().UTC(), Valid: true},
+			ID:        message.ID,
+			DeletedAt: message.DeletedAt,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to mark message purged: %w", err)
+		}
+		if purged == 0 {
+			// Restored meanwhile.
+			return nil
+		}
+	}
+
+	if err := removeMessageData(ctx, p.queries, message); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "unsent audio message purged", "message_id", message.ID)
+	p.audit.RecordContext(ctx, audit.Event{
+		Action:     audit.ActionAudioMessagePurged,
+		TargetType: audit.TargetAudioMessage,
+		TargetID:   message.ID,
+		Detail: map[string]any{
+			"sender_user_id":     message.SenderUserID,
+			"deleted_by_user_id": message.DeletedByUserID.String,
+		},
+	})
+	return nil
+}
+
+// Retracter runs retract jobs.
+type Retracter struct {
+	queries  *database.Queries
+	notifier *notify.Notifier
+}
+
+func NewRetracter(queries *database.Queries, notifier *notify.Notifier) *Retracter {
+	return &Retracter{queries: queries, notifier: notifier}
+}
+
+// Handle tells recipients about an unsend, unless the message has been
+// restored since or was unsent before they were shown it.
+func (rt *Retracter) Handle(ctx context.Context, job database.Job) error {
+	var payload unsendPayload
+	if err := jobs.Decode(job, &payload); err != nil {
+		return err
+	}
+	message, unsent, err := unsentMessage(ctx, rt.queries, payload)
+	if err != nil || !unsent || message.ProcessingStatus != StatusReady {
+		return err
+	}
+	return rt.notifier.MessageRetracted(ctx, message)
+}
+
+type UnsendResponse struct {
+	MessageID string `json:"message_id"`
+	// UndoUntil is when the message's files are removed, until which
+	// POST /v1/audio-messages/{id}/restore brings it back; null when there
+	// is no undo window.
+	UndoUntil *time.Time `json:"undo_until"`
+	Message   string     `json:"message"`
+}
+
+// HandleUnsend deletes a message for everyone on behalf of its sender or an
+// admin. It disappears at once and recipients are told to drop their copies;
+// its files are removed once the undo window has passed.
+func (h *Handler) HandleUnsend(w http.ResponseWriter, r *http.Request) {
+	message, userID, _, ok := h.unsendTarget(w, r, h.queries.GetAudioMessage)
+	if !ok {
+		return
+	}
+
+	now := time.Now().UTC()
+	unsent, err := h.queries.UnsendAudioMessage(r.Context(), database.UnsendAudioMessageParams{
+		DeletedAt:       sql.NullTime{Time: now, Valid: true},
+		DeletedByUserID: sql.NullString{String: userID, Valid: true},
+		ID:              message.ID,
+	})
+	if err == sql.ErrNoRows {
+		// Deleted since it was loaded.
+		apierror.Write(w, http.StatusNotFound, apierror.CodeMessageNotFound, "Message not found")
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to unsend message", "message_id", message.ID, "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to unsend message")
+		return
+	}
+	payload := unsendPayload{MessageID: unsent.ID, DeletedAt: now}
+	if _, err := h.queue.Enqueue(r.Context(), JobRetract, payload); err != nil {
+		// Clients still drop it the next time they list messages.
+		slog.ErrorContext(r.Context(), "failed to queue retraction", "message_id", unsent.ID, "error", err)
+	}
+
+	resp := UnsendResponse{MessageID: unsent.ID, Message: "Message unsent"}
+	if h.undoWindow > 0 {
+		undoUntil := now.Add(h.undoWindow)
+		resp.UndoUntil = &undoUntil
+	}
+	if _, err := h.queue.EnqueueAt(r.Context(), JobPurge, payload, now.Add(h.undoWindow)); err != nil {
+		slog.ErrorContext(r.Context(), "failed to queue purge, purging now", "message_id", unsent.ID, "error", err)
+		resp.UndoUntil = nil
+		if err := h.purger.purge(r.Context(), payload); err != nil {
+			slog.ErrorContext(r.Context(), "failed to purge unsent message", "message_id", unsent.ID, "error", err)
+		}
+	}
+
+	slog.InfoContext(r.Context(), "audio message unsent", "message_id", unsent.ID)
+	h.audit.Record(r, audit.Event{
+		Action:      audit.ActionAudioMessageUnsent,
+		ActorUserID: userID,
+		TargetType:  audit.TargetAudioMessage,
+		TargetID:    unsent.ID,
+		Detail:      map[string]any{"sender_user_id": unsent.SenderUserID},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// HandleUndoUnsend restores an unsent message within the undo window and
+// returns it. Only whoever unsent it or an admin may, so a sender cannot
+// bring back a message an admin took down. Recipients who dropped their copy
+// see it again the next time they list messages, unless they had already
+// received it.
+func (h *Handler) HandleUndoUnsend(w http.ResponseWriter, r *http.Request) {
+	message, userID, admin, ok := h.unsendTarget(w, r, h.queries.GetAudioMessageWithDeleted)
+	if !ok {
+		return
+	}
+	if !admin && message.DeletedByUserID.Valid && message.DeletedByUserID.String != userID {
+		apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Only whoever unsent a message or an admin can restore it")
+		return
+	}
+
+	restored, err := h.queries.RestoreAudioMessage(r.Context(), database.RestoreAudioMessageParams{
+		ID:        message.ID,
+		DeletedAt: sql.NullTime{Time: time.Now().UTC().Add(-h.undoWindow), Valid: true},
+	})
+	if err == sql.ErrNoRows {
+		apierror.Write(w, http.StatusConflict, apierror.CodeUndoUnavailable, "Message is not unsent, or can no longer be restored")
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to restore message", "message_id", message.ID, "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to restore message")
+		return
+	}
+	if restored.ProcessingStatus == StatusProcessing {
+		// Processing skips deleted messages, so it may have been dropped.
+		if err := h.pipeline.Start(r.Context(), restored); err != nil {
+			slog.ErrorContext(r.Context(), "failed to restart processing", "message_id", restored.ID, "error", err)
+		}
+	}
+
+	slog.InfoContext(r.Context(), "audio message unsend undone", "message_id", restored.ID)
+	h.audit.Record(r, audit.Event{
+		Action:      audit.ActionUnsendUndone,
+		ActorUserID: userID,
+		TargetType:  audit.TargetAudioMessage,
+		TargetID:    restored.ID,
+		Detail:      map[string]any{"sender_user_id": restored.SenderUserID},
+	})
+
+	senders := make(map[string]users.User, 1)
+	if sender, err := h.queries.GetUser(r.Context(), restored.SenderUserID); err == nil {
+		senders[sender.ID] = users.NewUser(sender)
+	}
+	resp, err := h.message(r.Context(), restored, senders)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get transcript", "message_id", restored.ID, "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve message")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// unsendTarget loads the message named in the path with get and checks the
+// user may unsend it: its sender, or an admin. Other users get 404 for
+// messages they cannot see and 403 for the rest. It returns the message, the
+// user's ID and whether they are an admin.
+func (h *Handler) unsendTarget(w http.ResponseWriter, r *http.Request, get func(context.Context, string) (database.AudioMessage, error)) (database.AudioMessage, string, bool, bool) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "User ID not found")
+		return database.AudioMessage{}, "", false, false
+	}
+	user, err := h.queries.GetUser(r.Context(), userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get user", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Internal server error")
+		return database.AudioMessage{}, "", false, false
+	}
+	admin := users.UserRole(user.Role).IsAdmin()
+
+	message, err := get(r.Context(), r.PathValue("id"))
+	if err == sql.ErrNoRows || (err == nil && !admin && message.SenderUserID != userID &&
+		(message.DeletedAt.Valid || !visibleTo(message, userID))) {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeMessageNotFound, "Message not found")
+		return database.AudioMessage{}, "", false, false
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get message", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve message")
+		return database.AudioMessage{}, "", false, false
+	}
+	if !admin && message.SenderUserID != userID {
+		apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Only the sender or an admin can unsend a message")
+		return database.AudioMessage{}, "", false, false
+	}
+	return message, userID, admin, true
+}
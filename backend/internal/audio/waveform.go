@@ -0,0 +1,82 @@
+package audio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+
+	"github.com/alecdray/waffle-talkie/internal/database"
+)
+
+// PeakCount is the fixed number of buckets in a waveform, whatever the
+// message length, so clients can draw it at any width.
+const PeakCount = 100
+
+// Peaks splits pcm into n buckets and returns the loudest absolute sample of
+// each across all channels, scaled so the loudest bucket is 255. Silence is
+// all zeros.
+func Peaks(pcm PCM, n int) []byte {
+	peaks := make([]byte, n)
+	frames := pcm.Frames()
+	if frames == 0 || n == 0 {
+		return peaks
+	}
+
+	levels := make([]float64, n)
+	var loudest float64
+	for frame := 0; frame < frames; frame++ {
+		bucket := frame * n / frames
+		for _, s := range pcm.Samples[frame*pcm.Channels : (frame+1)*pcm.Channels] {
+			if v := math.Abs(float64(s)); v > levels[bucket] {
+				levels[bucket] = v
+			}
+		}
+		loudest = max(loudest, levels[bucket])
+	}
+	if loudest == 0 {
+		return peaks
+	}
+	for i, level := range levels {
+		peaks[i] = byte(math.Round(level / loudest * 255))
+	}
+	return peaks
+}
+
+// WaveformStep is a step that decodes the message's audio with the first
+// decoder that recognizes it and stores its peaks. Audio no decoder
+// recognizes is left without a waveform rather than failing the step, as no
+// retry would make it decodable and the step may be required.
+func WaveformStep(queries *database.Queries, decoders []Decoder) Step {
+	return Step{
+		Name: "waveform",
+		Run: func(ctx context.Context, message database.AudioMessage) error {
+			err := generateWaveform(ctx, queries, decoders, message)
+			if err != nil {
+				waveformResults.Inc("error")
+			} else {
+				waveformResults.Inc("success")
+			}
+			if errors.Is(err, ErrUnsupportedFormat) {
+				slog.WarnContext(ctx, "cannot decode upload, leaving it without a waveform", "message_id", message.ID, "error", err)
+				return nil
+			}
+			return err
+		},
+	}
+}
+
+func generateWaveform(ctx context.Context, queries *database.Queries, decoders []Decoder, message database.AudioMessage) error {
+	pcm, err := Decode(ctx, message.FilePath, decoders)
+	if err != nil {
+		return err
+	}
+	if err := queries.SetAudioMessagePeaks(ctx, database.SetAudioMessagePeaksParams{
+		Peaks: Peaks(pcm, PeakCount),
+		ID:    message.ID,
+	}); err != nil {
+		return fmt.Errorf("failed to store peaks: %w", err)
+	}
+	return nil
+}
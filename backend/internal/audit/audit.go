@@ -0,0 +1,117 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/alecdray/waffle-talkie/internal/database"
+	"github.com/alecdray/waffle-talkie/internal/logging"
+)
+
+// Action names what happened. Actions are stored and filtered on, so never
+// rename an existing one.
+type Action string
+
+const (
+	ActionUserRegistered      Action = "user.registered"
+	ActionUserApproved        Action = "user.approved"
+	ActionUserSessionsRevoked Action = "user.sessions_revoked"
+	ActionUserDeleted         Action = "user.deleted"
+	ActionUserExported        Action = "user.exported"
+	ActionPendingUsersExpired Action = "user.pending_expired"
+	ActionUserDeactivated     Action = "user.deactivated"
+	ActionUserReactivated     Action = "user.reactivated"
+	ActionUserStatusChanged   Action = "user.status_changed"
+	ActionLoginSucceeded      Action = "auth.login_succeeded"
+	ActionLoginFailed         Action = "auth.login_failed"
+	ActionInviteCreated       Action = "invite.created"
+	ActionInviteRevoked       Action = "invite.revoked"
+	ActionFeedCreated         Action = "feed.created"
+	ActionFeedRevoked         Action = "feed.revoked"
+	ActionAudioMessagePurged  Action = "audio_message.purged"
+	ActionTranscriptRequested Action = "audio_message.transcript_requested"
+	ActionAudioMessageEdited  Action = "audio_message.edited"
+	ActionAudioMessageUnsent  Action = "audio_message.unsent"
+	ActionUnsendUndone        Action = "audio_message.unsend_undone"
+)
+
+// Target types identify what TargetID refers to.
+const (
+	TargetUser         = "user"
+	TargetInvite       = "invite"
+	TargetAudioMessage = "audio_message"
+)
+
+// Event is a single audit record. ActorUserID is empty for actions taken by
+// the server itself or by unauthenticated clients.
+type Event struct {
+	Action      Action
+	ActorUserID string
+	TargetType  string
+	TargetID    string
+	Detail      map[string]any
+}
+
+// Logger appends events to the audit_events table. Failing to record an event
+// is logged but never fails the action being audited.
+type Logger struct {
+	queries  *database.Queries
+	clientIP func(*http.Request) string
+}
+
+// New creates an audit logger. clientIP resolves the address recorded for
+// request events; it may be nil when only RecordContext is used.
+func New(queries *database.Queries, clientIP func(*http.Request) string) *Logger {
+	return &Logger{
+		queries:  queries,
+		clientIP: clientIP,
+	}
+}
+
+// Record appends an event caused by an HTTP request, including the client IP
+// and request ID.
+func (l *Logger) Record(r *http.Request, e Event) {
+	ip := ""
+	if l.clientIP != nil {
+		ip = l.clientIP(r)
+	}
+	l.record(r.Context(), e, ip)
+}
+
+// RecordContext appends an event raised outside of a request, such as by a
+// background task.
+func (l *Logger) RecordContext(ctx context.Context, e Event) {
+	l.record(ctx, e, "")
+}
+
+func (l *Logger) record(ctx context.Context, e Event, ip string) {
+	var detail sql.NullString
+	if len(e.Detail) > 0 {
+		b, err := json.Marshal(e.Detail)
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to encode audit detail", "action", e.Action, "error", err)
+		} else {
+			detail = sql.NullString{String: string(b), Valid: true}
+		}
+	}
+
+	err := l.queries.CreateAuditEvent(ctx, database.CreateAuditEventParams{
+		Action:      string(e.Action),
+		ActorUserID: nullString(e.ActorUserID),
+		TargetType:  nullString(e.TargetType),
+		TargetID:    nullString(e.TargetID),
+		Ip:          nullString(ip),
+		RequestID:   nullString(logging.RequestID(ctx)),
+		Detail:      detail,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to record audit event", "action", e.Action, "error", err)
+	}
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,132 @@
+package audit
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/alecdray/waffle-talkie/internal/apierror"
+	"github.com/alecdray/waffle-talkie/internal/database"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// Handler serves the audit log to admins.
+type Handler struct {
+	queries *database.Queries
+}
+
+func NewHandler(queries *database.Queries) *Handler {
+	return &Handler{queries: queries}
+}
+
+// RegisterAdminRoutes registers audit routes on the admin mux.
+func (h *Handler) RegisterAdminRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /v1/audit-events", h.HandleListEvents)
+}
+
+type EventResponse struct {
+	ID          int64           `json:"id"`
+	Action      string          `json:"action"`
+	ActorUserID *string         `json:"actor_user_id"`
+	TargetType  *string         `json:"target_type"`
+	TargetID    *string         `json:"target_id"`
+	IP          *string         `json:"ip"`
+	RequestID   *string         `json:"request_id"`
+	Detail      json.RawMessage `json:"detail"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+type EventsResponse struct {
+	Events []EventResponse `json:"events"`
+	// NextCursor is passed as the cursor parameter to fetch the next, older
+	// page. It is null on the last page.
+	NextCursor *string `json:"next_cursor"`
+}
+
+func newEventResponse(event database.AuditEvent) EventResponse {
+	resp := EventResponse{
+		ID:          event.ID,
+		Action:      event.Action,
+		ActorUserID: stringPtr(event.ActorUserID),
+		TargetType:  stringPtr(event.TargetType),
+		TargetID:    stringPtr(event.TargetID),
+		IP:          stringPtr(event.Ip),
+		RequestID:   stringPtr(event.RequestID),
+		Detail:      json.RawMessage("null"),
+		CreatedAt:   event.CreatedAt,
+	}
+	if event.Detail.Valid {
+		resp.Detail = json.RawMessage(event.Detail.String)
+	}
+	return resp
+}
+
+func stringPtr(s sql.NullString) *string {
+	if !s.Valid {
+		return nil
+	}
+	return &s.String
+}
+
+// HandleListEvents returns audit events newest first, optionally filtered by
+// action, actor_user_id and target_id, a page at a time.
+func (h *Handler) HandleListEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	params := database.ListAuditEventsParams{
+		Action:      nullString(query.Get("action")),
+		ActorUserID: nullString(query.Get("actor_user_id")),
+		TargetID:    nullString(query.Get("target_id")),
+		Limit:       defaultPageSize,
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		beforeID, err := strconv.ParseInt(cursor, 10, 64)
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid cursor")
+			return
+		}
+		params.BeforeID = sql.NullInt64{Int64: beforeID, Valid: true}
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		parsed, err := strconv.ParseInt(limit, 10, 64)
+		if err != nil || parsed < 1 || parsed > maxPageSize {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "limit must be between 1 and 200")
+			return
+		}
+		params.Limit = parsed
+	}
+
+	// Fetch one extra row to learn whether there is another page.
+	pageSize := params.Limit
+	params.Limit++
+	events, err := h.queries.ListAuditEvents(r.Context(), params)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to list audit events", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to list audit events")
+		return
+	}
+
+	resp := EventsResponse{
+		Events: make([]EventResponse, 0, len(events)),
+	}
+	if int64(len(events)) > pageSize {
+		events = events[:pageSize]
+		cursor := strconv.FormatInt(events[len(events)-1].ID, 10)
+		resp.NextCursor = &cursor
+	}
+	for _, event := range events {
+		resp.Events = append(resp.Events, newEventResponse(event))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
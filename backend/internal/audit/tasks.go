@@ -0,0 +1,58 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/alecdray/waffle-talkie/internal/database"
+)
+
+type TaskManager struct {
+	queries   *database.Queries
+	retention time.Duration
+}
+
+// NewTaskManager creates the audit background tasks. A zero retention keeps
+// events forever.
+func NewTaskManager(queries *database.Queries, retention time.Duration) *TaskManager {
+	return &TaskManager{
+		queries:   queries,
+		retention: retention,
+	}
+}
+
+func (tm *TaskManager) Start(ctx context.Context) error {
+	if tm.retention <= 0 {
+		return nil
+	}
+
+	slog.Info("starting audit tasks", "retention", tm.retention)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Hour):
+				if err := tm.EnforceRetention(ctx); err != nil {
+					slog.Error("failed to enforce audit retention", "error", err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// EnforceRetention deletes events older than the retention period.
+func (tm *TaskManager) EnforceRetention(ctx context.Context) error {
+	cutoff := time.Now().UTC().Add(-tm.retention)
+	deleted, err := tm.queries.DeleteAuditEventsBefore(ctx, cutoff)
+	if err != nil {
+		return fmt.Errorf("failed to delete old audit events: %w", err)
+	}
+	if deleted > 0 {
+		slog.Info("deleted old audit events", "count", deleted)
+	}
+	return nil
+}
@@ -1,40 +1,72 @@
 package auth
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"time"
 
+	"github.com/alecdray/waffle-talkie/internal/apierror"
+	"github.com/alecdray/waffle-talkie/internal/audit"
 	"github.com/alecdray/waffle-talkie/internal/database"
+	"github.com/alecdray/waffle-talkie/internal/routes"
 	"github.com/alecdray/waffle-talkie/internal/users"
 	"github.com/google/uuid"
 )
 
 // Handler manages authentication endpoints.
 type Handler struct {
+	db        *sql.DB
 	queries   *database.Queries
 	secretKey string
+	policy    RegistrationPolicy
+	audit     *audit.Logger
+}
+
+// RegistrationPolicy controls who may register and how many registrations may
+// wait for approval at once.
+type RegistrationPolicy struct {
+	// RequireInvite rejects registrations that do not carry a valid invite code.
+	RequireInvite bool
+	// MaxPendingUsers caps unapproved users; zero means no cap. Pre-approved
+	// invites are not subject to the cap.
+	MaxPendingUsers int
 }
 
 // NewHandler creates an auth handler with database access.
-func NewHandler(queries *database.Queries, secretKey string) *Handler {
+func NewHandler(db *sql.DB, queries *database.Queries, secretKey string, policy RegistrationPolicy, auditLog *audit.Logger) *Handler {
 	return &Handler{
+		db:        db,
 		queries:   queries,
 		secretKey: secretKey,
+		policy:    policy,
+		audit:     auditLog,
 	}
 }
 
 // RegisterRoutes registers auth routes on the provided mux.
 func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
-	mux.HandleFunc("/register", h.HandleRegister)
-	mux.HandleFunc("/login", h.HandleLogin)
+	mux.HandleFunc("POST /v1/register", h.HandleRegister)
+	mux.HandleFunc("POST /v1/login", h.HandleLogin)
+
+	// Deprecated unversioned routes kept for older app builds.
+	mux.Handle("POST /register", routes.Deprecated("/auth/v1/register", h.HandleRegister))
+	mux.Handle("POST /login", routes.Deprecated("/auth/v1/login", h.HandleLogin))
 }
 
 type RegisterRequest struct {
-	Name     string `json:"name"`
-	DeviceID string `json:"device_id"`
+	Name       string `json:"name"`
+	DeviceID   string `json:"device_id"`
+	InviteCode string `json:"invite_code,omitempty"`
+}
+
+// LogValue keeps the device ID and invite code out of logs if the request is ever logged whole.
+func (req RegisterRequest) LogValue() slog.Value {
+	return slog.GroupValue(slog.String("name", req.Name))
 }
 
 type RegisterResponse struct {
@@ -44,37 +76,27 @@ type RegisterResponse struct {
 
 // HandleRegister creates a new user pending approval. Device IDs are hashed before storage.
 func (h *Handler) HandleRegister(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	var req RegisterRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidBody, "Invalid request body")
 		return
 	}
 
-	if req.Name == "" || req.DeviceID == "" {
-		http.Error(w, "Name and device_id are required", http.StatusBadRequest)
+	if req.DeviceID == "" {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "device_id is required")
 		return
 	}
 
 	users, err := h.queries.ListUsers(r.Context())
 	if err != nil {
-		slog.Error("failed to list users", "error", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "failed to list users", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Internal server error")
 		return
 	}
 
 	for _, existingUser := range users {
 		if CompareDeviceID(existingUser.DeviceIDHash, req.DeviceID) {
-			if existingUser.Name != req.Name {
-				h.queries.UpdateUserName(r.Context(), database.UpdateUserNameParams{
-					ID:   existingUser.ID,
-					Name: req.Name,
-				})
-			}
+			// Names are changed through PATCH /api/v1/me, not by re-registering.
 			resp := RegisterResponse{
 				Message: "Device already registered",
 				UserID:  existingUser.ID,
@@ -86,41 +108,137 @@ func (h *Handler) HandleRegister(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	var invite *database.InviteCode
+	if req.InviteCode != "" {
+		found, err := h.queries.GetInviteCode(r.Context(), req.InviteCode)
+		if err == sql.ErrNoRows || (err == nil && !inviteUsable(found)) {
+			apierror.Write(w, http.StatusForbidden, apierror.CodeInviteInvalid, "Invite code is invalid, expired or used up")
+			return
+		} else if err != nil {
+			slog.ErrorContext(r.Context(), "failed to get invite code", "error", err)
+			apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Internal server error")
+			return
+		}
+		invite = &found
+	} else if h.policy.RequireInvite {
+		apierror.Write(w, http.StatusForbidden, apierror.CodeInviteRequired, "An invite code is required to register")
+		return
+	}
+
+	name := req.Name
+	if invite != nil && invite.Name.Valid {
+		name = invite.Name.String
+	}
+	if name == "" {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Name and device_id are required")
+		return
+	}
+
 	hashedDeviceID, err := HashDeviceID(req.DeviceID)
 	if err != nil {
-		slog.Error("failed to hash device ID", "error", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "failed to hash device ID", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Internal server error")
 		return
 	}
 
-	user, err := h.queries.CreateUser(r.Context(), database.CreateUserParams{
+	user, err := h.register(r.Context(), database.CreateUserParams{
 		ID:           uuid.New().String(),
-		Name:         req.Name,
+		Name:         name,
 		DeviceIDHash: hashedDeviceID,
-		Approved:     false,
-	})
-	if err != nil {
-		slog.Error("failed to create user", "error", err)
-		http.Error(w, "Failed to register user", http.StatusInternalServerError)
+		Approved:     invite != nil && invite.PreApproved,
+	}, invite)
+	if errors.Is(err, errPendingLimitReached) {
+		apierror.Write(w, http.StatusServiceUnavailable, apierror.CodePendingLimitReached, "Too many registrations are awaiting approval, try again later")
+		return
+	} else if errors.Is(err, errInviteUsedUp) {
+		apierror.Write(w, http.StatusForbidden, apierror.CodeInviteInvalid, "Invite code is invalid, expired or used up")
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to register user", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to register user")
 		return
 	}
 
-	slog.Info("user registered", "user_id", user.ID, "name", user.Name)
+	slog.InfoContext(r.Context(), "user registered", "user_id", user.ID, "name", user.Name, "approved", user.Approved, "invited", invite != nil)
+
+	event := audit.Event{
+		Action:      audit.ActionUserRegistered,
+		ActorUserID: user.ID,
+		TargetType:  audit.TargetUser,
+		TargetID:    user.ID,
+		Detail:      map[string]any{"approved": user.Approved},
+	}
+	if invite != nil {
+		event.Detail["invite_id"] = invite.ID
+	}
+	h.audit.Record(r, event)
 
 	resp := RegisterResponse{
 		Message: "Registration successful. Awaiting admin approval.",
 		UserID:  user.ID,
 	}
+	if user.Approved {
+		resp.Message = "Registration successful."
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(resp)
 }
 
+var (
+	errPendingLimitReached = errors.New("pending user limit reached")
+	errInviteUsedUp        = errors.New("invite code is no longer usable")
+)
+
+// register creates a user, redeeming invite if it is not nil. The pending
+// user count, the redemption and the insert share a transaction, which takes
+// the write lock as it begins, so concurrent registrations cannot go past the
+// pending cap or the invite's max_uses. A rejected registration rolls back and
+// does not use up the invite.
+func (h *Handler) register(ctx context.Context, params database.CreateUserParams, invite *database.InviteCode) (database.User, error) {
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return database.User{}, err
+	}
+	defer tx.Rollback()
+	qtx := h.queries.WithTx(tx)
+
+	if !params.Approved && h.policy.MaxPendingUsers > 0 {
+		pending, err := qtx.CountPendingUsers(ctx)
+		if err != nil {
+			return database.User{}, fmt.Errorf("failed to count pending users: %w", err)
+		}
+		if pending >= int64(h.policy.MaxPendingUsers) {
+			slog.WarnContext(ctx, "pending user limit reached", "pending", pending)
+			return database.User{}, errPendingLimitReached
+		}
+	}
+
+	if invite != nil {
+		if _, err := qtx.RedeemInviteCode(ctx, invite.Code); err == sql.ErrNoRows {
+			return database.User{}, errInviteUsedUp
+		} else if err != nil {
+			return database.User{}, fmt.Errorf("failed to redeem invite code: %w", err)
+		}
+	}
+
+	user, err := qtx.CreateUser(ctx, params)
+	if err != nil {
+		return database.User{}, fmt.Errorf("failed to create user: %w", err)
+	}
+	return user, tx.Commit()
+}
+
 type LoginRequest struct {
 	DeviceID string `json:"device_id"`
 }
 
+// LogValue keeps the device ID out of logs if the request is ever logged whole.
+func (req LoginRequest) LogValue() slog.Value {
+	return slog.GroupValue()
+}
+
 type LoginResponse struct {
 	Token          string         `json:"token"`
 	TokenExpiresAt time.Time      `json:"token_expires_at"`
@@ -132,26 +250,21 @@ type LoginResponse struct {
 
 // HandleLogin authenticates approved users and returns a JWT token.
 func (h *Handler) HandleLogin(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	var req LoginRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidBody, "Invalid request body")
 		return
 	}
 
 	if req.DeviceID == "" {
-		http.Error(w, "device_id is required", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "device_id is required")
 		return
 	}
 
 	allUsers, err := h.queries.ListUsers(r.Context())
 	if err != nil {
-		slog.Error("failed to list users", "error", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "failed to list users", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Internal server error")
 		return
 	}
 
@@ -164,34 +277,62 @@ func (h *Handler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if user == nil {
-		http.Error(w, "Device not registered", http.StatusUnauthorized)
+		h.audit.Record(r, audit.Event{
+			Action: audit.ActionLoginFailed,
+			Detail: map[string]any{"reason": apierror.CodeDeviceNotRegistered},
+		})
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeDeviceNotRegistered, "Device not registered")
 		return
 	}
 
 	if !user.Approved {
-		http.Error(w, "User not approved yet", http.StatusForbidden)
+		h.audit.Record(r, audit.Event{
+			Action:     audit.ActionLoginFailed,
+			TargetType: audit.TargetUser,
+			TargetID:   user.ID,
+			Detail:     map[string]any{"reason": apierror.CodeNotApproved},
+		})
+		apierror.Write(w, http.StatusForbidden, apierror.CodeNotApproved, "User not approved yet")
 		return
 	}
 
+	if users.UserStatus(user.Status) == users.UserStatusSuspended {
+		h.audit.Record(r, audit.Event{
+			Action:     audit.ActionLoginFailed,
+			TargetType: audit.TargetUser,
+			TargetID:   user.ID,
+			Detail:     map[string]any{"reason": apierror.CodeUserSuspended},
+		})
+		apierror.Write(w, http.StatusForbidden, apierror.CodeUserSuspended, "User is suspended")
+		return
+	}
+
+	reactivate(r, h.queries, h.audit, *user)
 	if err := h.queries.UpdateUserLastActive(r.Context(), user.ID); err != nil {
-		slog.Error("failed to update last active", "error", err)
+		slog.ErrorContext(r.Context(), "failed to update last active", "error", err)
 	}
 
-	token := GenerateToken(user.ID, h.secretKey)
+	token := GenerateToken(user.ID, user.TokenGeneration, h.secretKey)
 	tokenString, err := SignToken(token, h.secretKey)
 	if err != nil {
-		slog.Error("failed to generate token", "error", err)
-		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "failed to generate token", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to generate token")
 		return
 	}
 	tokenExpiresAt, err := token.Claims.GetExpirationTime()
 	if err != nil {
-		slog.Error("failed to get token expiration time", "error", err)
-		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "failed to get token expiration time", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to generate token")
 		return
 	}
 
-	slog.Info("user logged in", "user_id", user.ID, "name", user.Name)
+	slog.InfoContext(r.Context(), "user logged in", "user_id", user.ID, "name", user.Name)
+	h.audit.Record(r, audit.Event{
+		Action:      audit.ActionLoginSucceeded,
+		ActorUserID: user.ID,
+		TargetType:  audit.TargetUser,
+		TargetID:    user.ID,
+	})
 
 	resp := LoginResponse{
 		Token:          tokenString,
@@ -213,41 +354,46 @@ type ApproveResponse struct {
 	Message string `json:"message"`
 }
 
-// HandleApprove marks a user as approved, allowing them to log in.
+// HandleApprove marks a user as approved, allowing them to log in. The user ID
+// comes from the {id} path parameter, or the JSON body when the route has none.
 func (h *Handler) HandleApprove(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	var req ApproveRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
+	req := ApproveRequest{UserID: r.PathValue("id")}
+	if req.UserID == "" {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidBody, "Invalid request body")
+			return
+		}
 	}
 
 	if req.UserID == "" {
-		http.Error(w, "user_id is required", http.StatusBadRequest)
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "user_id is required")
 		return
 	}
 
 	user, err := h.queries.GetUser(r.Context(), req.UserID)
 	if err == sql.ErrNoRows {
-		http.Error(w, "User not found", http.StatusNotFound)
+		apierror.Write(w, http.StatusNotFound, apierror.CodeUserNotFound, "User not found")
 		return
 	} else if err != nil {
-		slog.Error("failed to get user", "error", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "failed to get user", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Internal server error")
 		return
 	}
 
 	if err := h.queries.ApproveUser(r.Context(), req.UserID); err != nil {
-		slog.Error("failed to approve user", "error", err)
-		http.Error(w, "Failed to approve user", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "failed to approve user", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to approve user")
 		return
 	}
 
-	slog.Info("user approved", "user_id", user.ID, "name", user.Name)
+	slog.InfoContext(r.Context(), "user approved", "user_id", user.ID, "name", user.Name)
+	actorID, _ := GetUserIDFromContext(r.Context())
+	h.audit.Record(r, audit.Event{
+		Action:      audit.ActionUserApproved,
+		ActorUserID: actorID,
+		TargetType:  audit.TargetUser,
+		TargetID:    user.ID,
+	})
 
 	resp := ApproveResponse{
 		Message: "User approved successfully",
@@ -271,15 +417,10 @@ type PendingUsersResponse struct {
 
 // HandleListPendingUsers returns all users awaiting approval.
 func (h *Handler) HandleListPendingUsers(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	users, err := h.queries.ListUsers(r.Context())
 	if err != nil {
-		slog.Error("failed to list users", "error", err)
-		http.Error(w, "Failed to list users", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "failed to list users", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to list users")
 		return
 	}
 
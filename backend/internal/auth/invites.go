@@ -0,0 +1,206 @@
+package auth
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/alecdray/waffle-talkie/internal/apierror"
+	"github.com/alecdray/waffle-talkie/internal/audit"
+	"github.com/alecdray/waffle-talkie/internal/database"
+	"github.com/google/uuid"
+)
+
+// RegisterAdminRoutes registers invite, approval and user status routes on the admin mux.
+func (h *Handler) RegisterAdminRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /v1/invites", h.HandleListInvites)
+	mux.HandleFunc("POST /v1/invites", h.HandleCreateInvite)
+	mux.HandleFunc("DELETE /v1/invites/{id}", h.HandleRevokeInvite)
+	mux.HandleFunc("GET /v1/pending-users", h.HandleListPendingUsers)
+	mux.HandleFunc("POST /v1/users/{id}/approve", h.HandleApprove)
+	mux.HandleFunc("POST /v1/users/{id}/revoke-sessions", h.HandleRevokeSessions)
+	mux.HandleFunc("PUT /v1/users/{id}/status", h.HandleSetStatus)
+}
+
+// inviteUsable reports whether an invite can still be redeemed.
+func inviteUsable(invite database.InviteCode) bool {
+	if invite.RevokedAt.Valid || invite.Uses >= invite.MaxUses {
+		return false
+	}
+	return !invite.ExpiresAt.Valid || invite.ExpiresAt.Time.After(time.Now())
+}
+
+// newInviteCode returns a random code that is easy to read out or type.
+func newInviteCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.EncodeToString(b), nil
+}
+
+type CreateInviteRequest struct {
+	// Name, when set, is used for the registered user instead of the name they send.
+	Name           string `json:"name,omitempty"`
+	MaxUses        int64  `json:"max_uses,omitempty"`
+	ExpiresInHours int64  `json:"expires_in_hours,omitempty"`
+	PreApproved    bool   `json:"pre_approved"`
+}
+
+type InviteResponse struct {
+	// ID refers to the invite where its code would be exposed, such as the
+	// audit log.
+	ID          string     `json:"id"`
+	Code        string     `json:"code"`
+	Name        *string    `json:"name"`
+	MaxUses     int64      `json:"max_uses"`
+	Uses        int64      `json:"uses"`
+	PreApproved bool       `json:"pre_approved"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	RevokedAt   *time.Time `json:"revoked_at"`
+	CreatedBy   string     `json:"created_by_user_id"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+type InvitesResponse struct {
+	Invites []InviteResponse `json:"invites"`
+}
+
+func newInviteResponse(invite database.InviteCode) InviteResponse {
+	resp := InviteResponse{
+		ID:          invite.ID,
+		Code:        invite.Code,
+		MaxUses:     invite.MaxUses,
+		Uses:        invite.Uses,
+		PreApproved: invite.PreApproved,
+		CreatedBy:   invite.CreatedByUserID,
+		CreatedAt:   invite.CreatedAt,
+	}
+	if invite.Name.Valid {
+		resp.Name = &invite.Name.String
+	}
+	if invite.ExpiresAt.Valid {
+		resp.ExpiresAt = &invite.ExpiresAt.Time
+	}
+	if invite.RevokedAt.Valid {
+		resp.RevokedAt = &invite.RevokedAt.Time
+	}
+	return resp
+}
+
+// HandleCreateInvite creates an invite code. Invites are single-use and never
+// expire unless max_uses and expires_in_hours say otherwise.
+func (h *Handler) HandleCreateInvite(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserIDFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req CreateInviteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidBody, "Invalid request body")
+		return
+	}
+
+	if req.MaxUses < 0 || req.ExpiresInHours < 0 {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "max_uses and expires_in_hours must not be negative")
+		return
+	}
+	if req.MaxUses == 0 {
+		req.MaxUses = 1
+	}
+
+	code, err := newInviteCode()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to generate invite code", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to create invite")
+		return
+	}
+
+	params := database.CreateInviteCodeParams{
+		ID:              uuid.New().String(),
+		Code:            code,
+		Name:            sql.NullString{String: req.Name, Valid: req.Name != ""},
+		MaxUses:         req.MaxUses,
+		PreApproved:     req.PreApproved,
+		CreatedByUserID: userID,
+	}
+	if req.ExpiresInHours > 0 {
+		params.ExpiresAt = sql.NullTime{Time: time.Now().UTC().Add(time.Duration(req.ExpiresInHours) * time.Hour), Valid: true}
+	}
+
+	invite, err := h.queries.CreateInviteCode(r.Context(), params)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to create invite code", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to create invite")
+		return
+	}
+
+	slog.InfoContext(r.Context(), "invite created", "max_uses", invite.MaxUses, "pre_approved", invite.PreApproved)
+	h.audit.Record(r, audit.Event{
+		Action:      audit.ActionInviteCreated,
+		ActorUserID: userID,
+		TargetType:  audit.TargetInvite,
+		TargetID:    invite.ID,
+		Detail:      map[string]any{"max_uses": invite.MaxUses, "pre_approved": invite.PreApproved},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newInviteResponse(invite))
+}
+
+// HandleListInvites returns every invite, newest first, including used and revoked ones.
+func (h *Handler) HandleListInvites(w http.ResponseWriter, r *http.Request) {
+	invites, err := h.queries.ListInviteCodes(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to list invite codes", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to list invites")
+		return
+	}
+
+	resp := InvitesResponse{
+		Invites: make([]InviteResponse, 0, len(invites)),
+	}
+	for _, invite := range invites {
+		resp.Invites = append(resp.Invites, newInviteResponse(invite))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// HandleRevokeInvite stops an invite from being redeemed again.
+func (h *Handler) HandleRevokeInvite(w http.ResponseWriter, r *http.Request) {
+	invite, err := h.queries.GetInviteCodeByID(r.Context(), r.PathValue("id"))
+	if err == sql.ErrNoRows {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeInviteNotFound, "Invite not found")
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get invite code", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Internal server error")
+		return
+	}
+
+	if err := h.queries.RevokeInviteCode(r.Context(), invite.ID); err != nil {
+		slog.ErrorContext(r.Context(), "failed to revoke invite code", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to revoke invite")
+		return
+	}
+
+	slog.InfoContext(r.Context(), "invite revoked", "invite_id", invite.ID)
+	actorID, _ := GetUserIDFromContext(r.Context())
+	h.audit.Record(r, audit.Event{
+		Action:      audit.ActionInviteRevoked,
+		ActorUserID: actorID,
+		TargetType:  audit.TargetInvite,
+		TargetID:    invite.ID,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -16,15 +16,20 @@ var (
 // Claims contains the JWT token payload with user identity.
 type Claims struct {
 	UserID string `json:"user_id"`
+	// Generation is the user's token generation when the token was issued.
+	// Revoking the user's sessions moves them to the next generation.
+	Generation int64 `json:"gen,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// GenerateToken creates a JWT token valid for 30 days.
-func GenerateToken(userID string, secretKey string) *jwt.Token {
+// GenerateToken creates a JWT token valid for 30 days in the given token
+// generation.
+func GenerateToken(userID string, generation int64, secretKey string) *jwt.Token {
 	expirationTime := time.Now().Add(30 * 24 * time.Hour)
 
 	claims := &Claims{
-		UserID: userID,
+		UserID:     userID,
+		Generation: generation,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -2,11 +2,18 @@ package auth
 
 import (
 	"context"
-	"encoding/json"
+	"database/sql"
 	"errors"
 	"log/slog"
 	"net/http"
 	"strings"
+	"time"
+
+	"github.com/alecdray/waffle-talkie/internal/apierror"
+	"github.com/alecdray/waffle-talkie/internal/audit"
+	"github.com/alecdray/waffle-talkie/internal/database"
+	"github.com/alecdray/waffle-talkie/internal/logging"
+	"github.com/alecdray/waffle-talkie/internal/users"
 )
 
 type contextKey string
@@ -15,19 +22,26 @@ const (
 	UserIDKey contextKey = "user_id"
 )
 
-// IsAuthenticatedMiddleware extracts and validates the Bearer token, then adds user context.
-func IsAuthenticatedMiddleware(next http.Handler, secretKey string) http.Handler {
+// lastActiveInterval limits how often a user's last_active is written, so
+// busy clients do not turn every request into a database write.
+const lastActiveInterval = time.Minute
+
+// IsAuthenticatedMiddleware extracts and validates the Bearer token, rejects it
+// if the user no longer exists or their sessions were revoked after it was
+// issued or they are suspended, records the user as active, then adds user
+// context.
+func IsAuthenticatedMiddleware(next http.Handler, secretKey string, queries *database.Queries, auditLog *audit.Logger) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
-			http.Error(w, "Authorization header required", http.StatusUnauthorized)
+			apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authorization header required")
 			return
 		}
 
 		// Extract token from "Bearer <token>"
 		parts := strings.Split(authHeader, " ")
 		if len(parts) != 2 || parts[0] != "Bearer" {
-			http.Error(w, "Invalid authorization header format", http.StatusUnauthorized)
+			apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid authorization header format")
 			return
 		}
 
@@ -36,18 +50,48 @@ func IsAuthenticatedMiddleware(next http.Handler, secretKey string) http.Handler
 		// Validate token
 		claims, err := ValidateToken(token, secretKey)
 		if err != nil {
-			slog.Error("token validation failed", "error", err)
-			w.WriteHeader(http.StatusUnauthorized)
+			slog.WarnContext(r.Context(), "token validation failed", "error", err)
 			if errors.Is(err, ErrTokenExpired) {
-				json.NewEncoder(w).Encode(map[string]string{"error": ErrTokenExpired.Error()})
+				apierror.Write(w, http.StatusUnauthorized, apierror.CodeTokenExpired, "Token expired")
 			} else {
-				json.NewEncoder(w).Encode(map[string]string{"error": ErrTokenInvalid.Error()})
+				apierror.Write(w, http.StatusUnauthorized, apierror.CodeTokenInvalid, "Invalid token")
 			}
 			return
 		}
 
+		user, err := queries.GetUser(r.Context(), claims.UserID)
+		if err == sql.ErrNoRows {
+			slog.WarnContext(r.Context(), "token for unknown user", "user_id", claims.UserID)
+			apierror.Write(w, http.StatusUnauthorized, apierror.CodeTokenInvalid, "Invalid token")
+			return
+		} else if err != nil {
+			slog.ErrorContext(r.Context(), "failed to get user", "error", err)
+			apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Internal server error")
+			return
+		}
+
+		if claims.Generation != user.TokenGeneration {
+			slog.WarnContext(r.Context(), "revoked token used", "user_id", claims.UserID)
+			apierror.Write(w, http.StatusUnauthorized, apierror.CodeTokenRevoked, "Token revoked, log in again")
+			return
+		}
+
+		if users.UserStatus(user.Status) == users.UserStatusSuspended {
+			slog.WarnContext(r.Context(), "suspended user rejected", "user_id", claims.UserID)
+			apierror.Write(w, http.StatusForbidden, apierror.CodeUserSuspended, "User is suspended")
+			return
+		}
+
+		reactivate(r, queries, auditLog, user)
+		if !user.LastActive.Valid || time.Since(user.LastActive.Time) >= lastActiveInterval {
+			if err := queries.UpdateUserLastActive(r.Context(), user.ID); err != nil {
+				slog.ErrorContext(r.Context(), "failed to update last active", "error", err)
+			}
+		}
+
 		// Add claims to context
 		ctx := context.WithValue(r.Context(), UserIDKey, claims.UserID)
+		logging.AddAttrs(ctx, slog.String("user_id", claims.UserID))
 
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
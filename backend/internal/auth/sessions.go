@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/alecdray/waffle-talkie/internal/apierror"
+	"github.com/alecdray/waffle-talkie/internal/audit"
+)
+
+type RevokeSessionsResponse struct {
+	Message string `json:"message"`
+}
+
+// HandleRevokeSessions invalidates every token issued to a user so far. The
+// user can log in again from a registered device.
+func (h *Handler) HandleRevokeSessions(w http.ResponseWriter, r *http.Request) {
+	userID := r.PathValue("id")
+
+	if _, err := h.queries.GetUser(r.Context(), userID); err == sql.ErrNoRows {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeUserNotFound, "User not found")
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get user", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Internal server error")
+		return
+	}
+
+	if err := h.queries.RevokeUserSessions(r.Context(), userID); err != nil {
+		slog.ErrorContext(r.Context(), "failed to revoke sessions", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to revoke sessions")
+		return
+	}
+
+	slog.InfoContext(r.Context(), "sessions revoked", "target_user_id", userID)
+	actorID, _ := GetUserIDFromContext(r.Context())
+	h.audit.Record(r, audit.Event{
+		Action:      audit.ActionUserSessionsRevoked,
+		ActorUserID: actorID,
+		TargetType:  audit.TargetUser,
+		TargetID:    userID,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RevokeSessionsResponse{
+		Message: "Sessions revoked",
+	})
+}
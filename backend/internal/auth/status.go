@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/alecdray/waffle-talkie/internal/apierror"
+	"github.com/alecdray/waffle-talkie/internal/audit"
+	"github.com/alecdray/waffle-talkie/internal/database"
+	"github.com/alecdray/waffle-talkie/internal/users"
+)
+
+type SetStatusRequest struct {
+	Status users.UserStatus `json:"status"`
+}
+
+type SetStatusResponse struct {
+	ID     string           `json:"id"`
+	Status users.UserStatus `json:"status"`
+}
+
+// HandleSetStatus suspends a user or restores them to active. Inactive is
+// managed by the inactivity task and cannot be set directly.
+func (h *Handler) HandleSetStatus(w http.ResponseWriter, r *http.Request) {
+	userID := r.PathValue("id")
+
+	var req SetStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidBody, "Invalid request body")
+		return
+	}
+	if req.Status != users.UserStatusActive && req.Status != users.UserStatusSuspended {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "status must be active or suspended")
+		return
+	}
+
+	actorID, _ := GetUserIDFromContext(r.Context())
+	if userID == actorID && req.Status == users.UserStatusSuspended {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Admins cannot suspend themselves")
+		return
+	}
+
+	user, err := h.queries.GetUser(r.Context(), userID)
+	if err == sql.ErrNoRows {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeUserNotFound, "User not found")
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get user", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Internal server error")
+		return
+	}
+
+	updated, err := h.queries.SetUserStatus(r.Context(), database.SetUserStatusParams{
+		ID:     userID,
+		Status: string(req.Status),
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to set user status", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to set user status")
+		return
+	}
+
+	if user.Status != updated.Status {
+		slog.InfoContext(r.Context(), "user status changed", "target_user_id", userID, "from", user.Status, "to", updated.Status)
+		h.audit.Record(r, audit.Event{
+			Action:      audit.ActionUserStatusChanged,
+			ActorUserID: actorID,
+			TargetType:  audit.TargetUser,
+			TargetID:    userID,
+			Detail:      map[string]any{"from": user.Status, "to": updated.Status},
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SetStatusResponse{
+		ID:     updated.ID,
+		Status: users.UserStatus(updated.Status),
+	})
+}
+
+// reactivate marks an inactive user active again now that they are back.
+func reactivate(r *http.Request, queries *database.Queries, auditLog *audit.Logger, user database.User) {
+	if users.UserStatus(user.Status) != users.UserStatusInactive {
+		return
+	}
+
+	reactivated, err := queries.ReactivateUser(r.Context(), user.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to reactivate user", "error", err)
+		return
+	}
+	if reactivated > 0 {
+		slog.InfoContext(r.Context(), "user reactivated", "target_user_id", user.ID)
+		auditLog.Record(r, audit.Event{
+			Action:      audit.ActionUserReactivated,
+			ActorUserID: user.ID,
+			TargetType:  audit.TargetUser,
+			TargetID:    user.ID,
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/alecdray/waffle-talkie/internal/audit"
+	"github.com/alecdray/waffle-talkie/internal/database"
+)
+
+type TaskManager struct {
+	queries        *database.Queries
+	pendingUserTTL time.Duration
+	audit          *audit.Logger
+}
+
+// NewTaskManager creates the auth background tasks. A zero pendingUserTTL
+// keeps unapproved registrations forever.
+func NewTaskManager(queries *database.Queries, pendingUserTTL time.Duration, auditLog *audit.Logger) *TaskManager {
+	return &TaskManager{
+		queries:        queries,
+		pendingUserTTL: pendingUserTTL,
+		audit:          auditLog,
+	}
+}
+
+func (tm *TaskManager) Start(ctx context.Context) error {
+	if tm.pendingUserTTL <= 0 {
+		return nil
+	}
+
+	slog.Info("starting auth tasks", "pending_user_ttl", tm.pendingUserTTL)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Hour):
+				if err := tm.ExpirePendingUsers(ctx); err != nil {
+					slog.Error("failed to expire pending users", "error", err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// ExpirePendingUsers deletes registrations that have waited for approval
+// longer than the TTL, freeing room under the pending-user cap.
+func (tm *TaskManager) ExpirePendingUsers(ctx context.Context) error {
+	cutoff := time.Now().UTC().Add(-tm.pendingUserTTL)
+	deleted, err := tm.queries.DeleteStalePendingUsers(ctx, cutoff)
+	if err != nil {
+		return fmt.Errorf("failed to delete stale pending users: %w", err)
+	}
+	if deleted > 0 {
+		slog.Info("expired pending users", "count", deleted)
+		tm.audit.RecordContext(ctx, audit.Event{
+			Action: audit.ActionPendingUsersExpired,
+			Detail: map[string]any{"count": deleted},
+		})
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+package compilation
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/alecdray/waffle-talkie/internal/audio"
+)
+
+// Chapter is a run of messages from one sender in a compilation.
+type Chapter struct {
+	Title        string
+	SenderUserID string
+	StartMs      int64
+	EndMs        int64
+	MessageCount int
+}
+
+// Encoder produces the file served for a compilation.
+type Encoder interface {
+	// Encode encodes the 16-bit PCM WAV file at src, marking chapters, to
+	// base plus an extension. src is consumed: it is removed or becomes the
+	// result.
+	Encode(ctx context.Context, src string, chapters []Chapter, base string) (audio.Rendition, error)
+}
+
+// NewEncoder returns an FFmpegEncoder using the ffmpeg binary at path, or a
+// WAVEncoder when path is empty or not executable.
+func NewEncoder(path string) Encoder {
+	if path == "" {
+		return WAVEncoder{}
+	}
+	if _, err := exec.LookPath(path); err != nil {
+		slog.Warn("ffmpeg not found, serving compilations as WAV", "path", path, "error", err)
+		return WAVEncoder{}
+	}
+	return FFmpegEncoder{Path: path}
+}
+
+// WAVEncoder serves compilations as WAV, marking chapters with cue points
+// labelled with their titles, which needs no external tools.
+type WAVEncoder struct{}
+
+func (WAVEncoder) Encode(ctx context.Context, src string, chapters []Chapter, base string) (audio.Rendition, error) {
+	if err := appendCues(src, chapters); err != nil {
+		os.Remove(src)
+		return audio.Rendition{}, fmt.Errorf("failed to write chapters: %w", err)
+	}
+	dst := base + ".wav"
+	if err := os.Rename(src, dst); err != nil {
+		os.Remove(src)
+		return audio.Rendition{}, fmt.Errorf("failed to store compilation: %w", err)
+	}
+	return audio.Rendition{Path: dst, ContentType: "audio/wav"}, nil
+}
+
+// appendCues adds a cue chunk with a point at the start of each chapter, and
+// an associated data list labelling each point, to the WAV file at path.
+func appendCues(path string, chapters []Chapter) error {
+	if len(chapters) == 0 {
+		return nil
+	}
+	var cue, labels bytes.Buffer
+	binary.Write(&cue, binary.LittleEndian, uint32(len(chapters)))
+	labels.WriteString("adtl")
+	for i, chapter := range chapters {
+		id := uint32(i + 1)
+		frame := uint32(chapter.StartMs * sampleRate / 1000)
+		// ID, position, chunk, chunk start, block start, sample offset.
+		for _, v := range []any{id, frame, [4]byte{'d', 'a', 't', 'a'}, uint32(0), uint32(0), frame} {
+			binary.Write(&cue, binary.LittleEndian, v)
+		}
+		text := append([]byte(chapter.Title), 0)
+		labels.WriteString("labl")
+		binary.Write(&labels, binary.LittleEndian, []uint32{uint32(4 + len(text)), id})
+		labels.Write(text)
+		if len(text)%2 == 1 {
+			labels.WriteByte(0)
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	end, err := f.Seek(0, 2)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, chunk := range []struct {
+		id   string
+		body []byte
+	}{{"cue ", cue.Bytes()}, {"LIST", labels.Bytes()}} {
+		w.WriteString(chunk.id)
+		binary.Write(w, binary.LittleEndian, uint32(len(chunk.body)))
+		w.Write(chunk.body)
+		end += 8 + int64(len(chunk.body))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	// The RIFF size covers everything after itself.
+	if _, err := f.Seek(4, 0); err != nil {
+		return err
+	}
+	return binary.Write(f, binary.LittleEndian, uint32(end-8))
+}
+
+// FFmpegEncoder encodes compilations as mono AAC in MP4 with chapters, which
+// podcast apps show and skip between.
+type FFmpegEncoder struct {
+	// Path is the ffmpeg binary.
+	Path string
+	// Bitrate is the AAC bitrate; empty means 32k, plenty for speech.
+	Bitrate string
+}
+
+func (e FFmpegEncoder) Encode(ctx context.Context, src string, chapters []Chapter, base string) (audio.Rendition, error) {
+	defer os.Remove(src)
+	bitrate := e.Bitrate
+	if bitrate == "" {
+		bitrate = "32k"
+	}
+
+	metadata := base + ".ffmetadata"
+	if err := os.WriteFile(metadata, []byte(ffmetadata(chapters)), 0644); err != nil {
+		return audio.Rendition{}, fmt.Errorf("failed to write chapters: %w", err)
+	}
+	defer os.Remove(metadata)
+
+	dst := base + ".m4a"
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, e.Path,
+		"-nostdin", "-hide_banner", "-loglevel", "error", "-y",
+		"-i", src, "-i", metadata,
+		"-map", "0:a", "-map_metadata", "1", "-map_chapters", "1",
+		"-ac", "1", "-c:a", "aac", "-b:a", bitrate,
+		"-movflags", "+faststart", "-f", "mp4",
+		dst,
+	)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		os.Remove(dst)
+		return audio.Rendition{}, fmt.Errorf("ffmpeg failed: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return audio.Rendition{Path: dst, ContentType: "audio/mp4"}, nil
+}
+
+// ffmetadata describes chapters in ffmpeg's metadata file format.
+func ffmetadata(chapters []Chapter) string {
+	escape := strings.NewReplacer(`\`, `\\`, "=", `\=`, ";", `\;`, "#", `\#`, "\n", "\\\n")
+	var b strings.Builder
+	b.WriteString(";FFMETADATA1\n")
+	for _, chapter := range chapters {
+		fmt.Fprintf(&b, "[CHAPTER]\nTIMEBASE=1/1000\nSTART=%d\nEND=%d\ntitle=%s\n",
+			chapter.StartMs, chapter.EndMs, escape.Replace(chapter.Title))
+	}
+	return b.String()
+}
+
+// wavWriter streams mono 16-bit PCM to a WAV file, so a compilation is never
+// held in memory whole.
+type wavWriter struct {
+	f      *os.File
+	w      *bufio.Writer
+	frames int64
+}
+
+// wavHeaderSize is the length of the header written by createWAV, which ends
+// with the data chunk's size.
+const wavHeaderSize = 44
+
+func createWAV(path string) (*wavWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	ww := &wavWriter{f: f, w: bufio.NewWriter(f)}
+	// Sizes are filled in by close.
+	header := []any{
+		[4]byte{'R', 'I', 'F', 'F'}, uint32(0), [4]byte{'W', 'A', 'V', 'E'},
+		[4]byte{'f', 'm', 't', ' '}, uint32(16),
+		uint16(1), uint16(1), uint32(sampleRate), uint32(sampleRate * 2), uint16(2), uint16(16),
+		[4]byte{'d', 'a', 't', 'a'}, uint32(0),
+	}
+	for _, v := range header {
+		if err := binary.Write(ww.w, binary.LittleEndian, v); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return ww, nil
+}
+
+func (ww *wavWriter) write(samples []float32) error {
+	buf := make([]byte, 2)
+	for _, s := range samples {
+		v := math.Round(math.Max(-1, math.Min(1, float64(s))) * math.MaxInt16)
+		binary.LittleEndian.PutUint16(buf, uint16(int16(v)))
+		if _, err := ww.w.Write(buf); err != nil {
+			return err
+		}
+	}
+	ww.frames += int64(len(samples))
+	return nil
+}
+
+func (ww *wavWriter) silence(frames int) error {
+	if _, err := ww.w.Write(make([]byte, 2*frames)); err != nil {
+		return err
+	}
+	ww.frames += int64(frames)
+	return nil
+}
+
+// durationMs returns the length of the audio written so far.
+func (ww *wavWriter) durationMs() int64 {
+	return ww.frames * 1000 / sampleRate
+}
+
+func (ww *wavWriter) close() error {
+	if err := ww.w.Flush(); err != nil {
+		ww.f.Close()
+		return err
+	}
+	dataSize := uint32(ww.frames * 2)
+	for _, field := range []struct {
+		offset int64
+		value  uint32
+	}{{4, wavHeaderSize - 8 + dataSize}, {wavHeaderSize - 4, dataSize}} {
+		if _, err := ww.f.Seek(field.offset, 0); err != nil {
+			ww.f.Close()
+			return err
+		}
+		if err := binary.Write(ww.f, binary.LittleEndian, field.value); err != nil {
+			ww.f.Close()
+			return err
+		}
+	}
+	return ww.f.Close()
+}
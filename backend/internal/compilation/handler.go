@@ -0,0 +1,160 @@
+package compilation
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/alecdray/waffle-talkie/internal/apierror"
+	"github.com/alecdray/waffle-talkie/internal/database"
+)
+
+// Handler serves compilations.
+type Handler struct {
+	queries *database.Queries
+}
+
+func NewHandler(queries *database.Queries) *Handler {
+	return &Handler{queries: queries}
+}
+
+func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /v1/compilations", h.HandleListCompilations)
+	mux.HandleFunc("GET /v1/compilations/{week}", h.HandleGetCompilation)
+	mux.HandleFunc("GET /v1/compilations/{week}/audio", h.HandleDownload)
+}
+
+type ChapterResponse struct {
+	// Title is the sender's name when the compilation was built.
+	Title        string `json:"title"`
+	SenderUserID string `json:"sender_user_id"`
+	StartMs      int64  `json:"start_ms"`
+	EndMs        int64  `json:"end_ms"`
+	MessageCount int64  `json:"message_count"`
+}
+
+type Compilation struct {
+	Week string `json:"week"`
+	// StartsAt and EndsAt bound when the messages were sent.
+	StartsAt     time.Time         `json:"starts_at"`
+	EndsAt       time.Time         `json:"ends_at"`
+	DurationMs   int64             `json:"duration_ms"`
+	MessageCount int64             `json:"message_count"`
+	ContentType  string            `json:"content_type"`
+	CreatedAt    time.Time         `json:"created_at"`
+	Chapters     []ChapterResponse `json:"chapters"`
+}
+
+type CompilationsResponse struct {
+	Compilations []Compilation `json:"compilations"`
+}
+
+// HandleListCompilations returns the compilations of finished weeks, newest
+// first.
+func (h *Handler) HandleListCompilations(w http.ResponseWriter, r *http.Request) {
+	compilations, err := h.queries.ListCompilations(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to list compilations", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve compilations")
+		return
+	}
+
+	resp := CompilationsResponse{Compilations: make([]Compilation, 0, len(compilations))}
+	for _, compilation := range compilations {
+		c, err := h.compilation(r.Context(), compilation)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to list chapters", "week", compilation.Week, "error", err)
+			apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve compilations")
+			return
+		}
+		resp.Compilations = append(resp.Compilations, c)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// HandleGetCompilation returns a week's compilation and its chapters.
+func (h *Handler) HandleGetCompilation(w http.ResponseWriter, r *http.Request) {
+	compilation, ok := h.get(w, r)
+	if !ok {
+		return
+	}
+	resp, err := h.compilation(r.Context(), compilation)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to list chapters", "week", compilation.Week, "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve compilation")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// HandleDownload serves a week's compilation audio, with support for Range
+// requests.
+func (h *Handler) HandleDownload(w http.ResponseWriter, r *http.Request) {
+	compilation, ok := h.get(w, r)
+	if !ok {
+		return
+	}
+	if _, err := os.Stat(compilation.FilePath); os.IsNotExist(err) {
+		slog.ErrorContext(r.Context(), "compilation file not found", "path", compilation.FilePath)
+		apierror.Write(w, http.StatusNotFound, apierror.CodeAudioFileNotFound, "Audio file not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", compilation.ContentType)
+	http.ServeFile(w, r, compilation.FilePath)
+}
+
+// get loads the compilation of the week named in the path.
+func (h *Handler) get(w http.ResponseWriter, r *http.Request) (database.Compilation, bool) {
+	week, err := ParseWeek(r.PathValue("week"))
+	if err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error())
+		return database.Compilation{}, false
+	}
+	compilation, err := h.queries.GetCompilation(r.Context(), week.Format(weekLayout))
+	if err == sql.ErrNoRows {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeCompilationNotFound, "No compilation for this week")
+		return database.Compilation{}, false
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get compilation", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve compilation")
+		return database.Compilation{}, false
+	}
+	return compilation, true
+}
+
+func (h *Handler) compilation(ctx context.Context, compilation database.Compilation) (Compilation, error) {
+	chapters, err := h.queries.ListCompilationChapters(ctx, compilation.Week)
+	if err != nil {
+		return Compilation{}, err
+	}
+	week, _ := time.Parse(weekLayout, compilation.Week)
+	resp := Compilation{
+		Week:         compilation.Week,
+		StartsAt:     week,
+		EndsAt:       week.AddDate(0, 0, 7),
+		DurationMs:   compilation.DurationMs,
+		MessageCount: compilation.MessageCount,
+		ContentType:  compilation.ContentType,
+		CreatedAt:    compilation.CreatedAt,
+		Chapters:     make([]ChapterResponse, 0, len(chapters)),
+	}
+	for _, chapter := range chapters {
+		resp.Chapters = append(resp.Chapters, ChapterResponse{
+			Title:        chapter.Title,
+			SenderUserID: chapter.SenderUserID,
+			StartMs:      chapter.StartMs,
+			EndMs:        chapter.EndMs,
+			MessageCount: chapter.MessageCount,
+		})
+	}
+	return resp, nil
+}
@@ -0,0 +1,296 @@
+package compilation
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/alecdray/waffle-talkie/internal/audio"
+	"github.com/alecdray/waffle-talkie/internal/database"
+	"github.com/alecdray/waffle-talkie/internal/jobs"
+)
+
+// Clips and compilations are mono at this rate, plenty for speech.
+const sampleRate = 16000
+
+// gap is the silence between messages.
+const gap = time.Second
+
+// ClipStep is an optional step that keeps a decoded copy of the message, run
+// through filters like the playback rendition, for its week's compilation.
+// The copy outlives the message's own files, until the compilation expires
+// or the message is unsent.
+func ClipStep(queries *database.Queries, decoders []audio.Decoder, filters []audio.Filter, directory string) audio.Step {
+	return audio.Step{
+		Name: "compile",
+		Run: func(ctx context.Context, message database.AudioMessage) error {
+			pcm, err := audio.Decode(ctx, message.FilePath, decoders)
+			if errors.Is(err, audio.ErrUnsupportedFormat) {
+				// No retry will make the file decodable.
+				return jobs.Permanent(err)
+			} else if err != nil {
+				return err
+			}
+			for _, filter := range filters {
+				pcm = filter(pcm)
+			}
+			pcm = audio.Resample(audio.Mono(pcm), sampleRate)
+
+			path := filepath.Join(directory, "clips", message.ID+".wav")
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return fmt.Errorf("failed to create clip directory: %w", err)
+			}
+			if err := audio.WriteWAV(path, pcm); err != nil {
+				return err
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				return fmt.Errorf("failed to measure clip: %w", err)
+			}
+			return queries.UpsertCompilationClip(ctx, database.UpsertCompilationClipParams{
+				AudioMessageID: message.ID,
+				SenderUserID:   message.SenderUserID,
+				Week:           WeekOf(message.CreatedAt).Format(weekLayout),
+				CreatedAt:      message.CreatedAt,
+				FilePath:       path,
+				Size:           info.Size(),
+				DurationMs:     pcm.Duration().Milliseconds(),
+			})
+		},
+	}
+}
+
+type TaskManager struct {
+	queries   *database.Queries
+	encoder   Encoder
+	directory string
+	weeks     int
+}
+
+// NewTaskManager returns the task that builds compilations with encoder into
+// directory, keeping the last weeks finished weeks.
+func NewTaskManager(queries *database.Queries, encoder Encoder, directory string, weeks int) *TaskManager {
+	return &TaskManager{
+		queries:   queries,
+		encoder:   encoder,
+		directory: directory,
+		weeks:     weeks,
+	}
+}
+
+func (tm *TaskManager) Start(ctx context.Context) error {
+	slog.Info("starting compilation tasks")
+	if err := os.MkdirAll(tm.directory, 0755); err != nil {
+		return fmt.Errorf("failed to create compilation directory: %w", err)
+	}
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Minute):
+				if err := tm.Compile(ctx); err != nil {
+					slog.Error("failed to build compilations", "error", err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// Compile removes the clips of expired weeks and of unsent or deleted
+// messages, then builds the compilation of every finished week whose clips
+// have changed since it was last built, and removes those left without any.
+func (tm *TaskManager) Compile(ctx context.Context) error {
+	current := WeekOf(time.Now())
+	oldest := current.AddDate(0, 0, -7*tm.weeks)
+
+	stale, err := tm.queries.ListStaleCompilationClips(ctx, oldest.Format(weekLayout))
+	if err != nil {
+		return fmt.Errorf("failed to list stale clips: %w", err)
+	}
+	for _, clip := range stale {
+		if err := os.Remove(clip.FilePath); err != nil && !os.IsNotExist(err) {
+			slog.ErrorContext(ctx, "failed to remove clip", "message_id", clip.AudioMessageID, "error", err)
+			continue
+		}
+		if err := tm.queries.DeleteCompilationClip(ctx, clip.AudioMessageID); err != nil {
+			slog.ErrorContext(ctx, "failed to delete clip", "message_id", clip.AudioMessageID, "error", err)
+		}
+	}
+
+	weeks, err := tm.queries.ListCompilationWeeks(ctx, current.Format(weekLayout))
+	if err != nil {
+		return fmt.Errorf("failed to list weeks: %w", err)
+	}
+	for _, week := range weeks {
+		if err := tm.compile(ctx, week); err != nil {
+			slog.ErrorContext(ctx, "failed to build compilation", "week", week, "error", err)
+		}
+	}
+	return nil
+}
+
+// compile rebuilds the compilation of week if its clips have changed.
+func (tm *TaskManager) compile(ctx context.Context, week string) error {
+	clips, err := tm.queries.ListCompilationClips(ctx, week)
+	if err != nil {
+		return fmt.Errorf("failed to list clips: %w", err)
+	}
+	existing, err := tm.queries.GetCompilation(ctx, week)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to get compilation: %w", err)
+	}
+	built := err == nil
+	fingerprint := fingerprintClips(clips)
+	if built && existing.Clips == fingerprint {
+		return nil
+	}
+
+	if len(clips) == 0 {
+		if !built {
+			return nil
+		}
+		if err := tm.remove(ctx, existing); err != nil {
+			return err
+		}
+		slog.InfoContext(ctx, "compilation removed", "week", week)
+		return nil
+	}
+
+	src := filepath.Join(tm.directory, week+".tmp.wav")
+	chapters, err := stitch(ctx, src, clips)
+	if err != nil {
+		os.Remove(src)
+		return err
+	}
+	rendition, err := tm.encoder.Encode(ctx, src, chapters, filepath.Join(tm.directory, week+"-"+fingerprint[:12]))
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(rendition.Path)
+	if err != nil {
+		return fmt.Errorf("failed to measure compilation: %w", err)
+	}
+
+	// The compilation row is written last, so it is only served once all
+	// its chapters are.
+	if built {
+		if err := tm.queries.DeleteCompilation(ctx, week); err != nil {
+			return fmt.Errorf("failed to delete compilation: %w", err)
+		}
+	}
+	if err := tm.queries.DeleteCompilationChapters(ctx, week); err != nil {
+		return fmt.Errorf("failed to delete chapters: %w", err)
+	}
+	messageCount := 0
+	for i, chapter := range chapters {
+		messageCount += chapter.MessageCount
+		if err := tm.queries.CreateCompilationChapter(ctx, database.CreateCompilationChapterParams{
+			Week:         week,
+			Position:     int64(i),
+			SenderUserID: chapter.SenderUserID,
+			Title:        chapter.Title,
+			StartMs:      chapter.StartMs,
+			EndMs:        chapter.EndMs,
+			MessageCount: int64(chapter.MessageCount),
+		}); err != nil {
+			return fmt.Errorf("failed to store chapter: %w", err)
+		}
+	}
+	if err := tm.queries.CreateCompilation(ctx, database.CreateCompilationParams{
+		Week:         week,
+		FilePath:     rendition.Path,
+		Size:         info.Size(),
+		ContentType:  rendition.ContentType,
+		DurationMs:   chapters[len(chapters)-1].EndMs,
+		MessageCount: int64(messageCount),
+		Clips:        fingerprint,
+	}); err != nil {
+		return fmt.Errorf("failed to store compilation: %w", err)
+	}
+	if built && existing.FilePath != rendition.Path {
+		if err := os.Remove(existing.FilePath); err != nil && !os.IsNotExist(err) {
+			slog.ErrorContext(ctx, "failed to remove old compilation", "week", week, "error", err)
+		}
+	}
+	slog.InfoContext(ctx, "compilation built", "week", week, "messages", messageCount)
+	return nil
+}
+
+// remove deletes a compilation and its file.
+func (tm *TaskManager) remove(ctx context.Context, compilation database.Compilation) error {
+	if err := tm.queries.DeleteCompilation(ctx, compilation.Week); err != nil {
+		return fmt.Errorf("failed to delete compilation: %w", err)
+	}
+	if err := tm.queries.DeleteCompilationChapters(ctx, compilation.Week); err != nil {
+		return fmt.Errorf("failed to delete chapters: %w", err)
+	}
+	if err := os.Remove(compilation.FilePath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove compilation file: %w", err)
+	}
+	return nil
+}
+
+// stitch writes clips to a WAV file at path in order, with a gap between
+// each, and returns a chapter for each run of clips from the same sender.
+// Each chapter lasts until the next begins.
+func stitch(ctx context.Context, path string, clips []database.ListCompilationClipsRow) ([]Chapter, error) {
+	ww, err := createWAV(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create compilation: %w", err)
+	}
+	var chapters []Chapter
+	for i, clip := range clips {
+		pcm, err := audio.WAVDecoder{}.Decode(ctx, clip.FilePath)
+		if err != nil {
+			ww.close()
+			return nil, fmt.Errorf("failed to decode clip of message %s: %w", clip.AudioMessageID, err)
+		}
+		pcm = audio.Resample(audio.Mono(pcm), sampleRate)
+
+		if i > 0 {
+			if err := ww.silence(int(gap.Seconds() * sampleRate)); err != nil {
+				ww.close()
+				return nil, fmt.Errorf("failed to write compilation: %w", err)
+			}
+		}
+		if n := len(chapters); n == 0 || chapters[n-1].SenderUserID != clip.SenderUserID {
+			if n > 0 {
+				chapters[n-1].EndMs = ww.durationMs()
+			}
+			title := clip.SenderName.String
+			if title == "" {
+				title = "Unknown sender"
+			}
+			chapters = append(chapters, Chapter{Title: title, SenderUserID: clip.SenderUserID, StartMs: ww.durationMs()})
+		}
+		chapters[len(chapters)-1].MessageCount++
+		if err := ww.write(pcm.Samples); err != nil {
+			ww.close()
+			return nil, fmt.Errorf("failed to write compilation: %w", err)
+		}
+	}
+	chapters[len(chapters)-1].EndMs = ww.durationMs()
+	if err := ww.close(); err != nil {
+		return nil, fmt.Errorf("failed to write compilation: %w", err)
+	}
+	return chapters, nil
+}
+
+// fingerprintClips identifies what a compilation is built from, including
+// sender names, which title its chapters.
+func fingerprintClips(clips []database.ListCompilationClipsRow) string {
+	hash := sha256.New()
+	for _, clip := range clips {
+		fmt.Fprintf(hash, "%s\x00%s\x00%d\x00%s\n", clip.AudioMessageID, clip.FilePath, clip.DurationMs, clip.SenderName.String)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,258 @@
+package compilation
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alecdray/waffle-talkie/internal/audio"
+	"github.com/alecdray/waffle-talkie/internal/database"
+)
+
+// writeClip writes seconds of quiet tone as a clip and returns its path.
+func writeClip(t *testing.T, dir, name string, seconds int) string {
+	t.Helper()
+	pcm := audio.PCM{SampleRate: sampleRate, Channels: 1, Samples: make([]float32, seconds*sampleRate)}
+	for i := range pcm.Samples {
+		pcm.Samples[i] = 0.1
+	}
+	path := filepath.Join(dir, name+".wav")
+	if err := audio.WriteWAV(path, pcm); err != nil {
+		t.Fatalf("failed to write clip: %v", err)
+	}
+	return path
+}
+
+func TestStitchChapters(t *testing.T) {
+	dir := t.TempDir()
+	clip := func(id, sender, name string, seconds int) database.ListCompilationClipsRow {
+		return database.ListCompilationClipsRow{
+			AudioMessageID: id,
+			SenderUserID:   sender,
+			FilePath:       writeClip(t, dir, id, seconds),
+			DurationMs:     int64(seconds) * 1000,
+			SenderName:     sql.NullString{String: name, Valid: name != ""},
+		}
+	}
+
+	// Consecutive messages from a sender share a chapter, which runs until
+	// the next begins, gaps included. Deleted senders have no name.
+	chapters, err := stitch(context.Background(), filepath.Join(dir, "out.wav"), []database.ListCompilationClipsRow{
+		clip("a1", "alice", "Alice", 1),
+		clip("a2", "alice", "Alice", 2),
+		clip("b1", "bob", "Bob", 1),
+		clip("g1", "gone", "", 1),
+		clip("a3", "alice", "Alice", 1),
+	})
+	if err != nil {
+		t.Fatalf("failed to stitch: %v", err)
+	}
+	want := []Chapter{
+		{Title: "Alice", SenderUserID: "alice", StartMs: 0, EndMs: 5000, MessageCount: 2},
+		{Title: "Bob", SenderUserID: "bob", StartMs: 5000, EndMs: 7000, MessageCount: 1},
+		{Title: "Unknown sender", SenderUserID: "gone", StartMs: 7000, EndMs: 9000, MessageCount: 1},
+		{Title: "Alice", SenderUserID: "alice", StartMs: 9000, EndMs: 10000, MessageCount: 1},
+	}
+	if !slices.Equal(chapters, want) {
+		t.Errorf("expected %+v, got %+v", want, chapters)
+	}
+
+	pcm, err := audio.WAVDecoder{}.Decode(context.Background(), filepath.Join(dir, "out.wav"))
+	if err != nil || pcm.Duration() != 10*time.Second {
+		t.Errorf("expected 10s of audio, got %v (%v)", pcm.Duration(), err)
+	}
+}
+
+func TestNewEncoder(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		path string
+		want Encoder
+	}{
+		{name: "unset", path: "", want: WAVEncoder{}},
+		{name: "missing binary", path: filepath.Join(t.TempDir(), "ffmpeg"), want: WAVEncoder{}},
+		{name: "executable", path: "sh", want: FFmpegEncoder{Path: "sh"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := NewEncoder(tc.path); got != tc.want {
+				t.Errorf("expected %#v, got %#v", tc.want, got)
+			}
+		})
+	}
+}
+
+// compileFixture is a database with two users, and a task keeping 4 weeks of
+// compilations.
+type compileFixture struct {
+	t       *testing.T
+	sqlDB   *sql.DB
+	queries *database.Queries
+	dir     string
+	tasks   *TaskManager
+	// week is the latest finished week.
+	week time.Time
+}
+
+func newCompileFixture(t *testing.T) *compileFixture {
+	t.Helper()
+	dir := t.TempDir()
+	sqlDB, queries, err := database.InitDB(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("failed to init database: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	for _, user := range []database.CreateUserParams{
+		{ID: "alice", Name: "Alice", DeviceIDHash: "alice", Approved: true},
+		{ID: "bob", Name: "Bob", DeviceIDHash: "bob", Approved: true},
+	} {
+		if _, err := queries.CreateUser(context.Background(), user); err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+	}
+	return &compileFixture{
+		t:       t,
+		sqlDB:   sqlDB,
+		queries: queries,
+		dir:     dir,
+		tasks:   NewTaskManager(queries, WAVEncoder{}, dir, 4),
+		week:    WeekOf(time.Now()).AddDate(0, 0, -7),
+	}
+}
+
+// send stores a message from sender with a one second clip in week.
+func (f *compileFixture) send(id, sender string, week time.Time) string {
+	f.t.Helper()
+	ctx := context.Background()
+	if _, err := f.queries.CreateAudioMessage(ctx, database.CreateAudioMessageParams{
+		ID: id, SenderUserID: sender, FilePath: filepath.Join(f.dir, id+".m4a"), Duration: 1, ProcessingStatus: "ready",
+	}); err != nil {
+		f.t.Fatalf("failed to create message: %v", err)
+	}
+	path := writeClip(f.t, f.dir, id, 1)
+	if err := f.queries.UpsertCompilationClip(ctx, database.UpsertCompilationClipParams{
+		AudioMessageID: id,
+		SenderUserID:   sender,
+		Week:           week.Format(weekLayout),
+		CreatedAt:      week.Add(time.Hour),
+		FilePath:       path,
+		DurationMs:     1000,
+	}); err != nil {
+		f.t.Fatalf("failed to store clip: %v", err)
+	}
+	return path
+}
+
+func (f *compileFixture) exec(query string, args ...any) {
+	f.t.Helper()
+	if _, err := f.sqlDB.Exec(query, args...); err != nil {
+		f.t.Fatal(err)
+	}
+}
+
+func (f *compileFixture) compile() {
+	f.t.Helper()
+	if err := f.tasks.Compile(context.Background()); err != nil {
+		f.t.Fatalf("failed to build compilations: %v", err)
+	}
+}
+
+// compiled returns the message count of each week's compilation.
+func (f *compileFixture) compiled() map[string]int64 {
+	f.t.Helper()
+	compilations, err := f.queries.ListCompilations(context.Background())
+	if err != nil {
+		f.t.Fatalf("failed to list compilations: %v", err)
+	}
+	counts := make(map[string]int64, len(compilations))
+	for _, c := range compilations {
+		counts[c.Week] = c.MessageCount
+	}
+	return counts
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestCompileRetention(t *testing.T) {
+	f := newCompileFixture(t)
+	weeksAgo := func(n int) time.Time { return WeekOf(time.Now()).AddDate(0, 0, -7*n) }
+	current := f.send("current", "alice", weeksAgo(0))
+	lastKept := f.send("last-kept", "alice", weeksAgo(4))
+	expired := f.send("expired", "bob", weeksAgo(5))
+
+	// Week five was built while it was still kept.
+	f.tasks.weeks = 5
+	f.compile()
+	if got := f.compiled(); len(got) != 2 || got[weeksAgo(5).Format(weekLayout)] != 1 {
+		t.Fatalf("expected weeks four and five compiled, got %v", got)
+	}
+	old, err := f.queries.GetCompilation(context.Background(), weeksAgo(5).Format(weekLayout))
+	if err != nil {
+		t.Fatalf("failed to get compilation: %v", err)
+	}
+
+	// Keeping four weeks, the fifth is removed with its clips, and the
+	// current week is not built until it ends.
+	f.tasks.weeks = 4
+	f.compile()
+	if got := f.compiled(); len(got) != 1 || got[weeksAgo(4).Format(weekLayout)] != 1 {
+		t.Errorf("expected only week four compiled, got %v", got)
+	}
+	if exists(expired) || exists(old.FilePath) {
+		t.Error("expected the expired week's clip and compilation removed")
+	}
+	if !exists(current) || !exists(lastKept) {
+		t.Error("expected the clips of kept weeks left alone")
+	}
+}
+
+func TestCompileRemovesClipsOfGoneMessages(t *testing.T) {
+	f := newCompileFixture(t)
+	kept := f.send("kept", "alice", f.week)
+	cleanedUp := f.send("cleaned-up", "alice", f.week)
+	unsent := f.send("unsent", "bob", f.week)
+	deleted := f.send("deleted", "bob", f.week)
+	week := f.week.Format(weekLayout)
+
+	// Clips outlive messages cleaned up once heard, which is what they are
+	// kept for, but not messages deleted outright.
+	f.exec("UPDATE audio_messages SET deleted_at = CURRENT_TIMESTAMP WHERE id = 'cleaned-up'")
+	f.exec("DELETE FROM audio_messages WHERE id = 'deleted'")
+	// An unsent message is left out at once, but its clip is kept while the
+	// unsend can be undone.
+	f.exec("UPDATE audio_messages SET deleted_at = CURRENT_TIMESTAMP, deleted_by_user_id = 'bob' WHERE id = 'unsent'")
+	f.compile()
+	if got := f.compiled(); got[week] != 2 {
+		t.Errorf("expected two messages compiled, got %v", got)
+	}
+	if exists(deleted) || !exists(kept) || !exists(cleanedUp) || !exists(unsent) {
+		t.Errorf("expected only the deleted message's clip removed")
+	}
+
+	// Once purged, the unsent message's clip goes too.
+	f.exec("UPDATE audio_messages SET purged_at = CURRENT_TIMESTAMP WHERE id = 'unsent'")
+	f.compile()
+	if exists(unsent) {
+		t.Error("expected the purged message's clip removed")
+	}
+	var clips int
+	if err := f.sqlDB.QueryRow("SELECT COUNT(*) FROM compilation_clips").Scan(&clips); err != nil {
+		t.Fatal(err)
+	}
+	if clips != 2 {
+		t.Errorf("expected 2 clips left, got %d", clips)
+	}
+
+	// A week left without clips loses its compilation.
+	f.exec("DELETE FROM audio_messages")
+	f.compile()
+	if got := f.compiled(); len(got) != 0 {
+		t.Errorf("expected the empty week's compilation removed, got %v", got)
+	}
+}
@@ -0,0 +1,29 @@
+// Package compilation stitches each week's messages into a single episode,
+// built once the week is over: "Waffle Wednesday".
+package compilation
+
+import (
+	"errors"
+	"time"
+)
+
+// Weeks run from Wednesday 00:00 UTC and are named by that date.
+const weekLayout = "2006-01-02"
+
+var errInvalidWeek = errors.New("week must be the date of a Wednesday, as YYYY-MM-DD")
+
+// WeekOf returns the start of the week t falls in.
+func WeekOf(t time.Time) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return day.AddDate(0, 0, -(int(day.Weekday())-int(time.Wednesday)+7)%7)
+}
+
+// ParseWeek returns the start of the week named s.
+func ParseWeek(s string) (time.Time, error) {
+	week, err := time.Parse(weekLayout, s)
+	if err != nil || week.Weekday() != time.Wednesday {
+		return time.Time{}, errInvalidWeek
+	}
+	return week, nil
+}
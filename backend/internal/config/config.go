@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -35,13 +37,89 @@ const (
 )
 
 type config struct {
-	Env            Env
-	Port           string
-	DatabasePath   string
-	JWTSecret      string
-	AudioDirectory string
+	Env             Env
+	Port            string
+	DatabasePath    string
+	JWTSecret       string
+	AudioDirectory  string
+	AvatarDirectory string
+	MetricsAddress  string
+	LogFormat       string
+	LogLevel        string
+
+	AuthRateLimitPerMinute int
+	AuthRateLimitBurst     int
+	APIRateLimitPerMinute  int
+	APIRateLimitBurst      int
+	// EmailRateLimit* and FeedRateLimit* limit the links opened from emails
+	// and podcast apps, per client IP.
+	EmailRateLimitPerMinute int
+	EmailRateLimitBurst     int
+	FeedRateLimitPerMinute  int
+	FeedRateLimitBurst      int
+	TrustedProxies          []string
+
+	RegistrationMode    RegistrationMode
+	MaxPendingUsers     int
+	PendingUserTTLHours int
+	InactivityDays      int
+
+	AuditRetentionDays int
+
+	// SMTPAddress is the host:port of the relay used for email; empty disables email.
+	SMTPAddress  string
+	SMTPUsername string
+	SMTPPassword string
+	EmailFrom    string
+	// PublicURL is the address clients reach the server at, used in email links.
+	PublicURL string
+
+	// NotifyWebhookURL receives a POST for every alert about a new or unsent
+	// message; empty disables alerts, leaving digests and feeds.
+	NotifyWebhookURL string
+
+	// FFmpegPath is the ffmpeg binary used to decode compressed audio and
+	// transcode uploads for playback; empty limits decoding to WAV and serves
+	// uploads as recorded.
+	FFmpegPath string
+	// AudioTargetLUFS is the loudness uploads are normalized to for playback;
+	// zero disables normalization.
+	AudioTargetLUFS int
+	// AudioTrimSilence trims leading and trailing silence for playback.
+	AudioTrimSilence bool
+	// WhisperPath is the whisper.cpp binary used to transcribe uploads, with
+	// the model at WhisperModel; either empty disables transcripts.
+	WhisperPath  string
+	WhisperModel string
+	// WhisperLanguage is the language spoken in uploads; empty detects it.
+	WhisperLanguage string
+
+	// UnsendUndoSeconds is how long an unsent message can be restored before
+	// its files are removed; zero removes them straight away.
+	UnsendUndoSeconds int
+	// CompilationWeeks is how many finished weeks of compilations are kept;
+	// zero disables compilations.
+	CompilationWeeks int
+
+	// UserQuotaMB and UserQuotaMinutes cap each user's stored audio, and
+	// InstanceQuotaMB and InstanceQuotaMinutes the server's; zero is unlimited.
+	UserQuotaMB          int
+	UserQuotaMinutes     int
+	InstanceQuotaMB      int
+	InstanceQuotaMinutes int
+	// MinFreeDiskMB is the free disk space below which uploads are rejected;
+	// zero disables the check.
+	MinFreeDiskMB int
 }
 
+// RegistrationMode selects whether registration requires an invite code.
+type RegistrationMode string
+
+const (
+	RegistrationOpen   RegistrationMode = "open"
+	RegistrationInvite RegistrationMode = "invite"
+)
+
 func NewConfig() *config {
 	env := Env(getEnvWithDefault("ENV", "local"))
 
@@ -66,11 +144,57 @@ func NewConfig() *config {
 	}
 
 	return &config{
-		Env:            env,
-		Port:           getEnvWithDefault("PORT", "8080"),
-		DatabasePath:   getEnvWithDefault("DATABASE_PATH", "./tmp/waffle-talkie.db"),
-		AudioDirectory: getEnvWithDefault("AUDIO_DIRECTORY", "./tmp/audio"),
-		JWTSecret:      *jwtSecret,
+		Env:             env,
+		Port:            getEnvWithDefault("PORT", "8080"),
+		DatabasePath:    getEnvWithDefault("DATABASE_PATH", "./tmp/waffle-talkie.db"),
+		AudioDirectory:  getEnvWithDefault("AUDIO_DIRECTORY", "./tmp/audio"),
+		AvatarDirectory: getEnvWithDefault("AVATAR_DIRECTORY", "./tmp/avatars"),
+		JWTSecret:       *jwtSecret,
+		MetricsAddress:  getEnvWithDefault("METRICS_ADDRESS", ""),
+		LogFormat:       getEnvWithDefault("LOG_FORMAT", "text"),
+		LogLevel:        getEnvWithDefault("LOG_LEVEL", "info"),
+
+		AuthRateLimitPerMinute:  getIntEnvWithDefault("RATE_LIMIT_AUTH_PER_MINUTE", 10),
+		AuthRateLimitBurst:      getIntEnvWithDefault("RATE_LIMIT_AUTH_BURST", 5),
+		APIRateLimitPerMinute:   getIntEnvWithDefault("RATE_LIMIT_API_PER_MINUTE", 300),
+		APIRateLimitBurst:       getIntEnvWithDefault("RATE_LIMIT_API_BURST", 60),
+		EmailRateLimitPerMinute: getIntEnvWithDefault("RATE_LIMIT_EMAIL_PER_MINUTE", 30),
+		EmailRateLimitBurst:     getIntEnvWithDefault("RATE_LIMIT_EMAIL_BURST", 10),
+		FeedRateLimitPerMinute:  getIntEnvWithDefault("RATE_LIMIT_FEED_PER_MINUTE", 120),
+		FeedRateLimitBurst:      getIntEnvWithDefault("RATE_LIMIT_FEED_BURST", 30),
+		TrustedProxies:          getListEnv("TRUSTED_PROXIES"),
+
+		RegistrationMode:    getRegistrationMode(),
+		MaxPendingUsers:     getIntEnvWithDefault("MAX_PENDING_USERS", 20),
+		PendingUserTTLHours: getIntEnvWithDefault("PENDING_USER_TTL_HOURS", 168),
+		InactivityDays:      getIntEnvWithDefault("INACTIVITY_THRESHOLD_DAYS", 30),
+
+		AuditRetentionDays: getIntEnvWithDefault("AUDIT_RETENTION_DAYS", 365),
+
+		SMTPAddress:  getEnvWithDefault("SMTP_ADDRESS", ""),
+		SMTPUsername: getEnvWithDefault("SMTP_USERNAME", ""),
+		SMTPPassword: getEnvWithDefault("SMTP_PASSWORD", ""),
+		EmailFrom:    getEnvWithDefault("EMAIL_FROM", "Waffle Talkie <waffle-talkie@localhost>"),
+		PublicURL:    getEnvWithDefault("PUBLIC_URL", "http://localhost:8080"),
+
+		NotifyWebhookURL: getEnvWithDefault("NOTIFY_WEBHOOK_URL", ""),
+
+		FFmpegPath:       getEnvWithDefault("FFMPEG_PATH", ""),
+		AudioTargetLUFS:  getIntEnvWithDefault("AUDIO_TARGET_LUFS", 0),
+		AudioTrimSilence: getBoolEnvWithDefault("AUDIO_TRIM_SILENCE", false),
+
+		WhisperPath:     getEnvWithDefault("WHISPER_PATH", ""),
+		WhisperModel:    getEnvWithDefault("WHISPER_MODEL", ""),
+		WhisperLanguage: getEnvWithDefault("WHISPER_LANGUAGE", ""),
+
+		UnsendUndoSeconds: getIntEnvWithDefault("UNSEND_UNDO_SECONDS", 30),
+		CompilationWeeks:  getIntEnvWithDefault("COMPILATION_WEEKS", 0),
+
+		UserQuotaMB:          getIntEnvWithDefault("USER_QUOTA_MB", 0),
+		UserQuotaMinutes:     getIntEnvWithDefault("USER_QUOTA_MINUTES", 0),
+		InstanceQuotaMB:      getIntEnvWithDefault("INSTANCE_QUOTA_MB", 0),
+		InstanceQuotaMinutes: getIntEnvWithDefault("INSTANCE_QUOTA_MINUTES", 0),
+		MinFreeDiskMB:        getIntEnvWithDefault("MIN_FREE_DISK_MB", 0),
 	}
 }
 
@@ -99,6 +223,56 @@ func getEnvWithDefault(key string, defaultValue string) string {
 	return *value
 }
 
+func getIntEnvWithDefault(key string, defaultValue int) int {
+	value := getOptionalEnv(key)
+	if value == nil {
+		return defaultValue
+	}
+	parsed, err := strconv.Atoi(*value)
+	if err != nil {
+		slog.Error("environment variable is not an integer", "key", key, "error", err)
+		panic(fmt.Sprintf("environment variable %s is not an integer", key))
+	}
+	return parsed
+}
+
+func getBoolEnvWithDefault(key string, defaultValue bool) bool {
+	value := getOptionalEnv(key)
+	if value == nil {
+		return defaultValue
+	}
+	parsed, err := strconv.ParseBool(*value)
+	if err != nil {
+		slog.Error("environment variable is not a boolean", "key", key, "error", err)
+		panic(fmt.Sprintf("environment variable %s is not a boolean", key))
+	}
+	return parsed
+}
+
+// getListEnv splits a comma-separated environment variable, dropping empty items.
+func getListEnv(key string) []string {
+	value := getOptionalEnv(key)
+	if value == nil {
+		return nil
+	}
+	var items []string
+	for _, item := range strings.Split(*value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func getRegistrationMode() RegistrationMode {
+	mode := RegistrationMode(getEnvWithDefault("REGISTRATION_MODE", string(RegistrationOpen)))
+	if mode != RegistrationOpen && mode != RegistrationInvite {
+		slog.Error("invalid registration mode", "mode", mode)
+		panic(fmt.Sprintf("REGISTRATION_MODE must be %q or %q", RegistrationOpen, RegistrationInvite))
+	}
+	return mode
+}
+
 func getSecretFromFile(path string) (string, error) {
 	content, err := os.ReadFile(path)
 	if err != nil {
@@ -7,19 +7,59 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 )
 
+const countAudioMessagesBySenderSince = `-- name: CountAudioMessagesBySenderSince :many
+SELECT sender_user_id, COUNT(*) AS message_count FROM audio_messages
+WHERE created_at >= ?
+GROUP BY sender_user_id
+`
+
+type CountAudioMessagesBySenderSinceRow struct {
+	SenderUserID string `json:"sender_user_id"`
+	MessageCount int64  `json:"message_count"`
+}
+
+func (q *Queries) CountAudioMessagesBySenderSince(ctx context.Context, createdAt time.Time) ([]CountAudioMessagesBySenderSinceRow, error) {
+	rows, err := q.db.QueryContext(ctx, countAudioMessagesBySenderSince, createdAt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []CountAudioMessagesBySenderSinceRow{}
+	for rows.Next() {
+		var i CountAudioMessagesBySenderSinceRow
+		if err := rows.Scan(&i.SenderUserID, &i.MessageCount); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const createAudioMessage = `-- name: CreateAudioMessage :one
-INSERT INTO audio_messages (id, sender_user_id, file_path, duration)
-VALUES (?, ?, ?, ?)
-RETURNING id, sender_user_id, file_path, duration, created_at, deleted_at
+INSERT INTO audio_messages (id, sender_user_id, file_path, size, duration, processing_status, title, caption)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+RETURNING id, sender_user_id, file_path, duration, created_at, deleted_at, peaks, processing_status, playback_path, playback_content_type, title, caption, edited_at, deleted_by_user_id, purged_at, size
 `
 
 type CreateAudioMessageParams struct {
-	ID           string `json:"id"`
-	SenderUserID string `json:"sender_user_id"`
-	FilePath     string `json:"file_path"`
-	Duration     int64  `json:"duration"`
+	ID               string         `json:"id"`
+	SenderUserID     string         `json:"sender_user_id"`
+	FilePath         string         `json:"file_path"`
+	Size             int64          `json:"size"`
+	Duration         int64          `json:"duration"`
+	ProcessingStatus string         `json:"processing_status"`
+	Title            sql.NullString `json:"title"`
+	Caption          sql.NullString `json:"caption"`
 }
 
 func (q *Queries) CreateAudioMessage(ctx context.Context, arg CreateAudioMessageParams) (AudioMessage, error) {
@@ -27,7 +67,11 @@ func (q *Queries) CreateAudioMessage(ctx context.Context, arg CreateAudioMessage
 		arg.ID,
 		arg.SenderUserID,
 		arg.FilePath,
+		arg.Size,
 		arg.Duration,
+		arg.ProcessingStatus,
+		arg.Title,
+		arg.Caption,
 	)
 	var i AudioMessage
 	err := row.Scan(
@@ -37,6 +81,16 @@ func (q *Queries) CreateAudioMessage(ctx context.Context, arg CreateAudioMessage
 		&i.Duration,
 		&i.CreatedAt,
 		&i.DeletedAt,
+		&i.Peaks,
+		&i.ProcessingStatus,
+		&i.PlaybackPath,
+		&i.PlaybackContentType,
+		&i.Title,
+		&i.Caption,
+		&i.EditedAt,
+		&i.DeletedByUserID,
+		&i.PurgedAt,
+		&i.Size,
 	)
 	return i, err
 }
@@ -51,8 +105,18 @@ func (q *Queries) DeleteAudioMessage(ctx context.Context, id string) error {
 	return err
 }
 
+const deleteAudioMessagesBySender = `-- name: DeleteAudioMessagesBySender :exec
+DELETE FROM audio_messages
+WHERE sender_user_id = ?
+`
+
+func (q *Queries) DeleteAudioMessagesBySender(ctx context.Context, senderUserID string) error {
+	_, err := q.db.ExecContext(ctx, deleteAudioMessagesBySender, senderUserID)
+	return err
+}
+
 const getActiveAudioMessages = `-- name: GetActiveAudioMessages :many
-SELECT id, sender_user_id, file_path, duration, created_at, deleted_at FROM audio_messages
+SELECT id, sender_user_id, file_path, duration, created_at, deleted_at, peaks, processing_status, playback_path, playback_content_type, title, caption, edited_at, deleted_by_user_id, purged_at, size FROM audio_messages
 WHERE deleted_at IS NULL
   AND (
     -- Not older than 7 days
@@ -77,6 +141,16 @@ func (q *Queries) GetActiveAudioMessages(ctx context.Context) ([]AudioMessage, e
 			&i.Duration,
 			&i.CreatedAt,
 			&i.DeletedAt,
+			&i.Peaks,
+			&i.ProcessingStatus,
+			&i.PlaybackPath,
+			&i.PlaybackContentType,
+			&i.Title,
+			&i.Caption,
+			&i.EditedAt,
+			&i.DeletedByUserID,
+			&i.PurgedAt,
+			&i.Size,
 		); err != nil {
 			return nil, err
 		}
@@ -92,7 +166,7 @@ func (q *Queries) GetActiveAudioMessages(ctx context.Context) ([]AudioMessage, e
 }
 
 const getAudioMessage = `-- name: GetAudioMessage :one
-SELECT id, sender_user_id, file_path, duration, created_at, deleted_at FROM audio_messages
+SELECT id, sender_user_id, file_path, duration, created_at, deleted_at, peaks, processing_status, playback_path, playback_content_type, title, caption, edited_at, deleted_by_user_id, purged_at, size FROM audio_messages
 WHERE id = ? AND deleted_at IS NULL
 `
 
@@ -106,27 +180,87 @@ func (q *Queries) GetAudioMessage(ctx context.Context, id string) (AudioMessage,
 		&i.Duration,
 		&i.CreatedAt,
 		&i.DeletedAt,
+		&i.Peaks,
+		&i.ProcessingStatus,
+		&i.PlaybackPath,
+		&i.PlaybackContentType,
+		&i.Title,
+		&i.Caption,
+		&i.EditedAt,
+		&i.DeletedByUserID,
+		&i.PurgedAt,
+		&i.Size,
 	)
 	return i, err
 }
 
+const getAudioMessageWithDeleted = `-- name: GetAudioMessageWithDeleted :one
+SELECT id, sender_user_id, file_path, duration, created_at, deleted_at, peaks, processing_status, playback_path, playback_content_type, title, caption, edited_at, deleted_by_user_id, purged_at, size FROM audio_messages
+WHERE id = ?
+`
+
+func (q *Queries) GetAudioMessageWithDeleted(ctx context.Context, id string) (AudioMessage, error) {
+	row := q.db.QueryRowContext(ctx, getAudioMessageWithDeleted, id)
+	var i AudioMessage
+	err := row.Scan(
+		&i.ID,
+		&i.SenderUserID,
+		&i.FilePath,
+		&i.Duration,
+		&i.CreatedAt,
+		&i.DeletedAt,
+		&i.Peaks,
+		&i.ProcessingStatus,
+		&i.PlaybackPath,
+		&i.PlaybackContentType,
+		&i.Title,
+		&i.Caption,
+		&i.EditedAt,
+		&i.DeletedByUserID,
+		&i.PurgedAt,
+		&i.Size,
+	)
+	return i, err
+}
+
+const getInstanceStorageUsage = `-- name: GetInstanceStorageUsage :one
+SELECT CAST(COALESCE(SUM(duration), 0) AS INTEGER) AS seconds,
+    COUNT(*) AS messages
+FROM audio_messages
+WHERE deleted_at IS NULL OR (deleted_by_user_id IS NOT NULL AND purged_at IS NULL)
+`
+
+type GetInstanceStorageUsageRow struct {
+	Seconds  int64 `json:"seconds"`
+	Messages int64 `json:"messages"`
+}
+
+func (q *Queries) GetInstanceStorageUsage(ctx context.Context) (GetInstanceStorageUsageRow, error) {
+	row := q.db.QueryRowContext(ctx, getInstanceStorageUsage)
+	var i GetInstanceStorageUsageRow
+	err := row.Scan(&i.Seconds, &i.Messages)
+	return i, err
+}
+
 const getOldOrFullyReceivedMessages = `-- name: GetOldOrFullyReceivedMessages :many
-SELECT am.id, am.sender_user_id, am.file_path, am.duration, am.created_at, am.deleted_at
+SELECT am.id, am.sender_user_id, am.file_path, am.duration, am.created_at, am.deleted_at, am.peaks, am.processing_status, am.playback_path, am.playback_content_type, am.title, am.caption, am.edited_at, am.deleted_by_user_id, am.purged_at, am.size
 FROM audio_messages am
 WHERE am.deleted_at IS NULL
   AND (
     -- Older than 7 days
     am.created_at <= datetime('now', '-7 days')
     OR
-    -- All approved users have received it
-    (
-      SELECT COUNT(DISTINCT u.id)
+    -- Every approved, active user has received it
+    NOT EXISTS (
+      SELECT 1
       FROM users u
       WHERE u.approved = TRUE
-    ) = (
-      SELECT COUNT(*)
-      FROM audio_message_receipts amr
-      WHERE amr.audio_message_id = am.id
+        AND u.status = 'active'
+        AND NOT EXISTS (
+          SELECT 1
+          FROM audio_message_receipts amr
+          WHERE amr.audio_message_id = am.id AND amr.user_id = u.id
+        )
     )
   )
 `
@@ -147,6 +281,16 @@ func (q *Queries) GetOldOrFullyReceivedMessages(ctx context.Context) ([]AudioMes
 			&i.Duration,
 			&i.CreatedAt,
 			&i.DeletedAt,
+			&i.Peaks,
+			&i.ProcessingStatus,
+			&i.PlaybackPath,
+			&i.PlaybackContentType,
+			&i.Title,
+			&i.Caption,
+			&i.EditedAt,
+			&i.DeletedByUserID,
+			&i.PurgedAt,
+			&i.Size,
 		); err != nil {
 			return nil, err
 		}
@@ -161,8 +305,76 @@ func (q *Queries) GetOldOrFullyReceivedMessages(ctx context.Context) ([]AudioMes
 	return items, nil
 }
 
+const getStoredBytes = `-- name: GetStoredBytes :one
+SELECT bytes FROM storage_usage
+WHERE id = 1
+`
+
+func (q *Queries) GetStoredBytes(ctx context.Context) (int64, error) {
+	row := q.db.QueryRowContext(ctx, getStoredBytes)
+	var bytes int64
+	err := row.Scan(&bytes)
+	return bytes, err
+}
+
+const getUserStorageUsage = `-- name: GetUserStorageUsage :one
+SELECT CAST(COALESCE(SUM(size), 0) AS INTEGER) AS bytes,
+    CAST(COALESCE(SUM(duration), 0) AS INTEGER) AS seconds,
+    COUNT(*) AS messages
+FROM audio_messages
+WHERE sender_user_id = ?1
+  AND (deleted_at IS NULL OR (deleted_by_user_id IS NOT NULL AND purged_at IS NULL))
+`
+
+type GetUserStorageUsageRow struct {
+	Bytes    int64 `json:"bytes"`
+	Seconds  int64 `json:"seconds"`
+	Messages int64 `json:"messages"`
+}
+
+func (q *Queries) GetUserStorageUsage(ctx context.Context, senderUserID string) (GetUserStorageUsageRow, error) {
+	row := q.db.QueryRowContext(ctx, getUserStorageUsage, senderUserID)
+	var i GetUserStorageUsageRow
+	err := row.Scan(&i.Bytes, &i.Seconds, &i.Messages)
+	return i, err
+}
+
+const listAudioFilePathsBySender = `-- name: ListAudioFilePathsBySender :many
+SELECT file_path FROM audio_messages
+WHERE sender_user_id = ?1
+  -- Unsent messages keep their files until purged
+  AND (deleted_at IS NULL OR (deleted_by_user_id IS NOT NULL AND purged_at IS NULL))
+UNION
+SELECT playback_path FROM audio_messages
+WHERE sender_user_id = ?1 AND playback_path IS NOT NULL
+  AND (deleted_at IS NULL OR (deleted_by_user_id IS NOT NULL AND purged_at IS NULL))
+`
+
+func (q *Queries) ListAudioFilePathsBySender(ctx context.Context, senderUserID string) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, listAudioFilePathsBySender, senderUserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []string{}
+	for rows.Next() {
+		var filePath string
+		if err := rows.Scan(&filePath); err != nil {
+			return nil, err
+		}
+		items = append(items, filePath)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listAudioMessages = `-- name: ListAudioMessages :many
-SELECT id, sender_user_id, file_path, duration, created_at, deleted_at FROM audio_messages
+SELECT id, sender_user_id, file_path, duration, created_at, deleted_at, peaks, processing_status, playback_path, playback_content_type, title, caption, edited_at, deleted_by_user_id, purged_at, size FROM audio_messages
 WHERE deleted_at IS NULL
 ORDER BY created_at DESC
 `
@@ -183,6 +395,16 @@ func (q *Queries) ListAudioMessages(ctx context.Context) ([]AudioMessage, error)
 			&i.Duration,
 			&i.CreatedAt,
 			&i.DeletedAt,
+			&i.Peaks,
+			&i.ProcessingStatus,
+			&i.PlaybackPath,
+			&i.PlaybackContentType,
+			&i.Title,
+			&i.Caption,
+			&i.EditedAt,
+			&i.DeletedByUserID,
+			&i.PurgedAt,
+			&i.Size,
 		); err != nil {
 			return nil, err
 		}
@@ -198,7 +420,7 @@ func (q *Queries) ListAudioMessages(ctx context.Context) ([]AudioMessage, error)
 }
 
 const listAudioMessagesBySender = `-- name: ListAudioMessagesBySender :many
-SELECT id, sender_user_id, file_path, duration, created_at, deleted_at FROM audio_messages
+SELECT id, sender_user_id, file_path, duration, created_at, deleted_at, peaks, processing_status, playback_path, playback_content_type, title, caption, edited_at, deleted_by_user_id, purged_at, size FROM audio_messages
 WHERE sender_user_id = ? AND deleted_at IS NULL
 ORDER BY created_at DESC
 `
@@ -219,6 +441,16 @@ func (q *Queries) ListAudioMessagesBySender(ctx context.Context, senderUserID st
 			&i.Duration,
 			&i.CreatedAt,
 			&i.DeletedAt,
+			&i.Peaks,
+			&i.ProcessingStatus,
+			&i.PlaybackPath,
+			&i.PlaybackContentType,
+			&i.Title,
+			&i.Caption,
+			&i.EditedAt,
+			&i.DeletedByUserID,
+			&i.PurgedAt,
+			&i.Size,
 		); err != nil {
 			return nil, err
 		}
@@ -233,6 +465,215 @@ func (q *Queries) ListAudioMessagesBySender(ctx context.Context, senderUserID st
 	return items, nil
 }
 
+const listRetractedAudioMessageIDs = `-- name: ListRetractedAudioMessageIDs :many
+SELECT id FROM audio_messages
+WHERE deleted_by_user_id IS NOT NULL AND deleted_at > ?1
+  -- Only messages the user could have fetched before they were unsent
+  AND (processing_status = 'ready' OR sender_user_id = ?2)
+ORDER BY deleted_at DESC
+`
+
+type ListRetractedAudioMessageIDsParams struct {
+	Since  sql.NullTime `json:"since"`
+	UserID string       `json:"user_id"`
+}
+
+func (q *Queries) ListRetractedAudioMessageIDs(ctx context.Context, arg ListRetractedAudioMessageIDsParams) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, listRetractedAudioMessageIDs, arg.Since, arg.UserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listStoredAudioFiles = `-- name: ListStoredAudioFiles :many
+SELECT id, sender_user_id, file_path, playback_path, size, duration FROM audio_messages
+-- Messages whose files are still on disk
+WHERE deleted_at IS NULL OR (deleted_by_user_id IS NOT NULL AND purged_at IS NULL)
+ORDER BY created_at
+`
+
+type ListStoredAudioFilesRow struct {
+	ID           string         `json:"id"`
+	SenderUserID string         `json:"sender_user_id"`
+	FilePath     string         `json:"file_path"`
+	PlaybackPath sql.NullString `json:"playback_path"`
+	Size         int64          `json:"size"`
+	Duration     int64          `json:"duration"`
+}
+
+func (q *Queries) ListStoredAudioFiles(ctx context.Context) ([]ListStoredAudioFilesRow, error) {
+	rows, err := q.db.QueryContext(ctx, listStoredAudioFiles)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListStoredAudioFilesRow{}
+	for rows.Next() {
+		var i ListStoredAudioFilesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.SenderUserID,
+			&i.FilePath,
+			&i.PlaybackPath,
+			&i.Size,
+			&i.Duration,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markAudioMessagePurged = `-- name: MarkAudioMessagePurged :execrows
+UPDATE audio_messages
+SET purged_at = ?
+WHERE id = ? AND deleted_at = ? AND purged_at IS NULL
+`
+
+type MarkAudioMessagePurgedParams struct {
+	PurgedAt  sql.NullTime `json:"purged_at"`
+	ID        string       `json:"id"`
+	DeletedAt sql.NullTime `json:"deleted_at"`
+}
+
+func (q *Queries) MarkAudioMessagePurged(ctx context.Context, arg MarkAudioMessagePurgedParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, markAudioMessagePurged, arg.PurgedAt, arg.ID, arg.DeletedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const restoreAudioMessage = `-- name: RestoreAudioMessage :one
+UPDATE audio_messages
+SET deleted_at = NULL, deleted_by_user_id = NULL
+WHERE id = ? AND deleted_by_user_id IS NOT NULL AND purged_at IS NULL AND deleted_at > ?
+RETURNING id, sender_user_id, file_path, duration, created_at, deleted_at, peaks, processing_status, playback_path, playback_content_type, title, caption, edited_at, deleted_by_user_id, purged_at, size
+`
+
+type RestoreAudioMessageParams struct {
+	ID        string       `json:"id"`
+	DeletedAt sql.NullTime `json:"deleted_at"`
+}
+
+func (q *Queries) RestoreAudioMessage(ctx context.Context, arg RestoreAudioMessageParams) (AudioMessage, error) {
+	row := q.db.QueryRowContext(ctx, restoreAudioMessage, arg.ID, arg.DeletedAt)
+	var i AudioMessage
+	err := row.Scan(
+		&i.ID,
+		&i.SenderUserID,
+		&i.FilePath,
+		&i.Duration,
+		&i.CreatedAt,
+		&i.DeletedAt,
+		&i.Peaks,
+		&i.ProcessingStatus,
+		&i.PlaybackPath,
+		&i.PlaybackContentType,
+		&i.Title,
+		&i.Caption,
+		&i.EditedAt,
+		&i.DeletedByUserID,
+		&i.PurgedAt,
+		&i.Size,
+	)
+	return i, err
+}
+
+const setAudioMessageDuration = `-- name: SetAudioMessageDuration :exec
+UPDATE audio_messages
+SET duration = ?
+WHERE id = ?
+`
+
+type SetAudioMessageDurationParams struct {
+	Duration int64  `json:"duration"`
+	ID       string `json:"id"`
+}
+
+func (q *Queries) SetAudioMessageDuration(ctx context.Context, arg SetAudioMessageDurationParams) error {
+	_, err := q.db.ExecContext(ctx, setAudioMessageDuration, arg.Duration, arg.ID)
+	return err
+}
+
+const setAudioMessagePeaks = `-- name: SetAudioMessagePeaks :exec
+UPDATE audio_messages
+SET peaks = ?
+WHERE id = ?
+`
+
+type SetAudioMessagePeaksParams struct {
+	Peaks []byte `json:"peaks"`
+	ID    string `json:"id"`
+}
+
+func (q *Queries) SetAudioMessagePeaks(ctx context.Context, arg SetAudioMessagePeaksParams) error {
+	_, err := q.db.ExecContext(ctx, setAudioMessagePeaks, arg.Peaks, arg.ID)
+	return err
+}
+
+const setAudioMessagePlayback = `-- name: SetAudioMessagePlayback :exec
+UPDATE audio_messages
+SET playback_path = ?, playback_content_type = ?, size = ?
+WHERE id = ?
+`
+
+type SetAudioMessagePlaybackParams struct {
+	PlaybackPath        sql.NullString `json:"playback_path"`
+	PlaybackContentType sql.NullString `json:"playback_content_type"`
+	Size                int64          `json:"size"`
+	ID                  string         `json:"id"`
+}
+
+func (q *Queries) SetAudioMessagePlayback(ctx context.Context, arg SetAudioMessagePlaybackParams) error {
+	_, err := q.db.ExecContext(ctx, setAudioMessagePlayback,
+		arg.PlaybackPath,
+		arg.PlaybackContentType,
+		arg.Size,
+		arg.ID,
+	)
+	return err
+}
+
+const setAudioMessageProcessingStatus = `-- name: SetAudioMessageProcessingStatus :exec
+UPDATE audio_messages
+SET processing_status = ?
+WHERE id = ?
+`
+
+type SetAudioMessageProcessingStatusParams struct {
+	ProcessingStatus string `json:"processing_status"`
+	ID               string `json:"id"`
+}
+
+func (q *Queries) SetAudioMessageProcessingStatus(ctx context.Context, arg SetAudioMessageProcessingStatusParams) error {
+	_, err := q.db.ExecContext(ctx, setAudioMessageProcessingStatus, arg.ProcessingStatus, arg.ID)
+	return err
+}
+
 const softDeleteAudioMessage = `-- name: SoftDeleteAudioMessage :exec
 UPDATE audio_messages
 SET deleted_at = CURRENT_TIMESTAMP
@@ -243,3 +684,83 @@ func (q *Queries) SoftDeleteAudioMessage(ctx context.Context, id string) error {
 	_, err := q.db.ExecContext(ctx, softDeleteAudioMessage, id)
 	return err
 }
+
+const unsendAudioMessage = `-- name: UnsendAudioMessage :one
+UPDATE audio_messages
+SET deleted_at = ?, deleted_by_user_id = ?
+WHERE id = ? AND deleted_at IS NULL
+RETURNING id, sender_user_id, file_path, duration, created_at, deleted_at, peaks, processing_status, playback_path, playback_content_type, title, caption, edited_at, deleted_by_user_id, purged_at, size
+`
+
+type UnsendAudioMessageParams struct {
+	DeletedAt       sql.NullTime   `json:"deleted_at"`
+	DeletedByUserID sql.NullString `json:"deleted_by_user_id"`
+	ID              string         `json:"id"`
+}
+
+func (q *Queries) UnsendAudioMessage(ctx context.Context, arg UnsendAudioMessageParams) (AudioMessage, error) {
+	row := q.db.QueryRowContext(ctx, unsendAudioMessage, arg.DeletedAt, arg.DeletedByUserID, arg.ID)
+	var i AudioMessage
+	err := row.Scan(
+		&i.ID,
+		&i.SenderUserID,
+		&i.FilePath,
+		&i.Duration,
+		&i.CreatedAt,
+		&i.DeletedAt,
+		&i.Peaks,
+		&i.ProcessingStatus,
+		&i.PlaybackPath,
+		&i.PlaybackContentType,
+		&i.Title,
+		&i.Caption,
+		&i.EditedAt,
+		&i.DeletedByUserID,
+		&i.PurgedAt,
+		&i.Size,
+	)
+	return i, err
+}
+
+const updateAudioMessageText = `-- name: UpdateAudioMessageText :one
+UPDATE audio_messages
+SET title = ?, caption = ?, edited_at = ?
+WHERE id = ? AND deleted_at IS NULL
+RETURNING id, sender_user_id, file_path, duration, created_at, deleted_at, peaks, processing_status, playback_path, playback_content_type, title, caption, edited_at, deleted_by_user_id, purged_at, size
+`
+
+type UpdateAudioMessageTextParams struct {
+	Title    sql.NullString `json:"title"`
+	Caption  sql.NullString `json:"caption"`
+	EditedAt sql.NullTime   `json:"edited_at"`
+	ID       string         `json:"id"`
+}
+
+func (q *Queries) UpdateAudioMessageText(ctx context.Context, arg UpdateAudioMessageTextParams) (AudioMessage, error) {
+	row := q.db.QueryRowContext(ctx, updateAudioMessageText,
+		arg.Title,
+		arg.Caption,
+		arg.EditedAt,
+		arg.ID,
+	)
+	var i AudioMessage
+	err := row.Scan(
+		&i.ID,
+		&i.SenderUserID,
+		&i.FilePath,
+		&i.Duration,
+		&i.CreatedAt,
+		&i.DeletedAt,
+		&i.Peaks,
+		&i.ProcessingStatus,
+		&i.PlaybackPath,
+		&i.PlaybackContentType,
+		&i.Title,
+		&i.Caption,
+		&i.EditedAt,
+		&i.DeletedByUserID,
+		&i.PurgedAt,
+		&i.Size,
+	)
+	return i, err
+}
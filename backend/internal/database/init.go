@@ -1,7 +1,9 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"embed"
 	"fmt"
 	"log/slog"
 	"os"
@@ -11,6 +13,9 @@ import (
 	"github.com/pressly/goose/v3"
 )
 
+//go:embed migrations/*.sql
+var migrations embed.FS
+
 // InitDB creates the database file if needed, applies schema, and returns queries.
 func InitDB(dbPath string) (*sql.DB, *Queries, error) {
 	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
@@ -29,7 +34,13 @@ func InitDB(dbPath string) (*sql.DB, *Queries, error) {
 		file.Close()
 	}
 
-	db, err := sql.Open("sqlite3", dbPath)
+	// SQLite allows one writer at a time, and job workers write alongside
+	// request handlers. With a busy timeout, writers wait up to 5 seconds for
+	// each other instead of failing with "database is locked". Immediate
+	// transactions take the write lock as they begin: a transaction that read
+	// first and then tried to write would fail at once if another writer held
+	// the lock, as waiting could deadlock.
+	db, err := sql.Open("sqlite3", dbPath+"?_busy_timeout=5000&_txlock=immediate")
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -38,16 +49,20 @@ func InitDB(dbPath string) (*sql.DB, *Queries, error) {
 		return nil, nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
+	goose.SetBaseFS(migrations)
 	if err := goose.SetDialect("sqlite3"); err != nil {
 		return nil, nil, fmt.Errorf("failed to set goose dialect: %w", err)
 	}
 
-	if err := goose.Up(db, "./internal/database/migrations"); err != nil {
+	if err := goose.Up(db, "migrations"); err != nil {
 		return nil, nil, fmt.Errorf("failed to run migrations: %w", err)
 	}
+	if err := ensureSearchIndex(context.Background(), db); err != nil {
+		return nil, nil, err
+	}
 
 	slog.Info("database initialized successfully", "path", dbPath)
 
-	queries := New(db)
+	queries := New(Instrument(db))
 	return db, queries, nil
 }
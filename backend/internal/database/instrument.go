@@ -0,0 +1,56 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/alecdray/waffle-talkie/internal/metrics"
+)
+
+var queryDuration = metrics.NewHistogram(
+	"waffle_db_query_duration_seconds",
+	"Time spent executing database queries.",
+	metrics.DefaultBuckets,
+	"query",
+)
+
+// instrumentedDB records query latency for every call made through the generated queries.
+type instrumentedDB struct {
+	db DBTX
+}
+
+// Instrument wraps a DBTX so each query's latency is recorded by name.
+func Instrument(db DBTX) DBTX {
+	return &instrumentedDB{db: db}
+}
+
+func (i *instrumentedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	defer queryDuration.ObserveDuration(time.Now(), queryName(query))
+	return i.db.ExecContext(ctx, query, args...)
+}
+
+func (i *instrumentedDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return i.db.PrepareContext(ctx, query)
+}
+
+func (i *instrumentedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	defer queryDuration.ObserveDuration(time.Now(), queryName(query))
+	return i.db.QueryContext(ctx, query, args...)
+}
+
+func (i *instrumentedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	defer queryDuration.ObserveDuration(time.Now(), queryName(query))
+	return i.db.QueryRowContext(ctx, query, args...)
+}
+
+// queryName extracts the sqlc query name from the "-- name: X :kind" header.
+func queryName(query string) string {
+	const prefix = "-- name: "
+	if !strings.HasPrefix(query, prefix) {
+		return "unknown"
+	}
+	name, _, _ := strings.Cut(query[len(prefix):], " ")
+	return name
+}
@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Invite codes let admins control who can register. The code is a credential,
+-- so invites are referred to by ID wherever it would be exposed, such as URLs
+-- and the audit log.
+CREATE TABLE IF NOT EXISTS invite_codes (
+    id TEXT PRIMARY KEY,
+    code TEXT NOT NULL UNIQUE,
+    name TEXT,
+    max_uses INTEGER NOT NULL DEFAULT 1,
+    uses INTEGER NOT NULL DEFAULT 0,
+    pre_approved BOOLEAN NOT NULL DEFAULT FALSE,
+    expires_at DATETIME,
+    revoked_at DATETIME,
+    created_by_user_id TEXT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (created_by_user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_invite_codes_created ON invite_codes(created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS invite_codes;
+-- +goose StatementEnd
@@ -0,0 +1,39 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Append-only record of security-relevant actions
+CREATE TABLE IF NOT EXISTS audit_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    action TEXT NOT NULL,
+    actor_user_id TEXT,
+    target_type TEXT,
+    target_id TEXT,
+    ip TEXT,
+    request_id TEXT,
+    detail TEXT,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_created ON audit_events(created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_events_action ON audit_events(action);
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor ON audit_events(actor_user_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_target ON audit_events(target_id);
+
+-- Events are never edited; rows are only removed by the retention task
+CREATE TRIGGER IF NOT EXISTS audit_events_append_only
+BEFORE UPDATE ON audit_events
+BEGIN
+    SELECT RAISE(ABORT, 'audit_events is append-only');
+END;
+
+-- Tokens carry the generation they were issued in; revoking a user's sessions
+-- moves to the next generation, rejecting every earlier token
+ALTER TABLE users ADD COLUMN token_generation INTEGER NOT NULL DEFAULT 0;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users DROP COLUMN token_generation;
+DROP TRIGGER IF EXISTS audit_events_append_only;
+DROP TABLE IF EXISTS audit_events;
+-- +goose StatementEnd
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users ADD COLUMN timezone TEXT;
+ALTER TABLE users ADD COLUMN status_text TEXT;
+-- Set when an avatar is uploaded; also versions the avatar URL
+ALTER TABLE users ADD COLUMN avatar_updated_at DATETIME;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users DROP COLUMN avatar_updated_at;
+ALTER TABLE users DROP COLUMN status_text;
+ALTER TABLE users DROP COLUMN timezone;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- active: counted as a recipient; inactive: idle past the threshold, reactivated
+-- on their next request; suspended: blocked by an admin
+ALTER TABLE users ADD COLUMN status TEXT NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'inactive', 'suspended'));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users DROP COLUMN status;
+-- +goose StatementEnd
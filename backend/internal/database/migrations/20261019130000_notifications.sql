@@ -0,0 +1,48 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- How each user wants to hear about new messages; users without a row get the defaults
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    user_id TEXT PRIMARY KEY,
+    mode TEXT NOT NULL DEFAULT 'all' CHECK (mode IN ('all', 'digest', 'none')),
+    -- Quiet hours as HH:MM in the user's timezone; both set or both NULL
+    quiet_start TEXT,
+    quiet_end TEXT,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Senders a user does not want to be alerted about
+CREATE TABLE IF NOT EXISTS notification_mutes (
+    user_id TEXT NOT NULL,
+    muted_user_id TEXT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, muted_user_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (muted_user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_mutes_muted ON notification_mutes(muted_user_id);
+
+-- Alerts held back by quiet hours (kind 'deferred') or collected for a digest (kind 'digest')
+CREATE TABLE IF NOT EXISTS pending_notifications (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id TEXT NOT NULL,
+    audio_message_id TEXT NOT NULL,
+    kind TEXT NOT NULL CHECK (kind IN ('deferred', 'digest')),
+    deliver_after DATETIME NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(user_id, audio_message_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (audio_message_id) REFERENCES audio_messages(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_pending_notifications_due ON pending_notifications(kind, deliver_after);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS pending_notifications;
+DROP TABLE IF EXISTS notification_mutes;
+DROP TABLE IF EXISTS notification_preferences;
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Optional email address per user for message digests
+CREATE TABLE IF NOT EXISTS user_emails (
+    user_id TEXT PRIMARY KEY,
+    address TEXT NOT NULL,
+    -- NULL until the user follows the verification link; reset when the address changes
+    verified_at DATETIME,
+    digest TEXT NOT NULL DEFAULT 'daily' CHECK (digest IN ('daily', 'weekly', 'off')),
+    last_digest_at DATETIME,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS user_emails;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Waveform peaks, one byte per bucket scaled so the loudest is 255; NULL until
+-- generated or if the audio could not be decoded
+ALTER TABLE audio_messages ADD COLUMN peaks BLOB;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE audio_messages DROP COLUMN peaks;
+-- +goose StatementEnd
@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Persisted background work; a running job is leased to a worker until
+-- lease_expires_at, after which another worker may claim it again
+CREATE TABLE IF NOT EXISTS jobs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    kind TEXT NOT NULL,
+    -- JSON arguments for the job's handler
+    payload TEXT NOT NULL DEFAULT '{}',
+    state TEXT NOT NULL DEFAULT 'queued' CHECK (state IN ('queued', 'running', 'succeeded', 'failed')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    run_at DATETIME NOT NULL,
+    lease_expires_at DATETIME,
+    last_error TEXT,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished_at DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_run_at ON jobs(state, run_at);
+CREATE INDEX IF NOT EXISTS idx_jobs_lease ON jobs(state, lease_expires_at);
+
+-- Messages are shown to recipients once their required processing is 'ready';
+-- existing messages were stored as uploaded and are ready already
+ALTER TABLE audio_messages ADD COLUMN processing_status TEXT NOT NULL DEFAULT 'ready'
+    CHECK (processing_status IN ('processing', 'ready', 'failed'));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE audio_messages DROP COLUMN processing_status;
+DROP TABLE IF EXISTS jobs;
+-- +goose StatementEnd
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+-- The canonical rendition served for playback; NULL until transcoded, in which
+-- case the original file is served. Passthrough transcoding points it at the
+-- original file itself
+ALTER TABLE audio_messages ADD COLUMN playback_path TEXT;
+ALTER TABLE audio_messages ADD COLUMN playback_content_type TEXT;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE audio_messages DROP COLUMN playback_content_type;
+ALTER TABLE audio_messages DROP COLUMN playback_path;
+-- +goose StatementEnd
@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Speech-to-text of a message's playback audio, one row once it has been
+-- transcribed, even if nothing was said
+CREATE TABLE IF NOT EXISTS transcripts (
+    audio_message_id TEXT PRIMARY KEY,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (audio_message_id) REFERENCES audio_messages(id) ON DELETE CASCADE
+);
+
+-- Timed phrases of a transcript, in order; offsets are milliseconds into the
+-- playback rendition
+CREATE TABLE IF NOT EXISTS transcript_segments (
+    audio_message_id TEXT NOT NULL,
+    position INTEGER NOT NULL,
+    start_ms INTEGER NOT NULL,
+    end_ms INTEGER NOT NULL,
+    text TEXT NOT NULL,
+    PRIMARY KEY (audio_message_id, position),
+    FOREIGN KEY (audio_message_id) REFERENCES audio_messages(id) ON DELETE CASCADE
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS transcript_segments;
+DROP TABLE IF EXISTS transcripts;
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Optional text the sender attaches to a message; edited_at is NULL until the
+-- sender first changes either after uploading
+ALTER TABLE audio_messages ADD COLUMN title TEXT;
+ALTER TABLE audio_messages ADD COLUMN caption TEXT;
+ALTER TABLE audio_messages ADD COLUMN edited_at DATETIME;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE audio_messages DROP COLUMN edited_at;
+ALTER TABLE audio_messages DROP COLUMN caption;
+ALTER TABLE audio_messages DROP COLUMN title;
+-- +goose StatementEnd
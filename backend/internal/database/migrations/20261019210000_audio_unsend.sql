@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Who deleted a message, set only when a user unsent it rather than cleanup
+-- removing it, and when its files were removed, ending the chance to undo
+ALTER TABLE audio_messages ADD COLUMN deleted_by_user_id TEXT;
+ALTER TABLE audio_messages ADD COLUMN purged_at DATETIME;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE audio_messages DROP COLUMN purged_at;
+ALTER TABLE audio_messages DROP COLUMN deleted_by_user_id;
+-- +goose StatementEnd
@@ -0,0 +1,53 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Decoded copies of ready messages, kept for the weekly compilation after the
+-- messages themselves are cleaned up; week is the date of the Wednesday that
+-- starts the message's week, in UTC
+CREATE TABLE IF NOT EXISTS compilation_clips (
+    audio_message_id TEXT PRIMARY KEY,
+    sender_user_id TEXT NOT NULL,
+    week TEXT NOT NULL,
+    created_at DATETIME NOT NULL,
+    file_path TEXT NOT NULL,
+    duration_ms INTEGER NOT NULL,
+    FOREIGN KEY (audio_message_id) REFERENCES audio_messages(id) ON DELETE CASCADE,
+    FOREIGN KEY (sender_user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_compilation_clips_week ON compilation_clips(week, created_at);
+CREATE INDEX IF NOT EXISTS idx_compilation_clips_sender ON compilation_clips(sender_user_id);
+
+-- One episode per finished week, rebuilt when its clips change; clips
+-- fingerprints the clips and sender names it was built from
+CREATE TABLE IF NOT EXISTS compilations (
+    week TEXT PRIMARY KEY,
+    file_path TEXT NOT NULL,
+    content_type TEXT NOT NULL,
+    duration_ms INTEGER NOT NULL,
+    message_count INTEGER NOT NULL,
+    clips TEXT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- A compilation's chapters, one per run of messages from the same sender;
+-- offsets are milliseconds into the compilation
+CREATE TABLE IF NOT EXISTS compilation_chapters (
+    week TEXT NOT NULL,
+    position INTEGER NOT NULL,
+    sender_user_id TEXT NOT NULL,
+    title TEXT NOT NULL,
+    start_ms INTEGER NOT NULL,
+    end_ms INTEGER NOT NULL,
+    message_count INTEGER NOT NULL,
+    PRIMARY KEY (week, position)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS compilation_chapters;
+DROP TABLE IF EXISTS compilations;
+DROP INDEX IF EXISTS idx_compilation_clips_sender;
+DROP INDEX IF EXISTS idx_compilation_clips_week;
+DROP TABLE IF EXISTS compilation_clips;
+-- +goose StatementEnd
@@ -0,0 +1,94 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Bytes on disk: a message's recording and playback rendition, a clip, a
+-- compilation. Sizes of files stored before this migration are filled in by
+-- the storage_sizes Go migration.
+ALTER TABLE audio_messages ADD COLUMN size INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE compilation_clips ADD COLUMN size INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE compilations ADD COLUMN size INTEGER NOT NULL DEFAULT 0;
+
+-- The running total of stored audio, kept by the triggers below so quota
+-- checks neither sum every row nor walk the audio directory. A message's
+-- files are stored until it is deleted, or purged if it was unsent.
+CREATE TABLE IF NOT EXISTS storage_usage (
+    id INTEGER PRIMARY KEY CHECK (id = 1),
+    bytes INTEGER NOT NULL
+);
+
+INSERT INTO storage_usage (id, bytes) VALUES (1, 0);
+
+CREATE TRIGGER IF NOT EXISTS storage_usage_message_insert
+AFTER INSERT ON audio_messages
+WHEN NEW.deleted_at IS NULL
+BEGIN
+    UPDATE storage_usage SET bytes = bytes + NEW.size;
+END;
+
+CREATE TRIGGER IF NOT EXISTS storage_usage_message_update
+AFTER UPDATE OF size, deleted_at, deleted_by_user_id, purged_at ON audio_messages
+BEGIN
+    UPDATE storage_usage SET bytes = bytes
+        + CASE WHEN NEW.deleted_at IS NULL OR (NEW.deleted_by_user_id IS NOT NULL AND NEW.purged_at IS NULL) THEN NEW.size ELSE 0 END
+        - CASE WHEN OLD.deleted_at IS NULL OR (OLD.deleted_by_user_id IS NOT NULL AND OLD.purged_at IS NULL) THEN OLD.size ELSE 0 END;
+END;
+
+CREATE TRIGGER IF NOT EXISTS storage_usage_message_delete
+AFTER DELETE ON audio_messages
+WHEN OLD.deleted_at IS NULL OR (OLD.deleted_by_user_id IS NOT NULL AND OLD.purged_at IS NULL)
+BEGIN
+    UPDATE storage_usage SET bytes = bytes - OLD.size;
+END;
+
+CREATE TRIGGER IF NOT EXISTS storage_usage_clip_insert
+AFTER INSERT ON compilation_clips
+BEGIN
+    UPDATE storage_usage SET bytes = bytes + NEW.size;
+END;
+
+CREATE TRIGGER IF NOT EXISTS storage_usage_clip_update
+AFTER UPDATE OF size ON compilation_clips
+BEGIN
+    UPDATE storage_usage SET bytes = bytes + NEW.size - OLD.size;
+END;
+
+CREATE TRIGGER IF NOT EXISTS storage_usage_clip_delete
+AFTER DELETE ON compilation_clips
+BEGIN
+    UPDATE storage_usage SET bytes = bytes - OLD.size;
+END;
+
+CREATE TRIGGER IF NOT EXISTS storage_usage_compilation_insert
+AFTER INSERT ON compilations
+BEGIN
+    UPDATE storage_usage SET bytes = bytes + NEW.size;
+END;
+
+CREATE TRIGGER IF NOT EXISTS storage_usage_compilation_update
+AFTER UPDATE OF size ON compilations
+BEGIN
+    UPDATE storage_usage SET bytes = bytes + NEW.size - OLD.size;
+END;
+
+CREATE TRIGGER IF NOT EXISTS storage_usage_compilation_delete
+AFTER DELETE ON compilations
+BEGIN
+    UPDATE storage_usage SET bytes = bytes - OLD.size;
+END;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS storage_usage_compilation_delete;
+DROP TRIGGER IF EXISTS storage_usage_compilation_update;
+DROP TRIGGER IF EXISTS storage_usage_compilation_insert;
+DROP TRIGGER IF EXISTS storage_usage_clip_delete;
+DROP TRIGGER IF EXISTS storage_usage_clip_update;
+DROP TRIGGER IF EXISTS storage_usage_clip_insert;
+DROP TRIGGER IF EXISTS storage_usage_message_delete;
+DROP TRIGGER IF EXISTS storage_usage_message_update;
+DROP TRIGGER IF EXISTS storage_usage_message_insert;
+DROP TABLE IF EXISTS storage_usage;
+ALTER TABLE compilations DROP COLUMN size;
+ALTER TABLE compilation_clips DROP COLUMN size;
+ALTER TABLE audio_messages DROP COLUMN size;
+-- +goose StatementEnd
@@ -10,12 +10,22 @@ import (
 )
 
 type AudioMessage struct {
-	ID           string       `json:"id"`
-	SenderUserID string       `json:"sender_user_id"`
-	FilePath     string       `json:"file_path"`
-	Duration     int64        `json:"duration"`
-	CreatedAt    time.Time    `json:"created_at"`
-	DeletedAt    sql.NullTime `json:"deleted_at"`
+	ID                  string         `json:"id"`
+	SenderUserID        string         `json:"sender_user_id"`
+	FilePath            string         `json:"file_path"`
+	Duration            int64          `json:"duration"`
+	CreatedAt           time.Time      `json:"created_at"`
+	DeletedAt           sql.NullTime   `json:"deleted_at"`
+	Peaks               []byte         `json:"peaks"`
+	ProcessingStatus    string         `json:"processing_status"`
+	PlaybackPath        sql.NullString `json:"playback_path"`
+	PlaybackContentType sql.NullString `json:"playback_content_type"`
+	Title               sql.NullString `json:"title"`
+	Caption             sql.NullString `json:"caption"`
+	EditedAt            sql.NullTime   `json:"edited_at"`
+	DeletedByUserID     sql.NullString `json:"deleted_by_user_id"`
+	PurgedAt            sql.NullTime   `json:"purged_at"`
+	Size                int64          `json:"size"`
 }
 
 type AudioMessageReceipt struct {
@@ -25,6 +35,57 @@ type AudioMessageReceipt struct {
 	ReceivedAt     time.Time `json:"received_at"`
 }
 
+type AuditEvent struct {
+	ID          int64          `json:"id"`
+	Action      string         `json:"action"`
+	ActorUserID sql.NullString `json:"actor_user_id"`
+	TargetType  sql.NullString `json:"target_type"`
+	TargetID    sql.NullString `json:"target_id"`
+	Ip          sql.NullString `json:"ip"`
+	RequestID   sql.NullString `json:"request_id"`
+	Detail      sql.NullString `json:"detail"`
+	CreatedAt   time.Time      `json:"created_at"`
+}
+
+type Compilation struct {
+	Week         string    `json:"week"`
+	FilePath     string    `json:"file_path"`
+	ContentType  string    `json:"content_type"`
+	DurationMs   int64     `json:"duration_ms"`
+	MessageCount int64     `json:"message_count"`
+	Clips        string    `json:"clips"`
+	CreatedAt    time.Time `json:"created_at"`
+	Size         int64     `json:"size"`
+}
+
+type CompilationChapter struct {
+	Week         string `json:"week"`
+	Position     int64  `json:"position"`
+	SenderUserID string `json:"sender_user_id"`
+	Title        string `json:"title"`
+	StartMs      int64  `json:"start_ms"`
+	EndMs        int64  `json:"end_ms"`
+	MessageCount int64  `json:"message_count"`
+}
+
+type CompilationClip struct {
+	AudioMessageID string    `json:"audio_message_id"`
+	SenderUserID   string    `json:"sender_user_id"`
+	Week           string    `json:"week"`
+	CreatedAt      time.Time `json:"created_at"`
+	FilePath       string    `json:"file_path"`
+	DurationMs     int64     `json:"duration_ms"`
+	Size           int64     `json:"size"`
+}
+
+type FeedToken struct {
+	UserID        string       `json:"user_id"`
+	TokenHash     string       `json:"token_hash"`
+	MarkReceived  bool         `json:"mark_received"`
+	CreatedAt     time.Time    `json:"created_at"`
+	LastFetchedAt sql.NullTime `json:"last_fetched_at"`
+}
+
 type GooseDbVersion struct {
 	ID        int64        `json:"id"`
 	VersionID int64        `json:"version_id"`
@@ -32,17 +93,98 @@ type GooseDbVersion struct {
 	Tstamp    sql.NullTime `json:"tstamp"`
 }
 
+type InviteCode struct {
+	ID              string         `json:"id"`
+	Code            string         `json:"code"`
+	Name            sql.NullString `json:"name"`
+	MaxUses         int64          `json:"max_uses"`
+	Uses            int64          `json:"uses"`
+	PreApproved     bool           `json:"pre_approved"`
+	ExpiresAt       sql.NullTime   `json:"expires_at"`
+	RevokedAt       sql.NullTime   `json:"revoked_at"`
+	CreatedByUserID string         `json:"created_by_user_id"`
+	CreatedAt       time.Time      `json:"created_at"`
+}
+
+type Job struct {
+	ID             int64          `json:"id"`
+	Kind           string         `json:"kind"`
+	Payload        string         `json:"payload"`
+	State          string         `json:"state"`
+	Attempts       int64          `json:"attempts"`
+	RunAt          time.Time      `json:"run_at"`
+	LeaseExpiresAt sql.NullTime   `json:"lease_expires_at"`
+	LastError      sql.NullString `json:"last_error"`
+	CreatedAt      time.Time      `json:"created_at"`
+	FinishedAt     sql.NullTime   `json:"finished_at"`
+}
+
+type NotificationMute struct {
+	UserID      string    `json:"user_id"`
+	MutedUserID string    `json:"muted_user_id"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type NotificationPreference struct {
+	UserID     string         `json:"user_id"`
+	Mode       string         `json:"mode"`
+	QuietStart sql.NullString `json:"quiet_start"`
+	QuietEnd   sql.NullString `json:"quiet_end"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+}
+
+type PendingNotification struct {
+	ID             int64     `json:"id"`
+	UserID         string    `json:"user_id"`
+	AudioMessageID string    `json:"audio_message_id"`
+	Kind           string    `json:"kind"`
+	DeliverAfter   time.Time `json:"deliver_after"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
 type SqliteSequence struct {
 	Name interface{} `json:"name"`
 	Seq  interface{} `json:"seq"`
 }
 
+type StorageUsage struct {
+	ID    int64 `json:"id"`
+	Bytes int64 `json:"bytes"`
+}
+
+type Transcript struct {
+	AudioMessageID string    `json:"audio_message_id"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type TranscriptSegment struct {
+	AudioMessageID string `json:"audio_message_id"`
+	Position       int64  `json:"position"`
+	StartMs        int64  `json:"start_ms"`
+	EndMs          int64  `json:"end_ms"`
+	Text           string `json:"text"`
+}
+
 type User struct {
-	ID           string       `json:"id"`
-	Name         string       `json:"name"`
-	DeviceIDHash string       `json:"device_id_hash"`
-	Approved     bool         `json:"approved"`
-	LastActive   sql.NullTime `json:"last_active"`
-	Role         string       `json:"role"`
+	ID              string         `json:"id"`
+	Name            string         `json:"name"`
+	DeviceIDHash    string         `json:"device_id_hash"`
+	Approved        bool           `json:"approved"`
+	LastActive      sql.NullTime   `json:"last_active"`
+	Role            string         `json:"role"`
+	CreatedAt       time.Time      `json:"created_at"`
+	TokenGeneration int64          `json:"token_generation"`
+	Timezone        sql.NullString `json:"timezone"`
+	StatusText      sql.NullString `json:"status_text"`
+	AvatarUpdatedAt sql.NullTime   `json:"avatar_updated_at"`
+	Status          string         `json:"status"`
+}
+
+type UserEmail struct {
+	UserID       string       `json:"user_id"`
+	Address      string       `json:"address"`
+	VerifiedAt   sql.NullTime `json:"verified_at"`
+	Digest       string       `json:"digest"`
+	LastDigestAt sql.NullTime `json:"last_digest_at"`
 	CreatedAt    time.Time    `json:"created_at"`
 }
@@ -1,6 +1,6 @@
 -- name: CreateAudioMessage :one
-INSERT INTO audio_messages (id, sender_user_id, file_path, duration)
-VALUES (?, ?, ?, ?)
+INSERT INTO audio_messages (id, sender_user_id, file_path, size, duration, processing_status, title, caption)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
 RETURNING *;
 
 -- name: GetAudioMessage :one
@@ -43,14 +43,114 @@ WHERE am.deleted_at IS NULL
     -- Older than 7 days
     am.created_at <= datetime('now', '-7 days')
     OR
-    -- All approved users have received it
-    (
-      SELECT COUNT(DISTINCT u.id)
+    -- Every approved, active user has received it
+    NOT EXISTS (
+      SELECT 1
       FROM users u
       WHERE u.approved = TRUE
-    ) = (
-      SELECT COUNT(*)
-      FROM audio_message_receipts amr
-      WHERE amr.audio_message_id = am.id
+        AND u.status = 'active'
+        AND NOT EXISTS (
+          SELECT 1
+          FROM audio_message_receipts amr
+          WHERE amr.audio_message_id = am.id AND amr.user_id = u.id
+        )
     )
   );
+
+-- name: ListAudioFilePathsBySender :many
+SELECT file_path FROM audio_messages
+WHERE sender_user_id = sqlc.arg(sender_user_id)
+  -- Unsent messages keep their files until purged
+  AND (deleted_at IS NULL OR (deleted_by_user_id IS NOT NULL AND purged_at IS NULL))
+UNION
+SELECT playback_path FROM audio_messages
+WHERE sender_user_id = sqlc.arg(sender_user_id) AND playback_path IS NOT NULL
+  AND (deleted_at IS NULL OR (deleted_by_user_id IS NOT NULL AND purged_at IS NULL));
+
+-- name: DeleteAudioMessagesBySender :exec
+DELETE FROM audio_messages
+WHERE sender_user_id = ?;
+
+-- name: CountAudioMessagesBySenderSince :many
+SELECT sender_user_id, COUNT(*) AS message_count FROM audio_messages
+WHERE created_at >= ?
+GROUP BY sender_user_id;
+
+-- name: SetAudioMessagePeaks :exec
+UPDATE audio_messages
+SET peaks = ?
+WHERE id = ?;
+
+-- name: SetAudioMessageProcessingStatus :exec
+UPDATE audio_messages
+SET processing_status = ?
+WHERE id = ?;
+
+-- name: SetAudioMessagePlayback :exec
+UPDATE audio_messages
+SET playback_path = ?, playback_content_type = ?, size = ?
+WHERE id = ?;
+
+-- name: SetAudioMessageDuration :exec
+UPDATE audio_messages
+SET duration = ?
+WHERE id = ?;
+
+-- name: UpdateAudioMessageText :one
+UPDATE audio_messages
+SET title = ?, caption = ?, edited_at = ?
+WHERE id = ? AND deleted_at IS NULL
+RETURNING *;
+
+-- name: GetAudioMessageWithDeleted :one
+SELECT * FROM audio_messages
+WHERE id = ?;
+
+-- name: UnsendAudioMessage :one
+UPDATE audio_messages
+SET deleted_at = ?, deleted_by_user_id = ?
+WHERE id = ? AND deleted_at IS NULL
+RETURNING *;
+
+-- name: RestoreAudioMessage :one
+UPDATE audio_messages
+SET deleted_at = NULL, deleted_by_user_id = NULL
+WHERE id = ? AND deleted_by_user_id IS NOT NULL AND purged_at IS NULL AND deleted_at > ?
+RETURNING *;
+
+-- name: MarkAudioMessagePurged :execrows
+UPDATE audio_messages
+SET purged_at = ?
+WHERE id = ? AND deleted_at = ? AND purged_at IS NULL;
+
+-- name: ListRetractedAudioMessageIDs :many
+SELECT id FROM audio_messages
+WHERE deleted_by_user_id IS NOT NULL AND deleted_at > sqlc.arg(since)
+  -- Only messages the user could have fetched before they were unsent
+  AND (processing_status = 'ready' OR sender_user_id = sqlc.arg(user_id))
+ORDER BY deleted_at DESC;
+
+-- name: ListStoredAudioFiles :many
+SELECT id, sender_user_id, file_path, playback_path, size, duration FROM audio_messages
+-- Messages whose files are still on disk
+WHERE deleted_at IS NULL OR (deleted_by_user_id IS NOT NULL AND purged_at IS NULL)
+ORDER BY created_at;
+
+-- name: GetUserStorageUsage :one
+SELECT CAST(COALESCE(SUM(size), 0) AS INTEGER) AS bytes,
+    CAST(COALESCE(SUM(duration), 0) AS INTEGER) AS seconds,
+    COUNT(*) AS messages
+FROM audio_messages
+WHERE sender_user_id = sqlc.arg(sender_user_id)
+  AND (deleted_at IS NULL OR (deleted_by_user_id IS NOT NULL AND purged_at IS NULL));
+
+-- name: GetStoredBytes :one
+SELECT bytes FROM storage_usage
+WHERE id = 1;
+
+-- name: GetInstanceStorageUsage :one
+SELECT CAST(COALESCE(SUM(duration), 0) AS INTEGER) AS seconds,
+    COUNT(*) AS messages
+FROM audio_messages
+WHERE deleted_at IS NULL OR (deleted_by_user_id IS NOT NULL AND purged_at IS NULL);
+
@@ -0,0 +1,16 @@
+-- name: CreateAuditEvent :exec
+INSERT INTO audit_events (action, actor_user_id, target_type, target_id, ip, request_id, detail)
+VALUES (?, ?, ?, ?, ?, ?, ?);
+
+-- name: ListAuditEvents :many
+SELECT * FROM audit_events
+WHERE (sqlc.narg(action) IS NULL OR action = sqlc.narg(action))
+  AND (sqlc.narg(actor_user_id) IS NULL OR actor_user_id = sqlc.narg(actor_user_id))
+  AND (sqlc.narg(target_id) IS NULL OR target_id = sqlc.narg(target_id))
+  AND (sqlc.narg(before_id) IS NULL OR id < sqlc.narg(before_id))
+ORDER BY id DESC
+LIMIT sqlc.arg(limit);
+
+-- name: DeleteAuditEventsBefore :execrows
+DELETE FROM audit_events
+WHERE created_at < ?;
@@ -0,0 +1,79 @@
+-- name: UpsertCompilationClip :exec
+INSERT INTO compilation_clips (audio_message_id, sender_user_id, week, created_at, file_path, size, duration_ms)
+VALUES (?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (audio_message_id) DO UPDATE SET
+    file_path = excluded.file_path,
+    size = excluded.size,
+    duration_ms = excluded.duration_ms;
+
+-- name: ListCompilationClips :many
+SELECT cc.audio_message_id, cc.sender_user_id, cc.created_at, cc.file_path, cc.duration_ms,
+    u.name AS sender_name
+FROM compilation_clips cc
+JOIN audio_messages am ON am.id = cc.audio_message_id
+LEFT JOIN users u ON u.id = cc.sender_user_id
+WHERE cc.week = sqlc.arg(week)
+  -- Unsent messages are left out, but keep their clips until purged
+  AND am.deleted_by_user_id IS NULL
+ORDER BY cc.created_at, cc.audio_message_id;
+
+-- name: ListStaleCompilationClips :many
+SELECT cc.audio_message_id, cc.file_path
+FROM compilation_clips cc
+LEFT JOIN audio_messages am ON am.id = cc.audio_message_id
+WHERE am.id IS NULL
+  OR am.purged_at IS NOT NULL
+  OR cc.week < sqlc.arg(oldest_week);
+
+-- name: DeleteCompilationClip :exec
+DELETE FROM compilation_clips
+WHERE audio_message_id = ?;
+
+-- name: ListCompilationClipPathsBySender :many
+SELECT file_path FROM compilation_clips
+WHERE sender_user_id = ?;
+
+-- name: DeleteCompilationClipsBySender :exec
+DELETE FROM compilation_clips
+WHERE sender_user_id = ?;
+
+-- name: ListCompilationWeeks :many
+SELECT week FROM compilation_clips
+WHERE week < sqlc.arg(before)
+UNION
+SELECT week FROM compilations
+ORDER BY week;
+
+-- name: GetCompilation :one
+SELECT * FROM compilations
+WHERE week = ?;
+
+-- name: ListCompilations :many
+SELECT * FROM compilations
+ORDER BY week DESC;
+
+-- name: CreateCompilation :exec
+INSERT INTO compilations (week, file_path, size, content_type, duration_ms, message_count, clips)
+VALUES (?, ?, ?, ?, ?, ?, ?);
+
+-- name: DeleteCompilation :exec
+DELETE FROM compilations
+WHERE week = ?;
+
+-- name: CreateCompilationChapter :exec
+INSERT INTO compilation_chapters (week, position, sender_user_id, title, start_ms, end_ms, message_count)
+VALUES (?, ?, ?, ?, ?, ?, ?);
+
+-- name: ListCompilationChapters :many
+SELECT * FROM compilation_chapters
+WHERE week = ?
+ORDER BY position;
+
+-- name: DeleteCompilationChapters :exec
+DELETE FROM compilation_chapters
+WHERE week = ?;
+
+-- name: ListCompilationFilePaths :many
+SELECT file_path FROM compilation_clips
+UNION ALL
+SELECT file_path FROM compilations;
@@ -0,0 +1,31 @@
+-- name: GetFeedToken :one
+SELECT * FROM feed_tokens
+WHERE user_id = ?;
+
+-- name: GetFeedTokenByHash :one
+SELECT * FROM feed_tokens
+WHERE token_hash = ?;
+
+-- name: UpsertFeedToken :one
+INSERT INTO feed_tokens (user_id, token_hash, mark_received)
+VALUES (?, ?, ?)
+ON CONFLICT (user_id) DO UPDATE SET
+    token_hash = excluded.token_hash,
+    mark_received = excluded.mark_received,
+    created_at = CURRENT_TIMESTAMP,
+    last_fetched_at = NULL
+RETURNING *;
+
+-- name: TouchFeedToken :exec
+UPDATE feed_tokens
+SET last_fetched_at = ?
+WHERE user_id = ?;
+
+-- name: DeleteFeedToken :execrows
+DELETE FROM feed_tokens
+WHERE user_id = ?;
+
+-- name: SetFeedMarkReceived :execrows
+UPDATE feed_tokens
+SET mark_received = ?
+WHERE user_id = ?;
@@ -0,0 +1,34 @@
+-- name: CreateInviteCode :one
+INSERT INTO invite_codes (id, code, name, max_uses, pre_approved, expires_at, created_by_user_id)
+VALUES (?, ?, ?, ?, ?, ?, ?)
+RETURNING *;
+
+-- name: GetInviteCode :one
+SELECT * FROM invite_codes
+WHERE code = ?;
+
+-- name: GetInviteCodeByID :one
+SELECT * FROM invite_codes
+WHERE id = ?;
+
+-- name: ListInviteCodes :many
+SELECT * FROM invite_codes
+ORDER BY created_at DESC;
+
+-- name: RedeemInviteCode :one
+UPDATE invite_codes
+SET uses = uses + 1
+WHERE code = ?
+  AND revoked_at IS NULL
+  AND uses < max_uses
+  AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)
+RETURNING *;
+
+-- name: RevokeInviteCode :exec
+UPDATE invite_codes
+SET revoked_at = CURRENT_TIMESTAMP
+WHERE id = ?;
+
+-- name: DeleteInviteCodesByCreator :exec
+DELETE FROM invite_codes
+WHERE created_by_user_id = ?;
@@ -0,0 +1,66 @@
+-- name: CreateJob :one
+INSERT INTO jobs (kind, payload, run_at)
+VALUES (?, ?, ?)
+RETURNING *;
+
+-- name: GetJob :one
+SELECT * FROM jobs
+WHERE id = ?;
+
+-- name: CountDueJobs :one
+SELECT COUNT(*) AS due FROM jobs
+WHERE (state = 'queued' AND run_at <= sqlc.arg(now))
+   OR (state = 'running' AND lease_expires_at <= sqlc.arg(now));
+
+-- name: ClaimJob :one
+UPDATE jobs
+SET state = 'running',
+    attempts = attempts + 1,
+    lease_expires_at = sqlc.arg(lease_expires_at)
+WHERE id = (
+    SELECT id FROM jobs
+    WHERE (state = 'queued' AND run_at <= sqlc.arg(now))
+       OR (state = 'running' AND lease_expires_at <= sqlc.arg(now))
+    ORDER BY run_at, id
+    LIMIT 1
+)
+RETURNING *;
+
+-- name: CompleteJob :execrows
+UPDATE jobs
+SET state = 'succeeded',
+    lease_expires_at = NULL,
+    last_error = NULL,
+    finished_at = ?
+WHERE id = ? AND attempts = ? AND state = 'running';
+
+-- name: RetryJob :execrows
+UPDATE jobs
+SET state = 'queued',
+    run_at = ?,
+    lease_expires_at = NULL,
+    last_error = ?
+WHERE id = ? AND attempts = ? AND state = 'running';
+
+-- name: FailJob :execrows
+UPDATE jobs
+SET state = 'failed',
+    lease_expires_at = NULL,
+    last_error = ?,
+    finished_at = ?
+WHERE id = ? AND attempts = ? AND state = 'running';
+
+-- name: DeleteFinishedJobs :execrows
+DELETE FROM jobs
+WHERE state IN ('succeeded', 'failed') AND finished_at <= ?;
+
+-- name: CountJobs :many
+SELECT kind, state, COUNT(*) AS job_count FROM jobs
+GROUP BY kind, state;
+
+-- name: DeleteJobsBySender :exec
+DELETE FROM jobs
+WHERE json_extract(payload, '$.message_id') IN (
+    SELECT id FROM audio_messages
+    WHERE sender_user_id = ?
+);
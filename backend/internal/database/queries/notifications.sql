@@ -0,0 +1,71 @@
+-- name: GetNotificationPreferences :one
+SELECT * FROM notification_preferences
+WHERE user_id = ?;
+
+-- name: ListNotificationPreferences :many
+SELECT * FROM notification_preferences;
+
+-- name: UpsertNotificationPreferences :one
+INSERT INTO notification_preferences (user_id, mode, quiet_start, quiet_end)
+VALUES (?, ?, ?, ?)
+ON CONFLICT (user_id) DO UPDATE
+SET mode = excluded.mode,
+    quiet_start = excluded.quiet_start,
+    quiet_end = excluded.quiet_end,
+    updated_at = CURRENT_TIMESTAMP
+RETURNING *;
+
+-- name: ListMutes :many
+SELECT * FROM notification_mutes
+WHERE user_id = ?
+ORDER BY created_at;
+
+-- name: ListMutesOfSender :many
+SELECT user_id FROM notification_mutes
+WHERE muted_user_id = ?;
+
+-- name: CreateMute :exec
+INSERT INTO notification_mutes (user_id, muted_user_id)
+VALUES (?, ?)
+ON CONFLICT DO NOTHING;
+
+-- name: DeleteMute :execrows
+DELETE FROM notification_mutes
+WHERE user_id = ? AND muted_user_id = ?;
+
+-- name: CreatePendingNotification :exec
+INSERT INTO pending_notifications (user_id, audio_message_id, kind, deliver_after)
+VALUES (?, ?, ?, ?)
+ON CONFLICT DO NOTHING;
+
+-- name: ListDueNotifications :many
+SELECT * FROM pending_notifications
+WHERE kind = ? AND deliver_after <= ?
+ORDER BY deliver_after;
+
+-- name: DeletePendingNotification :exec
+DELETE FROM pending_notifications
+WHERE id = ?;
+
+-- name: DeleteNotificationPreferencesByUser :exec
+DELETE FROM notification_preferences
+WHERE user_id = ?;
+
+-- name: DeleteMutesByUser :exec
+DELETE FROM notification_mutes
+WHERE user_id = sqlc.arg(user_id) OR muted_user_id = sqlc.arg(user_id);
+
+-- name: DeletePendingNotificationsByUser :exec
+DELETE FROM pending_notifications
+WHERE user_id = ?;
+
+-- name: DeletePendingNotificationsBySender :exec
+DELETE FROM pending_notifications
+WHERE audio_message_id IN (
+    SELECT id FROM audio_messages
+    WHERE sender_user_id = ?
+);
+
+-- name: DeletePendingNotificationsByUserAndKind :exec
+DELETE FROM pending_notifications
+WHERE user_id = ? AND kind = ?;
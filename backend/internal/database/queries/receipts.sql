@@ -26,9 +26,22 @@ WHERE audio_message_id = ?;
 SELECT am.*
 FROM audio_messages am
 WHERE am.deleted_at IS NULL
+  -- Senders see their own messages while they are processed
+  AND (am.processing_status = 'ready' OR am.sender_user_id = sqlc.arg(user_id))
   AND am.id NOT IN (
     SELECT amr.audio_message_id
     FROM audio_message_receipts amr
-    WHERE amr.user_id = ?
+    WHERE amr.user_id = sqlc.arg(user_id)
   )
 ORDER BY am.created_at DESC;
+
+-- name: DeleteReceiptsByUser :exec
+DELETE FROM audio_message_receipts
+WHERE user_id = ?;
+
+-- name: DeleteReceiptsBySender :exec
+DELETE FROM audio_message_receipts
+WHERE audio_message_id IN (
+    SELECT id FROM audio_messages
+    WHERE sender_user_id = ?
+);
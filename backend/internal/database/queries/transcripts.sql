@@ -0,0 +1,38 @@
+-- name: CreateTranscript :exec
+INSERT INTO transcripts (audio_message_id)
+VALUES (?);
+
+-- name: GetTranscript :one
+SELECT * FROM transcripts
+WHERE audio_message_id = ?;
+
+-- name: CreateTranscriptSegment :exec
+INSERT INTO transcript_segments (audio_message_id, position, start_ms, end_ms, text)
+VALUES (?, ?, ?, ?, ?);
+
+-- name: ListTranscriptSegments :many
+SELECT * FROM transcript_segments
+WHERE audio_message_id = ?
+ORDER BY position;
+
+-- name: DeleteTranscript :exec
+DELETE FROM transcripts
+WHERE audio_message_id = ?;
+
+-- name: DeleteTranscriptSegments :exec
+DELETE FROM transcript_segments
+WHERE audio_message_id = ?;
+
+-- name: DeleteTranscriptsBySender :exec
+DELETE FROM transcripts
+WHERE audio_message_id IN (
+    SELECT id FROM audio_messages
+    WHERE sender_user_id = ?
+);
+
+-- name: DeleteTranscriptSegmentsBySender :exec
+DELETE FROM transcript_segments
+WHERE audio_message_id IN (
+    SELECT id FROM audio_messages
+    WHERE sender_user_id = ?
+);
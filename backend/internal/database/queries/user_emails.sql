@@ -0,0 +1,36 @@
+-- name: GetUserEmail :one
+SELECT * FROM user_emails
+WHERE user_id = ?;
+
+-- name: UpsertUserEmail :one
+INSERT INTO user_emails (user_id, address, digest)
+VALUES (?, ?, ?)
+ON CONFLICT (user_id) DO UPDATE SET
+    address = excluded.address,
+    digest = excluded.digest,
+    verified_at = CASE WHEN user_emails.address = excluded.address THEN user_emails.verified_at ELSE NULL END
+RETURNING *;
+
+-- name: VerifyUserEmail :execrows
+UPDATE user_emails
+SET verified_at = CURRENT_TIMESTAMP
+WHERE user_id = ? AND address = ?;
+
+-- name: SetEmailDigest :execrows
+UPDATE user_emails
+SET digest = ?
+WHERE user_id = ?;
+
+-- name: ListDigestRecipients :many
+SELECT * FROM user_emails
+WHERE verified_at IS NOT NULL AND digest != 'off'
+ORDER BY user_id;
+
+-- name: MarkDigestSent :exec
+UPDATE user_emails
+SET last_digest_at = ?
+WHERE user_id = ?;
+
+-- name: DeleteUserEmail :exec
+DELETE FROM user_emails
+WHERE user_id = ?;
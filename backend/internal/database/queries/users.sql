@@ -15,6 +15,10 @@ WHERE device_id_hash = ?;
 SELECT * FROM users
 ORDER BY created_at DESC;
 
+-- name: CountUsers :many
+SELECT approved, status, COUNT(*) AS user_count FROM users
+GROUP BY approved, status;
+
 -- name: ListApprovedUsers :many
 SELECT * FROM users
 WHERE approved = TRUE
@@ -34,7 +38,47 @@ WHERE id = ?;
 DELETE FROM users
 WHERE id = ?;
 
--- name: UpdateUserName :exec
+-- name: CountPendingUsers :one
+SELECT COUNT(*) FROM users
+WHERE approved = FALSE;
+
+-- name: DeleteStalePendingUsers :execrows
+DELETE FROM users
+WHERE approved = FALSE
+  AND created_at <= ?;
+
+-- name: RevokeUserSessions :exec
 UPDATE users
-SET name = ?
+SET token_generation = token_generation + 1
 WHERE id = ?;
+
+-- name: UpdateUserProfile :one
+UPDATE users
+SET name = ?, timezone = ?, status_text = ?
+WHERE id = ?
+RETURNING *;
+
+-- name: SetUserAvatarUpdatedAt :one
+UPDATE users
+SET avatar_updated_at = ?
+WHERE id = ?
+RETURNING *;
+
+-- name: DeactivateIdleUsers :many
+UPDATE users
+SET status = 'inactive'
+WHERE status = 'active'
+  AND approved = TRUE
+  AND (last_active < sqlc.arg(cutoff) OR (last_active IS NULL AND created_at < sqlc.arg(cutoff)))
+RETURNING *;
+
+-- name: ReactivateUser :execrows
+UPDATE users
+SET status = 'active'
+WHERE id = ? AND status = 'inactive';
+
+-- name: SetUserStatus :one
+UPDATE users
+SET status = ?
+WHERE id = ?
+RETURNING *;
@@ -45,6 +45,29 @@ func (q *Queries) CreateReceipt(ctx context.Context, arg CreateReceiptParams) (A
 	return i, err
 }
 
+const deleteReceiptsBySender = `-- name: DeleteReceiptsBySender :exec
+DELETE FROM audio_message_receipts
+WHERE audio_message_id IN (
+    SELECT id FROM audio_messages
+    WHERE sender_user_id = ?
+)
+`
+
+func (q *Queries) DeleteReceiptsBySender(ctx context.Context, senderUserID string) error {
+	_, err := q.db.ExecContext(ctx, deleteReceiptsBySender, senderUserID)
+	return err
+}
+
+const deleteReceiptsByUser = `-- name: DeleteReceiptsByUser :exec
+DELETE FROM audio_message_receipts
+WHERE user_id = ?
+`
+
+func (q *Queries) DeleteReceiptsByUser(ctx context.Context, userID string) error {
+	_, err := q.db.ExecContext(ctx, deleteReceiptsByUser, userID)
+	return err
+}
+
 const getReceipt = `-- name: GetReceipt :one
 SELECT id, audio_message_id, user_id, received_at FROM audio_message_receipts
 WHERE audio_message_id = ? AND user_id = ?
@@ -68,13 +91,15 @@ func (q *Queries) GetReceipt(ctx context.Context, arg GetReceiptParams) (AudioMe
 }
 
 const getUnreceivedMessagesByUser = `-- name: GetUnreceivedMessagesByUser :many
-SELECT am.id, am.sender_user_id, am.file_path, am.duration, am.created_at, am.deleted_at
+SELECT am.id, am.sender_user_id, am.file_path, am.duration, am.created_at, am.deleted_at, am.peaks, am.processing_status, am.playback_path, am.playback_content_type, am.title, am.caption, am.edited_at, am.deleted_by_user_id, am.purged_at, am.size
 FROM audio_messages am
 WHERE am.deleted_at IS NULL
+  -- Senders see their own messages while they are processed
+  AND (am.processing_status = 'ready' OR am.sender_user_id = ?1)
   AND am.id NOT IN (
     SELECT amr.audio_message_id
     FROM audio_message_receipts amr
-    WHERE amr.user_id = ?
+    WHERE amr.user_id = ?1
   )
 ORDER BY am.created_at DESC
 `
@@ -95,6 +120,16 @@ func (q *Queries) GetUnreceivedMessagesByUser(ctx context.Context, userID string
 			&i.Duration,
 			&i.CreatedAt,
 			&i.DeletedAt,
+			&i.Peaks,
+			&i.ProcessingStatus,
+			&i.PlaybackPath,
+			&i.PlaybackContentType,
+			&i.Title,
+			&i.Caption,
+			&i.EditedAt,
+			&i.DeletedByUserID,
+			&i.PurgedAt,
+			&i.Size,
 		); err != nil {
 			return nil, err
 		}
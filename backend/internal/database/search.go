@@ -0,0 +1,248 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/pressly/goose/v3"
+)
+
+// The message_search FTS5 index is created by a Go migration rather than a
+// SQL one: FTS5 is only compiled into the SQLite driver with the sqlite_fts5
+// build tag, and without it the migrations must still run. The migration
+// fills the index once and triggers keep it in sync from then on; a change to
+// what is indexed needs a new migration to rebuild it. Its queries are
+// written here rather than generated, as sqlc cannot see it.
+
+func init() {
+	goose.AddNamedMigrationContext("20261019234000_message_search.go", upSearchIndex, downSearchIndex)
+}
+
+const searchTriggerInsert = "message_search_insert"
+
+// searchDocument selects the indexed text of messages: the sender's name, the
+// UTC date sent as "2006-01-02 January Monday", the note (the title and
+// caption) and the transcript.
+var searchDocument = `SELECT am.id AS id, COALESCE(u.name, '') AS sender_name, ` + searchDate("am.created_at") + ` AS sent_on,
+    trim(COALESCE(am.title, '') || char(10) || COALESCE(am.caption, '')) AS note,
+    COALESCE((
+        SELECT group_concat(ts.text, ' ') FROM (
+            SELECT text FROM transcript_segments
+            WHERE audio_message_id = am.id
+            ORDER BY position
+        ) ts
+        WHERE EXISTS (SELECT 1 FROM transcripts t WHERE t.audio_message_id = am.id)
+    ), '') AS transcript
+FROM audio_messages am
+LEFT JOIN users u ON u.id = am.sender_user_id`
+
+// searchDate formats a timestamp column with its month and weekday names,
+// which strftime cannot produce.
+func searchDate(column string) string {
+	var month, weekday strings.Builder
+	for m := time.January; m <= time.December; m++ {
+		fmt.Fprintf(&month, " WHEN '%02d' THEN '%s'", int(m), m)
+	}
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		fmt.Fprintf(&weekday, " WHEN '%d' THEN '%s'", int(d), d)
+	}
+	return fmt.Sprintf("strftime('%%Y-%%m-%%d', %[1]s) || ' ' || CASE strftime('%%m', %[1]s)%[2]s END || ' ' || CASE strftime('%%w', %[1]s)%[3]s END",
+		column, month.String(), weekday.String())
+}
+
+// reindex replaces the index rows of the messages matching where.
+func reindex(where string) string {
+	return fmt.Sprintf(`DELETE FROM message_search WHERE audio_message_id IN (SELECT am.id FROM audio_messages am WHERE %[1]s);
+    INSERT INTO message_search (audio_message_id, sender_name, sent_on, note, transcript)
+    %[2]s
+    WHERE %[1]s;`, where, searchDocument)
+}
+
+var searchTriggers = map[string]string{
+	searchTriggerInsert:                "AFTER INSERT ON audio_messages BEGIN " + reindex("am.id = NEW.id") + " END",
+	"message_search_update":            "AFTER UPDATE ON audio_messages BEGIN " + reindex("am.id = NEW.id") + " END",
+	"message_search_delete":            "AFTER DELETE ON audio_messages BEGIN DELETE FROM message_search WHERE audio_message_id = OLD.id; END",
+	"message_search_sender":            "AFTER UPDATE OF name ON users BEGIN " + reindex("am.sender_user_id = NEW.id") + " END",
+	"message_search_transcript_insert": "AFTER INSERT ON transcripts BEGIN " + reindex("am.id = NEW.audio_message_id") + " END",
+	"message_search_transcript_delete": "AFTER DELETE ON transcripts BEGIN " + reindex("am.id = OLD.audio_message_id") + " END",
+}
+
+// errNoFTS5 is returned by createSearchIndex when FTS5 is not compiled in.
+var errNoFTS5 = errors.New("FTS5 unavailable")
+
+// createSearchIndex creates the message_search index and its triggers, and
+// fills it from the existing messages.
+func createSearchIndex(ctx context.Context, tx *sql.Tx) error {
+	// Earlier versions created the triggers each time the database was opened.
+	for name := range searchTriggers {
+		if _, err := tx.ExecContext(ctx, "DROP TRIGGER IF EXISTS "+name); err != nil {
+			return fmt.Errorf("failed to drop search trigger: %w", err)
+		}
+	}
+
+	_, err := tx.ExecContext(ctx, `CREATE VIRTUAL TABLE IF NOT EXISTS message_search USING fts5(
+        audio_message_id UNINDEXED, sender_name, sent_on, note, transcript,
+        tokenize = 'unicode61 remove_diacritics 2'
+    )`)
+	if err != nil && strings.Contains(err.Error(), "no such module") {
+		return errNoFTS5
+	} else if err != nil {
+		return fmt.Errorf("failed to create search index: %w", err)
+	}
+
+	for name, trigger := range searchTriggers {
+		if _, err := tx.ExecContext(ctx, "CREATE TRIGGER "+name+" "+trigger); err != nil {
+			return fmt.Errorf("failed to create search trigger %s: %w", name, err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM message_search"); err != nil {
+		return fmt.Errorf("failed to clear search index: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO message_search (audio_message_id, sender_name, sent_on, note, transcript) `+searchDocument); err != nil {
+		return fmt.Errorf("failed to fill search index: %w", err)
+	}
+	return nil
+}
+
+// upSearchIndex skips the index when FTS5 is unavailable, leaving searches to
+// scan instead. ensureSearchIndex warns about it, and creates the index once
+// a build has FTS5.
+func upSearchIndex(ctx context.Context, tx *sql.Tx) error {
+	if err := createSearchIndex(ctx, tx); !errors.Is(err, errNoFTS5) {
+		return err
+	}
+	return nil
+}
+
+func downSearchIndex(ctx context.Context, tx *sql.Tx) error {
+	for name := range searchTriggers {
+		if _, err := tx.ExecContext(ctx, "DROP TRIGGER IF EXISTS "+name); err != nil {
+			return fmt.Errorf("failed to drop search trigger: %w", err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, "DROP TABLE IF EXISTS message_search"); err != nil {
+		return fmt.Errorf("failed to drop search index: %w", err)
+	}
+	return nil
+}
+
+// ensureSearchIndex creates the index when the migration ran without FTS5
+// and this build has it. Once the index exists it does nothing.
+func ensureSearchIndex(ctx context.Context, db *sql.DB) error {
+	var exists int
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'message_search'").Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to check for search index: %w", err)
+	}
+	if exists > 0 {
+		return nil
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if err := createSearchIndex(ctx, tx); errors.Is(err, errNoFTS5) {
+		slog.Warn("FTS5 unavailable, searching messages without an index; build with -tags sqlite_fts5")
+		return nil
+	} else if err != nil {
+		return err
+	}
+	slog.Info("created search index")
+	return tx.Commit()
+}
+
+const searchIndexed = `SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name = ?`
+
+// SearchIndexed reports whether the message_search index is in use.
+func (q *Queries) SearchIndexed(ctx context.Context) (bool, error) {
+	var count int64
+	err := q.db.QueryRowContext(ctx, searchIndexed, searchTriggerInsert).Scan(&count)
+	return count > 0, err
+}
+
+// SearchDocument is the indexed text of a message.
+type SearchDocument struct {
+	AudioMessageID string
+	SenderUserID   string
+	CreatedAt      time.Time
+	Duration       int64
+	SenderName     string
+	SentOn         string
+	Note           string
+	Transcript     string
+}
+
+// searchVisible limits searches to the messages userID may download: not
+// deleted, and ready unless they sent it.
+const searchVisible = `am.deleted_at IS NULL AND (am.processing_status = 'ready' OR am.sender_user_id = ?)`
+
+const searchMessages = `SELECT am.id, am.sender_user_id, am.created_at, am.duration, ms.sender_name, ms.sent_on, ms.note, ms.transcript
+FROM message_search ms
+JOIN audio_messages am ON am.id = ms.audio_message_id
+WHERE message_search MATCH ? AND ` + searchVisible + `
+ORDER BY bm25(message_search, 0, 4, 2, 3, 1)
+LIMIT ?`
+
+type SearchMessagesParams struct {
+	Match  string
+	UserID string
+	Limit  int64
+}
+
+// SearchMessages returns the messages matching an FTS5 query that the user
+// may see, best first.
+func (q *Queries) SearchMessages(ctx context.Context, arg SearchMessagesParams) ([]SearchDocument, error) {
+	rows, err := q.db.QueryContext(ctx, searchMessages, arg.Match, arg.UserID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanSearchDocuments(rows)
+}
+
+var listSearchDocuments = `SELECT am.id, am.sender_user_id, am.created_at, am.duration, d.sender_name, d.sent_on, d.note, d.transcript
+FROM (` + searchDocument + `) d
+JOIN audio_messages am ON am.id = d.id
+WHERE ` + searchVisible + `
+ORDER BY am.created_at DESC`
+
+// ListSearchDocuments returns the indexed text of every message the user may
+// see, newest first, for searching without the index.
+func (q *Queries) ListSearchDocuments(ctx context.Context, userID string) ([]SearchDocument, error) {
+	rows, err := q.db.QueryContext(ctx, listSearchDocuments, userID)
+	if err != nil {
+		return nil, err
+	}
+	return scanSearchDocuments(rows)
+}
+
+func scanSearchDocuments(rows *sql.Rows) ([]SearchDocument, error) {
+	defer rows.Close()
+	var items []SearchDocument
+	for rows.Next() {
+		var i SearchDocument
+		if err := rows.Scan(
+			&i.AudioMessageID,
+			&i.SenderUserID,
+			&i.CreatedAt,
+			&i.Duration,
+			&i.SenderName,
+			&i.SentOn,
+			&i.Note,
+			&i.Transcript,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	return items, rows.Err()
+}
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+
+	"github.com/pressly/goose/v3"
+)
+
+// The sizes of audio stored before the storage_usage migration are measured
+// by a Go migration, as only the files know them. From then on the size is
+// recorded when a file is written, and the storage_usage triggers keep the
+// running total. Paths are relative to the server's working directory, as
+// everywhere else.
+
+func init() {
+	goose.AddNamedMigrationContext("20261019235500_storage_sizes.go", upStorageSizes, nil)
+}
+
+// storageSizes selects the files of each stored row, and sets its size.
+var storageSizes = []struct{ files, update string }{
+	{
+		`SELECT id, file_path, COALESCE(NULLIF(playback_path, file_path), '') FROM audio_messages
+        WHERE deleted_at IS NULL OR (deleted_by_user_id IS NOT NULL AND purged_at IS NULL)`,
+		`UPDATE audio_messages SET size = ? WHERE id = ?`,
+	},
+	{
+		`SELECT audio_message_id, file_path, '' FROM compilation_clips`,
+		`UPDATE compilation_clips SET size = ? WHERE audio_message_id = ?`,
+	},
+	{
+		`SELECT week, file_path, '' FROM compilations`,
+		`UPDATE compilations SET size = ? WHERE week = ?`,
+	},
+}
+
+func upStorageSizes(ctx context.Context, tx *sql.Tx) error {
+	for _, table := range storageSizes {
+		sizes, err := measureFiles(ctx, tx, table.files)
+		if err != nil {
+			return err
+		}
+		for key, size := range sizes {
+			if _, err := tx.ExecContext(ctx, table.update, size, key); err != nil {
+				return fmt.Errorf("failed to store file size: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// measureFiles returns the bytes on disk of the one or two files of each row
+// the query selects, by key. Missing files take no space.
+func measureFiles(ctx context.Context, tx *sql.Tx, query string) (map[string]int64, error) {
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stored files: %w", err)
+	}
+	defer rows.Close()
+
+	sizes := make(map[string]int64)
+	for rows.Next() {
+		var key, path, other string
+		if err := rows.Scan(&key, &path, &other); err != nil {
+			return nil, fmt.Errorf("failed to list stored files: %w", err)
+		}
+		for _, path := range []string{path, other} {
+			if info, err := os.Stat(path); err == nil && path != "" {
+				sizes[key] += info.Size()
+			}
+		}
+	}
+	return sizes, rows.Err()
+}
@@ -7,6 +7,8 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 )
 
 const approveUser = `-- name: ApproveUser :exec
@@ -20,10 +22,56 @@ func (q *Queries) ApproveUser(ctx context.Context, id string) error {
 	return err
 }
 
+const countPendingUsers = `-- name: CountPendingUsers :one
+SELECT COUNT(*) FROM users
+WHERE approved = FALSE
+`
+
+func (q *Queries) CountPendingUsers(ctx context.Context) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countPendingUsers)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countUsers = `-- name: CountUsers :many
+SELECT approved, status, COUNT(*) AS user_count FROM users
+GROUP BY approved, status
+`
+
+type CountUsersRow struct {
+	Approved  bool   `json:"approved"`
+	Status    string `json:"status"`
+	UserCount int64  `json:"user_count"`
+}
+
+func (q *Queries) CountUsers(ctx context.Context) ([]CountUsersRow, error) {
+	rows, err := q.db.QueryContext(ctx, countUsers)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []CountUsersRow{}
+	for rows.Next() {
+		var i CountUsersRow
+		if err := rows.Scan(&i.Approved, &i.Status, &i.UserCount); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (id, name, device_id_hash, approved)
 VALUES (?, ?, ?, ?)
-RETURNING id, name, device_id_hash, approved, last_active, role, created_at
+RETURNING id, name, device_id_hash, approved, last_active, role, created_at, token_generation, timezone, status_text, avatar_updated_at, status
 `
 
 type CreateUserParams struct {
@@ -49,10 +97,74 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.LastActive,
 		&i.Role,
 		&i.CreatedAt,
+		&i.TokenGeneration,
+		&i.Timezone,
+		&i.StatusText,
+		&i.AvatarUpdatedAt,
+		&i.Status,
 	)
 	return i, err
 }
 
+const deactivateIdleUsers = `-- name: DeactivateIdleUsers :many
+UPDATE users
+SET status = 'inactive'
+WHERE status = 'active'
+  AND approved = TRUE
+  AND (last_active < ?1 OR (last_active IS NULL AND created_at < ?1))
+RETURNING id, name, device_id_hash, approved, last_active, role, created_at, token_generation, timezone, status_text, avatar_updated_at, status
+`
+
+func (q *Queries) DeactivateIdleUsers(ctx context.Context, cutoff sql.NullTime) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, deactivateIdleUsers, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []User{}
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.DeviceIDHash,
+			&i.Approved,
+			&i.LastActive,
+			&i.Role,
+			&i.CreatedAt,
+			&i.TokenGeneration,
+			&i.Timezone,
+			&i.StatusText,
+			&i.AvatarUpdatedAt,
+			&i.Status,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const deleteStalePendingUsers = `-- name: DeleteStalePendingUsers :execrows
+DELETE FROM users
+WHERE approved = FALSE
+  AND created_at <= ?
+`
+
+func (q *Queries) DeleteStalePendingUsers(ctx context.Context, createdAt time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteStalePendingUsers, createdAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const deleteUser = `-- name: DeleteUser :exec
 DELETE FROM users
 WHERE id = ?
@@ -64,7 +176,7 @@ func (q *Queries) DeleteUser(ctx context.Context, id string) error {
 }
 
 const getUser = `-- name: GetUser :one
-SELECT id, name, device_id_hash, approved, last_active, role, created_at FROM users
+SELECT id, name, device_id_hash, approved, last_active, role, created_at, token_generation, timezone, status_text, avatar_updated_at, status FROM users
 WHERE id = ?
 `
 
@@ -79,12 +191,17 @@ func (q *Queries) GetUser(ctx context.Context, id string) (User, error) {
 		&i.LastActive,
 		&i.Role,
 		&i.CreatedAt,
+		&i.TokenGeneration,
+		&i.Timezone,
+		&i.StatusText,
+		&i.AvatarUpdatedAt,
+		&i.Status,
 	)
 	return i, err
 }
 
 const getUserByDeviceID = `-- name: GetUserByDeviceID :one
-SELECT id, name, device_id_hash, approved, last_active, role, created_at FROM users
+SELECT id, name, device_id_hash, approved, last_active, role, created_at, token_generation, timezone, status_text, avatar_updated_at, status FROM users
 WHERE device_id_hash = ?
 `
 
@@ -99,12 +216,17 @@ func (q *Queries) GetUserByDeviceID(ctx context.Context, deviceIDHash string) (U
 		&i.LastActive,
 		&i.Role,
 		&i.CreatedAt,
+		&i.TokenGeneration,
+		&i.Timezone,
+		&i.StatusText,
+		&i.AvatarUpdatedAt,
+		&i.Status,
 	)
 	return i, err
 }
 
 const listApprovedUsers = `-- name: ListApprovedUsers :many
-SELECT id, name, device_id_hash, approved, last_active, role, created_at FROM users
+SELECT id, name, device_id_hash, approved, last_active, role, created_at, token_generation, timezone, status_text, avatar_updated_at, status FROM users
 WHERE approved = TRUE
 ORDER BY created_at DESC
 `
@@ -126,6 +248,11 @@ func (q *Queries) ListApprovedUsers(ctx context.Context) ([]User, error) {
 			&i.LastActive,
 			&i.Role,
 			&i.CreatedAt,
+			&i.TokenGeneration,
+			&i.Timezone,
+			&i.StatusText,
+			&i.AvatarUpdatedAt,
+			&i.Status,
 		); err != nil {
 			return nil, err
 		}
@@ -141,7 +268,7 @@ func (q *Queries) ListApprovedUsers(ctx context.Context) ([]User, error) {
 }
 
 const listUsers = `-- name: ListUsers :many
-SELECT id, name, device_id_hash, approved, last_active, role, created_at FROM users
+SELECT id, name, device_id_hash, approved, last_active, role, created_at, token_generation, timezone, status_text, avatar_updated_at, status FROM users
 ORDER BY created_at DESC
 `
 
@@ -162,6 +289,11 @@ func (q *Queries) ListUsers(ctx context.Context) ([]User, error) {
 			&i.LastActive,
 			&i.Role,
 			&i.CreatedAt,
+			&i.TokenGeneration,
+			&i.Timezone,
+			&i.StatusText,
+			&i.AvatarUpdatedAt,
+			&i.Status,
 		); err != nil {
 			return nil, err
 		}
@@ -176,6 +308,95 @@ func (q *Queries) ListUsers(ctx context.Context) ([]User, error) {
 	return items, nil
 }
 
+const reactivateUser = `-- name: ReactivateUser :execrows
+UPDATE users
+SET status = 'active'
+WHERE id = ? AND status = 'inactive'
+`
+
+func (q *Queries) ReactivateUser(ctx context.Context, id string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, reactivateUser, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const revokeUserSessions = `-- name: RevokeUserSessions :exec
+UPDATE users
+SET token_generation = token_generation + 1
+WHERE id = ?
+`
+
+func (q *Queries) RevokeUserSessions(ctx context.Context, id string) error {
+	_, err := q.db.ExecContext(ctx, revokeUserSessions, id)
+	return err
+}
+
+const setUserAvatarUpdatedAt = `-- name: SetUserAvatarUpdatedAt :one
+UPDATE users
+SET avatar_updated_at = ?
+WHERE id = ?
+RETURNING id, name, device_id_hash, approved, last_active, role, created_at, token_generation, timezone, status_text, avatar_updated_at, status
+`
+
+type SetUserAvatarUpdatedAtParams struct {
+	AvatarUpdatedAt sql.NullTime `json:"avatar_updated_at"`
+	ID              string       `json:"id"`
+}
+
+func (q *Queries) SetUserAvatarUpdatedAt(ctx context.Context, arg SetUserAvatarUpdatedAtParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserAvatarUpdatedAt, arg.AvatarUpdatedAt, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.DeviceIDHash,
+		&i.Approved,
+		&i.LastActive,
+		&i.Role,
+		&i.CreatedAt,
+		&i.TokenGeneration,
+		&i.Timezone,
+		&i.StatusText,
+		&i.AvatarUpdatedAt,
+		&i.Status,
+	)
+	return i, err
+}
+
+const setUserStatus = `-- name: SetUserStatus :one
+UPDATE users
+SET status = ?
+WHERE id = ?
+RETURNING id, name, device_id_hash, approved, last_active, role, created_at, token_generation, timezone, status_text, avatar_updated_at, status
+`
+
+type SetUserStatusParams struct {
+	Status string `json:"status"`
+	ID     string `json:"id"`
+}
+
+func (q *Queries) SetUserStatus(ctx context.Context, arg SetUserStatusParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserStatus, arg.Status, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.DeviceIDHash,
+		&i.Approved,
+		&i.LastActive,
+		&i.Role,
+		&i.CreatedAt,
+		&i.TokenGeneration,
+		&i.Timezone,
+		&i.StatusText,
+		&i.AvatarUpdatedAt,
+		&i.Status,
+	)
+	return i, err
+}
+
 const updateUserLastActive = `-- name: UpdateUserLastActive :exec
 UPDATE users
 SET last_active = CURRENT_TIMESTAMP
@@ -187,18 +408,41 @@ func (q *Queries) UpdateUserLastActive(ctx context.Context, id string) error {
 	return err
 }
 
-const updateUserName = `-- name: UpdateUserName :exec
+const updateUserProfile = `-- name: UpdateUserProfile :one
 UPDATE users
-SET name = ?
+SET name = ?, timezone = ?, status_text = ?
 WHERE id = ?
+RETURNING id, name, device_id_hash, approved, last_active, role, created_at, token_generation, timezone, status_text, avatar_updated_at, status
 `
 
-type UpdateUserNameParams struct {
-	Name string `json:"name"`
-	ID   string `json:"id"`
+type UpdateUserProfileParams struct {
+	Name       string         `json:"name"`
+	Timezone   sql.NullString `json:"timezone"`
+	StatusText sql.NullString `json:"status_text"`
+	ID         string         `json:"id"`
 }
 
-func (q *Queries) UpdateUserName(ctx context.Context, arg UpdateUserNameParams) error {
-	_, err := q.db.ExecContext(ctx, updateUserName, arg.Name, arg.ID)
-	return err
+func (q *Queries) UpdateUserProfile(ctx context.Context, arg UpdateUserProfileParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserProfile,
+		arg.Name,
+		arg.Timezone,
+		arg.StatusText,
+		arg.ID,
+	)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.DeviceIDHash,
+		&i.Approved,
+		&i.LastActive,
+		&i.Role,
+		&i.CreatedAt,
+		&i.TokenGeneration,
+		&i.Timezone,
+		&i.StatusText,
+		&i.AvatarUpdatedAt,
+		&i.Status,
+	)
+	return i, err
 }
@@ -0,0 +1,201 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"text/template"
+	"time"
+
+	"github.com/alecdray/waffle-talkie/internal/database"
+	"github.com/alecdray/waffle-talkie/internal/notify"
+	"github.com/alecdray/waffle-talkie/internal/users"
+)
+
+// Digest is how often a user is emailed about unheard messages.
+type Digest string
+
+const (
+	DigestDaily  Digest = "daily"
+	DigestWeekly Digest = "weekly"
+	DigestOff    Digest = "off"
+)
+
+func (d Digest) Valid() bool {
+	switch d {
+	case DigestDaily, DigestWeekly, DigestOff:
+		return true
+	}
+	return false
+}
+
+func (d Digest) period() time.Duration {
+	if d == DigestWeekly {
+		return 7 * 24 * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// Digester emails users a summary of the messages they have not heard.
+type Digester struct {
+	queries *database.Queries
+	sender  Sender
+	links   Links
+}
+
+func NewDigester(queries *database.Queries, sender Sender, links Links) *Digester {
+	return &Digester{
+		queries: queries,
+		sender:  sender,
+		links:   links,
+	}
+}
+
+// SendDue emails every verified address whose daily or weekly digest is due.
+// Digests are scheduled on the hour, so an hourly run keeps a steady cadence.
+// A user with nothing unheard gets no email but still waits a full period.
+func (d *Digester) SendDue(ctx context.Context, now time.Time) error {
+	recipients, err := d.queries.ListDigestRecipients(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list digest recipients: %w", err)
+	}
+	if len(recipients) == 0 {
+		return nil
+	}
+	dbUsers, err := d.queries.ListUsers(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list users: %w", err)
+	}
+	usersByID := make(map[string]database.User, len(dbUsers))
+	for _, user := range dbUsers {
+		usersByID[user.ID] = user
+	}
+
+	slot := now.UTC().Truncate(time.Hour)
+	for _, recipient := range recipients {
+		if recipient.LastDigestAt.Valid && recipient.LastDigestAt.Time.After(slot.Add(-Digest(recipient.Digest).period())) {
+			continue
+		}
+		user, ok := usersByID[recipient.UserID]
+		if !ok || !user.Approved || users.UserStatus(user.Status) == users.UserStatusSuspended {
+			continue
+		}
+
+		if err := d.send(ctx, recipient, user, usersByID, now); err != nil {
+			slog.ErrorContext(ctx, "failed to send digest", "target_user_id", user.ID, "error", err)
+			continue
+		}
+		if err := d.queries.MarkDigestSent(ctx, database.MarkDigestSentParams{
+			LastDigestAt: sql.NullTime{Time: slot, Valid: true},
+			UserID:       user.ID,
+		}); err != nil {
+			return fmt.Errorf("failed to mark digest sent: %w", err)
+		}
+		// Alerts collected for users in digest notification mode are covered
+		// by this email.
+		if err := d.queries.DeletePendingNotificationsByUserAndKind(ctx, database.DeletePendingNotificationsByUserAndKindParams{
+			UserID: user.ID,
+			Kind:   notify.KindDigest,
+		}); err != nil {
+			return fmt.Errorf("failed to clear digest notifications: %w", err)
+		}
+	}
+	return nil
+}
+
+type digestEntry struct {
+	Sender    string
+	Title     string
+	Length    string
+	SentAt    string
+	ListenURL string
+}
+
+var digestTemplate = template.Must(template.New("digest").Parse(`Hi {{.Name}},
+
+{{if eq (len .Messages) 1}}A message is{{else}}{{len .Messages}} messages are{{end}} waiting for you on Waffle Talkie:
+{{range .Messages}}
+- {{.Sender}}{{with .Title}}: {{.}}{{end}}, {{.Length}}, {{.SentAt}}
+  Listen: {{.ListenURL}}
+{{end}}
+Listen links expire after 7 days.
+
+To stop these emails, unsubscribe: {{.UnsubscribeURL}}
+`))
+
+// send emails recipient their unheard messages, leaving out those
+// notify.Decide would not alert them about: their own, those from senders they
+// muted and every message when notifications are off. Nothing is sent if no
+// messages are left.
+func (d *Digester) send(ctx context.Context, recipient database.UserEmail, user database.User, usersByID map[string]database.User, now time.Time) error {
+	messages, err := d.queries.GetUnreceivedMessagesByUser(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list unheard messages: %w", err)
+	}
+	prefs, err := notify.UserPreferences(ctx, d.queries, user)
+	if err != nil {
+		return err
+	}
+	mutes, err := d.queries.ListMutes(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list mutes: %w", err)
+	}
+	muted := make(map[string]bool, len(mutes))
+	for _, mute := range mutes {
+		muted[mute.MutedUserID] = true
+	}
+
+	var entries []digestEntry
+	for _, message := range messages {
+		// A digest is read whenever the user gets to it, so messages that
+		// quiet hours would defer are included.
+		decision := notify.Decide(user.ID, prefs, muted[message.SenderUserID], notify.Message{SenderUserID: message.SenderUserID}, now)
+		if decision.Action == notify.ActionSkip {
+			continue
+		}
+		sender := "Someone"
+		if u, ok := usersByID[message.SenderUserID]; ok {
+			sender = u.Name
+		}
+		entries = append(entries, digestEntry{
+			Sender:    sender,
+			Title:     message.Title.String,
+			Length:    fmt.Sprintf("%d:%02d", message.Duration/60, message.Duration%60),
+			SentAt:    message.CreatedAt.In(prefs.Location).Format("Mon 2 Jan 15:04"),
+			ListenURL: d.links.Listen(user.ID, message.ID, now),
+		})
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	unsubscribeURL := d.links.Unsubscribe(user.ID, now)
+	var body bytes.Buffer
+	if err := digestTemplate.Execute(&body, map[string]any{
+		"Name":           user.Name,
+		"Messages":       entries,
+		"UnsubscribeURL": unsubscribeURL,
+	}); err != nil {
+		return fmt.Errorf("failed to render digest: %w", err)
+	}
+
+	subject := "1 unheard message on Waffle Talkie"
+	if len(entries) > 1 {
+		subject = fmt.Sprintf("%d unheard messages on Waffle Talkie", len(entries))
+	}
+	if err := d.sender.Send(ctx, Message{
+		To:      recipient.Address,
+		Subject: subject,
+		Body:    body.String(),
+		Headers: map[string]string{
+			"List-Unsubscribe":      "<" + unsubscribeURL + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+	}); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "digest sent", "target_user_id", user.ID, "messages", len(entries))
+	return nil
+}
@@ -0,0 +1,367 @@
+package email
+
+import (
+	"database/sql"
+	"encoding/json"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/mail"
+	"os"
+	"time"
+
+	"github.com/alecdray/waffle-talkie/internal/apierror"
+	"github.com/alecdray/waffle-talkie/internal/audio"
+	"github.com/alecdray/waffle-talkie/internal/auth"
+	"github.com/alecdray/waffle-talkie/internal/database"
+	"github.com/alecdray/waffle-talkie/internal/notify"
+	"github.com/alecdray/waffle-talkie/internal/users"
+)
+
+// Handler manages users' email settings and the links sent in emails.
+type Handler struct {
+	queries *database.Queries
+	sender  Sender
+	links   Links
+}
+
+// NewHandler creates an email handler. A nil sender disables adding or
+// changing addresses; links already sent keep working.
+func NewHandler(queries *database.Queries, sender Sender, links Links) *Handler {
+	return &Handler{
+		queries: queries,
+		sender:  sender,
+		links:   links,
+	}
+}
+
+// RegisterRoutes registers the authenticated email settings routes.
+func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /v1/me/email", h.HandleGetSettings)
+	mux.HandleFunc("PUT /v1/me/email", h.HandleUpdateSettings)
+	mux.HandleFunc("DELETE /v1/me/email", h.HandleDeleteSettings)
+}
+
+// RegisterLinkRoutes registers the routes opened from links in emails. They
+// are authorized by the link's signature rather than a bearer token.
+func (h *Handler) RegisterLinkRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /v1/verify", h.HandleVerify)
+	mux.HandleFunc("GET /v1/listen/{id}", h.HandleListen)
+	mux.HandleFunc("GET /v1/listen/{id}/audio", h.HandleListenAudio)
+	mux.HandleFunc("GET /v1/unsubscribe", h.HandleUnsubscribePage)
+	mux.HandleFunc("POST /v1/unsubscribe", h.HandleUnsubscribe)
+}
+
+type Settings struct {
+	// Address is null when the user has not added one.
+	Address      *string    `json:"address"`
+	Verified     bool       `json:"verified"`
+	Digest       Digest     `json:"digest"`
+	LastDigestAt *time.Time `json:"last_digest_at"`
+}
+
+type UpdateSettingsRequest struct {
+	Address string `json:"address"`
+	Digest  Digest `json:"digest"`
+}
+
+// HandleGetSettings returns the authenticated user's email settings.
+func (h *Handler) HandleGetSettings(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "User ID not found")
+		return
+	}
+
+	stored, err := h.queries.GetUserEmail(r.Context(), userID)
+	if err == sql.ErrNoRows {
+		writeSettings(w, Settings{Digest: DigestOff})
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get email settings", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to get email settings")
+		return
+	}
+
+	writeSettings(w, newSettings(stored))
+}
+
+// HandleUpdateSettings sets the authenticated user's address and digest
+// frequency. A new or still unverified address is sent a verification link,
+// and gets no digests until it is followed.
+func (h *Handler) HandleUpdateSettings(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "User ID not found")
+		return
+	}
+	if h.sender == nil {
+		apierror.Write(w, http.StatusServiceUnavailable, apierror.CodeEmailUnavailable, "Email is not configured on this server")
+		return
+	}
+
+	var req UpdateSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidBody, "Invalid request body")
+		return
+	}
+	if addr, err := mail.ParseAddress(req.Address); err != nil || addr.Address != req.Address || len(req.Address) > 254 {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "address must be a plain email address")
+		return
+	}
+	if !req.Digest.Valid() {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "digest must be daily, weekly or off")
+		return
+	}
+
+	stored, err := h.queries.UpsertUserEmail(r.Context(), database.UpsertUserEmailParams{
+		UserID:  userID,
+		Address: req.Address,
+		Digest:  string(req.Digest),
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to update email settings", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update email settings")
+		return
+	}
+
+	if !stored.VerifiedAt.Valid {
+		if err := h.sender.Send(r.Context(), Message{
+			To:      stored.Address,
+			Subject: "Confirm your email for Waffle Talkie",
+			Body: "Follow this link within 48 hours to get Waffle Talkie digests at this address:\n\n" +
+				h.links.Verify(userID, stored.Address, time.Now()) + "\n\n" +
+				"If you did not ask for this, ignore this email.\n",
+		}); err != nil {
+			slog.ErrorContext(r.Context(), "failed to send verification email", "error", err)
+			apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to send verification email")
+			return
+		}
+	}
+
+	slog.InfoContext(r.Context(), "email settings updated", "digest", stored.Digest, "verified", stored.VerifiedAt.Valid)
+	writeSettings(w, newSettings(stored))
+}
+
+// HandleDeleteSettings removes the authenticated user's address.
+func (h *Handler) HandleDeleteSettings(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "User ID not found")
+		return
+	}
+
+	if err := h.queries.DeleteUserEmail(r.Context(), userID); err != nil {
+		slog.ErrorContext(r.Context(), "failed to delete email settings", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to delete email settings")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleVerify marks the address a verification link was sent to as verified.
+func (h *Handler) HandleVerify(w http.ResponseWriter, r *http.Request) {
+	userID, token := r.URL.Query().Get("user"), r.URL.Query().Get("token")
+
+	stored, err := h.queries.GetUserEmail(r.Context(), userID)
+	if err != nil && err != sql.ErrNoRows {
+		slog.ErrorContext(r.Context(), "failed to get email settings", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Internal server error")
+		return
+	}
+	// The address is part of the signature, so changing it invalidates
+	// links sent to the old one.
+	if err == sql.ErrNoRows || h.links.check(purposeVerify, token, time.Now(), userID, stored.Address) != nil {
+		apierror.Write(w, http.StatusForbidden, apierror.CodeLinkInvalid, "This link is invalid or has expired")
+		return
+	}
+
+	if _, err := h.queries.VerifyUserEmail(r.Context(), database.VerifyUserEmailParams{
+		UserID:  userID,
+		Address: stored.Address,
+	}); err != nil {
+		slog.ErrorContext(r.Context(), "failed to verify email", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to verify email")
+		return
+	}
+
+	slog.InfoContext(r.Context(), "email verified", "target_user_id", userID)
+	writePage(w, pageData{Title: "Email confirmed", Text: "You will get Waffle Talkie digests at " + stored.Address + "."})
+}
+
+// HandleListen renders a page that plays a message in the browser.
+func (h *Handler) HandleListen(w http.ResponseWriter, r *http.Request) {
+	user, message, ok := h.listenTarget(w, r)
+	if !ok {
+		return
+	}
+
+	sender := "Someone"
+	if u, err := h.queries.GetUser(r.Context(), message.SenderUserID); err == nil {
+		sender = u.Name
+	}
+	audioURL := "/email/v1/listen/" + message.ID + "/audio?" + r.URL.RawQuery
+	writePage(w, pageData{
+		Title:    "Message from " + sender,
+		Text:     message.CreatedAt.In(notify.Location(user)).Format("Monday 2 January 15:04"),
+		AudioURL: template.URL(audioURL),
+	})
+}
+
+// HandleListenAudio streams the audio for a listen link, honoring Range
+// requests, and records the message as received.
+func (h *Handler) HandleListenAudio(w http.ResponseWriter, r *http.Request) {
+	user, message, ok := h.listenTarget(w, r)
+	if !ok {
+		return
+	}
+
+	rendition := audio.Playback(message)
+	if _, err := os.Stat(rendition.Path); os.IsNotExist(err) {
+		slog.ErrorContext(r.Context(), "audio file not found", "path", rendition.Path)
+		apierror.Write(w, http.StatusNotFound, apierror.CodeAudioFileNotFound, "Audio file not found")
+		return
+	}
+
+	_, err := h.queries.GetReceipt(r.Context(), database.GetReceiptParams{
+		AudioMessageID: message.ID,
+		UserID:         user.ID,
+	})
+	if err == sql.ErrNoRows {
+		if _, err := h.queries.CreateReceipt(r.Context(), database.CreateReceiptParams{
+			AudioMessageID: message.ID,
+			UserID:         user.ID,
+		}); err != nil {
+			slog.ErrorContext(r.Context(), "failed to create receipt", "error", err)
+		}
+	}
+
+	w.Header().Set("Content-Type", rendition.ContentType)
+	http.ServeFile(w, r, rendition.Path)
+}
+
+// listenTarget checks a listen link and loads its user and message, writing
+// an error response if it cannot.
+func (h *Handler) listenTarget(w http.ResponseWriter, r *http.Request) (database.User, database.AudioMessage, bool) {
+	userID, token, messageID := r.URL.Query().Get("user"), r.URL.Query().Get("token"), r.PathValue("id")
+	if h.links.check(purposeListen, token, time.Now(), userID, messageID) != nil {
+		apierror.Write(w, http.StatusForbidden, apierror.CodeLinkInvalid, "This link is invalid or has expired")
+		return database.User{}, database.AudioMessage{}, false
+	}
+
+	user, err := h.queries.GetUser(r.Context(), userID)
+	if err == sql.ErrNoRows {
+		apierror.Write(w, http.StatusForbidden, apierror.CodeLinkInvalid, "This link is invalid or has expired")
+		return database.User{}, database.AudioMessage{}, false
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get user", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Internal server error")
+		return database.User{}, database.AudioMessage{}, false
+	}
+	if users.UserStatus(user.Status) == users.UserStatusSuspended {
+		apierror.Write(w, http.StatusForbidden, apierror.CodeUserSuspended, "User is suspended")
+		return database.User{}, database.AudioMessage{}, false
+	}
+
+	message, err := h.queries.GetAudioMessage(r.Context(), messageID)
+	if err == sql.ErrNoRows || (err == nil && (message.DeletedAt.Valid || message.ProcessingStatus != audio.StatusReady)) {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeMessageNotFound, "Message not found")
+		return database.User{}, database.AudioMessage{}, false
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get message", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve message")
+		return database.User{}, database.AudioMessage{}, false
+	}
+	return user, message, true
+}
+
+// HandleUnsubscribePage asks for confirmation before unsubscribing, so link
+// scanners that open every URL in an email do not unsubscribe anyone.
+func (h *Handler) HandleUnsubscribePage(w http.ResponseWriter, r *http.Request) {
+	if !h.checkUnsubscribe(w, r) {
+		return
+	}
+	writePage(w, pageData{
+		Title:      "Unsubscribe",
+		Text:       "Stop getting Waffle Talkie digests by email?",
+		FormAction: template.URL("/email/v1/unsubscribe?" + r.URL.RawQuery),
+	})
+}
+
+// HandleUnsubscribe turns off the user's digests. It also serves one-click
+// unsubscribes (RFC 8058) from mail clients.
+func (h *Handler) HandleUnsubscribe(w http.ResponseWriter, r *http.Request) {
+	if !h.checkUnsubscribe(w, r) {
+		return
+	}
+
+	userID := r.URL.Query().Get("user")
+	if _, err := h.queries.SetEmailDigest(r.Context(), database.SetEmailDigestParams{
+		Digest: string(DigestOff),
+		UserID: userID,
+	}); err != nil {
+		slog.ErrorContext(r.Context(), "failed to unsubscribe", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to unsubscribe")
+		return
+	}
+
+	slog.InfoContext(r.Context(), "digests unsubscribed", "target_user_id", userID)
+	writePage(w, pageData{Title: "Unsubscribed", Text: "You will no longer get Waffle Talkie digests by email."})
+}
+
+func (h *Handler) checkUnsubscribe(w http.ResponseWriter, r *http.Request) bool {
+	userID, token := r.URL.Query().Get("user"), r.URL.Query().Get("token")
+	if h.links.check(purposeUnsubscribe, token, time.Now(), userID) != nil {
+		apierror.Write(w, http.StatusForbidden, apierror.CodeLinkInvalid, "This link is invalid or has expired")
+		return false
+	}
+	return true
+}
+
+func newSettings(stored database.UserEmail) Settings {
+	settings := Settings{
+		Address:  &stored.Address,
+		Verified: stored.VerifiedAt.Valid,
+		Digest:   Digest(stored.Digest),
+	}
+	if stored.LastDigestAt.Valid {
+		settings.LastDigestAt = &stored.LastDigestAt.Time
+	}
+	return settings
+}
+
+func writeSettings(w http.ResponseWriter, settings Settings) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+type pageData struct {
+	Title      string
+	Text       string
+	AudioURL   template.URL
+	FormAction template.URL
+}
+
+var pageTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}} - Waffle Talkie</title>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{.Text}}</p>
+{{if .AudioURL}}<audio controls preload="metadata" src="{{.AudioURL}}"></audio>{{end}}
+{{if .FormAction}}<form method="post" action="{{.FormAction}}"><button type="submit">Unsubscribe</button></form>{{end}}
+</body>
+</html>
+`))
+
+// writePage renders the small HTML pages shown to people following links.
+func writePage(w http.ResponseWriter, data pageData) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	pageTemplate.Execute(w, data)
+}
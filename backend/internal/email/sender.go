@@ -0,0 +1,143 @@
+// Package email stores users' email addresses, sends them digests of the
+// messages they have not heard and serves the signed links those emails carry.
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Message is a plain-text email to a single recipient.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+	// Headers are extra headers, such as List-Unsubscribe.
+	Headers map[string]string
+}
+
+// Sender delivers email.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// SMTPSender delivers email through an SMTP relay, upgrading to TLS when the
+// relay offers STARTTLS. From may include a display name. Username and
+// Password are optional.
+type SMTPSender struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+// sendTimeout bounds a whole SMTP conversation when ctx has no deadline.
+const sendTimeout = time.Minute
+
+func (s *SMTPSender) Send(ctx context.Context, msg Message) error {
+	data, err := s.format(msg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	host, _, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		return fmt.Errorf("invalid SMTP address %q: %w", s.Addr, err)
+	}
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", s.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(sendTimeout)
+	}
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to start SMTP session: %w", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+	if s.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.Username, s.Password, host)); err != nil {
+			return fmt.Errorf("failed to authenticate: %w", err)
+		}
+	}
+	from, err := mail.ParseAddress(s.From)
+	if err != nil {
+		return fmt.Errorf("invalid from address %q: %w", s.From, err)
+	}
+	if err := client.Mail(from.Address); err != nil {
+		return fmt.Errorf("failed to set sender: %w", err)
+	}
+	if err := client.Rcpt(msg.To); err != nil {
+		return fmt.Errorf("failed to set recipient: %w", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("failed to start message: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	return client.Quit()
+}
+
+var errHeaderInjection = errors.New("email header contains a line break")
+
+// format renders msg as a MIME message with a quoted-printable UTF-8 body.
+func (s *SMTPSender) format(msg Message, now time.Time) ([]byte, error) {
+	headers := map[string]string{
+		"From":                      s.From,
+		"To":                        msg.To,
+		"Subject":                   mime.QEncoding.Encode("utf-8", msg.Subject),
+		"Date":                      now.Format(time.RFC1123Z),
+		"MIME-Version":              "1.0",
+		"Content-Type":              "text/plain; charset=utf-8",
+		"Content-Transfer-Encoding": "quoted-printable",
+	}
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+
+	keys := make([]string, 0, len(headers))
+	for k, v := range headers {
+		if strings.ContainsAny(k+v, "\r\n") {
+			return nil, errHeaderInjection
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	for _, k := range keys {
+		fmt.Fprintf(&buf, "%s: %s\r\n", k, headers[k])
+	}
+	buf.WriteString("\r\n")
+	qp := quotedprintable.NewWriter(&buf)
+	qp.Write([]byte(strings.ReplaceAll(msg.Body, "\n", "\r\n")))
+	qp.Close()
+	return buf.Bytes(), nil
+}
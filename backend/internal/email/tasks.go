@@ -0,0 +1,34 @@
+package email
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+type TaskManager struct {
+	digester *Digester
+}
+
+func NewTaskManager(digester *Digester) *TaskManager {
+	return &TaskManager{
+		digester: digester,
+	}
+}
+
+func (tm *TaskManager) Start(ctx context.Context) error {
+	slog.Info("starting email tasks")
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Hour):
+				if err := tm.digester.SendDue(ctx, time.Now()); err != nil {
+					slog.Error("failed to send digests", "error", err)
+				}
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,392 @@
+// Package feed serves each user a private podcast feed of the messages sent
+// to them, for relatives who would rather use a podcast app.
+package feed
+
+import (
+	"database/sql"
+	"encoding/json"
+	"encoding/xml"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/alecdray/waffle-talkie/internal/apierror"
+	"github.com/alecdray/waffle-talkie/internal/audio"
+	"github.com/alecdray/waffle-talkie/internal/audit"
+	"github.com/alecdray/waffle-talkie/internal/auth"
+	"github.com/alecdray/waffle-talkie/internal/database"
+	"github.com/alecdray/waffle-talkie/internal/notify"
+	"github.com/alecdray/waffle-talkie/internal/users"
+)
+
+// Handler manages feed URLs and serves the feeds.
+type Handler struct {
+	queries   *database.Queries
+	publicURL string
+	audit     *audit.Logger
+}
+
+// NewHandler creates a feed handler. publicURL is the address podcast apps
+// reach the server at.
+func NewHandler(queries *database.Queries, publicURL string, auditLog *audit.Logger) *Handler {
+	return &Handler{
+		queries:   queries,
+		publicURL: strings.TrimSuffix(publicURL, "/"),
+		audit:     auditLog,
+	}
+}
+
+// RegisterRoutes registers the authenticated routes managing the user's feed URL.
+func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /v1/me/feed", h.HandleGetFeedSettings)
+	mux.HandleFunc("POST /v1/me/feed", h.HandleCreateFeed)
+	mux.HandleFunc("PATCH /v1/me/feed", h.HandleUpdateFeed)
+	mux.HandleFunc("DELETE /v1/me/feed", h.HandleRevokeFeed)
+}
+
+// RegisterFeedRoutes registers the routes podcast apps fetch. They are
+// authorized by the token in the path rather than a bearer token.
+func (h *Handler) RegisterFeedRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /v1/{token}", h.HandleFeed)
+	mux.HandleFunc("GET /v1/{token}/episodes/{id}", h.HandleEpisode)
+}
+
+type FeedSettings struct {
+	Enabled       bool       `json:"enabled"`
+	MarkReceived  bool       `json:"mark_received"`
+	CreatedAt     *time.Time `json:"created_at"`
+	LastFetchedAt *time.Time `json:"last_fetched_at"`
+}
+
+type CreateFeedRequest struct {
+	MarkReceived bool `json:"mark_received"`
+}
+
+type CreateFeedResponse struct {
+	// URL is only ever returned here; the server keeps a hash of its token.
+	URL          string    `json:"url"`
+	MarkReceived bool      `json:"mark_received"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type UpdateFeedRequest struct {
+	MarkReceived bool `json:"mark_received"`
+}
+
+// HandleGetFeedSettings reports whether the authenticated user has a feed URL.
+func (h *Handler) HandleGetFeedSettings(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "User ID not found")
+		return
+	}
+
+	stored, err := h.queries.GetFeedToken(r.Context(), userID)
+	if err == sql.ErrNoRows {
+		writeJSON(w, http.StatusOK, FeedSettings{})
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get feed token", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to get feed settings")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newFeedSettings(stored))
+}
+
+// HandleCreateFeed issues a new feed URL, replacing any previous one.
+func (h *Handler) HandleCreateFeed(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "User ID not found")
+		return
+	}
+
+	var req CreateFeedRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidBody, "Invalid request body")
+		return
+	}
+
+	token, err := newToken()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to generate feed token", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to create feed")
+		return
+	}
+	stored, err := h.queries.UpsertFeedToken(r.Context(), database.UpsertFeedTokenParams{
+		UserID:       userID,
+		TokenHash:    hashToken(token),
+		MarkReceived: req.MarkReceived,
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to store feed token", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to create feed")
+		return
+	}
+
+	h.audit.Record(r, audit.Event{
+		Action:      audit.ActionFeedCreated,
+		ActorUserID: userID,
+		TargetType:  audit.TargetUser,
+		TargetID:    userID,
+	})
+
+	writeJSON(w, http.StatusCreated, CreateFeedResponse{
+		URL:          h.publicURL + "/feed/v1/" + token,
+		MarkReceived: stored.MarkReceived,
+		CreatedAt:    stored.CreatedAt,
+	})
+}
+
+// HandleUpdateFeed changes whether episode downloads mark messages received,
+// keeping the feed URL.
+func (h *Handler) HandleUpdateFeed(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "User ID not found")
+		return
+	}
+
+	var req UpdateFeedRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidBody, "Invalid request body")
+		return
+	}
+
+	rows, err := h.queries.SetFeedMarkReceived(r.Context(), database.SetFeedMarkReceivedParams{
+		MarkReceived: req.MarkReceived,
+		UserID:       userID,
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to update feed", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update feed")
+		return
+	}
+	if rows == 0 {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeFeedNotFound, "No feed URL has been created")
+		return
+	}
+
+	h.HandleGetFeedSettings(w, r)
+}
+
+// HandleRevokeFeed deletes the feed URL so podcast apps can no longer fetch it.
+func (h *Handler) HandleRevokeFeed(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "User ID not found")
+		return
+	}
+
+	rows, err := h.queries.DeleteFeedToken(r.Context(), userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to revoke feed", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to revoke feed")
+		return
+	}
+	if rows > 0 {
+		h.audit.Record(r, audit.Event{
+			Action:      audit.ActionFeedRevoked,
+			ActorUserID: userID,
+			TargetType:  audit.TargetUser,
+			TargetID:    userID,
+		})
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleFeed serves the RSS feed of every message available to the token's
+// user, newest first, with one episode per message.
+func (h *Handler) HandleFeed(w http.ResponseWriter, r *http.Request) {
+	token := r.PathValue("token")
+	stored, user, ok := h.feedOwner(w, r, token)
+	if !ok {
+		return
+	}
+
+	messages, err := h.queries.ListAudioMessages(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to list messages", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to build feed")
+		return
+	}
+	dbUsers, err := h.queries.ListUsers(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to list users", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to build feed")
+		return
+	}
+	names := make(map[string]string, len(dbUsers))
+	for _, u := range dbUsers {
+		names[u.ID] = u.Name
+	}
+
+	loc := notify.Location(user)
+	doc := rss{
+		Version:  "2.0",
+		ITunesNS: "http://www.itunes.com/dtds/podcast-1.0.dtd",
+		Channel: channel{
+			Title:       "Waffle Talkie for " + user.Name,
+			Link:        h.publicURL,
+			Description: "Voice messages sent to " + user.Name + " on Waffle Talkie.",
+			Language:    "en",
+			Author:      "Waffle Talkie",
+			Block:       "Yes",
+			Explicit:    "false",
+			Items:       []item{},
+		},
+	}
+	for _, message := range messages {
+		if message.SenderUserID == user.ID || message.ProcessingStatus != audio.StatusReady {
+			continue
+		}
+		rendition := audio.Playback(message)
+		info, err := os.Stat(rendition.Path)
+		if err != nil {
+			continue
+		}
+		sender, ok := names[message.SenderUserID]
+		if !ok {
+			sender = "Someone"
+		}
+		title := sender + ", " + message.CreatedAt.In(loc).Format("Mon 2 Jan 15:04")
+		if message.Title.Valid {
+			title = sender + ": " + message.Title.String
+		}
+		doc.Channel.Items = append(doc.Channel.Items, item{
+			Title:       title,
+			Description: message.Caption.String,
+			GUID:        guid{Value: message.ID},
+			PubDate:     message.CreatedAt.UTC().Format(time.RFC1123Z),
+			Enclosure:   enclosure{URL: h.publicURL + "/feed/v1/" + url.PathEscape(token) + "/episodes/" + url.PathEscape(message.ID), Length: info.Size(), Type: rendition.ContentType},
+			Author:      sender,
+			Duration:    itunesDuration(message.Duration),
+			EpisodeType: "full",
+		})
+	}
+
+	if err := h.queries.TouchFeedToken(r.Context(), database.TouchFeedTokenParams{
+		LastFetchedAt: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+		UserID:        stored.UserID,
+	}); err != nil {
+		slog.ErrorContext(r.Context(), "failed to record feed fetch", "error", err)
+	}
+
+	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.Write([]byte(xml.Header))
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		slog.ErrorContext(r.Context(), "failed to write feed", "error", err)
+	}
+}
+
+// HandleEpisode serves an episode's audio, honoring Range requests. If the
+// feed was created with mark_received, downloading it marks the message
+// received; podcast apps that download episodes automatically count too.
+func (h *Handler) HandleEpisode(w http.ResponseWriter, r *http.Request) {
+	stored, user, ok := h.feedOwner(w, r, r.PathValue("token"))
+	if !ok {
+		return
+	}
+
+	message, err := h.queries.GetAudioMessage(r.Context(), r.PathValue("id"))
+	if err == sql.ErrNoRows || (err == nil && message.ProcessingStatus != audio.StatusReady) {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeMessageNotFound, "Message not found")
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get message", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve message")
+		return
+	}
+
+	rendition := audio.Playback(message)
+	file, err := os.Open(rendition.Path)
+	if os.IsNotExist(err) {
+		slog.ErrorContext(r.Context(), "audio file not found", "path", rendition.Path)
+		apierror.Write(w, http.StatusNotFound, apierror.CodeAudioFileNotFound, "Audio file not found")
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to open audio file", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve message")
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to stat audio file", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve message")
+		return
+	}
+
+	if stored.MarkReceived && r.Method == http.MethodGet && message.SenderUserID != user.ID {
+		_, err := h.queries.GetReceipt(r.Context(), database.GetReceiptParams{
+			AudioMessageID: message.ID,
+			UserID:         user.ID,
+		})
+		if err == sql.ErrNoRows {
+			if _, err := h.queries.CreateReceipt(r.Context(), database.CreateReceiptParams{
+				AudioMessageID: message.ID,
+				UserID:         user.ID,
+			}); err != nil {
+				slog.ErrorContext(r.Context(), "failed to create receipt", "error", err)
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", rendition.ContentType)
+	http.ServeContent(w, r, "", info.ModTime(), file)
+}
+
+// feedOwner resolves a feed token to its user, writing an error response if
+// the token is unknown or the user may no longer receive messages.
+func (h *Handler) feedOwner(w http.ResponseWriter, r *http.Request, token string) (database.FeedToken, database.User, bool) {
+	stored, err := h.queries.GetFeedTokenByHash(r.Context(), hashToken(token))
+	if err == sql.ErrNoRows {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeFeedNotFound, "Feed not found")
+		return database.FeedToken{}, database.User{}, false
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get feed token", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Internal server error")
+		return database.FeedToken{}, database.User{}, false
+	}
+
+	user, err := h.queries.GetUser(r.Context(), stored.UserID)
+	if err == sql.ErrNoRows {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeFeedNotFound, "Feed not found")
+		return database.FeedToken{}, database.User{}, false
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get user", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Internal server error")
+		return database.FeedToken{}, database.User{}, false
+	}
+	if users.UserStatus(user.Status) == users.UserStatusSuspended {
+		apierror.Write(w, http.StatusForbidden, apierror.CodeUserSuspended, "User is suspended")
+		return database.FeedToken{}, database.User{}, false
+	}
+	return stored, user, true
+}
+
+func newFeedSettings(stored database.FeedToken) FeedSettings {
+	settings := FeedSettings{
+		Enabled:      true,
+		MarkReceived: stored.MarkReceived,
+		CreatedAt:    &stored.CreatedAt,
+	}
+	if stored.LastFetchedAt.Valid {
+		settings.LastFetchedAt = &stored.LastFetchedAt.Time
+	}
+	return settings
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
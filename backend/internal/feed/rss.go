@@ -0,0 +1,54 @@
+package feed
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+// rss is an RSS 2.0 document with the iTunes podcast extensions that podcast
+// apps rely on.
+type rss struct {
+	XMLName  xml.Name `xml:"rss"`
+	Version  string   `xml:"version,attr"`
+	ITunesNS string   `xml:"xmlns:itunes,attr"`
+	Channel  channel  `xml:"channel"`
+}
+
+type channel struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	Description string `xml:"description"`
+	Language    string `xml:"language"`
+	Author      string `xml:"itunes:author"`
+	// Block keeps the private feed out of podcast directories.
+	Block    string `xml:"itunes:block"`
+	Explicit string `xml:"itunes:explicit"`
+	Items    []item `xml:"item"`
+}
+
+type item struct {
+	Title       string    `xml:"title"`
+	Description string    `xml:"description,omitempty"`
+	GUID        guid      `xml:"guid"`
+	PubDate     string    `xml:"pubDate"`
+	Enclosure   enclosure `xml:"enclosure"`
+	Author      string    `xml:"itunes:author"`
+	Duration    string    `xml:"itunes:duration"`
+	EpisodeType string    `xml:"itunes:episodeType"`
+}
+
+type guid struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type enclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// itunesDuration formats seconds as HH:MM:SS.
+func itunesDuration(seconds int64) string {
+	return fmt.Sprintf("%02d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+}
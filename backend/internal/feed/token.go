@@ -0,0 +1,26 @@
+package feed
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+// newToken returns a random feed token. Feed URLs are typed into podcast apps
+// that cannot send headers, so the token is the only credential.
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate feed token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the stored form of a token. Tokens are long and random,
+// so a fast hash is enough to keep a leaked database from exposing feeds.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
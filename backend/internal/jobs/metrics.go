@@ -0,0 +1,17 @@
+package jobs
+
+import "github.com/alecdray/waffle-talkie/internal/metrics"
+
+var (
+	jobResults = metrics.NewCounter(
+		"waffle_jobs_total",
+		"Job attempts, by kind and result.",
+		"kind", "result",
+	)
+	jobDuration = metrics.NewHistogram(
+		"waffle_job_duration_seconds",
+		"Time spent running a job attempt, by kind.",
+		metrics.DefaultBuckets,
+		"kind",
+	)
+)
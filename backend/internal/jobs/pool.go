@@ -0,0 +1,246 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/alecdray/waffle-talkie/internal/database"
+)
+
+// Handler runs jobs of one kind. Handlers must be safe to run again for the
+// same job: a job is retried after an error, and rerun if its worker dies
+// before recording the result.
+type Handler interface {
+	Handle(ctx context.Context, job database.Job) error
+}
+
+// HandlerFunc adapts a function to Handler.
+type HandlerFunc func(ctx context.Context, job database.Job) error
+
+func (f HandlerFunc) Handle(ctx context.Context, job database.Job) error {
+	return f(ctx, job)
+}
+
+// FailureHandler is implemented by handlers that need to clean up after a job
+// has failed for good.
+type FailureHandler interface {
+	Failed(ctx context.Context, job database.Job, err error)
+}
+
+// PoolOptions tunes a Pool; zero values use the defaults.
+type PoolOptions struct {
+	// Workers is how many jobs run at once. Default 2.
+	Workers int
+	// MaxAttempts is how many times a job runs before it fails. Default 5.
+	MaxAttempts int
+	// Lease is how long a worker may hold a job, and so the longest a job can
+	// run, before it is handed to another worker. Default 5 minutes.
+	Lease time.Duration
+	// RetryDelay is the wait before the first retry, doubled for each further
+	// attempt up to an hour. Default 10 seconds.
+	RetryDelay time.Duration
+	// PollInterval is how often idle workers look for due jobs. Default 1 second.
+	PollInterval time.Duration
+	// Retention is how long finished jobs are kept. Default 7 days.
+	Retention time.Duration
+}
+
+const maxRetryDelay = time.Hour
+
+// Pool runs queued jobs with a fixed number of workers.
+type Pool struct {
+	queries  *database.Queries
+	opts     PoolOptions
+	handlers map[string]Handler
+}
+
+func NewPool(queries *database.Queries, opts PoolOptions) *Pool {
+	if opts.Workers <= 0 {
+		opts.Workers = 2
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 5
+	}
+	if opts.Lease <= 0 {
+		opts.Lease = 5 * time.Minute
+	}
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = 10 * time.Second
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+	if opts.Retention <= 0 {
+		opts.Retention = 7 * 24 * time.Hour
+	}
+	return &Pool{
+		queries:  queries,
+		opts:     opts,
+		handlers: make(map[string]Handler),
+	}
+}
+
+// Register sets the handler for jobs of kind. It must be called before Start.
+func (p *Pool) Register(kind string, handler Handler) {
+	p.handlers[kind] = handler
+}
+
+func (p *Pool) Start(ctx context.Context) error {
+	slog.Info("starting job workers", "workers", p.opts.Workers)
+	for range p.opts.Workers {
+		go p.work(ctx)
+	}
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Hour):
+				deleted, err := p.queries.DeleteFinishedJobs(ctx, sql.NullTime{Time: time.Now().Add(-p.opts.Retention).UTC(), Valid: true})
+				if err != nil {
+					slog.Error("failed to delete finished jobs", "error", err)
+				} else if deleted > 0 {
+					slog.Info("deleted finished jobs", "count", deleted)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// work claims and runs due jobs until ctx is done, waiting PollInterval
+// whenever there are none.
+func (p *Pool) work(ctx context.Context) {
+	for {
+		ran, err := p.RunNext(ctx)
+		if err != nil {
+			slog.Error("failed to run job", "error", err)
+		}
+		if ran && err == nil {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(p.opts.PollInterval):
+		}
+	}
+}
+
+// RunNext claims one due job and runs it, reporting whether there was one.
+// Jobs whose lease has expired are due again.
+func (p *Pool) RunNext(ctx context.Context) (bool, error) {
+	// Idle workers only read, so polling does not contend for the write lock.
+	now := time.Now().UTC()
+	due, err := p.queries.CountDueJobs(ctx, now)
+	if err != nil {
+		return false, fmt.Errorf("failed to check for due jobs: %w", err)
+	}
+	if due == 0 {
+		return false, nil
+	}
+
+	job, err := p.queries.ClaimJob(ctx, database.ClaimJobParams{
+		LeaseExpiresAt: sql.NullTime{Time: now.Add(p.opts.Lease), Valid: true},
+		Now:            now,
+	})
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to claim job: %w", err)
+	}
+	return true, p.run(ctx, job)
+}
+
+func (p *Pool) run(ctx context.Context, job database.Job) error {
+	start := time.Now()
+	logger := slog.With("job_id", job.ID, "kind", job.Kind, "attempt", job.Attempts)
+
+	handler, ok := p.handlers[job.Kind]
+	var err error
+	switch {
+	case !ok:
+		err = Permanent(fmt.Errorf("no handler for job kind %q", job.Kind))
+	case job.Attempts > int64(p.opts.MaxAttempts):
+		// The last attempt's worker died holding the lease.
+		err = Permanent(errors.New("lease expired on the final attempt"))
+	default:
+		err = p.handle(ctx, handler, job)
+	}
+	if ctx.Err() != nil {
+		// Shutting down; the lease lapses and the job runs again later.
+		return nil
+	}
+	jobDuration.ObserveDuration(start, job.Kind)
+
+	if err == nil {
+		jobResults.Inc(job.Kind, "success")
+		_, err := p.queries.CompleteJob(ctx, database.CompleteJobParams{
+			FinishedAt: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+			ID:         job.ID,
+			Attempts:   job.Attempts,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to complete job %d: %w", job.ID, err)
+		}
+		return nil
+	}
+
+	lastError := sql.NullString{String: err.Error(), Valid: true}
+	if IsPermanent(err) || job.Attempts >= int64(p.opts.MaxAttempts) {
+		jobResults.Inc(job.Kind, "failed")
+		logger.Error("job failed", "error", err)
+		updated, dbErr := p.queries.FailJob(ctx, database.FailJobParams{
+			LastError:  lastError,
+			FinishedAt: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+			ID:         job.ID,
+			Attempts:   job.Attempts,
+		})
+		if dbErr != nil {
+			return fmt.Errorf("failed to record job %d failure: %w", job.ID, dbErr)
+		}
+		// updated is zero if the lease was lost and another worker owns the job.
+		if failureHandler, ok := handler.(FailureHandler); ok && updated > 0 {
+			failureHandler.Failed(ctx, job, err)
+		}
+		return nil
+	}
+
+	jobResults.Inc(job.Kind, "retry")
+	delay := p.retryDelay(job.Attempts)
+	logger.Warn("job failed, retrying", "error", err, "retry_in", delay)
+	if _, err := p.queries.RetryJob(ctx, database.RetryJobParams{
+		RunAt:     time.Now().Add(delay).UTC(),
+		LastError: lastError,
+		ID:        job.ID,
+		Attempts:  job.Attempts,
+	}); err != nil {
+		return fmt.Errorf("failed to reschedule job %d: %w", job.ID, err)
+	}
+	return nil
+}
+
+// handle runs the handler within the job's lease, turning a panic into an error.
+func (p *Pool) handle(ctx context.Context, handler Handler, job database.Job) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, p.opts.Lease)
+	defer cancel()
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return handler.Handle(ctx, job)
+}
+
+// retryDelay is the exponential backoff after the given attempt.
+func (p *Pool) retryDelay(attempt int64) time.Duration {
+	delay := p.opts.RetryDelay
+	for i := int64(1); i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
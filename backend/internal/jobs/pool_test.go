@@ -0,0 +1,222 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alecdray/waffle-talkie/internal/database"
+)
+
+func newTestPool(t *testing.T, opts PoolOptions) (*Pool, *database.Queries, *sql.DB) {
+	t.Helper()
+	sqlDB, queries, err := database.InitDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to init database: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	return NewPool(queries, opts), queries, sqlDB
+}
+
+// claimExpired claims the next due job as a worker that then dies, leaving a
+// lease that has already run out.
+func claimExpired(t *testing.T, queries *database.Queries) database.Job {
+	t.Helper()
+	now := time.Now().UTC()
+	job, err := queries.ClaimJob(context.Background(), database.ClaimJobParams{
+		LeaseExpiresAt: sql.NullTime{Time: now.Add(-time.Second), Valid: true},
+		Now:            now,
+	})
+	if err != nil {
+		t.Fatalf("failed to claim job: %v", err)
+	}
+	return job
+}
+
+func getJob(t *testing.T, queries *database.Queries, id int64) database.Job {
+	t.Helper()
+	job, err := queries.GetJob(context.Background(), id)
+	if err != nil {
+		t.Fatalf("failed to get job: %v", err)
+	}
+	return job
+}
+
+func TestRetryDelay(t *testing.T) {
+	p := NewPool(nil, PoolOptions{RetryDelay: 10 * time.Second})
+	for _, tc := range []struct {
+		attempt int64
+		want    time.Duration
+	}{
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{6, 320 * time.Second},
+		{9, 2560 * time.Second},
+		{10, time.Hour},
+		{1000, time.Hour},
+	} {
+		if got := p.retryDelay(tc.attempt); got != tc.want {
+			t.Errorf("attempt %d: expected %v, got %v", tc.attempt, tc.want, got)
+		}
+	}
+}
+
+func TestRetryBacksOff(t *testing.T) {
+	ctx := context.Background()
+	p, queries, _ := newTestPool(t, PoolOptions{RetryDelay: time.Minute})
+	p.Register("test.flaky", HandlerFunc(func(ctx context.Context, job database.Job) error {
+		return errors.New("not yet")
+	}))
+	job, err := NewQueue(queries).Enqueue(ctx, "test.flaky", nil)
+	if err != nil {
+		t.Fatalf("failed to enqueue: %v", err)
+	}
+
+	before := time.Now()
+	if ran, err := p.RunNext(ctx); !ran || err != nil {
+		t.Fatalf("expected the job to run, got %v (%v)", ran, err)
+	}
+	job = getJob(t, queries, job.ID)
+	if job.State != StateQueued || job.LastError.String != "not yet" || job.LeaseExpiresAt.Valid {
+		t.Errorf("expected the job queued again with its error, got %+v", job)
+	}
+	if wait := job.RunAt.Sub(before); wait < time.Minute || wait > time.Minute+5*time.Second {
+		t.Errorf("expected the retry a minute away, got %v", wait)
+	}
+	if ran, _ := p.RunNext(ctx); ran {
+		t.Error("expected the job to wait out its backoff")
+	}
+}
+
+func TestLeaseExpiry(t *testing.T) {
+	ctx := context.Background()
+	p, queries, sqlDB := newTestPool(t, PoolOptions{})
+	var runs []int64
+	p.Register("test.lease", HandlerFunc(func(ctx context.Context, job database.Job) error {
+		runs = append(runs, job.Attempts)
+		return nil
+	}))
+	job, err := NewQueue(queries).Enqueue(ctx, "test.lease", nil)
+	if err != nil {
+		t.Fatalf("failed to enqueue: %v", err)
+	}
+
+	// A job leased to a live worker is left alone.
+	if _, err := queries.ClaimJob(ctx, database.ClaimJobParams{
+		LeaseExpiresAt: sql.NullTime{Time: time.Now().UTC().Add(time.Minute), Valid: true},
+		Now:            time.Now().UTC(),
+	}); err != nil {
+		t.Fatalf("failed to claim job: %v", err)
+	}
+	if ran, _ := p.RunNext(ctx); ran {
+		t.Fatal("expected a leased job not to be claimed")
+	}
+
+	// Once the lease runs out, another worker takes it over.
+	if _, err := sqlDB.ExecContext(ctx, "UPDATE jobs SET lease_expires_at = ? WHERE id = ?", time.Now().UTC().Add(-time.Second), job.ID); err != nil {
+		t.Fatalf("failed to expire lease: %v", err)
+	}
+	if ran, err := p.RunNext(ctx); !ran || err != nil {
+		t.Fatalf("expected the expired lease to be reclaimed, got %v (%v)", ran, err)
+	}
+	job = getJob(t, queries, job.ID)
+	if len(runs) != 1 || runs[0] != 2 || job.State != StateSucceeded || job.Attempts != 2 {
+		t.Errorf("expected the job to succeed on its second attempt, ran %v: %+v", runs, job)
+	}
+}
+
+func TestLeaseExpiredOnFinalAttempt(t *testing.T) {
+	ctx := context.Background()
+	p, queries, _ := newTestPool(t, PoolOptions{MaxAttempts: 1})
+	runs := 0
+	p.Register("test.final", HandlerFunc(func(ctx context.Context, job database.Job) error {
+		runs++
+		return nil
+	}))
+	job, err := NewQueue(queries).Enqueue(ctx, "test.final", nil)
+	if err != nil {
+		t.Fatalf("failed to enqueue: %v", err)
+	}
+	claimExpired(t, queries)
+
+	if ran, err := p.RunNext(ctx); !ran || err != nil {
+		t.Fatalf("expected the expired lease to be reclaimed, got %v (%v)", ran, err)
+	}
+	job = getJob(t, queries, job.ID)
+	if runs != 0 || job.State != StateFailed || job.LastError.String != "lease expired on the final attempt" {
+		t.Errorf("expected the job failed without running again, ran %d: %+v", runs, job)
+	}
+}
+
+// recordingFailures is a handler whose jobs always fail for good.
+type recordingFailures struct {
+	failed []int64
+}
+
+func (h *recordingFailures) Handle(ctx context.Context, job database.Job) error {
+	return Permanent(errors.New("broken"))
+}
+
+func (h *recordingFailures) Failed(ctx context.Context, job database.Job, err error) {
+	h.failed = append(h.failed, job.Attempts)
+}
+
+func TestStaleAttemptCannotFinishJob(t *testing.T) {
+	ctx := context.Background()
+	p, queries, sqlDB := newTestPool(t, PoolOptions{RetryDelay: time.Hour})
+	succeed := true
+	p.Register("test.stale", HandlerFunc(func(ctx context.Context, job database.Job) error {
+		if succeed {
+			return nil
+		}
+		return errors.New("still failing")
+	}))
+	job, err := NewQueue(queries).Enqueue(ctx, "test.stale", nil)
+	if err != nil {
+		t.Fatalf("failed to enqueue: %v", err)
+	}
+
+	// The first worker stalls past its lease, and a second one takes the job
+	// over and has it retried.
+	stale := claimExpired(t, queries)
+	succeed = false
+	if ran, err := p.RunNext(ctx); !ran || err != nil {
+		t.Fatalf("expected the job to be taken over, got %v (%v)", ran, err)
+	}
+
+	// The stalled worker finishing late must not overwrite the newer attempt.
+	succeed = true
+	if err := p.run(ctx, stale); err != nil {
+		t.Fatalf("failed to run stale attempt: %v", err)
+	}
+	job = getJob(t, queries, job.ID)
+	if job.State != StateQueued || job.Attempts != 2 || job.LastError.String != "still failing" {
+		t.Errorf("expected the second attempt's retry to stand, got %+v", job)
+	}
+
+	// Nor may a late failure, which also skips the failure handler.
+	failures := &recordingFailures{}
+	p.Register("test.stale", failures)
+	if err := p.run(ctx, stale); err != nil {
+		t.Fatalf("failed to run stale attempt: %v", err)
+	}
+	if job = getJob(t, queries, job.ID); job.State != StateQueued || len(failures.failed) != 0 {
+		t.Errorf("expected a stale failure ignored, got %+v and failures %v", job, failures.failed)
+	}
+
+	// The current attempt's failure is recorded and handled.
+	if _, err := sqlDB.ExecContext(ctx, "UPDATE jobs SET run_at = ? WHERE id = ?", time.Now().UTC().Add(-time.Second), job.ID); err != nil {
+		t.Fatalf("failed to make the retry due: %v", err)
+	}
+	if ran, err := p.RunNext(ctx); !ran || err != nil {
+		t.Fatalf("expected the retry to run, got %v (%v)", ran, err)
+	}
+	job = getJob(t, queries, job.ID)
+	if job.State != StateFailed || job.Attempts != 3 || len(failures.failed) != 1 || failures.failed[0] != 3 {
+		t.Errorf("expected the third attempt's failure recorded and handled, got %+v and failures %v", job, failures.failed)
+	}
+}
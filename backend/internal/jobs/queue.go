@@ -0,0 +1,88 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/alecdray/waffle-talkie/internal/database"
+)
+
+// Job states.
+const (
+	StateQueued    = "queued"
+	StateRunning   = "running"
+	StateSucceeded = "succeeded"
+	StateFailed    = "failed"
+)
+
+// Queue adds jobs for a Pool to run. Jobs are stored in the database, so they
+// survive restarts and may be enqueued by any process sharing it.
+type Queue struct {
+	queries *database.Queries
+}
+
+func NewQueue(queries *database.Queries) *Queue {
+	return &Queue{queries: queries}
+}
+
+// WithQueries returns a queue that enqueues through queries, typically bound
+// to a transaction so a job is only stored alongside the rows it refers to.
+func (q *Queue) WithQueries(queries *database.Queries) *Queue {
+	return &Queue{queries: queries}
+}
+
+// Enqueue stores a job of kind to run as soon as a worker is free. payload is
+// encoded as JSON and handed back to the handler through Decode.
+func (q *Queue) Enqueue(ctx context.Context, kind string, payload any) (database.Job, error) {
+	return q.EnqueueAt(ctx, kind, payload, time.Now())
+}
+
+// EnqueueAt stores a job of kind that does not run before runAt.
+func (q *Queue) EnqueueAt(ctx context.Context, kind string, payload any, runAt time.Time) (database.Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return database.Job{}, fmt.Errorf("failed to encode %s job payload: %w", kind, err)
+	}
+	job, err := q.queries.CreateJob(ctx, database.CreateJobParams{
+		Kind:    kind,
+		Payload: string(data),
+		RunAt:   runAt.UTC(),
+	})
+	if err != nil {
+		return database.Job{}, fmt.Errorf("failed to enqueue %s job: %w", kind, err)
+	}
+	return job, nil
+}
+
+// Decode unmarshals the job's payload into v.
+func Decode(job database.Job, v any) error {
+	if err := json.Unmarshal([]byte(job.Payload), v); err != nil {
+		return Permanent(fmt.Errorf("invalid %s job payload: %w", job.Kind, err))
+	}
+	return nil
+}
+
+// permanentError marks a failure that retrying cannot fix.
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so the job fails immediately instead of being retried.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err: err}
+}
+
+// IsPermanent reports whether err was wrapped by Permanent.
+func IsPermanent(err error) bool {
+	var permanent permanentError
+	return errors.As(err, &permanent)
+}
@@ -0,0 +1,151 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+type Format string
+
+const (
+	FormatText Format = "text"
+	FormatJSON Format = "json"
+)
+
+const redacted = "[REDACTED]"
+
+// sensitiveKeys are attribute keys whose values must never reach the log output.
+var sensitiveKeys = map[string]bool{
+	"authorization":  true,
+	"device_id":      true,
+	"device_id_hash": true,
+	"invite_code":    true,
+	"jwt":            true,
+	"password":       true,
+	"secret":         true,
+	"token":          true,
+}
+
+// New creates a logger writing to w in the given format. Request-scoped
+// attributes stored in the context are attached to every record logged with a
+// *Context method, and sensitive attributes are redacted.
+func New(w io.Writer, format Format, level slog.Level) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redact,
+	}
+
+	var handler slog.Handler
+	switch format {
+	case FormatText:
+		handler = slog.NewTextHandler(w, opts)
+	case FormatJSON:
+		handler = slog.NewJSONHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+
+	return slog.New(contextHandler{handler}), nil
+}
+
+// ParseLevel converts a level name such as "debug" or "warn" into a slog.Level.
+func ParseLevel(level string) (slog.Level, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return l, fmt.Errorf("invalid log level %q: %w", level, err)
+	}
+	return l, nil
+}
+
+// secretPathPrefixes are routes whose next path segment is a credential, such
+// as the token in a podcast feed URL.
+var secretPathPrefixes = []string{"/feed/v1/"}
+
+func redact(groups []string, a slog.Attr) slog.Attr {
+	if sensitiveKeys[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, redacted)
+	}
+	if a.Key == "path" && a.Value.Kind() == slog.KindString {
+		return slog.String(a.Key, redactPath(a.Value.String()))
+	}
+	return a
+}
+
+// redactPath replaces the credential segment of a secret route.
+func redactPath(path string) string {
+	for _, prefix := range secretPathPrefixes {
+		if rest, ok := strings.CutPrefix(path, prefix); ok {
+			_, tail, _ := strings.Cut(rest, "/")
+			if tail != "" {
+				tail = "/" + tail
+			}
+			return prefix + redacted + tail
+		}
+	}
+	return path
+}
+
+type contextKey struct{}
+
+// requestAttrs collects attributes for the lifetime of a request. It is shared
+// by pointer so attributes added deep in the handler chain (such as the user ID
+// set by the auth middleware) also appear on records logged by outer middleware.
+type requestAttrs struct {
+	mu        sync.Mutex
+	requestID string
+	attrs     []slog.Attr
+}
+
+// NewContext returns a context carrying a request ID and an empty attribute set.
+func NewContext(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, contextKey{}, &requestAttrs{
+		requestID: requestID,
+		attrs:     []slog.Attr{slog.String("request_id", requestID)},
+	})
+}
+
+// AddAttrs attaches attributes to every later record logged with ctx.
+func AddAttrs(ctx context.Context, attrs ...slog.Attr) {
+	ra, ok := ctx.Value(contextKey{}).(*requestAttrs)
+	if !ok {
+		return
+	}
+	ra.mu.Lock()
+	defer ra.mu.Unlock()
+	ra.attrs = append(ra.attrs, attrs...)
+}
+
+// RequestID returns the request ID carried by ctx, if any.
+func RequestID(ctx context.Context) string {
+	ra, ok := ctx.Value(contextKey{}).(*requestAttrs)
+	if !ok {
+		return ""
+	}
+	return ra.requestID
+}
+
+// contextHandler adds the request-scoped attributes from the context to each record.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if ra, ok := ctx.Value(contextKey{}).(*requestAttrs); ok {
+		ra.mu.Lock()
+		r.AddAttrs(ra.attrs...)
+		ra.mu.Unlock()
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
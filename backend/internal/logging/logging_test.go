@@ -0,0 +1,105 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+const (
+	deviceID   = "device-0b1e2f"
+	token      = "eyJhbGciOiJIUzI1NiJ9.secret"
+	inviteCode = "INVITE-7K3Q"
+	feedToken  = "feed-5d8c2a"
+)
+
+// logSecrets logs every kind of credential through a logger in format, the
+// way handlers and middleware do, and returns the output.
+func logSecrets(t *testing.T, format Format) string {
+	t.Helper()
+	var buf bytes.Buffer
+	logger, err := New(&buf, format, slog.LevelDebug)
+	if err != nil {
+		t.Fatalf("failed to create logger: %v", err)
+	}
+
+	ctx := NewContext(context.Background(), "request-1")
+	AddAttrs(ctx, slog.String("token", token))
+	logger.InfoContext(ctx, "incoming request",
+		"path", "/feed/v1/"+feedToken+"/episodes/message-1",
+		"Authorization", "Bearer "+token,
+		"device_id", deviceID,
+		"device_id_hash", "hash-of-"+deviceID,
+	)
+	logger.Info("feed requested", "path", "/feed/v1/"+feedToken)
+	logger.Info("user registered", slog.Group("request", "invite_code", inviteCode, "DEVICE_ID", deviceID))
+	logger.With("jwt", token).Warn("token rejected", "secret", "jwt-secret", "password", "hunter2")
+	return buf.String()
+}
+
+func TestRedaction(t *testing.T) {
+	for _, format := range []Format{FormatText, FormatJSON} {
+		t.Run(string(format), func(t *testing.T) {
+			out := logSecrets(t, format)
+			for _, secret := range []string{deviceID, token, inviteCode, feedToken, "jwt-secret", "hunter2"} {
+				if strings.Contains(out, secret) {
+					t.Errorf("expected %q redacted, got:\n%s", secret, out)
+				}
+			}
+			for _, kept := range []string{"/feed/v1/" + redacted + "/episodes/message-1", "request-1", "user registered"} {
+				if !strings.Contains(out, kept) {
+					t.Errorf("expected %q in the output, got:\n%s", kept, out)
+				}
+			}
+		})
+	}
+}
+
+func TestRedactPath(t *testing.T) {
+	for _, tc := range []struct {
+		path, want string
+	}{
+		{"/feed/v1/abc", "/feed/v1/" + redacted},
+		{"/feed/v1/abc/episodes/1", "/feed/v1/" + redacted + "/episodes/1"},
+		{"/api/v1/me/feed", "/api/v1/me/feed"},
+		{"/api/v1/audio-messages/1", "/api/v1/audio-messages/1"},
+	} {
+		if got := redactPath(tc.path); got != tc.want {
+			t.Errorf("redactPath(%q) = %q, want %q", tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestContextAttrs(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, FormatJSON, slog.LevelInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := NewContext(context.Background(), "request-2")
+	AddAttrs(ctx, slog.String("user_id", "user-1"))
+	logger.InfoContext(ctx, "handled")
+	logger.DebugContext(ctx, "hidden")
+
+	out := buf.String()
+	if !strings.Contains(out, `"request_id":"request-2"`) || !strings.Contains(out, `"user_id":"user-1"`) {
+		t.Errorf("expected request attributes on the record, got:\n%s", out)
+	}
+	if strings.Contains(out, "hidden") {
+		t.Errorf("expected debug records dropped at info level, got:\n%s", out)
+	}
+	if RequestID(ctx) != "request-2" || RequestID(context.Background()) != "" {
+		t.Error("unexpected request ID")
+	}
+}
+
+func TestNewRejectsUnknownFormat(t *testing.T) {
+	if _, err := New(&bytes.Buffer{}, "xml", slog.LevelInfo); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+	if _, err := ParseLevel("loud"); err == nil {
+		t.Error("expected an error for an unknown level")
+	}
+}
@@ -0,0 +1,381 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are latency buckets in seconds suited to HTTP handlers and queries.
+var DefaultBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// collector is anything that can write itself in the Prometheus text exposition format.
+type collector interface {
+	write(w io.Writer)
+}
+
+// Registry holds metrics and renders them for scraping.
+type Registry struct {
+	mu         sync.Mutex
+	names      []string
+	collectors map[string]collector
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]collector)}
+}
+
+// Default is the registry used by the package-level constructors and Handler.
+var Default = NewRegistry()
+
+// register adds a collector, replacing any previous collector with the same name.
+func (reg *Registry) register(name string, c collector) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if _, ok := reg.collectors[name]; !ok {
+		reg.names = append(reg.names, name)
+		sort.Strings(reg.names)
+	}
+	reg.collectors[name] = c
+}
+
+// Write renders every registered metric.
+func (reg *Registry) Write(w io.Writer) {
+	reg.mu.Lock()
+	collectors := make([]collector, 0, len(reg.names))
+	for _, name := range reg.names {
+		collectors = append(collectors, reg.collectors[name])
+	}
+	reg.mu.Unlock()
+
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
+
+// Handler serves the registry in the Prometheus text exposition format.
+func (reg *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		reg.Write(w)
+	})
+}
+
+// Handler serves the default registry.
+func Handler() http.Handler {
+	return Default.Handler()
+}
+
+// vec stores one value per distinct combination of label values.
+type vec[T any] struct {
+	mu      sync.Mutex
+	labels  []string
+	entries map[string]*entry[T]
+	newItem func() *T
+}
+
+type entry[T any] struct {
+	values []string
+	item   *T
+}
+
+func newVec[T any](labels []string, newItem func() *T) *vec[T] {
+	return &vec[T]{labels: labels, entries: make(map[string]*entry[T]), newItem: newItem}
+}
+
+func (v *vec[T]) with(values ...string) *T {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: expected %d label values, got %d", len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	e, ok := v.entries[key]
+	if !ok {
+		e = &entry[T]{values: append([]string(nil), values...), item: v.newItem()}
+		v.entries[key] = e
+	}
+	return e.item
+}
+
+// sorted returns entries in a stable order so scrapes are deterministic.
+func (v *vec[T]) sorted() []*entry[T] {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	keys := make([]string, 0, len(v.entries))
+	for k := range v.entries {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	entries := make([]*entry[T], len(keys))
+	for i, k := range keys {
+		entries[i] = v.entries[k]
+	}
+	return entries
+}
+
+// value is a float64 guarded by a mutex, shared by counters and gauges.
+type value struct {
+	mu sync.Mutex
+	v  float64
+}
+
+func (val *value) add(delta float64) {
+	val.mu.Lock()
+	val.v += delta
+	val.mu.Unlock()
+}
+
+func (val *value) set(v float64) {
+	val.mu.Lock()
+	val.v = v
+	val.mu.Unlock()
+}
+
+func (val *value) get() float64 {
+	val.mu.Lock()
+	defer val.mu.Unlock()
+	return val.v
+}
+
+// Counter is a monotonically increasing value partitioned by labels.
+type Counter struct {
+	name, help string
+	vec        *vec[value]
+}
+
+// NewCounter registers a counter on the default registry.
+func NewCounter(name, help string, labels ...string) *Counter {
+	return Default.NewCounter(name, help, labels...)
+}
+
+// NewCounter registers a counter on the registry.
+func (reg *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{name: name, help: help, vec: newVec(labels, func() *value { return &value{} })}
+	reg.register(name, c)
+	return c
+}
+
+// Inc increments the counter for the given label values by one.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increments the counter for the given label values. Negative deltas are ignored.
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		return
+	}
+	c.vec.with(labelValues...).add(delta)
+}
+
+func (c *Counter) write(w io.Writer) {
+	writeHeader(w, c.name, c.help, "counter")
+	for _, e := range c.vec.sorted() {
+		writeSample(w, c.name, c.vec.labels, e.values, "", "", e.item.get())
+	}
+}
+
+// Gauge is a value that can go up and down, partitioned by labels.
+type Gauge struct {
+	name, help string
+	vec        *vec[value]
+}
+
+// NewGauge registers a gauge on the default registry.
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return Default.NewGauge(name, help, labels...)
+}
+
+// NewGauge registers a gauge on the registry.
+func (reg *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{name: name, help: help, vec: newVec(labels, func() *value { return &value{} })}
+	reg.register(name, g)
+	return g
+}
+
+// Inc increments the gauge for the given label values by one.
+func (g *Gauge) Inc(labelValues ...string) {
+	g.vec.with(labelValues...).add(1)
+}
+
+// Dec decrements the gauge for the given label values by one.
+func (g *Gauge) Dec(labelValues ...string) {
+	g.vec.with(labelValues...).add(-1)
+}
+
+// Set replaces the gauge value for the given label values.
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.vec.with(labelValues...).set(v)
+}
+
+func (g *Gauge) write(w io.Writer) {
+	writeHeader(w, g.name, g.help, "gauge")
+	for _, e := range g.vec.sorted() {
+		writeSample(w, g.name, g.vec.labels, e.values, "", "", e.item.get())
+	}
+}
+
+// GaugeFunc computes its samples at scrape time. The callback returns one
+// Sample per combination of label values, given in label order.
+type GaugeFunc struct {
+	name, help string
+	labels     []string
+	fn         func() []Sample
+}
+
+// Sample is a single labelled value reported by a GaugeFunc.
+type Sample struct {
+	LabelValues []string
+	Value       float64
+}
+
+// NewGaugeFunc registers a scrape-time gauge on the default registry.
+// Registering the same name again replaces the previous callback.
+func NewGaugeFunc(name, help string, labels []string, fn func() []Sample) {
+	Default.NewGaugeFunc(name, help, labels, fn)
+}
+
+// NewGaugeFunc registers a scrape-time gauge on the registry.
+func (reg *Registry) NewGaugeFunc(name, help string, labels []string, fn func() []Sample) {
+	reg.register(name, &GaugeFunc{name: name, help: help, labels: labels, fn: fn})
+}
+
+func (g *GaugeFunc) write(w io.Writer) {
+	writeHeader(w, g.name, g.help, "gauge")
+	for _, s := range g.fn() {
+		writeSample(w, g.name, g.labels, s.LabelValues, "", "", s.Value)
+	}
+}
+
+// Histogram tracks the distribution of observations in cumulative buckets.
+type Histogram struct {
+	name, help string
+	buckets    []float64
+	vec        *vec[histogramValue]
+}
+
+type histogramValue struct {
+	mu     sync.Mutex
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// NewHistogram registers a histogram on the default registry.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return Default.NewHistogram(name, help, buckets, labels...)
+}
+
+// NewHistogram registers a histogram on the registry.
+func (reg *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	h := &Histogram{name: name, help: help, buckets: buckets}
+	h.vec = newVec(labels, func() *histogramValue {
+		return &histogramValue{counts: make([]uint64, len(buckets))}
+	})
+	reg.register(name, h)
+	return h
+}
+
+// Observe records a single observation for the given label values.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	hv := h.vec.with(labelValues...)
+	hv.mu.Lock()
+	defer hv.mu.Unlock()
+	for i, upper := range h.buckets {
+		if v <= upper {
+			hv.counts[i]++
+		}
+	}
+	hv.sum += v
+	hv.count++
+}
+
+// ObserveDuration records the time elapsed since start in seconds.
+func (h *Histogram) ObserveDuration(start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+func (h *Histogram) write(w io.Writer) {
+	writeHeader(w, h.name, h.help, "histogram")
+	for _, e := range h.vec.sorted() {
+		e.item.mu.Lock()
+		counts := append([]uint64(nil), e.item.counts...)
+		sum, count := e.item.sum, e.item.count
+		e.item.mu.Unlock()
+
+		for i, upper := range h.buckets {
+			writeSample(w, h.name+"_bucket", h.vec.labels, e.values, "le", formatFloat(upper), float64(counts[i]))
+		}
+		writeSample(w, h.name+"_bucket", h.vec.labels, e.values, "le", "+Inf", float64(count))
+		writeSample(w, h.name+"_sum", h.vec.labels, e.values, "", "", sum)
+		writeSample(w, h.name+"_count", h.vec.labels, e.values, "", "", float64(count))
+	}
+}
+
+func writeHeader(w io.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, strings.NewReplacer("\\", `\\`, "\n", `\n`).Replace(help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+}
+
+func writeSample(w io.Writer, name string, labels, values []string, extraLabel, extraValue string, v float64) {
+	var b strings.Builder
+	b.WriteString(name)
+
+	pairs := len(labels)
+	if extraLabel != "" {
+		pairs++
+	}
+	if pairs > 0 {
+		b.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			writeLabel(&b, label, values[i])
+		}
+		if extraLabel != "" {
+			if len(labels) > 0 {
+				b.WriteByte(',')
+			}
+			writeLabel(&b, extraLabel, extraValue)
+		}
+		b.WriteByte('}')
+	}
+
+	b.WriteByte(' ')
+	b.WriteString(formatFloat(v))
+	b.WriteByte('\n')
+	io.WriteString(w, b.String())
+}
+
+var labelEscaper = strings.NewReplacer("\\", `\\`, "\n", `\n`, `"`, `\"`)
+
+func writeLabel(b *strings.Builder, label, value string) {
+	b.WriteString(label)
+	b.WriteString(`="`)
+	b.WriteString(labelEscaper.Replace(value))
+	b.WriteByte('"')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
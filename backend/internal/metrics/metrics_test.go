@@ -0,0 +1,204 @@
+package metrics
+
+import (
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// scrape renders reg as the exposition format text.
+func scrape(reg *Registry) string {
+	var b strings.Builder
+	reg.Write(&b)
+	return b.String()
+}
+
+func TestCounter(t *testing.T) {
+	reg := NewRegistry()
+	c := reg.NewCounter("requests_total", "Requests handled.", "method", "status")
+	c.Inc("GET", "200")
+	c.Inc("GET", "200")
+	c.Add(2.5, "POST", "201")
+	c.Add(-1, "POST", "201")
+
+	want := `# HELP requests_total Requests handled.
+# TYPE requests_total counter
+requests_total{method="GET",status="200"} 2
+requests_total{method="POST",status="201"} 2.5
+`
+	if got := scrape(reg); got != want {
+		t.Errorf("unexpected output:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestCounterWithoutLabels(t *testing.T) {
+	reg := NewRegistry()
+	reg.NewCounter("runs_total", "Runs.")
+	want := "# HELP runs_total Runs.\n# TYPE runs_total counter\n"
+	if got := scrape(reg); got != want {
+		t.Errorf("expected a counter with no samples until used, got:\n%s", got)
+	}
+
+	reg.NewCounter("runs_total", "Runs.").Inc()
+	want += "runs_total 1\n"
+	if got := scrape(reg); got != want {
+		t.Errorf("unexpected output:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestCounterPanicsOnLabelCount(t *testing.T) {
+	c := NewRegistry().NewCounter("things_total", "Things.", "kind")
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic for a missing label value")
+		}
+	}()
+	c.Inc()
+}
+
+func TestGauge(t *testing.T) {
+	reg := NewRegistry()
+	g := reg.NewGauge("streams", "Open streams.", "kind")
+	g.Inc("download")
+	g.Inc("download")
+	g.Dec("download")
+	g.Set(-3, "upload")
+
+	want := `# HELP streams Open streams.
+# TYPE streams gauge
+streams{kind="download"} 1
+streams{kind="upload"} -3
+`
+	if got := scrape(reg); got != want {
+		t.Errorf("unexpected output:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestGaugeFunc(t *testing.T) {
+	reg := NewRegistry()
+	calls := 0
+	reg.NewGaugeFunc("users", "Users by state.", []string{"state"}, func() []Sample {
+		calls++
+		return []Sample{{LabelValues: []string{"active"}, Value: float64(calls)}, {LabelValues: []string{"pending"}, Value: 0}}
+	})
+
+	want := `# HELP users Users by state.
+# TYPE users gauge
+users{state="active"} 1
+users{state="pending"} 0
+`
+	if got := scrape(reg); got != want {
+		t.Errorf("unexpected output:\n%s\nwant:\n%s", got, want)
+	}
+	if got := scrape(reg); !strings.Contains(got, `users{state="active"} 2`) {
+		t.Errorf("expected the callback run on every scrape, got:\n%s", got)
+	}
+
+	reg.NewGaugeFunc("users", "Users by state.", nil, func() []Sample { return []Sample{{Value: 7}} })
+	if got := scrape(reg); got != "# HELP users Users by state.\n# TYPE users gauge\nusers 7\n" {
+		t.Errorf("expected registering again to replace the callback, got:\n%s", got)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	reg := NewRegistry()
+	// Buckets are sorted, whatever order they are given in.
+	h := reg.NewHistogram("latency_seconds", "Latency.", []float64{1, 0.1}, "route")
+	h.Observe(0.05, "/a")
+	h.Observe(0.5, "/a")
+	h.Observe(2, "/a")
+
+	want := `# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/a",le="0.1"} 1
+latency_seconds_bucket{route="/a",le="1"} 2
+latency_seconds_bucket{route="/a",le="+Inf"} 3
+latency_seconds_sum{route="/a"} 2.55
+latency_seconds_count{route="/a"} 3
+`
+	if got := scrape(reg); got != want {
+		t.Errorf("unexpected output:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestHistogramWithoutLabels(t *testing.T) {
+	reg := NewRegistry()
+	reg.NewHistogram("size_bytes", "Sizes.", []float64{10}).Observe(10)
+	want := `# HELP size_bytes Sizes.
+# TYPE size_bytes histogram
+size_bytes_bucket{le="10"} 1
+size_bytes_bucket{le="+Inf"} 1
+size_bytes_sum 10
+size_bytes_count 1
+`
+	if got := scrape(reg); got != want {
+		t.Errorf("unexpected output:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestEscaping(t *testing.T) {
+	reg := NewRegistry()
+	reg.NewCounter("escaped_total", "Help with a \\ backslash\nand a newline.", "path").Inc("C:\\dir\n\"quoted\"")
+
+	want := `# HELP escaped_total Help with a \\ backslash\nand a newline.
+# TYPE escaped_total counter
+escaped_total{path="C:\\dir\n\"quoted\""} 1
+`
+	if got := scrape(reg); got != want {
+		t.Errorf("unexpected output:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestOutputOrder(t *testing.T) {
+	reg := NewRegistry()
+	reg.NewGauge("b_gauge", "B.").Set(1)
+	c := reg.NewCounter("a_total", "A.", "kind")
+	c.Inc("z")
+	c.Inc("a")
+
+	want := `# HELP a_total A.
+# TYPE a_total counter
+a_total{kind="a"} 1
+a_total{kind="z"} 1
+# HELP b_gauge B.
+# TYPE b_gauge gauge
+b_gauge 1
+`
+	if got := scrape(reg); got != want {
+		t.Errorf("expected metrics and samples sorted, got:\n%s", got)
+	}
+}
+
+func TestFormatFloat(t *testing.T) {
+	for _, tc := range []struct {
+		v    float64
+		want string
+	}{
+		{0, "0"},
+		{42, "42"},
+		{0.25, "0.25"},
+		{1e21, "1e+21"},
+		{math.Inf(1), "+Inf"},
+		{math.Inf(-1), "-Inf"},
+		{math.NaN(), "NaN"},
+	} {
+		if got := formatFloat(tc.v); got != tc.want {
+			t.Errorf("formatFloat(%v) = %q, want %q", tc.v, got, tc.want)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	reg := NewRegistry()
+	reg.NewCounter("hits_total", "Hits.").Inc()
+
+	rec := httptest.NewRecorder()
+	reg.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	if !strings.Contains(rec.Body.String(), "hits_total 1\n") {
+		t.Errorf("unexpected body:\n%s", rec.Body.String())
+	}
+}
@@ -0,0 +1,217 @@
+package notify
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/alecdray/waffle-talkie/internal/apierror"
+	"github.com/alecdray/waffle-talkie/internal/auth"
+	"github.com/alecdray/waffle-talkie/internal/database"
+)
+
+// Handler manages the authenticated user's notification settings.
+type Handler struct {
+	queries *database.Queries
+}
+
+func NewHandler(queries *database.Queries) *Handler {
+	return &Handler{
+		queries: queries,
+	}
+}
+
+// RegisterRoutes registers the notification settings routes.
+func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /v1/me/notifications", h.HandleGetSettings)
+	mux.HandleFunc("PUT /v1/me/notifications", h.HandleUpdateSettings)
+	mux.HandleFunc("PUT /v1/me/notifications/mutes/{user_id}", h.HandleMute)
+	mux.HandleFunc("DELETE /v1/me/notifications/mutes/{user_id}", h.HandleUnmute)
+}
+
+type QuietHoursJSON struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+type Settings struct {
+	Mode       Mode            `json:"mode"`
+	QuietHours *QuietHoursJSON `json:"quiet_hours"`
+	// Timezone is the zone quiet hours are evaluated in: the user's profile
+	// timezone, or UTC if they have not set one.
+	Timezone     string   `json:"timezone"`
+	MutedUserIDs []string `json:"muted_user_ids"`
+}
+
+type UpdateSettingsRequest struct {
+	Mode       Mode            `json:"mode"`
+	QuietHours *QuietHoursJSON `json:"quiet_hours"`
+}
+
+// HandleGetSettings returns the authenticated user's notification settings.
+func (h *Handler) HandleGetSettings(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	prefs := DefaultPreferences()
+	stored, err := h.queries.GetNotificationPreferences(r.Context(), user.ID)
+	if err == nil {
+		prefs = FromDatabase(stored)
+	} else if err != sql.ErrNoRows {
+		slog.ErrorContext(r.Context(), "failed to get notification preferences", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to get notification settings")
+		return
+	}
+
+	h.writeSettings(w, r, user, prefs)
+}
+
+// HandleUpdateSettings replaces the authenticated user's notification mode
+// and quiet hours. A null quiet_hours turns quiet hours off.
+func (h *Handler) HandleUpdateSettings(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req UpdateSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeInvalidBody, "Invalid request body")
+		return
+	}
+	if !req.Mode.Valid() {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "mode must be all, digest or none")
+		return
+	}
+
+	params := database.UpsertNotificationPreferencesParams{
+		UserID: user.ID,
+		Mode:   string(req.Mode),
+	}
+	if req.QuietHours != nil {
+		start, startErr := ParseClock(req.QuietHours.Start)
+		end, endErr := ParseClock(req.QuietHours.End)
+		if startErr != nil || endErr != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "quiet_hours start and end must be HH:MM")
+			return
+		}
+		if start == end {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "quiet_hours start and end must differ")
+			return
+		}
+		params.QuietStart = sql.NullString{String: start.String(), Valid: true}
+		params.QuietEnd = sql.NullString{String: end.String(), Valid: true}
+	}
+
+	stored, err := h.queries.UpsertNotificationPreferences(r.Context(), params)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to update notification preferences", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update notification settings")
+		return
+	}
+
+	slog.InfoContext(r.Context(), "notification settings updated", "mode", stored.Mode)
+	h.writeSettings(w, r, user, FromDatabase(stored))
+}
+
+// HandleMute stops alerts about messages from another user.
+func (h *Handler) HandleMute(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	mutedUserID := r.PathValue("user_id")
+	if mutedUserID == user.ID {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "You cannot mute yourself")
+		return
+	}
+	if _, err := h.queries.GetUser(r.Context(), mutedUserID); err == sql.ErrNoRows {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeUserNotFound, "User not found")
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get user", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Internal server error")
+		return
+	}
+
+	if err := h.queries.CreateMute(r.Context(), database.CreateMuteParams{
+		UserID:      user.ID,
+		MutedUserID: mutedUserID,
+	}); err != nil {
+		slog.ErrorContext(r.Context(), "failed to mute user", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to mute user")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleUnmute resumes alerts about messages from another user.
+func (h *Handler) HandleUnmute(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := h.queries.DeleteMute(r.Context(), database.DeleteMuteParams{
+		UserID:      user.ID,
+		MutedUserID: r.PathValue("user_id"),
+	}); err != nil {
+		slog.ErrorContext(r.Context(), "failed to unmute user", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to unmute user")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) writeSettings(w http.ResponseWriter, r *http.Request, user database.User, prefs Preferences) {
+	mutes, err := h.queries.ListMutes(r.Context(), user.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to list mutes", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to get notification settings")
+		return
+	}
+
+	resp := Settings{
+		Mode:         prefs.Mode,
+		Timezone:     Location(user).String(),
+		MutedUserIDs: make([]string, len(mutes)),
+	}
+	if prefs.QuietHours != nil {
+		resp.QuietHours = &QuietHoursJSON{
+			Start: prefs.QuietHours.Start.String(),
+			End:   prefs.QuietHours.End.String(),
+		}
+	}
+	for i, mute := range mutes {
+		resp.MutedUserIDs[i] = mute.MutedUserID
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// currentUser loads the authenticated user, writing an error response if it cannot.
+func (h *Handler) currentUser(w http.ResponseWriter, r *http.Request) (database.User, bool) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "User ID not found")
+		return database.User{}, false
+	}
+
+	user, err := h.queries.GetUser(r.Context(), userID)
+	if err == sql.ErrNoRows {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeUserNotFound, "User not found")
+		return database.User{}, false
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get user", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Internal server error")
+		return database.User{}, false
+	}
+	return user, true
+}
@@ -0,0 +1,257 @@
+package notify
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/alecdray/waffle-talkie/internal/database"
+	"github.com/alecdray/waffle-talkie/internal/users"
+)
+
+// Channel delivers alerts about new messages, e.g. push or email.
+type Channel interface {
+	Name() string
+	Notify(ctx context.Context, recipient database.User, message database.AudioMessage) error
+}
+
+// Retractor is a Channel that can also tell a recipient that a message was
+// unsent, e.g. with a silent push so the app drops its copy.
+type Retractor interface {
+	Retract(ctx context.Context, recipient database.User, message database.AudioMessage) error
+}
+
+// Pending notification kinds.
+const (
+	KindDeferred = "deferred"
+	KindDigest   = "digest"
+)
+
+// Notifier applies Decide to every potential recipient of a message and
+// sends, defers or collects the alerts.
+type Notifier struct {
+	queries  *database.Queries
+	channels []Channel
+}
+
+func New(queries *database.Queries, channels ...Channel) *Notifier {
+	return &Notifier{
+		queries:  queries,
+		channels: channels,
+	}
+}
+
+// MessageSent alerts every approved, non-suspended user other than the sender
+// about a new message, as their preferences allow. Failures are logged.
+func (n *Notifier) MessageSent(ctx context.Context, message database.AudioMessage) {
+	if err := n.messageSent(ctx, message, time.Now()); err != nil {
+		slog.ErrorContext(ctx, "failed to send notifications", "message_id", message.ID, "error", err)
+	}
+}
+
+func (n *Notifier) messageSent(ctx context.Context, message database.AudioMessage, now time.Time) error {
+	recipients, err := n.queries.ListUsers(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list users: %w", err)
+	}
+	stored, err := n.queries.ListNotificationPreferences(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list notification preferences: %w", err)
+	}
+	prefsByUser := make(map[string]database.NotificationPreference, len(stored))
+	for _, p := range stored {
+		prefsByUser[p.UserID] = p
+	}
+	mutedBy, err := n.queries.ListMutesOfSender(ctx, message.SenderUserID)
+	if err != nil {
+		return fmt.Errorf("failed to list mutes: %w", err)
+	}
+	muted := make(map[string]bool, len(mutedBy))
+	for _, userID := range mutedBy {
+		muted[userID] = true
+	}
+
+	msg := Message{SenderUserID: message.SenderUserID}
+	for _, recipient := range recipients {
+		if !recipient.Approved || users.UserStatus(recipient.Status) == users.UserStatusSuspended {
+			continue
+		}
+
+		prefs := DefaultPreferences()
+		if p, ok := prefsByUser[recipient.ID]; ok {
+			prefs = FromDatabase(p)
+		}
+		prefs.Location = Location(recipient)
+
+		decision := Decide(recipient.ID, prefs, muted[recipient.ID], msg, now)
+		switch decision.Action {
+		case ActionSend:
+			n.send(ctx, recipient, message)
+		case ActionDefer, ActionDigest:
+			kind, deliverAt := KindDeferred, decision.DeliverAt
+			if decision.Action == ActionDigest {
+				kind, deliverAt = KindDigest, now.UTC()
+			}
+			if err := n.queries.CreatePendingNotification(ctx, database.CreatePendingNotificationParams{
+				UserID:         recipient.ID,
+				AudioMessageID: message.ID,
+				Kind:           kind,
+				DeliverAfter:   deliverAt,
+			}); err != nil {
+				slog.ErrorContext(ctx, "failed to queue notification", "target_user_id", recipient.ID, "error", err)
+			}
+		}
+		slog.DebugContext(ctx, "notification decision", "target_user_id", recipient.ID, "message_id", message.ID, "action", decision.Action, "reason", decision.Reason)
+	}
+	return nil
+}
+
+// DeliverDeferred sends the alerts held back by quiet hours whose window has
+// ended. Each is decided again, without quiet hours, so a recipient who since
+// muted the sender, turned alerts off or was suspended is not alerted, and one
+// who switched to digests gets the message in their next digest. Alerts for
+// messages that are gone by then are dropped.
+func (n *Notifier) DeliverDeferred(ctx context.Context) error {
+	now := time.Now()
+	due, err := n.queries.ListDueNotifications(ctx, database.ListDueNotificationsParams{
+		Kind:         KindDeferred,
+		DeliverAfter: now.UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list due notifications: %w", err)
+	}
+
+	for _, pending := range due {
+		decision, recipient, message, err := n.redecide(ctx, pending, now)
+		if err != nil {
+			return err
+		}
+		if err := n.queries.DeletePendingNotification(ctx, pending.ID); err != nil {
+			return fmt.Errorf("failed to delete pending notification: %w", err)
+		}
+		switch decision.Action {
+		case ActionSend:
+			n.send(ctx, recipient, message)
+		case ActionDigest:
+			if err := n.queries.CreatePendingNotification(ctx, database.CreatePendingNotificationParams{
+				UserID:         recipient.ID,
+				AudioMessageID: message.ID,
+				Kind:           KindDigest,
+				DeliverAfter:   now.UTC(),
+			}); err != nil {
+				slog.ErrorContext(ctx, "failed to queue notification", "target_user_id", recipient.ID, "error", err)
+			}
+		}
+		slog.DebugContext(ctx, "deferred notification decision", "target_user_id", pending.UserID, "message_id", pending.AudioMessageID, "action", decision.Action, "reason", decision.Reason)
+	}
+	return nil
+}
+
+// redecide applies Decide to a deferred alert as its recipient's settings
+// stand now, ignoring quiet hours, which already held it back. Alerts whose
+// recipient or message is gone, or whose recipient may no longer be alerted,
+// are skipped.
+func (n *Notifier) redecide(ctx context.Context, pending database.PendingNotification, now time.Time) (Decision, database.User, database.AudioMessage, error) {
+	recipient, err := n.queries.GetUser(ctx, pending.UserID)
+	if err == sql.ErrNoRows {
+		return Decision{Action: ActionSkip, Reason: "recipient gone"}, recipient, database.AudioMessage{}, nil
+	} else if err != nil {
+		return Decision{}, recipient, database.AudioMessage{}, fmt.Errorf("failed to get user: %w", err)
+	}
+	message, err := n.queries.GetAudioMessage(ctx, pending.AudioMessageID)
+	if err == sql.ErrNoRows {
+		return Decision{Action: ActionSkip, Reason: "message gone"}, recipient, message, nil
+	} else if err != nil {
+		return Decision{}, recipient, message, fmt.Errorf("failed to get message: %w", err)
+	}
+	if !recipient.Approved || users.UserStatus(recipient.Status) == users.UserStatusSuspended {
+		return Decision{Action: ActionSkip, Reason: "recipient not active"}, recipient, message, nil
+	}
+
+	prefs, err := UserPreferences(ctx, n.queries, recipient)
+	if err != nil {
+		return Decision{}, recipient, message, err
+	}
+	prefs.QuietHours = nil
+	mutedBy, err := n.queries.ListMutesOfSender(ctx, message.SenderUserID)
+	if err != nil {
+		return Decision{}, recipient, message, fmt.Errorf("failed to list mutes: %w", err)
+	}
+	muted := slices.Contains(mutedBy, recipient.ID)
+	return Decide(recipient.ID, prefs, muted, Message{SenderUserID: message.SenderUserID}, now), recipient, message, nil
+}
+
+func (n *Notifier) send(ctx context.Context, recipient database.User, message database.AudioMessage) {
+	for _, channel := range n.channels {
+		if err := channel.Notify(ctx, recipient, message); err != nil {
+			slog.ErrorContext(ctx, "failed to send notification", "channel", channel.Name(), "target_user_id", recipient.ID, "message_id", message.ID, "error", err)
+		}
+	}
+}
+
+// MessageRetracted tells every approved, non-suspended user other than the
+// sender, through the channels that are Retractors, that a message was
+// unsent. Quiet hours and mutes do not apply, as nothing is shown. Failures
+// to deliver are logged rather than returned, so a retry does not repeat the
+// deliveries that worked.
+func (n *Notifier) MessageRetracted(ctx context.Context, message database.AudioMessage) error {
+	recipients, err := n.queries.ListUsers(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list users: %w", err)
+	}
+	for _, recipient := range recipients {
+		if !recipient.Approved || users.UserStatus(recipient.Status) == users.UserStatusSuspended || recipient.ID == message.SenderUserID {
+			continue
+		}
+		for _, channel := range n.channels {
+			retractor, ok := channel.(Retractor)
+			if !ok {
+				continue
+			}
+			if err := retractor.Retract(ctx, recipient, message); err != nil {
+				slog.ErrorContext(ctx, "failed to send retraction", "channel", channel.Name(), "target_user_id", recipient.ID, "message_id", message.ID, "error", err)
+			}
+		}
+	}
+	return nil
+}
+
+// UserPreferences returns user's stored preferences, or the defaults if they
+// never changed them, with Location set to their timezone.
+func UserPreferences(ctx context.Context, queries *database.Queries, user database.User) (Preferences, error) {
+	prefs := DefaultPreferences()
+	stored, err := queries.GetNotificationPreferences(ctx, user.ID)
+	if err == nil {
+		prefs = FromDatabase(stored)
+	} else if err != sql.ErrNoRows {
+		return Preferences{}, fmt.Errorf("failed to get notification preferences: %w", err)
+	}
+	prefs.Location = Location(user)
+	return prefs, nil
+}
+
+// FromDatabase converts stored preferences. Location is left unset.
+func FromDatabase(p database.NotificationPreference) Preferences {
+	prefs := Preferences{Mode: Mode(p.Mode)}
+	if p.QuietStart.Valid && p.QuietEnd.Valid {
+		start, startErr := ParseClock(p.QuietStart.String)
+		end, endErr := ParseClock(p.QuietEnd.String)
+		if startErr == nil && endErr == nil {
+			prefs.QuietHours = &QuietHours{Start: start, End: end}
+		}
+	}
+	return prefs
+}
+
+// Location returns the user's timezone, or UTC if they have not set one.
+func Location(user database.User) *time.Location {
+	if user.Timezone.Valid {
+		if loc, err := time.LoadLocation(user.Timezone.String); err == nil {
+			return loc
+		}
+	}
+	return time.UTC
+}
@@ -0,0 +1,129 @@
+// Package notify decides whether, when and how users are alerted about new
+// messages, and hands alerts to the configured channels.
+package notify
+
+import (
+	"fmt"
+	"time"
+)
+
+// Mode is how a user wants to hear about new messages.
+type Mode string
+
+const (
+	ModeAll Mode = "all"
+	// ModeDigest collects messages for a periodic summary instead of alerting.
+	ModeDigest Mode = "digest"
+	ModeNone   Mode = "none"
+)
+
+func (m Mode) Valid() bool {
+	switch m {
+	case ModeAll, ModeDigest, ModeNone:
+		return true
+	}
+	return false
+}
+
+// Clock is a time of day in minutes after midnight.
+type Clock int
+
+// ParseClock parses a 24-hour "HH:MM" time of day.
+func ParseClock(s string) (Clock, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil || len(s) != 5 {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", s)
+	}
+	return Clock(t.Hour()*60 + t.Minute()), nil
+}
+
+func (c Clock) String() string {
+	return fmt.Sprintf("%02d:%02d", c/60, c%60)
+}
+
+// QuietHours is a daily window in the user's timezone during which alerts are
+// held back. End before Start spans midnight.
+type QuietHours struct {
+	Start Clock
+	End   Clock
+}
+
+// contains reports whether the time of day falls inside the window.
+func (q QuietHours) contains(c Clock) bool {
+	if q.Start < q.End {
+		return c >= q.Start && c < q.End
+	}
+	return c >= q.Start || c < q.End
+}
+
+// Preferences are a recipient's notification settings.
+type Preferences struct {
+	Mode       Mode
+	QuietHours *QuietHours
+	// Location is the recipient's timezone; quiet hours are evaluated in it.
+	Location *time.Location
+}
+
+// DefaultPreferences apply to users who never changed their settings.
+func DefaultPreferences() Preferences {
+	return Preferences{Mode: ModeAll, Location: time.UTC}
+}
+
+// Message describes the message an alert would be about.
+type Message struct {
+	SenderUserID string
+}
+
+// Action is what to do with a potential alert.
+type Action string
+
+const (
+	ActionSend   Action = "send"
+	ActionDefer  Action = "defer"
+	ActionDigest Action = "digest"
+	ActionSkip   Action = "skip"
+)
+
+// Decision is the outcome of Decide. DeliverAt is set for ActionDefer.
+type Decision struct {
+	Action    Action
+	DeliverAt time.Time
+	Reason    string
+}
+
+// Decide is the single policy every alerting path consults before telling
+// recipientID about msg. muted reports whether the recipient muted the sender.
+func Decide(recipientID string, prefs Preferences, muted bool, msg Message, now time.Time) Decision {
+	switch {
+	case msg.SenderUserID == recipientID:
+		return Decision{Action: ActionSkip, Reason: "own message"}
+	case muted:
+		return Decision{Action: ActionSkip, Reason: "sender muted"}
+	case prefs.Mode == ModeNone:
+		return Decision{Action: ActionSkip, Reason: "notifications off"}
+	case prefs.Mode == ModeDigest:
+		return Decision{Action: ActionDigest, Reason: "digest only"}
+	}
+
+	if prefs.QuietHours != nil {
+		loc := prefs.Location
+		if loc == nil {
+			loc = time.UTC
+		}
+		local := now.In(loc)
+		if prefs.QuietHours.contains(Clock(local.Hour()*60 + local.Minute())) {
+			return Decision{Action: ActionDefer, DeliverAt: quietHoursEnd(*prefs.QuietHours, local).UTC(), Reason: "quiet hours"}
+		}
+	}
+
+	return Decision{Action: ActionSend}
+}
+
+// quietHoursEnd returns the first end of the window after local.
+func quietHoursEnd(q QuietHours, local time.Time) time.Time {
+	end := time.Date(local.Year(), local.Month(), local.Day(), int(q.End)/60, int(q.End)%60, 0, 0, local.Location())
+	if !end.After(local) {
+		end = time.Date(local.Year(), local.Month(), local.Day()+1, int(q.End)/60, int(q.End)%60, 0, 0, local.Location())
+	}
+	return end
+}
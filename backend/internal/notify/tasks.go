@@ -0,0 +1,34 @@
+package notify
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+type TaskManager struct {
+	notifier *Notifier
+}
+
+func NewTaskManager(notifier *Notifier) *TaskManager {
+	return &TaskManager{
+		notifier: notifier,
+	}
+}
+
+func (tm *TaskManager) Start(ctx context.Context) error {
+	slog.Info("starting notification tasks")
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Minute):
+				if err := tm.notifier.DeliverDeferred(ctx); err != nil {
+					slog.Error("failed to deliver deferred notifications", "error", err)
+				}
+			}
+		}
+	}()
+	return nil
+}
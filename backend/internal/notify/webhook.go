@@ -0,0 +1,98 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/alecdray/waffle-talkie/internal/database"
+)
+
+// Webhook events.
+const (
+	EventMessageSent      = "message.sent"
+	EventMessageRetracted = "message.retracted"
+)
+
+// webhookTimeout bounds a delivery when the Webhook has no Client.
+const webhookTimeout = 10 * time.Second
+
+// Webhook is a Channel and Retractor that POSTs every alert as JSON to URL,
+// one request per recipient, so a push service or home automation hub can
+// deliver it. Any response other than 2xx is an error.
+type Webhook struct {
+	URL string
+	// Client defaults to one with a 10 second timeout.
+	Client *http.Client
+}
+
+type webhookUser struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type webhookMessage struct {
+	ID           string    `json:"id"`
+	SenderUserID string    `json:"sender_user_id"`
+	Duration     int64     `json:"duration"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type webhookPayload struct {
+	Event     string         `json:"event"`
+	Recipient webhookUser    `json:"recipient"`
+	Message   webhookMessage `json:"message"`
+}
+
+func (wh *Webhook) Name() string {
+	return "webhook"
+}
+
+func (wh *Webhook) Notify(ctx context.Context, recipient database.User, message database.AudioMessage) error {
+	return wh.post(ctx, EventMessageSent, recipient, message)
+}
+
+func (wh *Webhook) Retract(ctx context.Context, recipient database.User, message database.AudioMessage) error {
+	return wh.post(ctx, EventMessageRetracted, recipient, message)
+}
+
+func (wh *Webhook) post(ctx context.Context, event string, recipient database.User, message database.AudioMessage) error {
+	body, err := json.Marshal(webhookPayload{
+		Event:     event,
+		Recipient: webhookUser{ID: recipient.ID, Name: recipient.Name},
+		Message: webhookMessage{
+			ID:           message.ID,
+			SenderUserID: message.SenderUserID,
+			Duration:     message.Duration,
+			CreatedAt:    message.CreatedAt,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := wh.Client
+	if client == nil {
+		client = &http.Client{Timeout: webhookTimeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return nil
+}
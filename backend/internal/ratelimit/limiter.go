@@ -0,0 +1,106 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Rate describes a token bucket: Burst requests may be made at once, refilling
+// at PerMinute requests per minute. A zero PerMinute disables limiting.
+type Rate struct {
+	PerMinute float64
+	Burst     int
+}
+
+// Enabled reports whether the rate limits anything.
+func (r Rate) Enabled() bool {
+	return r.PerMinute > 0 && r.Burst > 0
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter keeps one token bucket per key. Buckets that have refilled completely
+// are indistinguishable from new ones, so they are evicted to bound memory.
+type Limiter struct {
+	rate      Rate
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewLimiter creates a limiter enforcing rate for every key.
+func NewLimiter(rate Rate) *Limiter {
+	return &Limiter{
+		rate:    rate,
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// perSecond is the refill rate in tokens per second.
+func (l *Limiter) perSecond() float64 {
+	return l.rate.PerMinute / 60
+}
+
+// refillDuration is how long an empty bucket takes to become full.
+func (l *Limiter) refillDuration() time.Duration {
+	return time.Duration(float64(l.rate.Burst) / l.perSecond() * float64(time.Second))
+}
+
+// Allow takes a token from the key's bucket. When the bucket is empty it
+// reports how long until the next token is available.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	if !l.rate.Enabled() {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.rate.Burst), last: now}
+		l.buckets[key] = b
+	}
+
+	elapsed := now.Sub(b.last).Seconds()
+	b.tokens = math.Min(float64(l.rate.Burst), b.tokens+elapsed*l.perSecond())
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	wait := (1 - b.tokens) / l.perSecond()
+	return false, time.Duration(wait * float64(time.Second))
+}
+
+// sweep evicts idle buckets at most once per refill period. Callers hold l.mu.
+func (l *Limiter) sweep(now time.Time) {
+	idle := l.refillDuration()
+	if now.Sub(l.lastSweep) < idle {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= idle {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Len returns the number of tracked buckets.
+func (l *Limiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
@@ -0,0 +1,117 @@
+package ratelimit
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/alecdray/waffle-talkie/internal/apierror"
+	"github.com/alecdray/waffle-talkie/internal/auth"
+)
+
+// KeyFunc picks the bucket a request is charged to.
+type KeyFunc func(r *http.Request) string
+
+// Middleware rejects requests with 429 and a Retry-After header once the
+// bucket chosen by key is empty.
+func Middleware(next http.Handler, limiter *Limiter, key KeyFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowed, retryAfter := limiter.Allow(key(r))
+		if !allowed {
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			slog.WarnContext(r.Context(), "rate limit exceeded", "retry_after_seconds", seconds)
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			apierror.Write(w, http.StatusTooManyRequests, apierror.CodeRateLimited, "Too many requests")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ByIP keys requests by client IP.
+func ByIP(trustedProxies []netip.Prefix) KeyFunc {
+	return func(r *http.Request) string {
+		return "ip:" + ClientIP(r, trustedProxies)
+	}
+}
+
+// ByUser keys authenticated requests by user ID, falling back to client IP.
+func ByUser(trustedProxies []netip.Prefix) KeyFunc {
+	return func(r *http.Request) string {
+		if userID, ok := auth.GetUserIDFromContext(r.Context()); ok {
+			return "user:" + userID
+		}
+		return "ip:" + ClientIP(r, trustedProxies)
+	}
+}
+
+// ClientIP returns the address of the client. X-Forwarded-For is only honored
+// when the connection comes from a trusted proxy, in which case the rightmost
+// address not belonging to a trusted proxy is used.
+func ClientIP(r *http.Request, trustedProxies []netip.Prefix) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	remote, err := netip.ParseAddr(host)
+	if err != nil {
+		return host
+	}
+	remote = remote.Unmap()
+	if !isTrusted(remote, trustedProxies) {
+		return remote.String()
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		hop = hop.Unmap()
+		if !isTrusted(hop, trustedProxies) {
+			return hop.String()
+		}
+		remote = hop
+	}
+	return remote.String()
+}
+
+func isTrusted(addr netip.Addr, trustedProxies []netip.Prefix) bool {
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParsePrefixes parses CIDR ranges or bare IP addresses.
+func ParsePrefixes(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if !strings.Contains(value, "/") {
+			addr, err := netip.ParseAddr(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", value, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", value, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
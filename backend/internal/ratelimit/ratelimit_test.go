@@ -0,0 +1,188 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+// fakeClock lets tests move a limiter's time forward.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestLimiter(rate Rate) (*Limiter, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)}
+	l := NewLimiter(rate)
+	l.now = func() time.Time { return clock.now }
+	return l, clock
+}
+
+func TestLimiterBurstAndRefill(t *testing.T) {
+	l, clock := newTestLimiter(Rate{PerMinute: 60, Burst: 3})
+
+	for i := range 3 {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("request %d: expected the burst allowed", i+1)
+		}
+	}
+	ok, wait := l.Allow("a")
+	if ok {
+		t.Fatal("expected an empty bucket to refuse")
+	}
+	if wait != time.Second {
+		t.Errorf("expected to wait a second for the next token, got %v", wait)
+	}
+
+	// Other keys have their own buckets.
+	if ok, _ := l.Allow("b"); !ok {
+		t.Error("expected another key allowed")
+	}
+
+	clock.advance(500 * time.Millisecond)
+	if ok, wait := l.Allow("a"); ok || wait != 500*time.Millisecond {
+		t.Errorf("expected half a token refilled, got allowed %v and wait %v", ok, wait)
+	}
+	clock.advance(500 * time.Millisecond)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Error("expected a refilled token allowed")
+	}
+
+	// Buckets never hold more than the burst, however long they are idle.
+	clock.advance(time.Hour)
+	for i := range 3 {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("request %d: expected the burst allowed after idling", i+1)
+		}
+	}
+	if ok, _ := l.Allow("a"); ok {
+		t.Error("expected the bucket capped at the burst")
+	}
+}
+
+func TestLimiterDisabled(t *testing.T) {
+	for _, rate := range []Rate{{}, {PerMinute: 60}, {Burst: 5}} {
+		l, _ := newTestLimiter(rate)
+		for range 100 {
+			if ok, _ := l.Allow("a"); !ok {
+				t.Fatalf("%+v: expected no limit", rate)
+			}
+		}
+		if l.Len() != 0 {
+			t.Errorf("%+v: expected no buckets tracked", rate)
+		}
+	}
+}
+
+func TestLimiterEvictsIdleBuckets(t *testing.T) {
+	// Empty buckets refill in 2 seconds.
+	l, clock := newTestLimiter(Rate{PerMinute: 60, Burst: 2})
+	l.Allow("a")
+	l.Allow("b")
+	if l.Len() != 2 {
+		t.Fatalf("expected 2 buckets, got %d", l.Len())
+	}
+
+	clock.advance(time.Second)
+	l.Allow("b")
+	clock.advance(time.Second)
+	l.Allow("c")
+	// a has refilled and is dropped; b was used a second ago.
+	if l.Len() != 2 {
+		t.Errorf("expected the idle bucket evicted, got %d buckets", l.Len())
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("::1/128")}
+	for _, tc := range []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		want         string
+		trustProxies bool
+	}{
+		{name: "direct", remoteAddr: "203.0.113.5:1234", want: "203.0.113.5"},
+		{name: "untrusted proxy is ignored", remoteAddr: "203.0.113.5:1234", forwardedFor: []string{"198.51.100.1"}, want: "203.0.113.5", trustProxies: true},
+		{name: "no trusted proxies configured", remoteAddr: "10.0.0.2:1234", forwardedFor: []string{"198.51.100.1"}, want: "10.0.0.2"},
+		{name: "trusted proxy", remoteAddr: "10.0.0.2:1234", forwardedFor: []string{"198.51.100.1"}, want: "198.51.100.1", trustProxies: true},
+		{name: "rightmost untrusted hop", remoteAddr: "10.0.0.2:1234", forwardedFor: []string{"192.0.2.9, 198.51.100.1, 10.0.0.3"}, want: "198.51.100.1", trustProxies: true},
+		{name: "repeated headers", remoteAddr: "10.0.0.2:1234", forwardedFor: []string{"192.0.2.9", "198.51.100.1"}, want: "198.51.100.1", trustProxies: true},
+		{name: "every hop trusted", remoteAddr: "10.0.0.2:1234", forwardedFor: []string{"10.0.0.4, 10.0.0.3"}, want: "10.0.0.4", trustProxies: true},
+		{name: "spoofed garbage stops the walk", remoteAddr: "10.0.0.2:1234", forwardedFor: []string{"198.51.100.1, not-an-ip, 10.0.0.3"}, want: "10.0.0.3", trustProxies: true},
+		{name: "IPv4-mapped remote", remoteAddr: "[::ffff:203.0.113.5]:1234", want: "203.0.113.5"},
+		{name: "IPv6 trusted proxy", remoteAddr: "[::1]:1234", forwardedFor: []string{"2001:db8::1"}, want: "2001:db8::1", trustProxies: true},
+		{name: "no port", remoteAddr: "203.0.113.5", want: "203.0.113.5"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tc.remoteAddr
+			for _, value := range tc.forwardedFor {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			var proxies []netip.Prefix
+			if tc.trustProxies {
+				proxies = trusted
+			}
+			if got := ClientIP(r, proxies); got != tc.want {
+				t.Errorf("expected %s, got %s", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestParsePrefixes(t *testing.T) {
+	prefixes, err := ParsePrefixes([]string{"10.1.2.3", " 172.16.5.0/12 ", "", "::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"10.1.2.3/32", "172.16.0.0/12", "::1/128"}
+	if len(prefixes) != len(want) {
+		t.Fatalf("expected %v, got %v", want, prefixes)
+	}
+	for i, prefix := range prefixes {
+		if prefix.String() != want[i] {
+			t.Errorf("expected %s, got %s", want[i], prefix)
+		}
+	}
+
+	for _, bad := range []string{"10.0.0.300", "10.0.0.0/40", "proxy"} {
+		if _, err := ParsePrefixes([]string{bad}); err == nil {
+			t.Errorf("expected %q rejected", bad)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	l, _ := newTestLimiter(Rate{PerMinute: 30, Burst: 1})
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}), l, ByIP(nil))
+
+	serve := func(remoteAddr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+	if w := serve("203.0.113.5:1"); w.Code != http.StatusNoContent {
+		t.Fatalf("expected the first request through, got %d", w.Code)
+	}
+	w := serve("203.0.113.5:2")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("expected Retry-After 2, got %q", got)
+	}
+	if w := serve("198.51.100.1:1"); w.Code != http.StatusNoContent {
+		t.Errorf("expected another client through, got %d", w.Code)
+	}
+}
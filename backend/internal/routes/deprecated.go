@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// unversionedDeprecatedAt is when the unversioned routes were superseded by
+// /v1, as an RFC 9745 structured date (2026-10-19T00:00:00Z).
+const unversionedDeprecatedAt = "@1792368000"
+
+// Deprecated serves next while advertising, via the Deprecation and Link
+// headers, that clients should move to the successor route.
+func Deprecated(successor string, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", unversionedDeprecatedAt)
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", successor))
+		next(w, r)
+	})
+}
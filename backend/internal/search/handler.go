@@ -0,0 +1,207 @@
+// Package search finds messages by their sender, date, note and transcript.
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/alecdray/waffle-talkie/internal/apierror"
+	"github.com/alecdray/waffle-talkie/internal/auth"
+	"github.com/alecdray/waffle-talkie/internal/database"
+)
+
+// Handler serves message search.
+type Handler struct {
+	queries *database.Queries
+	// indexed is whether the FTS5 index is available; without it every
+	// message the user may see is scanned.
+	indexed bool
+}
+
+func NewHandler(queries *database.Queries) *Handler {
+	indexed, err := queries.SearchIndexed(context.Background())
+	if err != nil {
+		slog.Error("failed to check for the search index, searching without it", "error", err)
+	}
+	return &Handler{queries: queries, indexed: indexed}
+}
+
+func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /v1/search", h.HandleSearch)
+}
+
+const (
+	defaultLimit   = 20
+	maxLimit       = 50
+	maxQueryLength = 200
+)
+
+// Fields a snippet can be taken from, with how much a match in each counts
+// when searching without the index, matching the index's bm25 weights.
+var fields = []struct {
+	name   string
+	weight int
+	text   func(database.SearchDocument) string
+}{
+	{"transcript", 1, func(d database.SearchDocument) string { return d.Transcript }},
+	{"note", 3, func(d database.SearchDocument) string { return d.Note }},
+	{"sender_name", 4, func(d database.SearchDocument) string { return d.SenderName }},
+	{"sent_on", 2, func(d database.SearchDocument) string { return d.SentOn }},
+}
+
+// Offset is a stretch of a message's playback audio.
+type Offset struct {
+	StartMs int64 `json:"start_ms"`
+	EndMs   int64 `json:"end_ms"`
+}
+
+type Result struct {
+	MessageID    string    `json:"message_id"`
+	SenderUserID string    `json:"sender_user_id"`
+	SenderName   string    `json:"sender_name"`
+	CreatedAt    time.Time `json:"created_at"`
+	Duration     int64     `json:"duration"`
+	// Field is where the snippet is from: transcript, note, sender_name or
+	// sent_on.
+	Field   string `json:"field"`
+	Snippet []Part `json:"snippet"`
+	// Matches are the transcript segments containing a search term.
+	Matches []Offset `json:"matches"`
+}
+
+type Response struct {
+	Results []Result `json:"results"`
+}
+
+// HandleSearch returns the messages the user may download that contain every
+// word of the q parameter, each as a prefix, best first.
+func (h *Handler) HandleSearch(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "User ID not found")
+		return
+	}
+
+	query := r.URL.Query().Get("q")
+	terms := Terms(query)
+	if len(terms) == 0 || len(query) > maxQueryLength {
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "q must contain a word and be at most 200 characters")
+		return
+	}
+	limit := defaultLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > maxLimit {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "limit must be between 1 and 50")
+			return
+		}
+		limit = parsed
+	}
+
+	var documents []database.SearchDocument
+	var err error
+	if h.indexed {
+		documents, err = h.queries.SearchMessages(r.Context(), database.SearchMessagesParams{
+			Match:  ftsQuery(terms),
+			UserID: userID,
+			Limit:  int64(limit),
+		})
+	} else {
+		documents, err = h.scan(r.Context(), userID, terms, limit)
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to search messages", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to search messages")
+		return
+	}
+
+	resp := Response{Results: make([]Result, 0, len(documents))}
+	for _, document := range documents {
+		result, err := h.result(r.Context(), document, terms)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to build search result", "message_id", document.AudioMessageID, "error", err)
+			apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to search messages")
+			return
+		}
+		resp.Results = append(resp.Results, result)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// scan searches without the index, keeping messages that contain every term
+// and ranking them by their weighted count of matching words.
+func (h *Handler) scan(ctx context.Context, userID string, terms []string, limit int) ([]database.SearchDocument, error) {
+	documents, err := h.queries.ListSearchDocuments(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	type scored struct {
+		document database.SearchDocument
+		score    int
+	}
+	var hits []scored
+	for _, document := range documents {
+		texts := make([]string, len(fields))
+		score := 0
+		for i, field := range fields {
+			texts[i] = field.text(document)
+			score += field.weight * countMatches(texts[i], terms)
+		}
+		if containsAll(terms, texts...) {
+			hits = append(hits, scored{document: document, score: score})
+		}
+	}
+	// Stable, so equal scores stay newest first.
+	slices.SortStableFunc(hits, func(a, b scored) int { return b.score - a.score })
+
+	results := make([]database.SearchDocument, 0, min(limit, len(hits)))
+	for _, hit := range hits[:min(limit, len(hits))] {
+		results = append(results, hit.document)
+	}
+	return results, nil
+}
+
+// result builds the snippet from the field with the most matching words,
+// preferring the transcript, and finds the transcript segments that match.
+func (h *Handler) result(ctx context.Context, document database.SearchDocument, terms []string) (Result, error) {
+	result := Result{
+		MessageID:    document.AudioMessageID,
+		SenderUserID: document.SenderUserID,
+		SenderName:   document.SenderName,
+		CreatedAt:    document.CreatedAt,
+		Duration:     document.Duration,
+		Matches:      []Offset{},
+	}
+
+	best := -1
+	for _, field := range fields {
+		text := field.text(document)
+		if n := countMatches(text, terms); n > best && text != "" {
+			best = n
+			result.Field = field.name
+			result.Snippet = snippet(text, terms)
+		}
+	}
+
+	if countMatches(document.Transcript, terms) == 0 {
+		return result, nil
+	}
+	segments, err := h.queries.ListTranscriptSegments(ctx, document.AudioMessageID)
+	if err != nil {
+		return Result{}, err
+	}
+	for _, segment := range segments {
+		if countMatches(segment.Text, terms) > 0 {
+			result.Matches = append(result.Matches, Offset{StartMs: segment.StartMs, EndMs: segment.EndMs})
+		}
+	}
+	return result, nil
+}
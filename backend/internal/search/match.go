@@ -0,0 +1,156 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// token is a run of word or non-word characters in a text.
+type token struct {
+	text string
+	word bool
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// tokenize splits text into alternating runs of word and non-word characters,
+// so joining the tokens gives back the text.
+func tokenize(text string) []token {
+	var tokens []token
+	start, word := 0, false
+	for i, r := range text {
+		w := isWordRune(r)
+		if i > 0 && w != word {
+			tokens = append(tokens, token{text: text[start:i], word: word})
+			start = i
+		}
+		word = w
+	}
+	if start < len(text) {
+		tokens = append(tokens, token{text: text[start:], word: word})
+	}
+	return tokens
+}
+
+// Terms returns the lowercased words of a search query.
+func Terms(query string) []string {
+	var terms []string
+	for _, t := range tokenize(query) {
+		if t.word {
+			terms = append(terms, strings.ToLower(t.text))
+		}
+	}
+	return terms
+}
+
+// ftsQuery builds an FTS5 query requiring every term, each as a prefix.
+// Terms hold only letters and digits, so quoting them is enough to keep FTS5
+// syntax out.
+func ftsQuery(terms []string) string {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + term + `"*`
+	}
+	return strings.Join(quoted, " ")
+}
+
+// matches reports whether word starts with any of terms.
+func matches(word string, terms []string) bool {
+	word = strings.ToLower(word)
+	for _, term := range terms {
+		if strings.HasPrefix(word, term) {
+			return true
+		}
+	}
+	return false
+}
+
+// countMatches returns how many words of text match terms.
+func countMatches(text string, terms []string) int {
+	n := 0
+	for _, t := range tokenize(text) {
+		if t.word && matches(t.text, terms) {
+			n++
+		}
+	}
+	return n
+}
+
+// containsAll reports whether every term matches a word of one of texts.
+func containsAll(terms []string, texts ...string) bool {
+	for _, term := range terms {
+		found := false
+		for _, text := range texts {
+			if countMatches(text, []string{term}) > 0 {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Part is a piece of a snippet, highlighted when it matches the query.
+type Part struct {
+	Text  string `json:"text"`
+	Match bool   `json:"match"`
+}
+
+// Snippet window, in words: the context kept before the first match, and the
+// most words shown.
+const (
+	snippetLead  = 4
+	snippetWords = 16
+)
+
+// snippet returns a window of text around its first match, split into parts
+// with the matching words highlighted.
+func snippet(text string, terms []string) []Part {
+	tokens := tokenize(text)
+	first, words := 0, 0
+	for i, t := range tokens {
+		if t.word && matches(t.text, terms) {
+			first = i
+			break
+		}
+	}
+
+	// Step back snippetLead words from the first match.
+	start := first
+	for i := first - 1; i >= 0 && words < snippetLead; i-- {
+		if tokens[i].word {
+			start = i
+			words++
+		}
+	}
+
+	var parts []Part
+	add := func(text string, match bool) {
+		if n := len(parts); n > 0 && parts[n-1].Match == match {
+			parts[n-1].Text += text
+			return
+		}
+		parts = append(parts, Part{Text: text, Match: match})
+	}
+	if start > 0 {
+		add("…", false)
+	}
+	words = 0
+	end := start
+	for ; end < len(tokens) && words < snippetWords; end++ {
+		t := tokens[end]
+		if t.word {
+			words++
+		}
+		add(t.text, t.word && matches(t.text, terms))
+	}
+	if end < len(tokens) {
+		add("…", false)
+	}
+	return parts
+}
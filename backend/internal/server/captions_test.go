@@ -0,0 +1,80 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecdray/waffle-talkie/internal/apierror"
+)
+
+func TestCaptions(t *testing.T) {
+	c := newContract(t, Options{})
+	c.startJobWorkers()
+	sender := c.registerApprovedUser("Sender", "sender-device", "user")
+	listener := c.registerApprovedUser("Listener", "listener-device", "user")
+
+	type message struct {
+		ID       string     `json:"id"`
+		Title    *string    `json:"title"`
+		Caption  *string    `json:"caption"`
+		EditedAt *time.Time `json:"edited_at"`
+	}
+	listed := func(id string) message {
+		t.Helper()
+		var list struct {
+			Messages []message `json:"messages"`
+		}
+		c.json("GET", "/api/v1/audio-messages", listener, nil).expect(t, http.StatusOK).decode(t, &list)
+		for _, m := range list.Messages {
+			if m.ID == id {
+				return m
+			}
+		}
+		t.Fatalf("message %s not listed", id)
+		return message{}
+	}
+
+	// Whitespace is collapsed in titles, line breaks kept in captions, and
+	// control and formatting characters dropped from both.
+	var upload struct {
+		MessageID string `json:"message_id"`
+	}
+	c.uploadFields("/api/v1/audio-messages", sender, "voice.m4a", []byte("audio"), map[string]string{
+		"duration": "3",
+		"title":    "  Sunday\t\u202epancakes\n ",
+		"caption":  "Flour, eggs\r\n\r\n\r\nand milk\x07 ",
+	}).expect(t, http.StatusCreated).decode(t, &upload)
+	untitled := c.send(sender, "voice.m4a", []byte("audio"), "3")
+
+	got := listed(upload.MessageID)
+	if got.Title == nil || *got.Title != "Sunday pancakes" || got.Caption == nil || *got.Caption != "Flour, eggs\n\nand milk" || got.EditedAt != nil {
+		t.Errorf("expected the cleaned title and caption, got %+v", got)
+	}
+	if got := listed(untitled); got.Title != nil || got.Caption != nil {
+		t.Errorf("expected no title or caption, got %+v", got)
+	}
+	expectCode(t, c.uploadFields("/api/v1/audio-messages", sender, "voice.m4a", []byte("audio"), map[string]string{
+		"duration": "3",
+		"title":    strings.Repeat("é", 101),
+	}).expect(t, http.StatusBadRequest), apierror.CodeBadRequest)
+
+	// Only the sender can edit; fields left out are kept and empty ones
+	// cleared.
+	path := "/api/v1/audio-messages/" + upload.MessageID
+	expectCode(t, c.json("PATCH", path, listener, map[string]string{"title": "Mine"}).expect(t, http.StatusForbidden), apierror.CodeForbidden)
+	expectCode(t, c.json("PATCH", "/api/v1/audio-messages/missing", sender, map[string]string{"title": "Mine"}).
+		expect(t, http.StatusNotFound), apierror.CodeMessageNotFound)
+	expectCode(t, c.json("PATCH", path, sender, map[string]string{"caption": strings.Repeat("c", 1001)}).
+		expect(t, http.StatusBadRequest), apierror.CodeBadRequest)
+
+	var edited message
+	c.json("PATCH", path, sender, map[string]string{"caption": ""}).expect(t, http.StatusOK).decode(t, &edited)
+	if edited.Title == nil || *edited.Title != "Sunday pancakes" || edited.Caption != nil || edited.EditedAt == nil {
+		t.Errorf("expected the caption cleared and the edit time set, got %+v", edited)
+	}
+	if got := listed(upload.MessageID); got.EditedAt == nil || !got.EditedAt.Equal(*edited.EditedAt) {
+		t.Errorf("expected listings to show the edit, got %+v", got)
+	}
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alecdray/waffle-talkie/internal/apierror"
+	"github.com/alecdray/waffle-talkie/internal/audio"
+	"github.com/alecdray/waffle-talkie/internal/compilation"
+)
+
+func TestCompilations(t *testing.T) {
+	c := newPipelineContract(t, Options{}, PipelineOptions{CompilationWeeks: 4})
+	c.startJobWorkers()
+	ctx := context.Background()
+	alice := c.registerApprovedUser("Alice", "alice-device", "user")
+	bob := c.registerApprovedUser("Bob", "bob-device", "user")
+	listener := c.registerApprovedUser("Listener", "listener-device", "user")
+
+	second := func(int) float64 { return 0.5 }
+	first := c.send(alice, "first.wav", testWAV(1, 16, 8000, second), "1")
+	reply := c.send(bob, "reply.wav", testWAV(2, 16, 8000, second), "1")
+	c.send(bob, "undecodable.m4a", []byte("not really audio"), "1")
+	last := c.send(alice, "last.wav", testWAV(1, 16, 8000, second), "1")
+	c.waitForJobs()
+
+	// Move the clips into last week, in the order sent.
+	week := compilation.WeekOf(time.Now()).AddDate(0, 0, -7)
+	for i, id := range []string{first, reply, last} {
+		if _, err := c.sqlDB.Exec("UPDATE compilation_clips SET week = ?, created_at = ? WHERE audio_message_id = ?",
+			week.Format("2006-01-02"), week.Add(time.Duration(i)*time.Hour), id); err != nil {
+			t.Fatalf("failed to move clip: %v", err)
+		}
+	}
+	tasks := compilation.NewTaskManager(c.queries, compilation.WAVEncoder{}, compilationDirectory(c.audioDirectory, 4), 4)
+	if err := tasks.Compile(ctx); err != nil {
+		t.Fatalf("failed to build compilations: %v", err)
+	}
+
+	type chapter struct {
+		Title        string `json:"title"`
+		StartMs      int64  `json:"start_ms"`
+		EndMs        int64  `json:"end_ms"`
+		MessageCount int64  `json:"message_count"`
+	}
+	type compiled struct {
+		Week         string    `json:"week"`
+		DurationMs   int64     `json:"duration_ms"`
+		MessageCount int64     `json:"message_count"`
+		Chapters     []chapter `json:"chapters"`
+	}
+	path := "/api/v1/compilations/" + week.Format("2006-01-02")
+	var list struct {
+		Compilations []compiled `json:"compilations"`
+	}
+	c.json("GET", "/api/v1/compilations", listener, nil).expect(t, http.StatusOK).decode(t, &list)
+	if len(list.Compilations) != 1 || list.Compilations[0].Week != week.Format("2006-01-02") {
+		t.Fatalf("expected last week's compilation, got %+v", list.Compilations)
+	}
+
+	// Three one-second messages with a second between each, in a chapter per
+	// run of messages from the same sender.
+	var got compiled
+	c.json("GET", path, listener, nil).expect(t, http.StatusOK).decode(t, &got)
+	want := []chapter{{"Alice", 0, 2000, 1}, {"Bob", 2000, 4000, 1}, {"Alice", 4000, 5000, 1}}
+	if got.DurationMs != 5000 || got.MessageCount != 3 || !slices.Equal(got.Chapters, want) {
+		t.Errorf("expected %v over 5s, got %+v", want, got)
+	}
+
+	audioResp := c.json("GET", path+"/audio", listener, nil).expect(t, http.StatusOK)
+	if ct := audioResp.resp.Header.Get("Content-Type"); ct != "audio/wav" {
+		t.Errorf("expected WAV, got %q", ct)
+	}
+	file := filepath.Join(t.TempDir(), "compilation.wav")
+	if err := os.WriteFile(file, audioResp.respBody, 0644); err != nil {
+		t.Fatalf("failed to write compilation: %v", err)
+	}
+	pcm, err := audio.WAVDecoder{}.Decode(ctx, file)
+	if err != nil || pcm.Duration() != 5*time.Second {
+		t.Errorf("expected 5s of audio, got %v (%v)", pcm.Duration(), err)
+	}
+	if !bytes.Contains(audioResp.respBody, []byte("cue ")) || !bytes.Contains(audioResp.respBody, []byte("labl")) || !bytes.Contains(audioResp.respBody, []byte("Bob\x00")) {
+		t.Error("expected chapters marked with labelled cue points")
+	}
+
+	// Unsent messages are left out when the week is rebuilt.
+	c.json("DELETE", "/api/v1/audio-messages/"+reply, bob, nil).expect(t, http.StatusOK)
+	if err := tasks.Compile(ctx); err != nil {
+		t.Fatalf("failed to build compilations: %v", err)
+	}
+	c.json("GET", path, listener, nil).expect(t, http.StatusOK).decode(t, &got)
+	want = []chapter{{"Alice", 0, 3000, 2}}
+	if got.DurationMs != 3000 || !slices.Equal(got.Chapters, want) {
+		t.Errorf("expected %v after the unsend, got %+v", want, got)
+	}
+
+	// The current week is not compiled until it ends, and expired weeks are
+	// removed with their clips.
+	c.json("GET", "/api/v1/compilations/"+compilation.WeekOf(time.Now()).Format("2006-01-02"), listener, nil).expect(t, http.StatusNotFound)
+	expired := compilation.NewTaskManager(c.queries, compilation.WAVEncoder{}, compilationDirectory(c.audioDirectory, 4), 0)
+	if err := expired.Compile(ctx); err != nil {
+		t.Fatalf("failed to build compilations: %v", err)
+	}
+	expectCode(t, c.json("GET", path, listener, nil).expect(t, http.StatusNotFound), apierror.CodeCompilationNotFound)
+	if clips, err := os.ReadDir(filepath.Join(compilationDirectory(c.audioDirectory, 4), "clips")); err != nil || len(clips) != 0 {
+		t.Errorf("expected the clips removed, got %v (%v)", clips, err)
+	}
+}
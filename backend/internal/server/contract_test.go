@@ -0,0 +1,650 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/xml"
+	"fmt"
+	"image/jpeg"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecdray/waffle-talkie/internal/apierror"
+	"github.com/alecdray/waffle-talkie/internal/database"
+	"github.com/alecdray/waffle-talkie/internal/email"
+)
+
+// TestAPIContract drives every documented operation through NewMux and checks
+// each request and response against openapi.json.
+func TestAPIContract(t *testing.T) {
+	mailbox := newSMTPStub(t)
+	c := newContract(t, Options{EmailSender: mailbox.sender(), PublicURL: testPublicURL})
+	c.startJobWorkers()
+
+	c.json("GET", "/health", "", nil).expect(t, http.StatusOK)
+	c.json("GET", "/openapi.json", "", nil).expect(t, http.StatusOK)
+
+	admin := c.registerApprovedUser("Admin", "admin-device", "admin")
+	member := c.registerApprovedUser("Member", "member-device", "user")
+
+	t.Run("auth", func(t *testing.T) {
+		c.json("POST", "/auth/v1/register", "", map[string]string{"name": "Pending", "device_id": "pending-device"}).
+			expect(t, http.StatusCreated)
+		c.json("POST", "/auth/v1/register", "", map[string]string{"name": "Pending", "device_id": "pending-device"}).
+			expect(t, http.StatusOK)
+		c.do(&exchange{method: "POST", path: "/auth/v1/register", contentType: "application/json", body: []byte(`{"name": ""}`), invalid: true}).
+			expect(t, http.StatusBadRequest)
+
+		c.json("POST", "/auth/v1/login", "", map[string]string{"device_id": "pending-device"}).
+			expect(t, http.StatusForbidden)
+		c.json("POST", "/auth/v1/login", "", map[string]string{"device_id": "unknown-device"}).
+			expect(t, http.StatusUnauthorized)
+		c.do(&exchange{method: "GET", path: "/auth/v1/login", invalid: true}).
+			expect(t, http.StatusMethodNotAllowed)
+	})
+
+	t.Run("users", func(t *testing.T) {
+		var resp struct {
+			Users []struct {
+				Name       string     `json:"name"`
+				Approved   bool       `json:"approved"`
+				LastActive *time.Time `json:"last_active"`
+				Online     bool       `json:"online"`
+			} `json:"users"`
+		}
+		c.json("GET", "/api/v1/users", member, nil).expect(t, http.StatusOK).decode(t, &resp)
+		if len(resp.Users) != 2 {
+			t.Errorf("expected the 2 approved users, got %d", len(resp.Users))
+		}
+		for _, u := range resp.Users {
+			if u.LastActive == nil || !u.Online {
+				t.Errorf("expected %s to be active and online, got %+v", u.Name, u)
+			}
+		}
+
+		c.json("GET", "/api/v1/users?include=pending", admin, nil).expect(t, http.StatusOK).decode(t, &resp)
+		if len(resp.Users) != 3 {
+			t.Errorf("expected 3 users including pending, got %d", len(resp.Users))
+		}
+		expectCode(t, c.json("GET", "/api/v1/users?include=pending", member, nil).expect(t, http.StatusForbidden), apierror.CodeForbidden)
+		c.do(&exchange{method: "GET", path: "/api/v1/users?include=everyone", token: member, invalid: true}).expect(t, http.StatusBadRequest)
+		c.json("GET", "/api/v1/users", "", nil).expect(t, http.StatusUnauthorized)
+		c.json("GET", "/api/v1/users", "not-a-token", nil).expect(t, http.StatusUnauthorized)
+	})
+
+	t.Run("profile", func(t *testing.T) {
+		var profile struct {
+			ID        string  `json:"id"`
+			Name      string  `json:"name"`
+			AvatarURL *string `json:"avatar_url"`
+			Timezone  *string `json:"timezone"`
+		}
+		c.json("GET", "/api/v1/me", member, nil).expect(t, http.StatusOK).decode(t, &profile)
+		if profile.Name != "Member" || profile.AvatarURL != nil {
+			t.Errorf("unexpected profile %+v", profile)
+		}
+
+		c.json("PATCH", "/api/v1/me", member, map[string]string{"name": "Renamed", "timezone": "Europe/London", "status_text": "on a walk"}).
+			expect(t, http.StatusOK).decode(t, &profile)
+		if profile.Name != "Renamed" || profile.Timezone == nil || *profile.Timezone != "Europe/London" {
+			t.Errorf("profile not updated: %+v", profile)
+		}
+		c.json("PATCH", "/api/v1/me", member, map[string]string{"timezone": "Mars/Olympus"}).expect(t, http.StatusBadRequest)
+		c.json("PATCH", "/api/v1/me", member, map[string]string{"name": strings.Repeat("n", 65)}).expect(t, http.StatusBadRequest)
+		c.json("PATCH", "/api/v1/me", member, map[string]string{"timezone": ""}).expect(t, http.StatusOK).decode(t, &profile)
+		if profile.Timezone != nil {
+			t.Errorf("expected timezone to be cleared, got %q", *profile.Timezone)
+		}
+		c.json("POST", "/auth/v1/register", "", map[string]string{"name": "Hijacked", "device_id": "member-device"}).expect(t, http.StatusOK)
+		c.json("GET", "/api/v1/me", member, nil).expect(t, http.StatusOK).decode(t, &profile)
+		if profile.Name != "Renamed" {
+			t.Errorf("re-registering should not rename the user, got %q", profile.Name)
+		}
+
+		expectCode(t, c.uploadAvatar(member, []byte("not an image")).expect(t, http.StatusBadRequest), apierror.CodeInvalidImage)
+		c.uploadAvatar(member, testPNG(t, 300, 200)).expect(t, http.StatusOK).decode(t, &profile)
+		if profile.AvatarURL == nil {
+			t.Fatal("expected an avatar URL after upload")
+		}
+
+		avatar := c.json("GET", *profile.AvatarURL, admin, nil).expect(t, http.StatusOK)
+		img, err := jpeg.DecodeConfig(bytes.NewReader(avatar.respBody))
+		if err != nil || img.Width != 256 || img.Height != 256 {
+			t.Errorf("expected a 256x256 JPEG, got %+v (%v)", img, err)
+		}
+		if avatar.resp.Header.Get("Cache-Control") == "" || avatar.resp.Header.Get("ETag") == "" {
+			t.Error("expected caching headers on the avatar")
+		}
+		c.do(&exchange{method: "GET", path: *profile.AvatarURL, token: admin, header: http.Header{"If-None-Match": {avatar.resp.Header.Get("ETag")}}}).
+			expect(t, http.StatusNotModified)
+		c.json("GET", "/api/v1/users/"+profile.ID+"/avatar?size=64", admin, nil).expect(t, http.StatusOK)
+		c.json("GET", "/api/v1/users/"+profile.ID+"/avatar?size=100", admin, nil).expect(t, http.StatusBadRequest)
+
+		var users struct {
+			Users []map[string]any `json:"users"`
+		}
+		c.json("GET", "/api/v1/users", admin, nil).expect(t, http.StatusOK).decode(t, &users)
+		for _, u := range users.Users {
+			if u["id"] == profile.ID && u["avatar_url"] != *profile.AvatarURL {
+				t.Errorf("expected avatar_url in the users list, got %v", u["avatar_url"])
+			}
+		}
+
+		c.json("DELETE", "/api/v1/me/avatar", member, nil).expect(t, http.StatusNoContent)
+		expectCode(t, c.json("GET", "/api/v1/users/"+profile.ID+"/avatar", admin, nil).expect(t, http.StatusNotFound), apierror.CodeAvatarNotFound)
+		c.json("GET", "/api/v1/me", "", nil).expect(t, http.StatusUnauthorized)
+	})
+
+	t.Run("notifications", func(t *testing.T) {
+		var settings struct {
+			Mode         string            `json:"mode"`
+			QuietHours   map[string]string `json:"quiet_hours"`
+			Timezone     string            `json:"timezone"`
+			MutedUserIDs []string          `json:"muted_user_ids"`
+		}
+		c.json("GET", "/api/v1/me/notifications", member, nil).expect(t, http.StatusOK).decode(t, &settings)
+		if settings.Mode != "all" || settings.QuietHours != nil || settings.Timezone != "UTC" {
+			t.Errorf("unexpected default settings %+v", settings)
+		}
+
+		c.json("PUT", "/api/v1/me/notifications", member, map[string]any{
+			"mode":        "digest",
+			"quiet_hours": map[string]string{"start": "22:00", "end": "07:30"},
+		}).expect(t, http.StatusOK).decode(t, &settings)
+		if settings.Mode != "digest" || settings.QuietHours["end"] != "07:30" {
+			t.Errorf("settings not updated: %+v", settings)
+		}
+		c.json("PUT", "/api/v1/me/notifications", member, map[string]any{"mode": "all", "quiet_hours": map[string]string{"start": "25:00", "end": "07:00"}}).
+			expect(t, http.StatusBadRequest)
+		c.do(&exchange{method: "PUT", path: "/api/v1/me/notifications", token: member, contentType: "application/json", body: []byte(`{"mode": "loud"}`), invalid: true}).
+			expect(t, http.StatusBadRequest)
+		// Direct mode is gone; every message is a broadcast.
+		c.do(&exchange{method: "PUT", path: "/api/v1/me/notifications", token: member, contentType: "application/json", body: []byte(`{"mode": "direct"}`), invalid: true}).
+			expect(t, http.StatusBadRequest)
+
+		var me struct {
+			ID string `json:"id"`
+		}
+		c.json("GET", "/api/v1/me", admin, nil).expect(t, http.StatusOK).decode(t, &me)
+		c.json("PUT", "/api/v1/me/notifications/mutes/"+me.ID, member, nil).expect(t, http.StatusNoContent)
+		c.json("PUT", "/api/v1/me/notifications/mutes/missing", member, nil).expect(t, http.StatusNotFound)
+		c.json("GET", "/api/v1/me/notifications", member, nil).expect(t, http.StatusOK).decode(t, &settings)
+		if len(settings.MutedUserIDs) != 1 || settings.MutedUserIDs[0] != me.ID {
+			t.Errorf("expected the admin to be muted, got %v", settings.MutedUserIDs)
+		}
+		c.json("DELETE", "/api/v1/me/notifications/mutes/"+me.ID, member, nil).expect(t, http.StatusNoContent)
+		c.json("PUT", "/api/v1/me/notifications", member, map[string]any{"mode": "all", "quiet_hours": nil}).expect(t, http.StatusOK)
+	})
+
+	t.Run("registration", func(t *testing.T) {
+		c.json("POST", "/admin/v1/invites", member, map[string]any{}).expect(t, http.StatusForbidden)
+		c.do(&exchange{method: "POST", path: "/admin/v1/invites", token: admin, contentType: "application/json", body: []byte(`{"max_uses": -1}`), invalid: true}).
+			expect(t, http.StatusBadRequest)
+
+		var invite struct {
+			ID   string `json:"id"`
+			Code string `json:"code"`
+		}
+		c.json("POST", "/admin/v1/invites", admin, map[string]any{"name": "Invited", "pre_approved": true, "expires_in_hours": 24}).
+			expect(t, http.StatusCreated).decode(t, &invite)
+		c.json("POST", "/auth/v1/register", "", map[string]string{"device_id": "invited-device", "invite_code": invite.Code}).
+			expect(t, http.StatusCreated)
+		c.json("POST", "/auth/v1/register", "", map[string]string{"name": "Another", "device_id": "another-device", "invite_code": invite.Code}).
+			expect(t, http.StatusForbidden)
+
+		var login struct {
+			Name string `json:"name"`
+		}
+		c.json("POST", "/auth/v1/login", "", map[string]string{"device_id": "invited-device"}).
+			expect(t, http.StatusOK).decode(t, &login)
+		if login.Name != "Invited" {
+			t.Errorf("expected the invite to name the user, got %q", login.Name)
+		}
+
+		var invites struct {
+			Invites []map[string]any `json:"invites"`
+		}
+		c.json("GET", "/admin/v1/invites", admin, nil).expect(t, http.StatusOK).decode(t, &invites)
+		if len(invites.Invites) != 1 || invites.Invites[0]["uses"] != float64(1) {
+			t.Errorf("expected one invite used once, got %v", invites.Invites)
+		}
+		// The code is a credential and stays out of URLs; invites are revoked by ID.
+		c.json("DELETE", "/admin/v1/invites/"+invite.Code, admin, nil).expect(t, http.StatusNotFound)
+		c.json("DELETE", "/admin/v1/invites/"+invite.ID, admin, nil).expect(t, http.StatusNoContent)
+
+		var pending struct {
+			Users []struct {
+				ID string `json:"id"`
+			} `json:"users"`
+		}
+		c.json("GET", "/admin/v1/pending-users", admin, nil).expect(t, http.StatusOK).decode(t, &pending)
+		if len(pending.Users) != 1 {
+			t.Fatalf("expected 1 pending user, got %d", len(pending.Users))
+		}
+		c.json("POST", "/admin/v1/users/"+pending.Users[0].ID+"/approve", admin, nil).expect(t, http.StatusOK)
+		c.json("POST", "/admin/v1/users/missing/approve", admin, nil).expect(t, http.StatusNotFound)
+		c.json("POST", "/auth/v1/login", "", map[string]string{"device_id": "pending-device"}).expect(t, http.StatusOK)
+	})
+
+	t.Run("audio messages", func(t *testing.T) {
+		var upload struct {
+			MessageID string `json:"message_id"`
+		}
+		c.upload("/api/v1/audio-messages", admin, "hello.m4a", []byte("fake audio"), "3").expect(t, http.StatusCreated).decode(t, &upload)
+		c.waitForMessage(t, upload.MessageID)
+		c.upload("/api/v1/audio-messages", admin, "", nil, "3").expect(t, http.StatusBadRequest)
+
+		var list struct {
+			Messages []map[string]any `json:"messages"`
+		}
+		c.json("GET", "/api/v1/audio-messages", member, nil).expect(t, http.StatusOK).decode(t, &list)
+		if len(list.Messages) != 1 {
+			t.Fatalf("expected 1 message, got %d", len(list.Messages))
+		}
+		if sender, _ := list.Messages[0]["sender"].(map[string]any); sender["name"] != "Admin" {
+			t.Errorf("expected the sender's profile on the message, got %v", list.Messages[0]["sender"])
+		}
+
+		var directory struct {
+			Users []struct {
+				Name             string `json:"name"`
+				MessagesThisWeek int64  `json:"messages_this_week"`
+			} `json:"users"`
+		}
+		c.json("GET", "/api/v1/users", member, nil).expect(t, http.StatusOK).decode(t, &directory)
+		for _, u := range directory.Users {
+			if u.Name == "Admin" && u.MessagesThisWeek != 1 {
+				t.Errorf("expected Admin to have sent 1 message this week, got %d", u.MessagesThisWeek)
+			}
+		}
+
+		c.json("GET", "/api/v1/audio-messages/"+upload.MessageID, member, nil).expect(t, http.StatusOK)
+		c.json("GET", "/api/v1/audio-messages/missing", member, nil).expect(t, http.StatusNotFound)
+		// TestCaptions covers editing and TestUnsend undoing.
+		var unsent struct {
+			MessageID string `json:"message_id"`
+		}
+		c.upload("/api/v1/audio-messages", admin, "unsend.m4a", []byte("unsend audio"), "1").expect(t, http.StatusCreated).decode(t, &unsent)
+		c.waitForMessage(t, unsent.MessageID)
+		c.json("DELETE", "/api/v1/audio-messages/"+unsent.MessageID, member, nil).expect(t, http.StatusForbidden)
+		c.json("DELETE", "/api/v1/audio-messages/"+unsent.MessageID, admin, nil).expect(t, http.StatusOK)
+		c.json("DELETE", "/api/v1/audio-messages/"+unsent.MessageID, admin, nil).expect(t, http.StatusNotFound)
+		// Without an undo window the files go straight away.
+		expectCode(t, c.json("POST", "/api/v1/audio-messages/"+unsent.MessageID+"/restore", admin, nil).
+			expect(t, http.StatusConflict), apierror.CodeUndoUnavailable)
+		expectCode(t, c.json("PATCH", "/api/v1/audio-messages/"+upload.MessageID, member, map[string]string{"title": "Mine now"}).
+			expect(t, http.StatusForbidden), apierror.CodeForbidden)
+		c.do(&exchange{method: "DELETE", path: "/api/v1/audio-messages", token: member, invalid: true}).
+			expect(t, http.StatusMethodNotAllowed)
+
+		c.json("POST", "/api/v1/audio-messages/"+upload.MessageID+"/receipt", admin, nil).
+			expect(t, http.StatusOK)
+		c.json("POST", "/api/v1/audio-messages/missing/receipt", admin, nil).
+			expect(t, http.StatusNotFound)
+
+		// No transcriber is configured here; TestTranscripts covers retries.
+		expectCode(t, c.json("POST", "/admin/v1/audio-messages/"+upload.MessageID+"/transcript", admin, nil).
+			expect(t, http.StatusServiceUnavailable), apierror.CodeTranscriptionUnavailable)
+		c.json("POST", "/admin/v1/audio-messages/missing/transcript", admin, nil).expect(t, http.StatusNotFound)
+
+		// TestSearch covers transcripts and access rules.
+		var search struct {
+			Results []struct {
+				MessageID string `json:"message_id"`
+				Field     string `json:"field"`
+			} `json:"results"`
+		}
+		c.json("GET", "/api/v1/search?q=adm", member, nil).expect(t, http.StatusOK).decode(t, &search)
+		if len(search.Results) != 1 || search.Results[0].MessageID != upload.MessageID || search.Results[0].Field != "sender_name" {
+			t.Errorf("expected Admin's message found by name, got %+v", search.Results)
+		}
+		expectCode(t, c.json("GET", "/api/v1/search?q=%3F%3F", member, nil).expect(t, http.StatusBadRequest), apierror.CodeBadRequest)
+
+		// No week has finished yet; TestCompilations covers building them.
+		var compilations struct {
+			Compilations []any `json:"compilations"`
+		}
+		c.json("GET", "/api/v1/compilations", member, nil).expect(t, http.StatusOK).decode(t, &compilations)
+		if len(compilations.Compilations) != 0 {
+			t.Errorf("expected no compilations, got %v", compilations.Compilations)
+		}
+		expectCode(t, c.json("GET", "/api/v1/compilations/2026-10-15", member, nil).expect(t, http.StatusBadRequest), apierror.CodeBadRequest)
+		expectCode(t, c.json("GET", "/api/v1/compilations/2026-10-14", member, nil).expect(t, http.StatusNotFound), apierror.CodeCompilationNotFound)
+		expectCode(t, c.json("GET", "/api/v1/compilations/2026-10-14/audio", member, nil).expect(t, http.StatusNotFound), apierror.CodeCompilationNotFound)
+
+		// TestStorageQuotas covers enforcement and the report's contents.
+		var usage struct {
+			Usage struct {
+				Messages int64 `json:"messages"`
+			} `json:"usage"`
+		}
+		c.json("GET", "/api/v1/me/usage", admin, nil).expect(t, http.StatusOK).decode(t, &usage)
+		if usage.Usage.Messages == 0 {
+			t.Error("expected Admin's messages counted in their usage")
+		}
+		c.json("GET", "/admin/v1/storage", admin, nil).expect(t, http.StatusOK)
+		c.json("GET", "/admin/v1/storage", member, nil).expect(t, http.StatusForbidden)
+	})
+
+	t.Run("deprecated routes", func(t *testing.T) {
+		var upload struct {
+			MessageID string `json:"message_id"`
+		}
+		expectDeprecated(t, c.upload("/api/audio-messages/upload", member, "old.m4a", []byte("fake audio"), "2").
+			expect(t, http.StatusCreated)).decode(t, &upload)
+		c.waitForMessage(t, upload.MessageID)
+
+		expectDeprecated(t, c.json("POST", "/auth/register", "", map[string]string{"name": "Member", "device_id": "member-device"}).
+			expect(t, http.StatusOK))
+		expectDeprecated(t, c.json("POST", "/auth/login", "", map[string]string{"device_id": "member-device"}).
+			expect(t, http.StatusOK))
+		expectDeprecated(t, c.json("GET", "/api/users", member, nil).expect(t, http.StatusOK))
+		expectDeprecated(t, c.json("GET", "/api/audio-messages", admin, nil).expect(t, http.StatusOK))
+		expectDeprecated(t, c.json("GET", "/api/audio-messages/download?id="+upload.MessageID, admin, nil).
+			expect(t, http.StatusOK))
+		c.do(&exchange{method: "GET", path: "/api/audio-messages/download", token: admin, invalid: true}).
+			expect(t, http.StatusBadRequest)
+		expectDeprecated(t, c.json("POST", "/api/audio-messages/received", member, map[string]string{"message_id": upload.MessageID}).
+			expect(t, http.StatusOK))
+		expectDeprecated(t, c.json("GET", "/admin/metrics", admin, nil).expect(t, http.StatusOK))
+	})
+
+	t.Run("email", func(t *testing.T) {
+		var settings struct {
+			Address  *string `json:"address"`
+			Verified bool    `json:"verified"`
+			Digest   string  `json:"digest"`
+		}
+		c.json("GET", "/api/v1/me/email", member, nil).expect(t, http.StatusOK).decode(t, &settings)
+		if settings.Address != nil || settings.Digest != "off" {
+			t.Errorf("expected no address, got %+v", settings)
+		}
+		c.do(&exchange{method: "PUT", path: "/api/v1/me/email", token: member, contentType: "application/json", body: []byte(`{"address": "Member <member@example.com>", "digest": "daily"}`), invalid: true}).
+			expect(t, http.StatusBadRequest)
+
+		c.json("PUT", "/api/v1/me/email", member, map[string]string{"address": "member@example.com", "digest": "daily"}).
+			expect(t, http.StatusOK).decode(t, &settings)
+		if settings.Verified {
+			t.Error("expected a new address to be unverified")
+		}
+		verify := mailbox.next(t)
+		if verify.to != "member@example.com" {
+			t.Errorf("expected verification email to member@example.com, got %q", verify.to)
+		}
+		verifyLink := verify.link(t, "/email/v1/verify")
+		expectCode(t, c.json("GET", verifyLink+"x", "", nil).expect(t, http.StatusForbidden), apierror.CodeLinkInvalid)
+		c.json("GET", verifyLink, "", nil).expect(t, http.StatusOK)
+		c.json("GET", "/api/v1/me/email", member, nil).expect(t, http.StatusOK).decode(t, &settings)
+		if !settings.Verified {
+			t.Error("expected the address to be verified")
+		}
+
+		var upload struct {
+			MessageID string `json:"message_id"`
+		}
+		c.upload("/api/v1/audio-messages", admin, "digest.m4a", []byte("digest audio"), "75").expect(t, http.StatusCreated).decode(t, &upload)
+		c.waitForMessage(t, upload.MessageID)
+		digester := email.NewDigester(c.queries, mailbox.sender(), email.NewLinks("test-secret", testPublicURL))
+		if err := digester.SendDue(context.Background(), time.Now()); err != nil {
+			t.Fatalf("failed to send digests: %v", err)
+		}
+		digest := mailbox.next(t)
+		if !strings.Contains(digest.body, "Admin, 1:15") {
+			t.Errorf("expected the digest to list the new message, got:\n%s", digest.body)
+		}
+		if err := digester.SendDue(context.Background(), time.Now()); err != nil {
+			t.Fatalf("failed to send digests: %v", err)
+		}
+		mailbox.expectEmpty(t)
+
+		listenLink := digest.link(t, "/email/v1/listen/"+upload.MessageID)
+		c.json("GET", listenLink, "", nil).expect(t, http.StatusOK)
+		audioLink := strings.Replace(listenLink, "?", "/audio?", 1)
+		c.do(&exchange{method: "GET", path: audioLink, header: http.Header{"Range": {"bytes=0-4"}}}).expect(t, http.StatusPartialContent)
+		c.json("GET", "/email/v1/listen/missing/audio?user=x&token=y", "", nil).expect(t, http.StatusForbidden)
+		if _, err := c.queries.GetReceipt(context.Background(), database.GetReceiptParams{AudioMessageID: upload.MessageID, UserID: verify.userID(t)}); err != nil {
+			t.Errorf("expected listening from email to mark the message received: %v", err)
+		}
+
+		unsubscribeLink := digest.link(t, "/email/v1/unsubscribe")
+		if !strings.Contains(digest.header.Get("List-Unsubscribe"), unsubscribeLink) {
+			t.Errorf("expected a List-Unsubscribe header, got %q", digest.header.Get("List-Unsubscribe"))
+		}
+		c.json("GET", unsubscribeLink, "", nil).expect(t, http.StatusOK)
+		c.do(&exchange{method: "POST", path: unsubscribeLink, contentType: "application/x-www-form-urlencoded", body: []byte("List-Unsubscribe=One-Click")}).
+			expect(t, http.StatusOK)
+		c.json("GET", "/api/v1/me/email", member, nil).expect(t, http.StatusOK).decode(t, &settings)
+		if settings.Digest != "off" || !settings.Verified {
+			t.Errorf("expected digests off for a still verified address, got %+v", settings)
+		}
+
+		c.json("DELETE", "/api/v1/me/email", member, nil).expect(t, http.StatusNoContent)
+		c.json("GET", verifyLink, "", nil).expect(t, http.StatusForbidden)
+	})
+
+	t.Run("feed", func(t *testing.T) {
+		var settings struct {
+			Enabled       bool       `json:"enabled"`
+			MarkReceived  bool       `json:"mark_received"`
+			LastFetchedAt *time.Time `json:"last_fetched_at"`
+		}
+		c.json("GET", "/api/v1/me/feed", member, nil).expect(t, http.StatusOK).decode(t, &settings)
+		if settings.Enabled {
+			t.Error("expected no feed before one is created")
+		}
+		expectCode(t, c.json("PATCH", "/api/v1/me/feed", member, map[string]bool{"mark_received": true}).expect(t, http.StatusNotFound), apierror.CodeFeedNotFound)
+
+		var created struct {
+			URL string `json:"url"`
+		}
+		c.json("POST", "/api/v1/me/feed", member, map[string]bool{"mark_received": true}).expect(t, http.StatusCreated).decode(t, &created)
+		feedPath, ok := strings.CutPrefix(created.URL, testPublicURL)
+		if !ok {
+			t.Fatalf("expected the feed URL under PUBLIC_URL, got %q", created.URL)
+		}
+
+		var upload struct {
+			MessageID string `json:"message_id"`
+		}
+		c.upload("/api/v1/audio-messages", admin, "episode.m4a", []byte("episode audio"), "42").expect(t, http.StatusCreated).decode(t, &upload)
+		c.waitForMessage(t, upload.MessageID)
+
+		var doc struct {
+			Channel struct {
+				Items []struct {
+					GUID      string `xml:"guid"`
+					Author    string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd author"`
+					Duration  string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd duration"`
+					Enclosure struct {
+						URL    string `xml:"url,attr"`
+						Length int64  `xml:"length,attr"`
+						Type   string `xml:"type,attr"`
+					} `xml:"enclosure"`
+				} `xml:"item"`
+			} `xml:"channel"`
+		}
+		ex := c.json("GET", feedPath, "", nil).expect(t, http.StatusOK)
+		if err := xml.Unmarshal(ex.respBody, &doc); err != nil {
+			t.Fatalf("failed to parse feed: %v", err)
+		}
+		var episodePath string
+		for _, item := range doc.Channel.Items {
+			if item.GUID != upload.MessageID {
+				continue
+			}
+			if item.Author != "Admin" || item.Duration != "00:00:42" || item.Enclosure.Type != "audio/mp4" || item.Enclosure.Length != int64(len("episode audio")) {
+				t.Errorf("unexpected episode %+v", item)
+			}
+			episodePath = strings.TrimPrefix(item.Enclosure.URL, testPublicURL)
+		}
+		if episodePath == "" {
+			t.Fatalf("expected the new message as an episode, got %+v", doc.Channel.Items)
+		}
+
+		ex = c.do(&exchange{method: "GET", path: episodePath, header: http.Header{"Range": {"bytes=0-6"}}}).expect(t, http.StatusPartialContent)
+		if string(ex.respBody) != "episode" {
+			t.Errorf("expected the first 7 bytes, got %q", ex.respBody)
+		}
+		var me struct {
+			ID string `json:"id"`
+		}
+		c.json("GET", "/api/v1/me", member, nil).expect(t, http.StatusOK).decode(t, &me)
+		if _, err := c.queries.GetReceipt(context.Background(), database.GetReceiptParams{AudioMessageID: upload.MessageID, UserID: me.ID}); err != nil {
+			t.Errorf("expected the feed download to mark the message received: %v", err)
+		}
+
+		c.json("PATCH", "/api/v1/me/feed", member, map[string]bool{"mark_received": false}).expect(t, http.StatusOK).decode(t, &settings)
+		if !settings.Enabled || settings.MarkReceived || settings.LastFetchedAt == nil {
+			t.Errorf("unexpected feed settings %+v", settings)
+		}
+
+		c.json("POST", "/api/v1/me/feed", member, map[string]bool{}).expect(t, http.StatusCreated).decode(t, &created)
+		expectCode(t, c.json("GET", feedPath, "", nil).expect(t, http.StatusNotFound), apierror.CodeFeedNotFound)
+		c.json("DELETE", "/api/v1/me/feed", member, nil).expect(t, http.StatusNoContent)
+		c.json("GET", strings.TrimPrefix(created.URL, testPublicURL), "", nil).expect(t, http.StatusNotFound)
+	})
+
+	t.Run("admin", func(t *testing.T) {
+		metrics := c.json("GET", "/admin/v1/metrics", admin, nil).expect(t, http.StatusOK)
+		if !strings.Contains(string(metrics.respBody), `route="/api/v1/audio-messages/{id}"`) {
+			t.Errorf("expected request metrics to be labelled by route pattern")
+		}
+		var pending, active int
+		if err := c.sqlDB.QueryRow("SELECT COUNT(*) FILTER (WHERE NOT approved), COUNT(*) FILTER (WHERE approved AND status = 'active') FROM users").Scan(&pending, &active); err != nil {
+			t.Fatal(err)
+		}
+		for _, sample := range []string{fmt.Sprintf(`waffle_users{state="pending"} %d`, pending), fmt.Sprintf(`waffle_users{state="active"} %d`, active)} {
+			if !strings.Contains(string(metrics.respBody), sample+"\n") {
+				t.Errorf("expected %s in metrics", sample)
+			}
+		}
+		c.json("GET", "/admin/v1/metrics", member, nil).expect(t, http.StatusForbidden)
+
+		revoked := c.registerApprovedUser("Revoked", "revoked-device", "user")
+		var user struct {
+			UserID string `json:"user_id"`
+		}
+		c.json("POST", "/auth/v1/register", "", map[string]string{"device_id": "revoked-device"}).
+			expect(t, http.StatusOK).decode(t, &user)
+		c.json("POST", "/admin/v1/users/"+user.UserID+"/revoke-sessions", admin, nil).expect(t, http.StatusOK)
+		c.json("POST", "/admin/v1/users/missing/revoke-sessions", admin, nil).expect(t, http.StatusNotFound)
+		expectCode(t, c.json("GET", "/api/v1/users", revoked, nil).expect(t, http.StatusUnauthorized), apierror.CodeTokenRevoked)
+		// Logging in again, even within the same second, issues a working token.
+		var relogin struct {
+			Token string `json:"token"`
+		}
+		c.json("POST", "/auth/v1/login", "", map[string]string{"device_id": "revoked-device"}).
+			expect(t, http.StatusOK).decode(t, &relogin)
+		c.json("GET", "/api/v1/users", relogin.Token, nil).expect(t, http.StatusOK)
+
+		c.json("PUT", "/admin/v1/users/"+user.UserID+"/status", admin, map[string]string{"status": "suspended"}).expect(t, http.StatusOK)
+		expectCode(t, c.json("POST", "/auth/v1/login", "", map[string]string{"device_id": "revoked-device"}).
+			expect(t, http.StatusForbidden), apierror.CodeUserSuspended)
+		c.do(&exchange{method: "PUT", path: "/admin/v1/users/" + user.UserID + "/status", token: admin, contentType: "application/json", body: []byte(`{"status": "inactive"}`), invalid: true}).
+			expect(t, http.StatusBadRequest)
+		c.json("PUT", "/admin/v1/users/missing/status", admin, map[string]string{"status": "active"}).expect(t, http.StatusNotFound)
+
+		var page struct {
+			Events []struct {
+				Action      string  `json:"action"`
+				ActorUserID *string `json:"actor_user_id"`
+				TargetID    *string `json:"target_id"`
+			} `json:"events"`
+			NextCursor *string `json:"next_cursor"`
+		}
+		c.json("GET", "/admin/v1/audit-events?action=user.sessions_revoked", admin, nil).expect(t, http.StatusOK).decode(t, &page)
+		if len(page.Events) != 1 || page.Events[0].TargetID == nil || *page.Events[0].TargetID != user.UserID || page.Events[0].ActorUserID == nil {
+			t.Errorf("expected one sessions_revoked event for %s by an admin, got %+v", user.UserID, page.Events)
+		}
+		c.json("GET", "/admin/v1/audit-events?limit=1", admin, nil).expect(t, http.StatusOK).decode(t, &page)
+		if len(page.Events) != 1 || page.NextCursor == nil {
+			t.Fatalf("expected a single event and a next cursor, got %+v", page)
+		}
+		c.json("GET", "/admin/v1/audit-events?limit=1&cursor="+*page.NextCursor, admin, nil).expect(t, http.StatusOK)
+		c.json("GET", "/admin/v1/audit-events?cursor=abc", admin, nil).expect(t, http.StatusBadRequest)
+		c.json("GET", "/admin/v1/audit-events", member, nil).expect(t, http.StatusForbidden)
+	})
+
+	t.Run("account", func(t *testing.T) {
+		leaver := c.registerApprovedUser("Leaver", "leaver-device", "user")
+		var upload struct {
+			MessageID string `json:"message_id"`
+		}
+		c.upload("/api/v1/audio-messages", leaver, "bye.m4a", []byte("leaving audio"), "1").expect(t, http.StatusCreated).decode(t, &upload)
+		c.waitForMessage(t, upload.MessageID)
+		c.json("POST", "/api/v1/audio-messages/"+upload.MessageID+"/receipt", member, nil).expect(t, http.StatusOK)
+		messageJobs := func() int {
+			t.Helper()
+			var n int
+			if err := c.sqlDB.QueryRow("SELECT COUNT(*) FROM jobs WHERE json_extract(payload, '$.message_id') = ?", upload.MessageID).Scan(&n); err != nil {
+				t.Fatalf("failed to count jobs: %v", err)
+			}
+			return n
+		}
+		if messageJobs() == 0 {
+			t.Fatal("expected the upload to queue processing")
+		}
+
+		export := c.json("GET", "/api/v1/me/export", leaver, nil).expect(t, http.StatusOK)
+		archive, err := zip.NewReader(bytes.NewReader(export.respBody), int64(len(export.respBody)))
+		if err != nil {
+			t.Fatalf("export is not a zip: %v", err)
+		}
+		files := map[string]bool{}
+		for _, f := range archive.File {
+			files[f.Name] = true
+		}
+		for _, name := range []string{"profile.json", "messages.json", "receipts.json", "audio/" + upload.MessageID + ".m4a"} {
+			if !files[name] {
+				t.Errorf("expected %s in export, got %v", name, files)
+			}
+		}
+
+		var confirmation struct {
+			ConfirmationToken string `json:"confirmation_token"`
+		}
+		c.json("POST", "/api/v1/me/deletion-token", leaver, nil).expect(t, http.StatusOK).decode(t, &confirmation)
+		c.json("DELETE", "/api/v1/me", member, map[string]string{"confirmation_token": confirmation.ConfirmationToken}).
+			expect(t, http.StatusForbidden)
+		c.do(&exchange{method: "DELETE", path: "/api/v1/me", token: leaver, contentType: "application/json", body: []byte(`{}`), invalid: true}).
+			expect(t, http.StatusBadRequest)
+		c.json("DELETE", "/api/v1/me", leaver, map[string]string{"confirmation_token": confirmation.ConfirmationToken}).
+			expect(t, http.StatusNoContent)
+
+		expectCode(t, c.json("GET", "/api/v1/users", leaver, nil).expect(t, http.StatusUnauthorized), apierror.CodeTokenInvalid)
+		if _, err := c.queries.GetAudioMessage(context.Background(), upload.MessageID); err != sql.ErrNoRows {
+			t.Errorf("expected the sent message to be deleted, got %v", err)
+		}
+		if paths, _ := filepath.Glob(filepath.Join(c.audioDirectory, upload.MessageID+"*")); len(paths) != 0 {
+			t.Errorf("expected the audio file to be removed, found %v", paths)
+		}
+		if n := messageJobs(); n != 0 {
+			t.Errorf("expected the message's jobs deleted, got %d", n)
+		}
+
+		c.json("GET", "/admin/v1/users/missing/export", admin, nil).expect(t, http.StatusNotFound)
+		c.json("DELETE", "/admin/v1/users/missing", admin, nil).expect(t, http.StatusNotFound)
+		c.json("GET", "/admin/v1/users/missing/export", member, nil).expect(t, http.StatusForbidden)
+
+		var doomed struct {
+			UserID string `json:"user_id"`
+		}
+		c.registerApprovedUser("Doomed", "doomed-device", "user")
+		c.json("POST", "/auth/v1/register", "", map[string]string{"device_id": "doomed-device"}).
+			expect(t, http.StatusOK).decode(t, &doomed)
+		c.json("GET", "/admin/v1/users/"+doomed.UserID+"/export", admin, nil).expect(t, http.StatusOK)
+		c.json("DELETE", "/admin/v1/users/"+doomed.UserID, admin, nil).expect(t, http.StatusNoContent)
+		c.json("POST", "/auth/v1/login", "", map[string]string{"device_id": "doomed-device"}).expect(t, http.StatusUnauthorized)
+	})
+
+	t.Run("unknown route", func(t *testing.T) {
+		c.do(&exchange{method: "GET", path: "/api/nope", token: member, invalid: true}).expect(t, http.StatusNotFound)
+	})
+
+	c.assertCoverage()
+}
@@ -0,0 +1,194 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/textproto"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecdray/waffle-talkie/internal/database"
+	"github.com/alecdray/waffle-talkie/internal/email"
+)
+
+func TestDigestFollowsNotificationPolicy(t *testing.T) {
+	mailbox := newSMTPStub(t)
+	c := newContract(t, Options{})
+	c.startJobWorkers()
+	ctx := context.Background()
+
+	// Every user has a verified address with a daily digest.
+	subscribe := func(name string) (token, userID string) {
+		t.Helper()
+		token = c.registerApprovedUser(name, strings.ToLower(name)+"-device", "user")
+		userID = c.userID(token)
+		address := strings.ToLower(name) + "@example.com"
+		if _, err := c.queries.UpsertUserEmail(ctx, database.UpsertUserEmailParams{UserID: userID, Address: address, Digest: string(email.DigestDaily)}); err != nil {
+			t.Fatalf("failed to add address: %v", err)
+		}
+		if _, err := c.queries.VerifyUserEmail(ctx, database.VerifyUserEmailParams{UserID: userID, Address: address}); err != nil {
+			t.Fatalf("failed to verify address: %v", err)
+		}
+		return token, userID
+	}
+	sender, senderID := subscribe("Sender")
+	subscribe("Reader")
+	off, _ := subscribe("Off")
+	muter, _ := subscribe("Muter")
+	sleepy, _ := subscribe("Sleepy")
+
+	c.json("PUT", "/api/v1/me/notifications", off, map[string]any{"mode": "none"}).expect(t, http.StatusOK)
+	c.json("PUT", "/api/v1/me/notifications/mutes/"+senderID, muter, nil).expect(t, http.StatusNoContent)
+	// Quiet hours defer alerts, but a digest is read when the user gets to it.
+	now := time.Now().UTC()
+	c.json("PUT", "/api/v1/me/notifications", sleepy, map[string]any{
+		"mode":        "all",
+		"quiet_hours": map[string]string{"start": now.Add(-time.Hour).Format("15:04"), "end": now.Add(time.Hour).Format("15:04")},
+	}).expect(t, http.StatusOK)
+
+	c.send(sender, "hi.m4a", []byte("audio"), "5")
+
+	digester := email.NewDigester(c.queries, mailbox.sender(), email.NewLinks("test-secret", testPublicURL))
+	if err := digester.SendDue(ctx, now); err != nil {
+		t.Fatalf("failed to send digests: %v", err)
+	}
+	var to []string
+	for range 2 {
+		to = append(to, mailbox.next(t).to)
+	}
+	mailbox.expectEmpty(t)
+	slices.Sort(to)
+	if !slices.Equal(to, []string{"reader@example.com", "sleepy@example.com"}) {
+		t.Errorf("expected digests only for Reader and Sleepy, got %v", to)
+	}
+}
+
+const testPublicURL = "https://waffle.example"
+
+// smtpStub is an in-process SMTP server that records the emails it receives.
+type smtpStub struct {
+	addr     string
+	received chan receivedEmail
+}
+
+type receivedEmail struct {
+	to     string
+	header mail.Header
+	body   string
+}
+
+func newSMTPStub(t *testing.T) *smtpStub {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	stub := &smtpStub{addr: ln.Addr().String(), received: make(chan receivedEmail, 16)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go stub.serve(conn)
+		}
+	}()
+	return stub
+}
+
+func (s *smtpStub) sender() email.Sender {
+	return &email.SMTPSender{Addr: s.addr, From: "Waffle Talkie <waffle@example.com>"}
+}
+
+// serve speaks just enough SMTP for net/smtp to deliver one message at a time.
+func (s *smtpStub) serve(conn net.Conn) {
+	defer conn.Close()
+	tc := textproto.NewConn(conn)
+	tc.PrintfLine("220 localhost")
+	var to string
+	for {
+		line, err := tc.ReadLine()
+		if err != nil {
+			return
+		}
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch verb {
+		case "EHLO", "HELO", "MAIL", "RSET", "NOOP":
+			tc.PrintfLine("250 OK")
+		case "RCPT":
+			to = strings.Trim(strings.TrimPrefix(line[len(verb):], " TO:"), "<>")
+			tc.PrintfLine("250 OK")
+		case "DATA":
+			tc.PrintfLine("354 Go ahead")
+			data, err := tc.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			msg, err := mail.ReadMessage(bytes.NewReader(data))
+			if err != nil {
+				tc.PrintfLine("554 Malformed message")
+				continue
+			}
+			body, _ := io.ReadAll(quotedprintable.NewReader(msg.Body))
+			s.received <- receivedEmail{to: to, header: msg.Header, body: strings.ReplaceAll(string(body), "\r\n", "\n")}
+			tc.PrintfLine("250 OK")
+		case "QUIT":
+			tc.PrintfLine("221 Bye")
+			return
+		default:
+			tc.PrintfLine("502 Not implemented")
+		}
+	}
+}
+
+// next returns the next email received, failing if none arrives.
+func (s *smtpStub) next(t *testing.T) receivedEmail {
+	t.Helper()
+	select {
+	case msg := <-s.received:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("no email received")
+		return receivedEmail{}
+	}
+}
+
+// expectEmpty fails if an email is waiting. Sends are synchronous, so
+// anything sent has already arrived.
+func (s *smtpStub) expectEmpty(t *testing.T) {
+	t.Helper()
+	select {
+	case msg := <-s.received:
+		t.Errorf("unexpected email %q to %s", msg.header.Get("Subject"), msg.to)
+	default:
+	}
+}
+
+// link returns the path and query of the first link in the body to path.
+func (e receivedEmail) link(t *testing.T, path string) string {
+	t.Helper()
+	for _, field := range strings.Fields(e.body) {
+		if u, err := url.Parse(field); err == nil && strings.HasPrefix(field, testPublicURL) && u.Path == path {
+			return u.RequestURI()
+		}
+	}
+	t.Fatalf("no link to %s in email:\n%s", path, e.body)
+	return ""
+}
+
+// userID returns the user a verification email was sent for.
+func (e receivedEmail) userID(t *testing.T) string {
+	t.Helper()
+	u, _ := url.Parse(e.link(t, "/email/v1/verify"))
+	return u.Query().Get("user")
+}
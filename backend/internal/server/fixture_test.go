@@ -0,0 +1,309 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecdray/waffle-talkie/internal/apierror"
+	"github.com/alecdray/waffle-talkie/internal/audio"
+	"github.com/alecdray/waffle-talkie/internal/audit"
+	"github.com/alecdray/waffle-talkie/internal/database"
+	"github.com/alecdray/waffle-talkie/internal/jobs"
+	"github.com/alecdray/waffle-talkie/internal/notify"
+	"github.com/alecdray/waffle-talkie/internal/openapi"
+)
+
+// contract wraps a test server and validates every exchange against the spec,
+// recording which operations were exercised.
+type contract struct {
+	t              *testing.T
+	doc            *openAPIDoc
+	server         *httptest.Server
+	sqlDB          *sql.DB
+	queries        *database.Queries
+	audioDirectory string
+	opts           Options
+	covered        map[string]bool
+}
+
+func newContract(t *testing.T, opts Options) *contract {
+	t.Helper()
+	return newPipelineContract(t, opts, PipelineOptions{})
+}
+
+// newPipelineContract is newContract with uploads processed as pipelineOpts
+// configure.
+func newPipelineContract(t *testing.T, opts Options, pipelineOpts PipelineOptions) *contract {
+	t.Helper()
+
+	var doc openAPIDoc
+	if err := json.Unmarshal(openapi.Spec, &doc); err != nil {
+		t.Fatalf("failed to parse OpenAPI spec: %v", err)
+	}
+
+	dir := t.TempDir()
+	sqlDB, queries, err := database.InitDB(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("failed to init database: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+
+	opts.JWTSecret = "test-secret"
+	opts.AudioDirectory = filepath.Join(dir, "audio")
+	opts.AvatarDirectory = filepath.Join(dir, "avatars")
+	pipelineOpts.AudioDirectory = opts.AudioDirectory
+	opts.Pipeline = NewPipeline(queries, notify.New(queries, opts.NotificationChannels...), pipelineOpts)
+	server := httptest.NewServer(NewMux(sqlDB, queries, opts))
+	t.Cleanup(server.Close)
+
+	return &contract{
+		t:              t,
+		doc:            &doc,
+		server:         server,
+		sqlDB:          sqlDB,
+		queries:        queries,
+		audioDirectory: opts.AudioDirectory,
+		opts:           opts,
+		covered:        make(map[string]bool),
+	}
+}
+
+// registerApprovedUser registers a device, approves it with the given role and
+// returns a bearer token.
+func (c *contract) registerApprovedUser(name, deviceID, role string) string {
+	c.t.Helper()
+
+	var registered struct {
+		UserID string `json:"user_id"`
+	}
+	c.json("POST", "/auth/v1/register", "", map[string]string{"name": name, "device_id": deviceID}).
+		expect(c.t, http.StatusCreated).decode(c.t, &registered)
+
+	if _, err := c.sqlDB.ExecContext(context.Background(), "UPDATE users SET approved = TRUE, role = ? WHERE id = ?", role, registered.UserID); err != nil {
+		c.t.Fatalf("failed to approve user: %v", err)
+	}
+
+	var login struct {
+		Token string `json:"token"`
+	}
+	c.json("POST", "/auth/v1/login", "", map[string]string{"device_id": deviceID}).
+		expect(c.t, http.StatusOK).decode(c.t, &login)
+	return login.Token
+}
+
+// userID returns the ID of the user a token belongs to.
+func (c *contract) userID(token string) string {
+	c.t.Helper()
+	var me struct {
+		ID string `json:"id"`
+	}
+	c.json("GET", "/api/v1/me", token, nil).expect(c.t, http.StatusOK).decode(c.t, &me)
+	return me.ID
+}
+
+// send uploads a message and returns its ID once it is processed, which
+// needs startJobWorkers.
+func (c *contract) send(token, filename string, audio []byte, duration string) string {
+	c.t.Helper()
+	var upload struct {
+		MessageID string `json:"message_id"`
+	}
+	c.upload("/api/v1/audio-messages", token, filename, audio, duration).expect(c.t, http.StatusCreated).decode(c.t, &upload)
+	c.waitForMessage(c.t, upload.MessageID)
+	return upload.MessageID
+}
+
+// waitForMessage waits until a message's required processing steps finish.
+func (c *contract) waitForMessage(t *testing.T, messageID string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		message, err := c.queries.GetAudioMessageWithDeleted(context.Background(), messageID)
+		if err != nil {
+			t.Fatalf("failed to get message: %v", err)
+		}
+		if message.ProcessingStatus != audio.StatusProcessing {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("message %s was not processed in time", messageID)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// expectDeprecated fails unless the response advertises its successor route.
+func expectDeprecated(t *testing.T, ex *exchange) *exchange {
+	t.Helper()
+	if ex.resp.Header.Get("Deprecation") == "" || !strings.Contains(ex.resp.Header.Get("Link"), "successor-version") {
+		t.Errorf("%s %s: expected Deprecation and successor Link headers", ex.method, ex.path)
+	}
+	return ex
+}
+
+// upload sends a multipart audio upload; an empty filename omits the file part.
+func (c *contract) upload(path, token, filename string, audio []byte, duration string) *exchange {
+	c.t.Helper()
+	return c.uploadFields(path, token, filename, audio, map[string]string{"duration": duration})
+}
+
+// uploadFields sends a multipart audio upload with the given form fields.
+func (c *contract) uploadFields(path, token, filename string, audio []byte, fields map[string]string) *exchange {
+	c.t.Helper()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	if filename != "" {
+		part, err := mw.CreateFormFile("audio", filename)
+		if err != nil {
+			c.t.Fatalf("failed to create form file: %v", err)
+		}
+		part.Write(audio)
+	}
+	for name, value := range fields {
+		mw.WriteField(name, value)
+	}
+	mw.Close()
+
+	return c.do(&exchange{
+		method:      "POST",
+		path:        path,
+		token:       token,
+		contentType: mw.FormDataContentType(),
+		body:        body.Bytes(),
+		invalid:     filename == "",
+	})
+}
+
+// uploadAvatar sends a multipart avatar upload.
+func (c *contract) uploadAvatar(token string, image []byte) *exchange {
+	c.t.Helper()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreateFormFile("avatar", "avatar.png")
+	if err != nil {
+		c.t.Fatalf("failed to create form file: %v", err)
+	}
+	part.Write(image)
+	mw.Close()
+
+	return c.do(&exchange{
+		method:      "PUT",
+		path:        "/api/v1/me/avatar",
+		token:       token,
+		contentType: mw.FormDataContentType(),
+		body:        body.Bytes(),
+	})
+}
+
+// testPNG encodes a translucent gradient of the given size.
+func testPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 128, A: 200})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("failed to encode png: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// testWAV encodes frames of integer PCM whose amplitude is level(frame) of
+// full scale, alternating in sign, on every channel.
+func testWAV(channels, bits, frames int, level func(frame int) float64) []byte {
+	width := bits / 8
+	var data bytes.Buffer
+	for frame := range frames {
+		v := int32(level(frame) * float64(int32(1)<<(bits-1)-1))
+		if frame%2 == 1 {
+			v = -v
+		}
+		for range channels {
+			for b := range width {
+				data.WriteByte(byte(v >> (8 * b)))
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	le := binary.LittleEndian
+	buf.WriteString("RIFF")
+	binary.Write(&buf, le, uint32(36+data.Len()))
+	buf.WriteString("WAVEfmt ")
+	binary.Write(&buf, le, uint32(16))
+	binary.Write(&buf, le, uint16(1))
+	binary.Write(&buf, le, uint16(channels))
+	binary.Write(&buf, le, uint32(8000))
+	binary.Write(&buf, le, uint32(8000*channels*width))
+	binary.Write(&buf, le, uint16(channels*width))
+	binary.Write(&buf, le, uint16(bits))
+	buf.WriteString("data")
+	binary.Write(&buf, le, uint32(data.Len()))
+	buf.Write(data.Bytes())
+	return buf.Bytes()
+}
+
+// startJobWorkers runs the task manager's job workers against c until the test
+// ends, polling often so tests need not wait long.
+func (c *contract) startJobWorkers() {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.t.Cleanup(cancel)
+	pool := jobs.NewPool(c.queries, jobs.PoolOptions{PollInterval: 10 * time.Millisecond})
+	c.opts.Pipeline.Register(pool)
+	pool.Register(audio.JobPurge, audio.NewPurger(c.queries, audit.New(c.queries, nil)))
+	pool.Register(audio.JobRetract, audio.NewRetracter(c.queries, notify.New(c.queries, c.opts.NotificationChannels...)))
+	if err := pool.Start(ctx); err != nil {
+		c.t.Fatalf("failed to start job workers: %v", err)
+	}
+}
+
+// waitForJobs waits until no job is queued or running.
+func (c *contract) waitForJobs() {
+	c.t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		counts, err := c.queries.CountJobs(context.Background())
+		if err != nil {
+			c.t.Fatalf("failed to count jobs: %v", err)
+		}
+		pending := false
+		for _, count := range counts {
+			pending = pending || count.State == jobs.StateQueued || count.State == jobs.StateRunning
+		}
+		if !pending {
+			return
+		}
+		if time.Now().After(deadline) {
+			c.t.Fatalf("jobs did not finish in time: %+v", counts)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// expectCode fails unless the error response carries the given code.
+func expectCode(t *testing.T, ex *exchange, code apierror.Code) {
+	t.Helper()
+	var resp apierror.Response
+	ex.decode(t, &resp)
+	if resp.Error.Code != code {
+		t.Errorf("%s %s: expected error code %q, got %q", ex.method, ex.path, code, resp.Error.Code)
+	}
+}
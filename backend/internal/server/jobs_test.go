@@ -0,0 +1,222 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alecdray/waffle-talkie/internal/apierror"
+	"github.com/alecdray/waffle-talkie/internal/audio"
+	"github.com/alecdray/waffle-talkie/internal/database"
+	"github.com/alecdray/waffle-talkie/internal/jobs"
+	"github.com/alecdray/waffle-talkie/internal/notify"
+)
+
+func TestJobs(t *testing.T) {
+	c := newContract(t, Options{})
+	ctx := context.Background()
+	sender := c.registerApprovedUser("Sender", "sender-device", "user")
+	listener := c.registerApprovedUser("Listener", "listener-device", "user")
+	senderID := c.userID(sender)
+
+	pool := jobs.NewPool(c.queries, jobs.PoolOptions{MaxAttempts: 3, RetryDelay: 50 * time.Millisecond})
+	runNext := func() bool {
+		t.Helper()
+		ran, err := pool.RunNext(ctx)
+		if err != nil {
+			t.Fatalf("failed to run job: %v", err)
+		}
+		return ran
+	}
+	// retry runs the next job once its backoff is over, reporting false if
+	// none comes due within a few seconds.
+	retry := func() bool {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !runNext() {
+			if time.Now().After(deadline) {
+				return false
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		return true
+	}
+
+	// A required step that fails until it is told to pass.
+	var attempts int
+	pass := false
+	pipeline := audio.NewPipeline(c.queries, notify.New(c.queries), audio.Step{
+		Name:     "check",
+		Required: true,
+		Run: func(ctx context.Context, message database.AudioMessage) error {
+			attempts++
+			if !pass && message.ID == "flaky" {
+				return fmt.Errorf("not yet")
+			}
+			if message.ID == "broken" {
+				return jobs.Permanent(fmt.Errorf("cannot process"))
+			}
+			return nil
+		},
+	})
+	pipeline.Register(pool)
+	if pipeline.InitialStatus() != audio.StatusProcessing {
+		t.Fatalf("expected required steps to hold messages back, got %s", pipeline.InitialStatus())
+	}
+
+	create := func(id string) {
+		t.Helper()
+		message, err := c.queries.CreateAudioMessage(ctx, database.CreateAudioMessageParams{
+			ID:               id,
+			SenderUserID:     senderID,
+			FilePath:         filepath.Join(c.audioDirectory, id+".m4a"),
+			Duration:         1,
+			ProcessingStatus: pipeline.InitialStatus(),
+		})
+		if err != nil {
+			t.Fatalf("failed to create message: %v", err)
+		}
+		if err := pipeline.Start(ctx, message); err != nil {
+			t.Fatalf("failed to start processing: %v", err)
+		}
+	}
+	statuses := func(token string) map[string]string {
+		t.Helper()
+		var list struct {
+			Messages []struct {
+				ID               string `json:"id"`
+				ProcessingStatus string `json:"processing_status"`
+			} `json:"messages"`
+		}
+		c.json("GET", "/api/v1/audio-messages", token, nil).expect(t, http.StatusOK).decode(t, &list)
+		seen := make(map[string]string)
+		for _, message := range list.Messages {
+			seen[message.ID] = message.ProcessingStatus
+		}
+		return seen
+	}
+
+	t.Run("required steps hold messages back from recipients", func(t *testing.T) {
+		create("flaky")
+		if seen := statuses(listener); len(seen) != 0 {
+			t.Errorf("expected recipients to see nothing while processing, got %v", seen)
+		}
+		if seen := statuses(sender); seen["flaky"] != audio.StatusProcessing {
+			t.Errorf("expected the sender to see their message processing, got %v", seen)
+		}
+		expectCode(t, c.json("GET", "/api/v1/audio-messages/flaky", listener, nil).expect(t, http.StatusNotFound), apierror.CodeMessageNotFound)
+		expectCode(t, c.json("POST", "/api/v1/audio-messages/flaky/receipt", listener, nil).expect(t, http.StatusNotFound), apierror.CodeMessageNotFound)
+
+		if !runNext() {
+			t.Fatal("expected the processing job to run")
+		}
+		if runNext() {
+			t.Fatal("expected the failed job to back off before its retry")
+		}
+		pass = true
+		if !retry() {
+			t.Fatal("expected the processing job to be retried")
+		}
+		if attempts != 2 {
+			t.Errorf("expected 2 attempts, got %d", attempts)
+		}
+		if seen := statuses(listener); seen["flaky"] != audio.StatusReady {
+			t.Errorf("expected the processed message to be shown, got %v", seen)
+		}
+		if runNext() {
+			t.Error("expected no jobs once processed")
+		}
+	})
+
+	t.Run("messages whose processing fails stay hidden", func(t *testing.T) {
+		create("broken")
+		if !runNext() || runNext() {
+			t.Fatal("expected a permanent failure to run once")
+		}
+		if seen := statuses(listener); len(seen) != 1 {
+			t.Errorf("expected the failed message to stay hidden, got %v", seen)
+		}
+		if seen := statuses(sender); seen["broken"] != audio.StatusFailed {
+			t.Errorf("expected the sender to see the failure, got %v", seen)
+		}
+	})
+
+	t.Run("jobs fail after their last attempt", func(t *testing.T) {
+		var runs int
+		pool.Register("test.fail", jobs.HandlerFunc(func(ctx context.Context, job database.Job) error {
+			runs++
+			return fmt.Errorf("attempt %d", job.Attempts)
+		}))
+		job, err := jobs.NewQueue(c.queries).Enqueue(ctx, "test.fail", nil)
+		if err != nil {
+			t.Fatalf("failed to enqueue: %v", err)
+		}
+		if !runNext() || !retry() || !retry() {
+			t.Fatal("expected 3 attempts")
+		}
+		if runNext() {
+			t.Fatal("expected no attempts after the last")
+		}
+		if job, err = c.queries.GetJob(ctx, job.ID); err != nil {
+			t.Fatalf("failed to get job: %v", err)
+		}
+		if runs != 3 || job.State != jobs.StateFailed || job.Attempts != 3 || job.LastError.String != "attempt 3" {
+			t.Errorf("expected 3 failed attempts, ran %d: %+v", runs, job)
+		}
+	})
+
+	t.Run("jobs are rerun once their lease expires", func(t *testing.T) {
+		var payloads []string
+		pool.Register("test.lease", jobs.HandlerFunc(func(ctx context.Context, job database.Job) error {
+			var payload struct {
+				Name string `json:"name"`
+			}
+			if err := jobs.Decode(job, &payload); err != nil {
+				return err
+			}
+			payloads = append(payloads, payload.Name)
+			return nil
+		}))
+		job, err := jobs.NewQueue(c.queries).Enqueue(ctx, "test.lease", map[string]string{"name": "leased"})
+		if err != nil {
+			t.Fatalf("failed to enqueue: %v", err)
+		}
+
+		// A worker claims the job and dies; its lease has already run out.
+		now := time.Now().UTC()
+		if _, err := c.queries.ClaimJob(ctx, database.ClaimJobParams{
+			LeaseExpiresAt: sql.NullTime{Time: now.Add(-time.Second), Valid: true},
+			Now:            now,
+		}); err != nil {
+			t.Fatalf("failed to claim job: %v", err)
+		}
+		if !runNext() {
+			t.Fatal("expected the expired lease to be reclaimed")
+		}
+		if job, err = c.queries.GetJob(ctx, job.ID); err != nil {
+			t.Fatalf("failed to get job: %v", err)
+		}
+		if !slices.Equal(payloads, []string{"leased"}) || job.State != jobs.StateSucceeded || job.Attempts != 2 {
+			t.Errorf("expected the job to succeed on its second attempt, ran %v: %+v", payloads, job)
+		}
+	})
+
+	t.Run("jobs without a handler fail", func(t *testing.T) {
+		job, err := jobs.NewQueue(c.queries).Enqueue(ctx, "test.unknown", nil)
+		if err != nil {
+			t.Fatalf("failed to enqueue: %v", err)
+		}
+		runNext()
+		if job, err = c.queries.GetJob(ctx, job.ID); err != nil {
+			t.Fatalf("failed to get job: %v", err)
+		}
+		if job.State != jobs.StateFailed || job.Attempts != 1 {
+			t.Errorf("expected the job to fail without retries: %+v", job)
+		}
+	})
+}
@@ -0,0 +1,208 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alecdray/waffle-talkie/internal/apierror"
+	"github.com/alecdray/waffle-talkie/internal/database"
+	"github.com/alecdray/waffle-talkie/internal/metrics"
+	"github.com/alecdray/waffle-talkie/internal/storage"
+)
+
+var (
+	httpRequests = metrics.NewCounter(
+		"waffle_http_requests_total",
+		"HTTP requests handled, by route and status.",
+		"method", "route", "status",
+	)
+	httpRequestDuration = metrics.NewHistogram(
+		"waffle_http_request_duration_seconds",
+		"HTTP request latency, by route.",
+		metrics.DefaultBuckets,
+		"method", "route",
+	)
+)
+
+type routeContextKey struct{}
+
+// withRoute serves mux, recording the matched pattern so metrics can be
+// labelled by route instead of raw path. The prefix restores any segment
+// removed by StripPrefix. When nothing matches, the ServeMux plain-text 404 and
+// 405 responses are replaced with the JSON error envelope.
+func withRoute(prefix string, mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, pattern := mux.Handler(r)
+		if pattern == "" {
+			mux.ServeHTTP(&unmatchedResponseWriter{ResponseWriter: w}, r)
+			return
+		}
+
+		if route, ok := r.Context().Value(routeContextKey{}).(*string); ok {
+			// Patterns may carry a method, e.g. "GET /v1/users".
+			if _, path, found := strings.Cut(pattern, " "); found {
+				pattern = path
+			}
+			*route = prefix + pattern
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// unmatchedResponseWriter rewrites the plain-text bodies ServeMux writes for
+// unmatched paths and methods. Headers such as Allow are preserved.
+type unmatchedResponseWriter struct {
+	http.ResponseWriter
+	rewritten bool
+}
+
+func (uw *unmatchedResponseWriter) WriteHeader(code int) {
+	switch code {
+	case http.StatusNotFound:
+		uw.rewritten = true
+		apierror.Write(uw.ResponseWriter, code, apierror.CodeNotFound, "Not found")
+	case http.StatusMethodNotAllowed:
+		uw.rewritten = true
+		apierror.Write(uw.ResponseWriter, code, apierror.CodeMethodNotAllowed, "Method not allowed")
+	default:
+		uw.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (uw *unmatchedResponseWriter) Write(b []byte) (int, error) {
+	if uw.rewritten {
+		return len(b), nil
+	}
+	return uw.ResponseWriter.Write(b)
+}
+
+// metricsMiddleware counts requests and observes latency per route and status.
+func metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		route := "unmatched"
+		ctx := context.WithValue(r.Context(), routeContextKey{}, &route)
+
+		rw := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(rw, r.WithContext(ctx))
+
+		httpRequests.Inc(r.Method, route, strconv.Itoa(rw.statusCode))
+		httpRequestDuration.ObserveDuration(start, r.Method, route)
+	})
+}
+
+// storageSizeTTL is how long a measurement of the audio directory is reused.
+// Walking it takes a stat per file, too slow to repeat on every scrape.
+const storageSizeTTL = 5 * time.Minute
+
+// cachedSize measures a directory at most once per storageSizeTTL.
+type cachedSize struct {
+	mu         sync.Mutex
+	dir        string
+	bytes      int64
+	measuredAt time.Time
+}
+
+func (c *cachedSize) get() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.measuredAt.IsZero() && time.Since(c.measuredAt) < storageSizeTTL {
+		return c.bytes
+	}
+	total, err := storage.DirectorySize(c.dir)
+	if err != nil {
+		// Keep reporting the last measurement, and try again next scrape.
+		slog.Error("failed to measure audio storage", "error", err)
+		return c.bytes
+	}
+	c.bytes, c.measuredAt = total, time.Now()
+	return c.bytes
+}
+
+// registerStateMetrics exposes gauges that are computed from the database and
+// disk at scrape time.
+func registerStateMetrics(queries *database.Queries, audioDirectory string) {
+	storageSize := &cachedSize{dir: audioDirectory}
+	metrics.NewGaugeFunc(
+		"waffle_storage_bytes",
+		"Bytes used by stored audio files, measured at most every 5 minutes.",
+		nil,
+		func() []metrics.Sample {
+			return []metrics.Sample{{Value: float64(storageSize.get())}}
+		},
+	)
+
+	metrics.NewGaugeFunc(
+		"waffle_disk_free_bytes",
+		"Disk space available on the file system holding audio.",
+		nil,
+		func() []metrics.Sample {
+			free, err := storage.FreeBytes(audioDirectory)
+			if err != nil {
+				if !errors.Is(err, storage.ErrFreeSpaceUnknown) {
+					slog.Error("failed to measure free disk space", "error", err)
+				}
+				return nil
+			}
+			return []metrics.Sample{{Value: float64(free)}}
+		},
+	)
+
+	metrics.NewGaugeFunc(
+		"waffle_users",
+		"Registered users, by state: pending approval, or the status of approved users.",
+		[]string{"state"},
+		func() []metrics.Sample {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			users, err := queries.CountUsers(ctx)
+			if err != nil {
+				slog.Error("failed to count users", "error", err)
+				return nil
+			}
+
+			counts := map[string]float64{"pending": 0, "active": 0, "inactive": 0, "suspended": 0}
+			for _, count := range users {
+				if count.Approved {
+					counts[count.Status] += float64(count.UserCount)
+				} else {
+					counts["pending"] += float64(count.UserCount)
+				}
+			}
+			samples := make([]metrics.Sample, 0, len(counts))
+			for _, state := range []string{"active", "inactive", "suspended", "pending"} {
+				samples = append(samples, metrics.Sample{LabelValues: []string{state}, Value: counts[state]})
+			}
+			return samples
+		},
+	)
+
+	metrics.NewGaugeFunc(
+		"waffle_jobs",
+		"Stored jobs, by kind and state.",
+		[]string{"kind", "state"},
+		func() []metrics.Sample {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			counts, err := queries.CountJobs(ctx)
+			if err != nil {
+				slog.Error("failed to count jobs", "error", err)
+				return nil
+			}
+			samples := make([]metrics.Sample, len(counts))
+			for i, count := range counts {
+				samples[i] = metrics.Sample{LabelValues: []string{count.Kind, count.State}, Value: float64(count.JobCount)}
+			}
+			return samples
+		},
+	)
+}
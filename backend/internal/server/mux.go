@@ -1,42 +1,143 @@
 package server
 
 import (
+	"database/sql"
 	"encoding/json"
 	"log/slog"
 	"net/http"
+	"net/netip"
+	"strings"
 	"time"
 
+	"github.com/alecdray/waffle-talkie/internal/account"
 	"github.com/alecdray/waffle-talkie/internal/admin"
 	"github.com/alecdray/waffle-talkie/internal/audio"
+	"github.com/alecdray/waffle-talkie/internal/audit"
 	"github.com/alecdray/waffle-talkie/internal/auth"
+	"github.com/alecdray/waffle-talkie/internal/compilation"
 	"github.com/alecdray/waffle-talkie/internal/database"
+	"github.com/alecdray/waffle-talkie/internal/email"
+	"github.com/alecdray/waffle-talkie/internal/feed"
+	"github.com/alecdray/waffle-talkie/internal/logging"
+	"github.com/alecdray/waffle-talkie/internal/notify"
+	"github.com/alecdray/waffle-talkie/internal/openapi"
+	"github.com/alecdray/waffle-talkie/internal/ratelimit"
+	"github.com/alecdray/waffle-talkie/internal/search"
+	"github.com/alecdray/waffle-talkie/internal/storage"
 	"github.com/alecdray/waffle-talkie/internal/users"
+	"github.com/google/uuid"
 )
 
-func NewMux(queries *database.Queries, jwtSecret string, audioDirectory string) http.Handler {
+// Options configures the HTTP handler built by NewMux.
+type Options struct {
+	JWTSecret       string
+	AudioDirectory  string
+	AvatarDirectory string
+
+	// AuthRateLimit applies per client IP to the unauthenticated /auth routes.
+	AuthRateLimit ratelimit.Rate
+	// APIRateLimit applies per user to the authenticated /api and /admin routes.
+	APIRateLimit ratelimit.Rate
+	// EmailRateLimit applies per client IP to the /email link routes.
+	EmailRateLimit ratelimit.Rate
+	// FeedRateLimit applies per client IP to the /feed podcast routes.
+	FeedRateLimit ratelimit.Rate
+	// TrustedProxies are the proxies whose X-Forwarded-For header is honored.
+	TrustedProxies []netip.Prefix
+
+	// Registration controls invite requirements and the pending-user cap.
+	Registration auth.RegistrationPolicy
+	// NotificationChannels deliver alerts about new messages, and retractions
+	// of unsent ones through those that are notify.Retractors.
+	NotificationChannels []notify.Channel
+	// UnsendUndoWindow is how long an unsent message can be restored before
+	// its files are removed; zero removes them straight away.
+	UnsendUndoWindow time.Duration
+	// Pipeline processes uploads; see NewPipeline.
+	Pipeline *audio.Pipeline
+	// StorageQuotas limit the audio uploads may add.
+	StorageQuotas storage.Quotas
+
+	// EmailSender sends verification emails; nil disables adding addresses.
+	EmailSender email.Sender
+	// PublicURL is the address clients reach the server at, used in email
+	// links and podcast feeds.
+	PublicURL string
+}
+
+// NewMux builds the HTTP handler. db is used by handlers that need
+// transactions; everything else goes through queries.
+func NewMux(db *sql.DB, queries *database.Queries, opts Options) http.Handler {
 	rootMux := http.NewServeMux()
 
-	authHandler := auth.NewHandler(queries, jwtSecret)
-	audioHandler := audio.NewHandler(queries, audioDirectory)
-	usersHandler := users.NewHandler(queries)
-	adminHandler := admin.NewHandler(queries)
+	auditLog := audit.New(queries, func(r *http.Request) string {
+		return ratelimit.ClientIP(r, opts.TrustedProxies)
+	})
 
-	rootMux.HandleFunc("/health", handleHealth)
+	authHandler := auth.NewHandler(db, queries, opts.JWTSecret, opts.Registration, auditLog)
+	presence := users.NewPresence()
+	storageGuard := storage.NewGuard(queries, opts.AudioDirectory, opts.StorageQuotas)
+	audioHandler := audio.NewHandler(queries, opts.AudioDirectory, presence, opts.Pipeline, opts.UnsendUndoWindow, auditLog, storageGuard)
+	usersHandler := users.NewHandler(queries, opts.AvatarDirectory, presence, auth.GetUserIDFromContext)
+	adminHandler := admin.NewHandler(queries)
+	auditHandler := audit.NewHandler(queries)
+	accountHandler := account.NewHandler(db, queries, opts.JWTSecret, opts.AvatarDirectory, auditLog)
+	notifyHandler := notify.NewHandler(queries)
+	emailHandler := email.NewHandler(queries, opts.EmailSender, email.NewLinks(opts.JWTSecret, opts.PublicURL))
+	feedHandler := feed.NewHandler(queries, opts.PublicURL, auditLog)
+	searchHandler := search.NewHandler(queries)
+	compilationHandler := compilation.NewHandler(queries)
+	storageHandler := storage.NewHandler(queries, storageGuard)
+
+	authLimiter := ratelimit.NewLimiter(opts.AuthRateLimit)
+	apiLimiter := ratelimit.NewLimiter(opts.APIRateLimit)
+	emailLimiter := ratelimit.NewLimiter(opts.EmailRateLimit)
+	feedLimiter := ratelimit.NewLimiter(opts.FeedRateLimit)
+	byIP := ratelimit.ByIP(opts.TrustedProxies)
+	byUser := ratelimit.ByUser(opts.TrustedProxies)
+
+	registerStateMetrics(queries, opts.AudioDirectory)
+
+	rootMux.HandleFunc("GET /health", handleHealth)
+	rootMux.Handle("GET /openapi.json", openapi.Handler())
 
 	authMux := http.NewServeMux()
-	rootMux.Handle("/auth/", http.StripPrefix("/auth", authMux))
+	rootMux.Handle("/auth/", ratelimit.Middleware(http.StripPrefix("/auth", withRoute("/auth", authMux)), authLimiter, byIP))
 	authHandler.RegisterRoutes(authMux)
 
+	// Links in emails are opened without a bearer token, so they are limited per IP.
+	emailMux := http.NewServeMux()
+	rootMux.Handle("/email/", ratelimit.Middleware(http.StripPrefix("/email", withRoute("/email", emailMux)), emailLimiter, byIP))
+	emailHandler.RegisterLinkRoutes(emailMux)
+
+	// Podcast apps cannot send bearer tokens; feeds are authorized by the
+	// token in their URL and limited per IP.
+	feedMux := http.NewServeMux()
+	rootMux.Handle("/feed/", ratelimit.Middleware(http.StripPrefix("/feed", withRoute("/feed", feedMux)), feedLimiter, byIP))
+	feedHandler.RegisterFeedRoutes(feedMux)
+
 	authenticatedMux := http.NewServeMux()
-	rootMux.Handle("/api/", http.StripPrefix("/api", auth.IsAuthenticatedMiddleware(authenticatedMux, jwtSecret)))
+	rootMux.Handle("/api/", http.StripPrefix("/api", auth.IsAuthenticatedMiddleware(ratelimit.Middleware(withRoute("/api", authenticatedMux), apiLimiter, byUser), opts.JWTSecret, queries, auditLog)))
 	audioHandler.RegisterRoutes(authenticatedMux)
 	usersHandler.RegisterRoutes(authenticatedMux)
+	accountHandler.RegisterRoutes(authenticatedMux)
+	notifyHandler.RegisterRoutes(authenticatedMux)
+	emailHandler.RegisterRoutes(authenticatedMux)
+	feedHandler.RegisterRoutes(authenticatedMux)
+	searchHandler.RegisterRoutes(authenticatedMux)
+	compilationHandler.RegisterRoutes(authenticatedMux)
+	storageHandler.RegisterRoutes(authenticatedMux)
 
 	adminMux := http.NewServeMux()
-	rootMux.Handle("/admin/", http.StripPrefix("/admin", admin.IsAdminMiddleware(auth.IsAuthenticatedMiddleware(adminMux, jwtSecret), queries)))
+	rootMux.Handle("/admin/", http.StripPrefix("/admin", auth.IsAuthenticatedMiddleware(ratelimit.Middleware(admin.IsAdminMiddleware(withRoute("/admin", adminMux), queries), apiLimiter, byUser), opts.JWTSecret, queries, auditLog)))
 	adminHandler.RegisterRoutes(adminMux)
+	authHandler.RegisterAdminRoutes(adminMux)
+	auditHandler.RegisterAdminRoutes(adminMux)
+	accountHandler.RegisterAdminRoutes(adminMux)
+	audioHandler.RegisterAdminRoutes(adminMux)
+	storageHandler.RegisterAdminRoutes(adminMux)
 
-	return loggingMiddleware(rootMux)
+	return loggingMiddleware(metricsMiddleware(withRoute("", rootMux)))
 }
 
 func handleHealth(w http.ResponseWriter, r *http.Request) {
@@ -57,12 +158,41 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
-// loggingMiddleware logs basic request information
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+const requestIDHeader = "X-Request-ID"
+
+// requestID propagates a well-formed X-Request-ID from the client or proxy,
+// otherwise it generates a new one.
+func requestID(r *http.Request) string {
+	id := r.Header.Get(requestIDHeader)
+	if id == "" || len(id) > 128 {
+		return uuid.New().String()
+	}
+	for _, c := range id {
+		isAlnum := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+		if !isAlnum && !strings.ContainsRune("-_.:", c) {
+			return uuid.New().String()
+		}
+	}
+	return id
+}
+
+// loggingMiddleware assigns a request ID, carries it in the context for
+// request-scoped logging, and logs a single line when the request completes.
 func loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 
-		slog.Info("incoming request",
+		id := requestID(r)
+		w.Header().Set(requestIDHeader, id)
+		ctx := logging.NewContext(r.Context(), id)
+		r = r.WithContext(ctx)
+
+		slog.DebugContext(ctx, "incoming request",
 			"method", r.Method,
 			"path", r.URL.Path,
 			"remote_addr", r.RemoteAddr,
@@ -80,9 +210,10 @@ func loggingMiddleware(next http.Handler) http.Handler {
 			logLevel = slog.LevelWarn
 		}
 
-		slog.Log(r.Context(), logLevel, "request completed",
+		slog.Log(ctx, logLevel, "request completed",
 			"method", r.Method,
 			"path", r.URL.Path,
+			"remote_addr", r.RemoteAddr,
 			"status", rw.statusCode,
 			"status_text", http.StatusText(rw.statusCode),
 			"duration", time.Since(start),
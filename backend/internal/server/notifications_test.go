@@ -0,0 +1,215 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alecdray/waffle-talkie/internal/audio"
+	"github.com/alecdray/waffle-talkie/internal/database"
+	"github.com/alecdray/waffle-talkie/internal/notify"
+)
+
+// recordingChannel collects the alerts it is asked to send.
+type recordingChannel struct {
+	mu   sync.Mutex
+	sent []string
+}
+
+func (ch *recordingChannel) Name() string { return "recording" }
+
+func (ch *recordingChannel) Notify(ctx context.Context, recipient database.User, message database.AudioMessage) error {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	ch.sent = append(ch.sent, recipient.Name)
+	return nil
+}
+
+func (ch *recordingChannel) take() []string {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	sent := ch.sent
+	ch.sent = nil
+	slices.Sort(sent)
+	return sent
+}
+
+func TestNotifications(t *testing.T) {
+	c := newContract(t, Options{})
+	ctx := context.Background()
+
+	sender := c.registerApprovedUser("Sender", "sender-device", "user")
+	c.registerApprovedUser("Loud", "loud-device", "user")
+	sleepy := c.registerApprovedUser("Sleepy", "sleepy-device", "user")
+	muter := c.registerApprovedUser("Muter", "muter-device", "user")
+	quiet := c.registerApprovedUser("Quiet", "quiet-device", "user")
+
+	senderID := c.userID(sender)
+
+	// Quiet hours around the current time in Sleepy's timezone.
+	c.json("PATCH", "/api/v1/me", sleepy, map[string]string{"timezone": "Pacific/Auckland"}).expect(t, http.StatusOK)
+	local := time.Now().In(mustLoadLocation(t, "Pacific/Auckland"))
+	c.json("PUT", "/api/v1/me/notifications", sleepy, map[string]any{
+		"mode":        "all",
+		"quiet_hours": map[string]string{"start": local.Add(-time.Hour).Format("15:04"), "end": local.Add(time.Hour).Format("15:04")},
+	}).expect(t, http.StatusOK)
+	c.json("PUT", "/api/v1/me/notifications/mutes/"+senderID, muter, nil).expect(t, http.StatusNoContent)
+	c.json("PUT", "/api/v1/me/notifications", quiet, map[string]any{"mode": "none"}).expect(t, http.StatusOK)
+
+	create := func(id string) database.AudioMessage {
+		t.Helper()
+		message, err := c.queries.CreateAudioMessage(ctx, database.CreateAudioMessageParams{
+			ID:               id,
+			SenderUserID:     senderID,
+			FilePath:         filepath.Join(c.audioDirectory, id+".m4a"),
+			Duration:         1,
+			ProcessingStatus: audio.StatusReady,
+		})
+		if err != nil {
+			t.Fatalf("failed to create message: %v", err)
+		}
+		return message
+	}
+	// deliverDue ends every wait for quiet hours and delivers what is held back.
+	deliverDue := func(notifier *notify.Notifier) {
+		t.Helper()
+		if _, err := c.sqlDB.ExecContext(ctx, "UPDATE pending_notifications SET deliver_after = ? WHERE kind = 'deferred'", time.Now().UTC().Add(-time.Minute)); err != nil {
+			t.Fatalf("failed to backdate pending notifications: %v", err)
+		}
+		if err := notifier.DeliverDeferred(ctx); err != nil {
+			t.Fatalf("failed to deliver deferred notifications: %v", err)
+		}
+	}
+	message := create("message-1")
+
+	channel := &recordingChannel{}
+	notifier := notify.New(c.queries, channel)
+	notifier.MessageSent(ctx, message)
+	if sent := channel.take(); !slices.Equal(sent, []string{"Loud"}) {
+		t.Errorf("expected only Loud to be alerted, got %v", sent)
+	}
+
+	if err := notifier.DeliverDeferred(ctx); err != nil {
+		t.Fatalf("failed to deliver deferred notifications: %v", err)
+	}
+	if sent := channel.take(); len(sent) != 0 {
+		t.Errorf("expected Sleepy's alert to wait for quiet hours to end, got %v", sent)
+	}
+	deliverDue(notifier)
+	if sent := channel.take(); !slices.Equal(sent, []string{"Sleepy"}) {
+		t.Errorf("expected Sleepy's deferred alert once quiet hours ended, got %v", sent)
+	}
+
+	// Deferred alerts follow the settings in force when they are delivered.
+	sleepyID := c.userID(sleepy)
+	pendingKinds := func() []string {
+		t.Helper()
+		rows, err := c.sqlDB.QueryContext(ctx, "SELECT kind FROM pending_notifications WHERE user_id = ? ORDER BY id", sleepyID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		var kinds []string
+		for rows.Next() {
+			var kind string
+			if err := rows.Scan(&kind); err != nil {
+				t.Fatal(err)
+			}
+			kinds = append(kinds, kind)
+		}
+		return kinds
+	}
+
+	notifier.MessageSent(ctx, create("message-2"))
+	channel.take()
+	c.json("PUT", "/api/v1/me/notifications/mutes/"+senderID, sleepy, nil).expect(t, http.StatusNoContent)
+	deliverDue(notifier)
+	if sent := channel.take(); len(sent) != 0 {
+		t.Errorf("expected no alert about a sender muted while deferred, got %v", sent)
+	}
+	if kinds := pendingKinds(); len(kinds) != 0 {
+		t.Errorf("expected the skipped alert dropped, got %v", kinds)
+	}
+	c.json("DELETE", "/api/v1/me/notifications/mutes/"+senderID, sleepy, nil).expect(t, http.StatusNoContent)
+
+	notifier.MessageSent(ctx, create("message-3"))
+	channel.take()
+	c.json("PUT", "/api/v1/me/notifications", sleepy, map[string]any{"mode": "digest", "quiet_hours": nil}).expect(t, http.StatusOK)
+	deliverDue(notifier)
+	if sent := channel.take(); len(sent) != 0 {
+		t.Errorf("expected no alert after switching to digests, got %v", sent)
+	}
+	if kinds := pendingKinds(); !slices.Equal(kinds, []string{notify.KindDigest}) {
+		t.Errorf("expected the deferred alert moved to the digest, got %v", kinds)
+	}
+}
+
+func TestWebhookChannel(t *testing.T) {
+	type payload struct {
+		Event     string `json:"event"`
+		Recipient struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"recipient"`
+		Message struct {
+			ID           string `json:"id"`
+			SenderUserID string `json:"sender_user_id"`
+			Duration     int64  `json:"duration"`
+		} `json:"message"`
+	}
+	received := make(chan payload, 4)
+	var status atomic.Int32
+	status.Store(http.StatusNoContent)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p payload
+		if r.Method != "POST" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected webhook request %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			t.Errorf("failed to decode webhook payload: %v", err)
+		}
+		received <- p
+		w.WriteHeader(int(status.Load()))
+	}))
+	t.Cleanup(hook.Close)
+
+	webhook := &notify.Webhook{URL: hook.URL}
+	recipient := database.User{ID: "grandma", Name: "Grandma"}
+	message := database.AudioMessage{ID: "message-1", SenderUserID: "kid", Duration: 12}
+
+	if err := webhook.Notify(context.Background(), recipient, message); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+	if p := <-received; p.Event != notify.EventMessageSent || p.Recipient.ID != "grandma" || p.Recipient.Name != "Grandma" ||
+		p.Message.ID != "message-1" || p.Message.SenderUserID != "kid" || p.Message.Duration != 12 {
+		t.Errorf("unexpected alert %+v", p)
+	}
+	if err := webhook.Retract(context.Background(), recipient, message); err != nil {
+		t.Fatalf("failed to retract: %v", err)
+	}
+	if p := <-received; p.Event != notify.EventMessageRetracted || p.Message.ID != "message-1" {
+		t.Errorf("unexpected retraction %+v", p)
+	}
+
+	status.Store(http.StatusBadGateway)
+	if err := webhook.Notify(context.Background(), recipient, message); err == nil {
+		t.Error("expected an error when the webhook fails")
+	}
+	<-received
+}
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("failed to load %s: %v", name, err)
+	}
+	return loc
+}
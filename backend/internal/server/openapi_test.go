@@ -0,0 +1,407 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// This file holds a deliberately small OpenAPI 3 validator: just enough of the
+// spec (refs, types, required, enums, closed objects, date-time) to check that
+// every request and response in the contract tests matches the document.
+
+type openAPIDoc struct {
+	Paths      map[string]map[string]*apiOperation `json:"paths"`
+	Components struct {
+		Schemas   map[string]*apiSchema   `json:"schemas"`
+		Responses map[string]*apiResponse `json:"responses"`
+	} `json:"components"`
+}
+
+type apiOperation struct {
+	OperationID string         `json:"operationId"`
+	Parameters  []apiParameter `json:"parameters"`
+	RequestBody *struct {
+		Required bool                    `json:"required"`
+		Content  map[string]apiMediaType `json:"content"`
+	} `json:"requestBody"`
+	Responses map[string]*apiResponse `json:"responses"`
+}
+
+type apiParameter struct {
+	Name     string     `json:"name"`
+	In       string     `json:"in"`
+	Required bool       `json:"required"`
+	Schema   *apiSchema `json:"schema"`
+}
+
+type apiResponse struct {
+	Ref     string                  `json:"$ref"`
+	Content map[string]apiMediaType `json:"content"`
+}
+
+type apiMediaType struct {
+	Schema *apiSchema `json:"schema"`
+}
+
+type apiSchema struct {
+	Ref                  string                `json:"$ref"`
+	Type                 string                `json:"type"`
+	Format               string                `json:"format"`
+	Nullable             bool                  `json:"nullable"`
+	Enum                 []any                 `json:"enum"`
+	Required             []string              `json:"required"`
+	Properties           map[string]*apiSchema `json:"properties"`
+	AdditionalProperties *bool                 `json:"additionalProperties"`
+	Items                *apiSchema            `json:"items"`
+	AllOf                []*apiSchema          `json:"allOf"`
+	MaxLength            *int                  `json:"maxLength"`
+}
+
+// exchange is a request to send and the response that came back.
+type exchange struct {
+	method      string
+	path        string
+	token       string
+	contentType string
+	body        []byte
+	header      http.Header
+	// invalid marks exchanges that deliberately send requests the spec does
+	// not allow, so only the response is validated.
+	invalid bool
+
+	resp     *http.Response
+	respBody []byte
+}
+
+func (c *contract) json(method, path, token string, body any) *exchange {
+	c.t.Helper()
+	var raw []byte
+	if body != nil {
+		var err error
+		if raw, err = json.Marshal(body); err != nil {
+			c.t.Fatalf("failed to marshal body: %v", err)
+		}
+	}
+	return c.do(&exchange{method: method, path: path, token: token, contentType: "application/json", body: raw})
+}
+
+func (c *contract) do(ex *exchange) *exchange {
+	c.t.Helper()
+
+	template, op := c.findOperation(ex.method, ex.path)
+	if op == nil && !ex.invalid {
+		c.t.Fatalf("%s %s is not documented in openapi.json", ex.method, ex.path)
+	}
+	if op != nil {
+		c.covered[strings.ToUpper(ex.method)+" "+template] = true
+		c.validateRequest(ex, op)
+	}
+
+	req, err := http.NewRequest(ex.method, c.server.URL+ex.path, bytes.NewReader(ex.body))
+	if err != nil {
+		c.t.Fatalf("failed to build request: %v", err)
+	}
+	for k, v := range ex.header {
+		req.Header[k] = v
+	}
+	if ex.body != nil && ex.contentType != "" {
+		req.Header.Set("Content-Type", ex.contentType)
+	}
+	if ex.token != "" {
+		req.Header.Set("Authorization", "Bearer "+ex.token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.t.Fatalf("%s %s failed: %v", ex.method, ex.path, err)
+	}
+	defer resp.Body.Close()
+	ex.resp = resp
+	ex.respBody, err = io.ReadAll(resp.Body)
+	if err != nil {
+		c.t.Fatalf("failed to read response body: %v", err)
+	}
+
+	if op != nil {
+		c.validateResponse(ex, op)
+	} else {
+		c.validateErrorResponse(ex)
+	}
+	return ex
+}
+
+// validateErrorResponse checks responses to undocumented routes or methods
+// still use the shared error envelope.
+func (c *contract) validateErrorResponse(ex *exchange) {
+	c.t.Helper()
+	var body any
+	if err := json.Unmarshal(ex.respBody, &body); err != nil {
+		c.t.Errorf("%s %s: error response is not JSON: %q", ex.method, ex.path, ex.respBody)
+		return
+	}
+	for _, err := range c.validate(&apiSchema{Ref: "#/components/schemas/ErrorResponse"}, body, "response") {
+		c.t.Errorf("%s %s: %v", ex.method, ex.path, err)
+	}
+}
+
+// expect fails the test unless the exchange returned the given status.
+func (ex *exchange) expect(t *testing.T, status int) *exchange {
+	t.Helper()
+	if ex.resp.StatusCode != status {
+		t.Fatalf("%s %s: expected status %d, got %d: %s", ex.method, ex.path, status, ex.resp.StatusCode, ex.respBody)
+	}
+	return ex
+}
+
+// decode unmarshals the JSON response body into v.
+func (ex *exchange) decode(t *testing.T, v any) {
+	t.Helper()
+	if err := json.Unmarshal(ex.respBody, v); err != nil {
+		t.Fatalf("%s %s: failed to decode response: %v", ex.method, ex.path, err)
+	}
+}
+
+// findOperation matches a concrete path against the spec's path templates,
+// preferring the template with the most literal segments.
+func (c *contract) findOperation(method, rawPath string) (string, *apiOperation) {
+	path, _, _ := strings.Cut(rawPath, "?")
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+
+	bestTemplate, bestScore := "", -1
+	for template := range c.doc.Paths {
+		templateSegments := strings.Split(strings.Trim(template, "/"), "/")
+		if len(templateSegments) != len(segments) {
+			continue
+		}
+		score := 0
+		matched := true
+		for i, seg := range templateSegments {
+			if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+				if segments[i] == "" {
+					matched = false
+					break
+				}
+				continue
+			}
+			if seg != segments[i] {
+				matched = false
+				break
+			}
+			score++
+		}
+		if matched && score > bestScore {
+			bestTemplate, bestScore = template, score
+		}
+	}
+	if bestScore < 0 {
+		return "", nil
+	}
+	return bestTemplate, c.doc.Paths[bestTemplate][strings.ToLower(method)]
+}
+
+func (c *contract) validateRequest(ex *exchange, op *apiOperation) {
+	c.t.Helper()
+
+	query := httptest.NewRequest(ex.method, ex.path, nil).URL.Query()
+	for _, param := range op.Parameters {
+		if param.In == "query" && param.Required && query.Get(param.Name) == "" && !ex.invalid {
+			c.t.Errorf("%s %s: missing required query parameter %q", ex.method, ex.path, param.Name)
+		}
+	}
+
+	if op.RequestBody == nil || ex.body == nil || ex.invalid {
+		return
+	}
+	mediaType, _, _ := mime.ParseMediaType(ex.contentType)
+	content, ok := op.RequestBody.Content[mediaType]
+	if !ok {
+		c.t.Errorf("%s %s: request content type %q is not documented", ex.method, ex.path, mediaType)
+		return
+	}
+	if mediaType != "application/json" {
+		return
+	}
+
+	var body any
+	if err := json.Unmarshal(ex.body, &body); err != nil {
+		c.t.Errorf("%s %s: request body is not JSON: %v", ex.method, ex.path, err)
+		return
+	}
+	for _, err := range c.validate(content.Schema, body, "request") {
+		c.t.Errorf("%s %s: %v", ex.method, ex.path, err)
+	}
+}
+
+func (c *contract) validateResponse(ex *exchange, op *apiOperation) {
+	c.t.Helper()
+
+	status := strconv.Itoa(ex.resp.StatusCode)
+	resp, ok := op.Responses[status]
+	if !ok {
+		resp, ok = op.Responses["default"]
+	}
+	if !ok {
+		c.t.Errorf("%s %s: status %s is not documented: %s", ex.method, ex.path, status, ex.respBody)
+		return
+	}
+	if resp.Ref != "" {
+		resp = c.doc.Components.Responses[strings.TrimPrefix(resp.Ref, "#/components/responses/")]
+	}
+
+	if len(resp.Content) == 0 {
+		if len(ex.respBody) > 0 {
+			c.t.Errorf("%s %s: status %s documents no body but got %q", ex.method, ex.path, status, ex.respBody)
+		}
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(ex.resp.Header.Get("Content-Type"))
+	var content *apiMediaType
+	for documented, mt := range resp.Content {
+		if documented == mediaType || (strings.HasSuffix(documented, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(documented, "*"))) {
+			content = &mt
+			break
+		}
+	}
+	if content == nil {
+		c.t.Errorf("%s %s: response content type %q is not documented for status %s", ex.method, ex.path, mediaType, status)
+		return
+	}
+	if mediaType != "application/json" {
+		return
+	}
+
+	var body any
+	if err := json.Unmarshal(ex.respBody, &body); err != nil {
+		c.t.Errorf("%s %s: response body is not JSON: %v", ex.method, ex.path, err)
+		return
+	}
+	for _, err := range c.validate(content.Schema, body, "response") {
+		c.t.Errorf("%s %s (%s): %v", ex.method, ex.path, status, err)
+	}
+}
+
+func (c *contract) validate(s *apiSchema, value any, path string) []error {
+	if s == nil {
+		return nil
+	}
+	if s.Ref != "" {
+		return c.validate(c.doc.Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")], value, path)
+	}
+	if value == nil {
+		if s.Nullable {
+			return nil
+		}
+		return []error{fmt.Errorf("%s: unexpected null", path)}
+	}
+
+	var errs []error
+	for _, sub := range s.AllOf {
+		errs = append(errs, c.validate(sub, value, path)...)
+	}
+
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if e == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return append(errs, fmt.Errorf("%s: %v is not one of %v", path, value, s.Enum))
+		}
+	}
+
+	switch s.Type {
+	case "object":
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return []error{fmt.Errorf("%s: expected object, got %T", path, value)}
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				errs = append(errs, fmt.Errorf("%s: missing required property %q", path, name))
+			}
+		}
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			prop, ok := s.Properties[k]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					errs = append(errs, fmt.Errorf("%s: undocumented property %q", path, k))
+				}
+				continue
+			}
+			errs = append(errs, c.validate(prop, obj[k], path+"."+k)...)
+		}
+	case "array":
+		arr, ok := value.([]any)
+		if !ok {
+			return []error{fmt.Errorf("%s: expected array, got %T", path, value)}
+		}
+		for i, item := range arr {
+			errs = append(errs, c.validate(s.Items, item, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return []error{fmt.Errorf("%s: expected string, got %T", path, value)}
+		}
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, str); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is not a date-time", path, str))
+			}
+		}
+		if s.MaxLength != nil && len([]rune(str)) > *s.MaxLength {
+			errs = append(errs, fmt.Errorf("%s: longer than %d characters", path, *s.MaxLength))
+		}
+	case "integer":
+		num, ok := value.(float64)
+		if !ok || num != float64(int64(num)) {
+			return []error{fmt.Errorf("%s: expected integer, got %v", path, value)}
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			return []error{fmt.Errorf("%s: expected number, got %T", path, value)}
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return []error{fmt.Errorf("%s: expected boolean, got %T", path, value)}
+		}
+	}
+	return errs
+}
+
+// assertCoverage fails if any documented operation was never exercised, so new
+// routes cannot be added to the spec without a contract test and vice versa.
+func (c *contract) assertCoverage() {
+	c.t.Helper()
+	var missing []string
+	for template, ops := range c.doc.Paths {
+		for method := range ops {
+			key := strings.ToUpper(method) + " " + template
+			if !c.covered[key] {
+				missing = append(missing, key)
+			}
+		}
+	}
+	sort.Strings(missing)
+	for _, key := range missing {
+		c.t.Errorf("operation %s is documented but not exercised by the contract tests", key)
+	}
+}
@@ -0,0 +1,254 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alecdray/waffle-talkie/internal/apierror"
+	"github.com/alecdray/waffle-talkie/internal/audio"
+	"github.com/alecdray/waffle-talkie/internal/jobs"
+)
+
+func TestWaveforms(t *testing.T) {
+	c := newContract(t, Options{})
+	c.startJobWorkers()
+	sender := c.registerApprovedUser("Sender", "sender-device", "user")
+	listener := c.registerApprovedUser("Listener", "listener-device", "user")
+
+	ramp := func(frame int) float64 { return float64(frame) / 8000 }
+	uploads := map[string][]byte{
+		"undecodable.m4a": []byte("not really audio"),
+		"mono.wav":        testWAV(1, 16, 8000, ramp),
+		"stereo.wav":      testWAV(2, 24, 8000, ramp),
+	}
+	ids := make(map[string]string)
+	for name, data := range uploads {
+		ids[c.send(sender, name, data, "1")] = name
+	}
+	c.waitForJobs()
+
+	var list struct {
+		Messages []struct {
+			ID    string `json:"id"`
+			Peaks []int  `json:"peaks"`
+		} `json:"messages"`
+	}
+	c.json("GET", "/api/v1/audio-messages", listener, nil).expect(t, http.StatusOK).decode(t, &list)
+	peaks := make(map[string][]int)
+	for _, message := range list.Messages {
+		peaks[ids[message.ID]] = message.Peaks
+	}
+
+	if peaks["undecodable.m4a"] != nil {
+		t.Errorf("expected no waveform for undecodable audio, got %v", peaks["undecodable.m4a"])
+	}
+	for _, name := range []string{"mono.wav", "stereo.wav"} {
+		p := peaks[name]
+		if len(p) != audio.PeakCount {
+			t.Fatalf("%s: expected %d peaks, got %d", name, audio.PeakCount, len(p))
+		}
+		if p[audio.PeakCount-1] != 255 || p[0] > 5 || !(p[10] < p[50] && p[50] < p[90]) {
+			t.Errorf("%s: expected a rising ramp peaking at 255, got %v", name, p)
+		}
+	}
+
+	// Without a transcoder the waveform is drawn before a message is shown,
+	// and undecodable audio is shown without one rather than held back.
+	counts, err := c.queries.CountJobs(context.Background())
+	if err != nil {
+		t.Fatalf("failed to count jobs: %v", err)
+	}
+	if len(counts) != 1 || counts[0].Kind != audio.JobProcess || counts[0].State != jobs.StateSucceeded || counts[0].JobCount != 3 {
+		t.Errorf("expected 3 processing jobs to succeed, got %+v", counts)
+	}
+}
+
+// reversingTranscoder stands in for ffmpeg, writing the original bytes reversed
+// as Ogg.
+type reversingTranscoder struct{}
+
+func (reversingTranscoder) Transcode(ctx context.Context, src, base string) (audio.Rendition, error) {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return audio.Rendition{}, err
+	}
+	slices.Reverse(data)
+	dst := base + ".ogg"
+	if err := os.WriteFile(dst, data, 0644); err != nil {
+		return audio.Rendition{}, err
+	}
+	return audio.Rendition{Path: dst, ContentType: "audio/ogg"}, nil
+}
+
+func TestTranscoding(t *testing.T) {
+	c := newPipelineContract(t, Options{}, PipelineOptions{Transcoder: reversingTranscoder{}})
+	sender := c.registerApprovedUser("Sender", "sender-device", "user")
+	listener := c.registerApprovedUser("Listener", "listener-device", "user")
+
+	var upload struct {
+		MessageID string `json:"message_id"`
+	}
+	c.upload("/api/v1/audio-messages", sender, "voice.m4a", []byte("original"), "1").expect(t, http.StatusCreated).decode(t, &upload)
+	messageID := upload.MessageID
+	path := "/api/v1/audio-messages/" + messageID
+	download := func(token, query, accept string) *exchange {
+		t.Helper()
+		header := http.Header{}
+		if accept != "" {
+			header.Set("Accept", accept)
+		}
+		return c.do(&exchange{method: "GET", path: path + query, token: token, header: header})
+	}
+	listed := func(token string) bool {
+		t.Helper()
+		var list struct {
+			Messages []struct {
+				ID string `json:"id"`
+			} `json:"messages"`
+		}
+		c.json("GET", "/api/v1/audio-messages", token, nil).expect(t, http.StatusOK).decode(t, &list)
+		for _, message := range list.Messages {
+			if message.ID == messageID {
+				return true
+			}
+		}
+		return false
+	}
+	expectAudio := func(e *exchange, contentType, body string) {
+		t.Helper()
+		e.expect(t, http.StatusOK)
+		if got := e.resp.Header.Get("Content-Type"); got != contentType || string(e.respBody) != body {
+			t.Errorf("expected %s %q, got %s %q", contentType, body, got, e.respBody)
+		}
+		if !slices.Contains(e.resp.Header.Values("Vary"), "Accept") {
+			t.Errorf("expected Vary: Accept, got %v", e.resp.Header.Values("Vary"))
+		}
+	}
+
+	// Transcoding is required, so recipients cannot list or fetch the raw
+	// upload until it is done; the sender plays back what they recorded.
+	if listed(listener) {
+		t.Error("expected recipients not to see the message before it is transcoded")
+	}
+	expectCode(t, download(listener, "", "").expect(t, http.StatusNotFound), apierror.CodeMessageNotFound)
+	expectCode(t, download(listener, "?format=original", "").expect(t, http.StatusNotFound), apierror.CodeMessageNotFound)
+	if !listed(sender) {
+		t.Error("expected the sender to see their message while it is transcoded")
+	}
+	expectAudio(download(sender, "", ""), "audio/mp4", "original")
+
+	c.startJobWorkers()
+	c.waitForMessage(t, messageID)
+	if !listed(listener) {
+		t.Error("expected recipients to see the message once it is transcoded")
+	}
+
+	expectAudio(download(listener, "", ""), "audio/ogg", "lanigiro")
+	expectAudio(download(listener, "?format=original", "audio/ogg"), "audio/mp4", "original")
+	expectAudio(download(listener, "?format=playback", ""), "audio/ogg", "lanigiro")
+	expectAudio(download(listener, "", "audio/*"), "audio/ogg", "lanigiro")
+	expectAudio(download(listener, "", "audio/mp4"), "audio/mp4", "original")
+	expectAudio(download(listener, "", "audio/ogg;q=0.5, audio/mp4;q=0.8"), "audio/mp4", "original")
+	expectAudio(download(listener, "", "audio/*;q=0.1, audio/ogg"), "audio/ogg", "lanigiro")
+	expectCode(t, download(listener, "", "audio/webm, audio/*;q=0").expect(t, http.StatusNotAcceptable), apierror.CodeNotAcceptable)
+	download(listener, "?format=flac", "").expect(t, http.StatusBadRequest)
+
+	// Both renditions count toward the sender's storage.
+	var usage struct {
+		Usage struct {
+			Bytes int64 `json:"bytes"`
+		} `json:"usage"`
+	}
+	c.json("GET", "/api/v1/me/usage", sender, nil).expect(t, http.StatusOK).decode(t, &usage)
+	if want := int64(len("original") + len("lanigiro")); usage.Usage.Bytes != want {
+		t.Errorf("expected %d bytes stored, got %d", want, usage.Usage.Bytes)
+	}
+
+	// Deleting the account removes both renditions.
+	files, err := filepath.Glob(filepath.Join(c.audioDirectory, messageID+".*"))
+	if err != nil || len(files) != 2 {
+		t.Fatalf("expected the original and playback files, got %v (%v)", files, err)
+	}
+	var confirmation struct {
+		ConfirmationToken string `json:"confirmation_token"`
+	}
+	c.json("POST", "/api/v1/me/deletion-token", sender, nil).expect(t, http.StatusOK).decode(t, &confirmation)
+	c.json("DELETE", "/api/v1/me", sender, map[string]string{"confirmation_token": confirmation.ConfirmationToken}).
+		expect(t, http.StatusNoContent)
+	if files, _ := filepath.Glob(filepath.Join(c.audioDirectory, messageID+".*")); len(files) != 0 {
+		t.Errorf("expected the audio files to be removed, got %v", files)
+	}
+}
+
+func TestEnhancement(t *testing.T) {
+	// A full-scale 997 Hz sine reads -3.01 LUFS on a BS.1770 meter.
+	sine := audio.PCM{SampleRate: 48000, Channels: 1, Samples: make([]float32, 48000*3)}
+	for i := range sine.Samples {
+		sine.Samples[i] = float32(math.Sin(2 * math.Pi * 997 * float64(i) / 48000))
+	}
+	if got := audio.IntegratedLoudness(sine); math.Abs(got+3.01) > 0.05 {
+		t.Errorf("expected a full-scale sine to read -3.01 LUFS, got %.2f", got)
+	}
+
+	c := newPipelineContract(t, Options{}, PipelineOptions{
+		Transcoder:   audio.PassthroughTranscoder{},
+		AudioFilters: []audio.Filter{audio.TrimSilence(), audio.Normalize(-16)},
+	})
+	c.startJobWorkers()
+	sender := c.registerApprovedUser("Sender", "sender-device", "user")
+	listener := c.registerApprovedUser("Listener", "listener-device", "user")
+
+	// A second of silence either side of two seconds of quiet tone.
+	original := testWAV(1, 16, 4*8000, func(frame int) float64 {
+		if frame < 8000 || frame >= 3*8000 {
+			return 0
+		}
+		return 0.05
+	})
+	messageID := c.send(sender, "voice.wav", original, "4")
+	c.waitForJobs()
+
+	var list struct {
+		Messages []struct {
+			Duration int   `json:"duration"`
+			Peaks    []int `json:"peaks"`
+		} `json:"messages"`
+	}
+	c.json("GET", "/api/v1/audio-messages", listener, nil).expect(t, http.StatusOK).decode(t, &list)
+	if len(list.Messages) != 1 || list.Messages[0].Duration != 2 || len(list.Messages[0].Peaks) != audio.PeakCount {
+		t.Fatalf("expected the trimmed duration and a waveform, got %+v", list.Messages)
+	}
+	// Only the padding around the tone is left silent.
+	if p := list.Messages[0].Peaks; p[audio.PeakCount/2] != 255 || slices.Index(p, 255) > audio.PeakCount/10 {
+		t.Errorf("expected the leading silence trimmed, got %v", p)
+	}
+
+	path := "/api/v1/audio-messages/" + messageID
+	playback := c.do(&exchange{method: "GET", path: path, token: listener}).expect(t, http.StatusOK)
+	file := filepath.Join(t.TempDir(), "playback.wav")
+	if err := os.WriteFile(file, playback.respBody, 0o600); err != nil {
+		t.Fatalf("failed to write playback: %v", err)
+	}
+	pcm, err := audio.WAVDecoder{}.Decode(context.Background(), file)
+	if err != nil {
+		t.Fatalf("failed to decode playback: %v", err)
+	}
+	if d := pcm.Duration(); d < 2*time.Second || d > 2500*time.Millisecond {
+		t.Errorf("expected the silence trimmed to a little padding, got %v", d)
+	}
+	if got := audio.IntegratedLoudness(pcm); math.Abs(got+16) > 0.5 {
+		t.Errorf("expected playback normalized to -16 LUFS, got %.2f", got)
+	}
+
+	// The upload is kept as recorded.
+	if got := c.do(&exchange{method: "GET", path: path + "?format=original", token: listener}).expect(t, http.StatusOK).respBody; !bytes.Equal(got, original) {
+		t.Errorf("expected the original to be unchanged")
+	}
+}
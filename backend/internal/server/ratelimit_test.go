@@ -0,0 +1,39 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/alecdray/waffle-talkie/internal/ratelimit"
+)
+
+func TestRateLimit(t *testing.T) {
+	c := newContract(t, Options{
+		AuthRateLimit: ratelimit.Rate{PerMinute: 1, Burst: 2},
+	})
+
+	for range 2 {
+		c.json("POST", "/auth/v1/login", "", map[string]string{"device_id": "unknown-device"}).
+			expect(t, http.StatusUnauthorized)
+	}
+	limited := c.json("POST", "/auth/v1/login", "", map[string]string{"device_id": "unknown-device"}).
+		expect(t, http.StatusTooManyRequests)
+	if retryAfter := limited.resp.Header.Get("Retry-After"); retryAfter == "" || retryAfter == "0" {
+		t.Errorf("expected a positive Retry-After header, got %q", retryAfter)
+	}
+
+	t.Run("route groups", func(t *testing.T) {
+		c := newContract(t, Options{
+			EmailRateLimit: ratelimit.Rate{PerMinute: 1, Burst: 1},
+			FeedRateLimit:  ratelimit.Rate{PerMinute: 1, Burst: 2},
+		})
+
+		// Email links and feeds draw on separate buckets.
+		c.do(&exchange{method: "GET", path: "/email/v1/verify?token=bad", invalid: true}).expect(t, http.StatusForbidden)
+		for range 2 {
+			c.do(&exchange{method: "GET", path: "/feed/v1/bad-token", invalid: true}).expect(t, http.StatusNotFound)
+		}
+		c.do(&exchange{method: "GET", path: "/feed/v1/bad-token", invalid: true}).expect(t, http.StatusTooManyRequests)
+		c.do(&exchange{method: "GET", path: "/email/v1/verify?token=bad", invalid: true}).expect(t, http.StatusTooManyRequests)
+	})
+}
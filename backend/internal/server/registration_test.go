@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alecdray/waffle-talkie/internal/apierror"
+	"github.com/alecdray/waffle-talkie/internal/audit"
+	"github.com/alecdray/waffle-talkie/internal/auth"
+	"github.com/alecdray/waffle-talkie/internal/database"
+)
+
+func TestRegistrationPolicy(t *testing.T) {
+	c := newContract(t, Options{
+		Registration: auth.RegistrationPolicy{RequireInvite: true, MaxPendingUsers: 1},
+	})
+	ctx := context.Background()
+
+	expectCode(t, c.json("POST", "/auth/v1/register", "", map[string]string{"name": "A", "device_id": "device-a"}).
+		expect(t, http.StatusForbidden), apierror.CodeInviteRequired)
+	expectCode(t, c.json("POST", "/auth/v1/register", "", map[string]string{"name": "A", "device_id": "device-a", "invite_code": "nope"}).
+		expect(t, http.StatusForbidden), apierror.CodeInviteInvalid)
+
+	invite, err := c.queries.CreateInviteCode(ctx, database.CreateInviteCodeParams{
+		ID:              "family-invite",
+		Code:            "FAMILY",
+		MaxUses:         3,
+		CreatedByUserID: "admin",
+	})
+	if err != nil {
+		t.Fatalf("failed to create invite: %v", err)
+	}
+
+	c.json("POST", "/auth/v1/register", "", map[string]string{"name": "A", "device_id": "device-a", "invite_code": invite.Code}).
+		expect(t, http.StatusCreated)
+
+	// The code is a credential, so the audit log refers to the invite by ID.
+	var detail string
+	if err := c.sqlDB.QueryRow("SELECT detail FROM audit_events WHERE action = ?", audit.ActionUserRegistered).Scan(&detail); err != nil {
+		t.Fatalf("failed to read audit event: %v", err)
+	}
+	if !strings.Contains(detail, `"invite_id":"family-invite"`) || strings.Contains(detail, invite.Code) {
+		t.Errorf("expected the invite ID and not its code audited, got %s", detail)
+	}
+	expectCode(t, c.json("POST", "/auth/v1/register", "", map[string]string{"name": "B", "device_id": "device-b", "invite_code": invite.Code}).
+		expect(t, http.StatusServiceUnavailable), apierror.CodePendingLimitReached)
+
+	if invite, err = c.queries.GetInviteCode(ctx, invite.Code); err != nil || invite.Uses != 1 {
+		t.Fatalf("expected a rejected registration not to use the invite, got %d uses (%v)", invite.Uses, err)
+	}
+
+	if err := auth.NewTaskManager(c.queries, time.Nanosecond, audit.New(c.queries, nil)).ExpirePendingUsers(ctx); err != nil {
+		t.Fatalf("failed to expire pending users: %v", err)
+	}
+	c.json("POST", "/auth/v1/register", "", map[string]string{"name": "B", "device_id": "device-b", "invite_code": invite.Code}).
+		expect(t, http.StatusCreated)
+}
+
+func TestRegistrationPendingCapConcurrent(t *testing.T) {
+	const maxPending = 3
+	c := newContract(t, Options{
+		Registration: auth.RegistrationPolicy{MaxPendingUsers: maxPending},
+	})
+
+	// Requests go straight to the server; the contract's bookkeeping is not
+	// safe for concurrent use.
+	var wg sync.WaitGroup
+	statuses := make(chan int, 12)
+	for i := range cap(statuses) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body := fmt.Sprintf(`{"name":"User %d","device_id":"device-%d"}`, i, i)
+			resp, err := http.Post(c.server.URL+"/auth/v1/register", "application/json", strings.NewReader(body))
+			if err != nil {
+				t.Errorf("register failed: %v", err)
+				return
+			}
+			resp.Body.Close()
+			statuses <- resp.StatusCode
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	created := 0
+	for status := range statuses {
+		switch status {
+		case http.StatusCreated:
+			created++
+		case http.StatusServiceUnavailable:
+		default:
+			t.Errorf("unexpected status %d", status)
+		}
+	}
+	if created != maxPending {
+		t.Errorf("expected %d registrations accepted, got %d", maxPending, created)
+	}
+	pending, err := c.queries.CountPendingUsers(context.Background())
+	if err != nil {
+		t.Fatalf("failed to count pending users: %v", err)
+	}
+	if pending != maxPending {
+		t.Errorf("expected the cap of %d pending users held, got %d", maxPending, pending)
+	}
+}
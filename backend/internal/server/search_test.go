@@ -0,0 +1,148 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alecdray/waffle-talkie/internal/apierror"
+	"github.com/alecdray/waffle-talkie/internal/audio"
+)
+
+// scriptedTranscriber stands in for whisper, transcribing audio lasting n
+// seconds as script[n], one phrase per second.
+type scriptedTranscriber map[int][]string
+
+func (t scriptedTranscriber) Transcribe(ctx context.Context, pcm audio.PCM) ([]audio.Segment, error) {
+	var segments []audio.Segment
+	for i, text := range t[int(pcm.Duration()/time.Second)] {
+		segments = append(segments, audio.Segment{
+			Start: time.Duration(i) * time.Second,
+			End:   time.Duration(i+1) * time.Second,
+			Text:  text,
+		})
+	}
+	return segments, nil
+}
+
+func TestSearch(t *testing.T) {
+	c := newPipelineContract(t, Options{}, PipelineOptions{
+		Transcriber: scriptedTranscriber{
+			3: {"Mix the pancake", "recipe ingredients", "until smooth."},
+			2: {"Call me back", "later"},
+			1: {"Pancakes tomorrow?"},
+		},
+	})
+	mom := c.registerApprovedUser("Mom", "mom-device", "user")
+	dad := c.registerApprovedUser("Dad", "dad-device", "user")
+	kid := c.registerApprovedUser("Kid", "kid-device", "user")
+
+	c.startJobWorkers()
+	tone := func(frame int) float64 { return 0.5 }
+	recipe := c.send(mom, "recipe.wav", testWAV(1, 16, 3*8000, tone), "3")
+	callBack := c.send(mom, "call.wav", testWAV(1, 16, 2*8000, tone), "2")
+	tomorrow := c.send(dad, "tomorrow.wav", testWAV(1, 16, 8000, tone), "1")
+	c.waitForJobs()
+
+	type result struct {
+		MessageID string `json:"message_id"`
+		Field     string `json:"field"`
+		Snippet   []struct {
+			Text  string `json:"text"`
+			Match bool   `json:"match"`
+		} `json:"snippet"`
+		Matches []struct {
+			StartMs int64 `json:"start_ms"`
+			EndMs   int64 `json:"end_ms"`
+		} `json:"matches"`
+	}
+	search := func(token, query string) []result {
+		t.Helper()
+		var resp struct {
+			Results []result `json:"results"`
+		}
+		c.json("GET", "/api/v1/search?q="+url.QueryEscape(query), token, nil).expect(t, http.StatusOK).decode(t, &resp)
+		return resp.Results
+	}
+	ids := func(results []result) []string {
+		var ids []string
+		for _, r := range results {
+			ids = append(ids, r.MessageID)
+		}
+		slices.Sort(ids)
+		return ids
+	}
+	expectIDs := func(results []result, want ...string) {
+		t.Helper()
+		slices.Sort(want)
+		if got := ids(results); !slices.Equal(got, want) {
+			t.Errorf("expected messages %v, got %v", want, got)
+		}
+	}
+
+	// Every word must match, across the transcript's segments, and the
+	// matching segments give offsets into the audio.
+	got := search(kid, "Pancake RECIPE")
+	expectIDs(got, recipe)
+	if len(got) == 1 {
+		var highlighted []string
+		for _, part := range got[0].Snippet {
+			if part.Match {
+				highlighted = append(highlighted, part.Text)
+			}
+		}
+		if got[0].Field != "transcript" || !slices.Equal(highlighted, []string{"pancake", "recipe"}) {
+			t.Errorf("expected a transcript snippet highlighting both words, got %+v", got[0])
+		}
+		if len(got[0].Matches) != 2 || got[0].Matches[0].StartMs != 0 || got[0].Matches[1].EndMs != 2000 {
+			t.Errorf("expected the first two seconds matched, got %+v", got[0].Matches)
+		}
+	}
+
+	// Words match as prefixes, names and dates are searchable too, and a
+	// match on the sender's name outranks one in a transcript.
+	expectIDs(search(kid, "pancake"), recipe, tomorrow)
+	if got := search(kid, "mom"); len(got) != 2 || got[0].Field != "sender_name" {
+		t.Errorf("expected Mom's messages found by name, got %+v", got)
+	}
+	if got := search(kid, "dad pancakes"); len(got) != 1 || got[0].MessageID != tomorrow {
+		t.Errorf("expected Dad's message, got %+v", got)
+	}
+	now := time.Now().UTC()
+	expectIDs(search(kid, now.Format("2006-01-02")), recipe, callBack, tomorrow)
+	expectIDs(search(kid, now.Weekday().String()+" call"), callBack)
+
+	// Titles and captions are searched as the message's note.
+	c.json("PATCH", "/api/v1/audio-messages/"+callBack, mom, map[string]string{"title": "Groceries", "caption": "Before six"}).
+		expect(t, http.StatusOK)
+	if got := search(kid, "groceries six"); len(got) != 1 || got[0].MessageID != callBack || got[0].Field != "note" {
+		t.Errorf("expected the message found by its note, got %+v", got)
+	}
+
+	// Searches see only what the user could download: not deleted, and ready
+	// unless they sent it.
+	if _, err := c.sqlDB.Exec("UPDATE audio_messages SET processing_status = 'processing' WHERE id = ?", tomorrow); err != nil {
+		t.Fatalf("failed to mark message processing: %v", err)
+	}
+	if _, err := c.sqlDB.Exec("UPDATE audio_messages SET deleted_at = CURRENT_TIMESTAMP WHERE id = ?", recipe); err != nil {
+		t.Fatalf("failed to delete message: %v", err)
+	}
+	expectIDs(search(kid, "pancake"))
+	expectIDs(search(dad, "pancake"), tomorrow)
+
+	// Renaming the sender updates what their messages match.
+	if _, err := c.sqlDB.Exec("UPDATE users SET name = 'Mother' WHERE name = 'Mom'"); err != nil {
+		t.Fatalf("failed to rename user: %v", err)
+	}
+	expectIDs(search(kid, "mom"))
+	expectIDs(search(kid, "mother"), callBack)
+
+	expectCode(t, c.do(&exchange{method: "GET", path: "/api/v1/search", token: kid, invalid: true}).
+		expect(t, http.StatusBadRequest), apierror.CodeBadRequest)
+	expectCode(t, c.json("GET", "/api/v1/search?q=%21%21", kid, nil).expect(t, http.StatusBadRequest), apierror.CodeBadRequest)
+	expectCode(t, c.do(&exchange{method: "GET", path: "/api/v1/search?q=mom&limit=51", token: kid, invalid: true}).
+		expect(t, http.StatusBadRequest), apierror.CodeBadRequest)
+}
@@ -0,0 +1,244 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alecdray/waffle-talkie/internal/apierror"
+	"github.com/alecdray/waffle-talkie/internal/audio"
+	"github.com/alecdray/waffle-talkie/internal/storage"
+)
+
+func TestStorageQuotas(t *testing.T) {
+	c := newContract(t, Options{
+		StorageQuotas: storage.Quotas{
+			User:     storage.Limits{Bytes: 100, Seconds: 5},
+			Instance: storage.Limits{Seconds: 8},
+		},
+		UnsendUndoWindow: time.Hour,
+	})
+	c.startJobWorkers()
+	alice := c.registerApprovedUser("Alice", "alice-device", "admin")
+	bob := c.registerApprovedUser("Bob", "bob-device", "user")
+
+	type usage struct {
+		Bytes    int64 `json:"bytes"`
+		Seconds  int64 `json:"seconds"`
+		Messages int64 `json:"messages"`
+	}
+	first := c.send(alice, "first.m4a", bytes.Repeat([]byte("a"), 60), "2")
+
+	var mine struct {
+		Usage usage `json:"usage"`
+		Quota struct {
+			Bytes   *int64 `json:"bytes"`
+			Seconds *int64 `json:"seconds"`
+		} `json:"quota"`
+	}
+	c.json("GET", "/api/v1/me/usage", alice, nil).expect(t, http.StatusOK).decode(t, &mine)
+	if mine.Usage != (usage{Bytes: 60, Seconds: 2, Messages: 1}) {
+		t.Errorf("expected 60 bytes and 2 seconds in 1 message, got %+v", mine.Usage)
+	}
+	if mine.Quota.Bytes == nil || *mine.Quota.Bytes != 100 || mine.Quota.Seconds == nil || *mine.Quota.Seconds != 5 {
+		t.Errorf("expected a quota of 100 bytes and 5 seconds, got %+v", mine.Quota)
+	}
+
+	t.Run("user quota", func(t *testing.T) {
+		expectCode(t, c.upload("/api/v1/audio-messages", alice, "big.m4a", bytes.Repeat([]byte("a"), 60), "1").
+			expect(t, http.StatusRequestEntityTooLarge), apierror.CodeQuotaExceeded)
+		expectCode(t, c.upload("/api/v1/audio-messages", alice, "long.m4a", []byte("long"), "4").
+			expect(t, http.StatusRequestEntityTooLarge), apierror.CodeQuotaExceeded)
+		// A duration of zero or less would sneak under the quota, or lower
+		// the sender's usage.
+		for _, duration := range []string{"0", "-100"} {
+			expectCode(t, c.upload("/api/v1/audio-messages", alice, "short.m4a", []byte("short"), duration).
+				expect(t, http.StatusBadRequest), apierror.CodeBadRequest)
+		}
+		if paths, _ := filepath.Glob(filepath.Join(c.audioDirectory, "*")); len(paths) != 1 {
+			t.Errorf("expected rejected uploads not written, found %v", paths)
+		}
+	})
+
+	var more string
+	t.Run("instance quota", func(t *testing.T) {
+		c.send(bob, "reply.m4a", []byte("reply"), "4")
+		more = c.send(bob, "more.m4a", []byte("more"), "1")
+		expectCode(t, c.upload("/api/v1/audio-messages", alice, "again.m4a", []byte("again"), "2").
+			expect(t, http.StatusRequestEntityTooLarge), apierror.CodeQuotaExceeded)
+	})
+
+	t.Run("report", func(t *testing.T) {
+		// A leftover file, and a message whose recording has gone.
+		if err := os.WriteFile(filepath.Join(c.audioDirectory, "orphan.m4a"), []byte("orphan"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		message, err := c.queries.GetAudioMessage(context.Background(), first)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Remove(message.FilePath); err != nil {
+			t.Fatal(err)
+		}
+
+		var report struct {
+			Users []struct {
+				Name         string `json:"name"`
+				Usage        usage  `json:"usage"`
+				MissingFiles int64  `json:"missing_files"`
+			} `json:"users"`
+			Instance struct {
+				Usage usage `json:"usage"`
+			} `json:"instance"`
+			Disk struct {
+				OnDiskBytes       int64  `json:"on_disk_bytes"`
+				ReferencedBytes   int64  `json:"referenced_bytes"`
+				UnreferencedFiles int64  `json:"unreferenced_files"`
+				UnreferencedBytes int64  `json:"unreferenced_bytes"`
+				MissingFiles      int64  `json:"missing_files"`
+				FreeBytes         *int64 `json:"free_bytes"`
+			} `json:"disk"`
+		}
+		c.json("GET", "/admin/v1/storage", alice, nil).expect(t, http.StatusOK).decode(t, &report)
+		// Usage is what the quotas count: the sizes recorded when the files
+		// were written, whatever has happened on disk since.
+		if len(report.Users) != 2 || report.Users[0].Name != "Alice" || report.Users[0].Usage != (usage{Bytes: 60, Seconds: 2, Messages: 1}) || report.Users[0].MissingFiles != 1 ||
+			report.Users[1].Name != "Bob" || report.Users[1].Usage != (usage{Bytes: 9, Seconds: 5, Messages: 2}) {
+			t.Errorf("expected Alice's 60 bytes with a missing file then Bob's 9, got %+v", report.Users)
+		}
+		if report.Instance.Usage != (usage{Bytes: 69, Seconds: 7, Messages: 3}) {
+			t.Errorf("expected 69 bytes and 7 seconds in 3 messages, got %+v", report.Instance.Usage)
+		}
+		disk := report.Disk
+		if disk.OnDiskBytes != 15 || disk.ReferencedBytes != 9 || disk.UnreferencedFiles != 1 || disk.UnreferencedBytes != 6 || disk.MissingFiles != 1 {
+			t.Errorf("expected the orphan and the missing file reported, got %+v", disk)
+		}
+		if disk.FreeBytes == nil {
+			t.Error("expected free disk space measured")
+		}
+	})
+
+	t.Run("purge", func(t *testing.T) {
+		instance := func() usage {
+			t.Helper()
+			var report struct {
+				Instance struct {
+					Usage usage `json:"usage"`
+				} `json:"instance"`
+			}
+			c.json("GET", "/admin/v1/storage", alice, nil).expect(t, http.StatusOK).decode(t, &report)
+			return report.Instance.Usage
+		}
+
+		// An unsent message is held until the undo window passes, then its
+		// bytes are freed.
+		c.json("DELETE", "/api/v1/audio-messages/"+more, bob, nil).expect(t, http.StatusOK)
+		if got := instance(); got != (usage{Bytes: 69, Seconds: 7, Messages: 3}) {
+			t.Errorf("expected the unsent message still counted, got %+v", got)
+		}
+		if _, err := c.sqlDB.Exec("UPDATE jobs SET run_at = ? WHERE kind = ?", time.Now().UTC().Add(-time.Second), audio.JobPurge); err != nil {
+			t.Fatalf("failed to expire the undo window: %v", err)
+		}
+		c.waitForJobs()
+		if got := instance(); got != (usage{Bytes: 65, Seconds: 6, Messages: 2}) {
+			t.Errorf("expected the purged message's 4 bytes freed, got %+v", got)
+		}
+	})
+
+	t.Run("low disk", func(t *testing.T) {
+		c := newContract(t, Options{StorageQuotas: storage.Quotas{MinFreeBytes: math.MaxInt64}})
+		member := c.registerApprovedUser("Member", "member-device", "user")
+		expectCode(t, c.upload("/api/v1/audio-messages", member, "hello.m4a", []byte("hello"), "1").
+			expect(t, http.StatusInsufficientStorage), apierror.CodeInsufficientStorage)
+	})
+}
+
+func TestStorageQuotasConcurrent(t *testing.T) {
+	const quotaSeconds = 3
+	c := newContract(t, Options{StorageQuotas: storage.Quotas{
+		User:     storage.Limits{Seconds: quotaSeconds},
+		Instance: storage.Limits{Seconds: quotaSeconds + 2},
+	}})
+	alice := c.registerApprovedUser("Alice", "alice-device", "user")
+	bob := c.registerApprovedUser("Bob", "bob-device", "user")
+
+	// Requests go straight to the server; the contract's bookkeeping is not
+	// safe for concurrent use. Each upload is one second long.
+	upload := func(token string) int {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		part, err := mw.CreateFormFile("audio", "hello.m4a")
+		if err != nil {
+			t.Errorf("failed to create form file: %v", err)
+			return 0
+		}
+		part.Write([]byte("hello"))
+		mw.WriteField("duration", "1")
+		mw.Close()
+		req, err := http.NewRequest("POST", c.server.URL+"/api/v1/audio-messages", &body)
+		if err != nil {
+			t.Errorf("failed to build request: %v", err)
+			return 0
+		}
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Errorf("upload failed: %v", err)
+			return 0
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	race := func(tokens ...string) (created int) {
+		var wg sync.WaitGroup
+		statuses := make(chan int, len(tokens))
+		for _, token := range tokens {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				statuses <- upload(token)
+			}()
+		}
+		wg.Wait()
+		close(statuses)
+		for status := range statuses {
+			switch status {
+			case http.StatusCreated:
+				created++
+			case http.StatusRequestEntityTooLarge:
+			default:
+				t.Errorf("unexpected status %d", status)
+			}
+		}
+		return created
+	}
+
+	// Every upload checks the quota before any is stored, but only as many
+	// as fit are accepted.
+	if created := race(slices.Repeat([]string{alice}, 10)...); created != quotaSeconds {
+		t.Errorf("expected %d of Alice's uploads accepted, got %d", quotaSeconds, created)
+	}
+	var mine struct {
+		Usage struct {
+			Seconds int64 `json:"seconds"`
+		} `json:"usage"`
+	}
+	c.json("GET", "/api/v1/me/usage", alice, nil).expect(t, http.StatusOK).decode(t, &mine)
+	if mine.Usage.Seconds != quotaSeconds {
+		t.Errorf("expected Alice's quota held at %d seconds, got %d", quotaSeconds, mine.Usage.Seconds)
+	}
+
+	// The instance quota holds too, with the room left shared between users.
+	if created := race(slices.Repeat([]string{alice, bob}, 5)...); created != 2 {
+		t.Errorf("expected the 2 seconds left on the server taken, got %d uploads", created)
+	}
+}
@@ -4,29 +4,177 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"path/filepath"
+	"time"
 
 	"github.com/alecdray/waffle-talkie/internal/audio"
+	"github.com/alecdray/waffle-talkie/internal/audit"
+	"github.com/alecdray/waffle-talkie/internal/auth"
+	"github.com/alecdray/waffle-talkie/internal/compilation"
 	"github.com/alecdray/waffle-talkie/internal/database"
+	"github.com/alecdray/waffle-talkie/internal/email"
+	"github.com/alecdray/waffle-talkie/internal/jobs"
+	"github.com/alecdray/waffle-talkie/internal/notify"
+	"github.com/alecdray/waffle-talkie/internal/users"
 )
 
+// TaskOptions configures the background tasks started by TaskManager.
+type TaskOptions struct {
+	AudioDirectory string
+	// PendingUserTTL is how long unapproved registrations are kept; zero keeps them.
+	PendingUserTTL time.Duration
+	// AuditRetention is how long audit events are kept; zero keeps them.
+	AuditRetention time.Duration
+	// InactivityThreshold is how long a user may go without a request before
+	// they are marked inactive; zero never marks them.
+	InactivityThreshold time.Duration
+	// NotificationChannels deliver alerts once messages are processed, and
+	// those deferred by quiet hours.
+	NotificationChannels []notify.Channel
+	// EmailSender sends digests of unheard messages; nil disables them.
+	EmailSender email.Sender
+	// EmailLinks signs the links in digests.
+	EmailLinks email.Links
+	// Pipeline processes uploads; the job workers run its steps.
+	Pipeline *audio.Pipeline
+	// CompilationWeeks is how many finished weeks of compilations are kept;
+	// zero disables them.
+	CompilationWeeks int
+	// CompilationEncoder encodes compilations; nil writes WAV.
+	CompilationEncoder compilation.Encoder
+	// Jobs tunes the workers that run queued jobs.
+	Jobs jobs.PoolOptions
+}
+
 type TaskManager struct {
-	queries        *database.Queries
-	audioDirectory string
+	queries *database.Queries
+	opts    TaskOptions
 }
 
-func NewTaskManager(queries *database.Queries, audioDirectory string) *TaskManager {
+func NewTaskManager(queries *database.Queries, opts TaskOptions) *TaskManager {
 	return &TaskManager{
-		queries:        queries,
-		audioDirectory: audioDirectory,
+		queries: queries,
+		opts:    opts,
 	}
 }
 
 func (tm *TaskManager) Start(ctx context.Context) error {
 	slog.Info("starting server tasks")
-	audioTaskManager := audio.NewTaskManager(tm.queries, tm.audioDirectory)
+	auditLog := audit.New(tm.queries, nil)
+
+	audioTaskManager := audio.NewTaskManager(tm.queries, tm.opts.AudioDirectory, auditLog)
 	err := audioTaskManager.Start(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to start audio task manager: %w", err)
 	}
+	authTaskManager := auth.NewTaskManager(tm.queries, tm.opts.PendingUserTTL, auditLog)
+	err = authTaskManager.Start(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start auth task manager: %w", err)
+	}
+	usersTaskManager := users.NewTaskManager(tm.queries, tm.opts.InactivityThreshold, auditLog)
+	err = usersTaskManager.Start(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start users task manager: %w", err)
+	}
+	notifier := notify.New(tm.queries, tm.opts.NotificationChannels...)
+	notifyTaskManager := notify.NewTaskManager(notifier)
+	err = notifyTaskManager.Start(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start notification task manager: %w", err)
+	}
+	if tm.opts.EmailSender != nil {
+		emailTaskManager := email.NewTaskManager(email.NewDigester(tm.queries, tm.opts.EmailSender, tm.opts.EmailLinks))
+		err = emailTaskManager.Start(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to start email task manager: %w", err)
+		}
+	}
+	auditTaskManager := audit.NewTaskManager(tm.queries, tm.opts.AuditRetention)
+	err = auditTaskManager.Start(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start audit task manager: %w", err)
+	}
+
+	compilations := compilationDirectory(tm.opts.AudioDirectory, tm.opts.CompilationWeeks)
+	if compilations != "" {
+		encoder := tm.opts.CompilationEncoder
+		if encoder == nil {
+			encoder = compilation.WAVEncoder{}
+		}
+		compilationTaskManager := compilation.NewTaskManager(tm.queries, encoder, compilations, tm.opts.CompilationWeeks)
+		err = compilationTaskManager.Start(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to start compilation task manager: %w", err)
+		}
+	}
+
+	pool := jobs.NewPool(tm.queries, tm.opts.Jobs)
+	tm.opts.Pipeline.Register(pool)
+	pool.Register(audio.JobPurge, audio.NewPurger(tm.queries, auditLog))
+	pool.Register(audio.JobRetract, audio.NewRetracter(tm.queries, notifier))
+	err = pool.Start(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start job workers: %w", err)
+	}
 	return nil
 }
+
+// compilationDirectory is where compilations and their clips are kept, or
+// empty when they are disabled.
+func compilationDirectory(audioDirectory string, weeks int) string {
+	if weeks <= 0 {
+		return ""
+	}
+	return filepath.Join(audioDirectory, "compilations")
+}
+
+// PipelineOptions configures how uploads are processed.
+type PipelineOptions struct {
+	AudioDirectory string
+	// AudioDecoders decode uploads, after the built-in WAV decoder.
+	AudioDecoders []audio.Decoder
+	// Transcoder produces the playback rendition of uploads; nil serves them
+	// as recorded.
+	Transcoder audio.Transcoder
+	// AudioFilters are applied, in order, to the playback rendition.
+	AudioFilters []audio.Filter
+	// Transcriber transcribes uploads; nil disables transcripts.
+	Transcriber audio.Transcriber
+	// CompilationWeeks, when positive, clips uploads for compilations.
+	CompilationWeeks int
+}
+
+// NewPipeline builds the processing pipeline for uploads. Build it once and
+// give it to both NewMux, which queues uploads on it, and NewTaskManager,
+// whose workers run it.
+func NewPipeline(queries *database.Queries, notifier *notify.Notifier, opts PipelineOptions) *audio.Pipeline {
+	decoders := append([]audio.Decoder{audio.WAVDecoder{}}, opts.AudioDecoders...)
+	// The playback rendition, or the waveform when there is none, is made
+	// before recipients can fetch the message, so they never get the raw
+	// upload.
+	var steps []audio.Step
+	switch {
+	case opts.Transcoder == nil:
+		steps = append(steps, required(audio.WaveformStep(queries, decoders)))
+	case len(opts.AudioFilters) > 0:
+		// Filtering changes what plays, so the transcode step draws the
+		// waveform from the filtered audio itself.
+		steps = append(steps, required(audio.TranscodeStep(queries, opts.Transcoder, decoders, opts.AudioFilters)))
+	default:
+		steps = append(steps, required(audio.TranscodeStep(queries, opts.Transcoder, decoders, nil)), audio.WaveformStep(queries, decoders))
+	}
+	if opts.Transcriber != nil {
+		steps = append(steps, audio.TranscribeStep(queries, opts.Transcriber, decoders, opts.AudioFilters))
+	}
+	if dir := compilationDirectory(opts.AudioDirectory, opts.CompilationWeeks); dir != "" {
+		steps = append(steps, compilation.ClipStep(queries, decoders, opts.AudioFilters, dir))
+	}
+	return audio.NewPipeline(queries, notifier, steps...)
+}
+
+// required marks step as one that must finish before the message is shown.
+func required(step audio.Step) audio.Step {
+	step.Required = true
+	return step
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/alecdray/waffle-talkie/internal/apierror"
+	"github.com/alecdray/waffle-talkie/internal/audio"
+	"github.com/alecdray/waffle-talkie/internal/jobs"
+)
+
+// countingTranscriber stands in for whisper, splitting the audio into two
+// timed segments whose text counts the transcriptions so far.
+type countingTranscriber struct {
+	runs *atomic.Int64
+}
+
+func (t countingTranscriber) Transcribe(ctx context.Context, pcm audio.PCM) ([]audio.Segment, error) {
+	run := t.runs.Add(1)
+	half := pcm.Duration() / 2
+	return []audio.Segment{
+		{Start: 0, End: half, Text: "take"},
+		{Start: half, End: pcm.Duration(), Text: strconv.FormatInt(run, 10)},
+	}, nil
+}
+
+func TestTranscripts(t *testing.T) {
+	c := newPipelineContract(t, Options{}, PipelineOptions{
+		Transcoder:   audio.PassthroughTranscoder{},
+		AudioFilters: []audio.Filter{audio.TrimSilence()},
+		Transcriber:  countingTranscriber{runs: new(atomic.Int64)},
+	})
+	sender := c.registerApprovedUser("Sender", "sender-device", "user")
+	listener := c.registerApprovedUser("Listener", "listener-device", "user")
+	admin := c.registerApprovedUser("Admin", "admin-device", "admin")
+	c.startJobWorkers()
+
+	// A second of silence either side of two seconds of tone.
+	wav := testWAV(1, 16, 4*8000, func(frame int) float64 {
+		if frame < 8000 || frame >= 3*8000 {
+			return 0
+		}
+		return 0.5
+	})
+	messageID := c.send(sender, "voice.wav", wav, "4")
+	undecodable := c.send(sender, "voice.m4a", []byte("not really audio"), "1")
+
+	type transcript struct {
+		Text     string `json:"text"`
+		Segments []struct {
+			StartMs int64  `json:"start_ms"`
+			EndMs   int64  `json:"end_ms"`
+			Text    string `json:"text"`
+		} `json:"segments"`
+	}
+	transcripts := func() map[string]*transcript {
+		t.Helper()
+		var list struct {
+			Messages []struct {
+				ID         string      `json:"id"`
+				Transcript *transcript `json:"transcript"`
+			} `json:"messages"`
+		}
+		c.json("GET", "/api/v1/audio-messages", listener, nil).expect(t, http.StatusOK).decode(t, &list)
+		byID := make(map[string]*transcript)
+		for _, message := range list.Messages {
+			byID[message.ID] = message.Transcript
+		}
+		return byID
+	}
+
+	c.waitForJobs()
+
+	// Segments are timed against the trimmed playback, not the upload.
+	got := transcripts()
+	if tr := got[messageID]; tr == nil || tr.Text != "take 1" || len(tr.Segments) != 2 ||
+		tr.Segments[1].EndMs < 2000 || tr.Segments[1].EndMs > 2500 {
+		t.Fatalf("expected a two-segment transcript of the trimmed audio, got %+v", tr)
+	}
+	if tr := got[undecodable]; tr != nil {
+		t.Errorf("expected no transcript for undecodable audio, got %+v", tr)
+	}
+
+	retry := func(token, id string) *exchange {
+		return c.json("POST", "/admin/v1/audio-messages/"+id+"/transcript", token, nil)
+	}
+	expectCode(t, retry(sender, messageID).expect(t, http.StatusForbidden), apierror.CodeForbidden)
+	expectCode(t, retry(admin, "missing").expect(t, http.StatusNotFound), apierror.CodeMessageNotFound)
+	var queued struct {
+		JobID int64 `json:"job_id"`
+	}
+	retry(admin, messageID).expect(t, http.StatusAccepted).decode(t, &queued)
+	c.waitForJobs()
+	if job, err := c.queries.GetJob(context.Background(), queued.JobID); err != nil || job.State != jobs.StateSucceeded {
+		t.Fatalf("expected the retry job to succeed, got %+v (%v)", job, err)
+	}
+	if tr := transcripts()[messageID]; tr == nil || tr.Text != "take 2" || len(tr.Segments) != 2 {
+		t.Errorf("expected the transcript replaced, got %+v", tr)
+	}
+
+	// Deleting the account removes its transcripts.
+	var confirmation struct {
+		ConfirmationToken string `json:"confirmation_token"`
+	}
+	c.json("POST", "/api/v1/me/deletion-token", sender, nil).expect(t, http.StatusOK).decode(t, &confirmation)
+	c.json("DELETE", "/api/v1/me", sender, map[string]string{"confirmation_token": confirmation.ConfirmationToken}).
+		expect(t, http.StatusNoContent)
+	if _, err := c.queries.GetTranscript(context.Background(), messageID); err != sql.ErrNoRows {
+		t.Errorf("expected the transcript deleted, got %v", err)
+	}
+	if segments, err := c.queries.ListTranscriptSegments(context.Background(), messageID); err != nil || len(segments) != 0 {
+		t.Errorf("expected the transcript segments deleted, got %v (%v)", segments, err)
+	}
+}
+
+// TestWhisperTranscriber runs whisper.cpp on a second of silence when
+// WHISPER_PATH and WHISPER_MODEL point at a binary and model.
+func TestWhisperTranscriber(t *testing.T) {
+	transcriber := audio.NewTranscriber(os.Getenv("WHISPER_PATH"), os.Getenv("WHISPER_MODEL"), "en")
+	if transcriber == nil {
+		t.Skip("set WHISPER_PATH and WHISPER_MODEL to test whisper.cpp")
+	}
+	silence := audio.PCM{SampleRate: 44100, Channels: 2, Samples: make([]float32, 2*44100)}
+	if _, err := transcriber.Transcribe(context.Background(), silence); err != nil {
+		t.Fatalf("failed to transcribe: %v", err)
+	}
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alecdray/waffle-talkie/internal/apierror"
+	"github.com/alecdray/waffle-talkie/internal/audio"
+	"github.com/alecdray/waffle-talkie/internal/database"
+	"github.com/alecdray/waffle-talkie/internal/jobs"
+	"github.com/alecdray/waffle-talkie/internal/notify"
+)
+
+// retractingChannel records retractions apart from alerts.
+type retractingChannel struct {
+	recordingChannel
+	retracted recordingChannel
+}
+
+func (ch *retractingChannel) Retract(ctx context.Context, recipient database.User, message database.AudioMessage) error {
+	return ch.retracted.Notify(ctx, recipient, message)
+}
+
+func TestUnsend(t *testing.T) {
+	channel := &retractingChannel{}
+	c := newContract(t, Options{
+		UnsendUndoWindow:     time.Hour,
+		NotificationChannels: []notify.Channel{channel},
+	})
+	c.startJobWorkers()
+	ctx := context.Background()
+	sender := c.registerApprovedUser("Sender", "sender-device", "user")
+	listener := c.registerApprovedUser("Listener", "listener-device", "user")
+	admin := c.registerApprovedUser("Admin", "admin-device", "admin")
+	suspended := c.registerApprovedUser("Suspended", "suspended-device", "user")
+	c.json("PUT", "/admin/v1/users/"+c.userID(suspended)+"/status", admin, map[string]string{"status": "suspended"}).expect(t, http.StatusOK)
+
+	messageID := c.send(sender, "oops.m4a", []byte("meant for one person"), "2")
+	path := "/api/v1/audio-messages/" + messageID
+	stored, err := c.queries.GetAudioMessage(ctx, messageID)
+	if err != nil {
+		t.Fatalf("failed to get message: %v", err)
+	}
+
+	type list struct {
+		Messages []struct {
+			ID string `json:"id"`
+		} `json:"messages"`
+		Retracted []string `json:"retracted"`
+	}
+	listed := func() (ids []string, retracted []string) {
+		t.Helper()
+		var l list
+		c.json("GET", "/api/v1/audio-messages", listener, nil).expect(t, http.StatusOK).decode(t, &l)
+		for _, m := range l.Messages {
+			ids = append(ids, m.ID)
+		}
+		return ids, l.Retracted
+	}
+
+	expectCode(t, c.json("DELETE", path, listener, nil).expect(t, http.StatusForbidden), apierror.CodeForbidden)
+	expectCode(t, c.json("DELETE", "/api/v1/audio-messages/missing", sender, nil).expect(t, http.StatusNotFound), apierror.CodeMessageNotFound)
+
+	// Unsending hides the message at once, lists it as retracted and tells
+	// everyone else through a job, but keeps the file until the undo window
+	// passes.
+	var unsent struct {
+		UndoUntil *time.Time `json:"undo_until"`
+	}
+	c.json("DELETE", path, sender, nil).expect(t, http.StatusOK).decode(t, &unsent)
+	if unsent.UndoUntil == nil || time.Until(*unsent.UndoUntil) < 59*time.Minute {
+		t.Errorf("expected an hour to undo, got %v", unsent.UndoUntil)
+	}
+	if ids, retracted := listed(); slices.Contains(ids, messageID) || !slices.Equal(retracted, []string{messageID}) {
+		t.Errorf("expected the message retracted, got messages %v and retracted %v", ids, retracted)
+	}
+	c.json("GET", path, listener, nil).expect(t, http.StatusNotFound)
+
+	// A message unsent before recipients could fetch it is only listed as
+	// retracted to its sender, and no one is sent a retraction for it.
+	if _, err := c.queries.CreateAudioMessage(ctx, database.CreateAudioMessageParams{
+		ID:               "unfinished",
+		SenderUserID:     stored.SenderUserID,
+		FilePath:         stored.FilePath,
+		Duration:         1,
+		ProcessingStatus: audio.StatusProcessing,
+	}); err != nil {
+		t.Fatalf("failed to create message: %v", err)
+	}
+	c.json("DELETE", "/api/v1/audio-messages/unfinished", sender, nil).expect(t, http.StatusOK)
+	if _, retracted := listed(); slices.Contains(retracted, "unfinished") {
+		t.Errorf("expected a message recipients never saw kept from them, got retracted %v", retracted)
+	}
+	var own list
+	c.json("GET", "/api/v1/audio-messages", sender, nil).expect(t, http.StatusOK).decode(t, &own)
+	if !slices.Contains(own.Retracted, "unfinished") {
+		t.Errorf("expected the sender told of their own retraction, got %v", own.Retracted)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for retracting := 1; retracting > 0 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		if err := c.sqlDB.QueryRow("SELECT COUNT(*) FROM jobs WHERE kind = ? AND state IN (?, ?)", audio.JobRetract, jobs.StateQueued, jobs.StateRunning).Scan(&retracting); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Suspended users are not told, as they are not alerted about messages
+	// either.
+	if told := channel.retracted.take(); !slices.Equal(told, []string{"Admin", "Listener"}) {
+		t.Errorf("expected the other active users told of the retraction, got %v", told)
+	}
+	if _, err := os.Stat(stored.FilePath); err != nil {
+		t.Errorf("expected the file kept during the undo window: %v", err)
+	}
+	if deleted, err := c.queries.GetAudioMessageWithDeleted(ctx, messageID); err != nil || deleted.DeletedByUserID.String != deleted.SenderUserID {
+		t.Errorf("expected the sender recorded as deleting it, got %+v (%v)", deleted, err)
+	}
+
+	// Undoing brings it back for everyone.
+	c.json("POST", path+"/restore", listener, nil).expect(t, http.StatusNotFound)
+	c.json("POST", path+"/restore", sender, nil).expect(t, http.StatusOK)
+	if ids, retracted := listed(); !slices.Contains(ids, messageID) || len(retracted) != 0 {
+		t.Errorf("expected the message restored, got messages %v and retracted %v", ids, retracted)
+	}
+	expectCode(t, c.json("POST", path+"/restore", sender, nil).expect(t, http.StatusConflict), apierror.CodeUndoUnavailable)
+
+	// Admins may unsend too, and only they may undo it: the sender cannot
+	// bring back a message an admin took down. Once the window passes the
+	// files are removed, and the purge queued by the first unsend does
+	// nothing.
+	c.json("DELETE", path, admin, nil).expect(t, http.StatusOK)
+	expectCode(t, c.json("POST", path+"/restore", sender, nil).expect(t, http.StatusForbidden), apierror.CodeForbidden)
+	if _, err := c.sqlDB.Exec("UPDATE jobs SET run_at = ? WHERE kind = ?", time.Now().UTC().Add(-time.Second), audio.JobPurge); err != nil {
+		t.Fatalf("failed to expire the undo window: %v", err)
+	}
+	c.waitForJobs()
+	if _, err := os.Stat(stored.FilePath); !os.IsNotExist(err) {
+		t.Errorf("expected the file removed, got %v", err)
+	}
+	purged, err := c.queries.GetAudioMessageWithDeleted(ctx, messageID)
+	if err != nil || !purged.PurgedAt.Valid || purged.DeletedByUserID.String == purged.SenderUserID {
+		t.Errorf("expected the message purged after the admin unsent it, got %+v (%v)", purged, err)
+	}
+	expectCode(t, c.json("POST", path+"/restore", admin, nil).expect(t, http.StatusConflict), apierror.CodeUndoUnavailable)
+
+	var events struct {
+		Events []struct {
+			Action string `json:"action"`
+		} `json:"events"`
+	}
+	c.json("GET", "/admin/v1/audit-events?target_id="+messageID, admin, nil).expect(t, http.StatusOK).decode(t, &events)
+	var actions []string
+	for _, event := range events.Events {
+		actions = append(actions, event.Action)
+	}
+	slices.Sort(actions)
+	if want := []string{"audio_message.purged", "audio_message.unsend_undone", "audio_message.unsent", "audio_message.unsent"}; !slices.Equal(actions, want) {
+		t.Errorf("expected %v audited, got %v", want, actions)
+	}
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alecdray/waffle-talkie/internal/apierror"
+	"github.com/alecdray/waffle-talkie/internal/audit"
+	"github.com/alecdray/waffle-talkie/internal/users"
+)
+
+func TestUserStatus(t *testing.T) {
+	c := newContract(t, Options{})
+	c.startJobWorkers()
+	ctx := context.Background()
+
+	admin := c.registerApprovedUser("Admin", "admin-device", "admin")
+	sender := c.registerApprovedUser("Sender", "sender-device", "user")
+	idle := c.registerApprovedUser("Idle", "idle-device", "user")
+	var idleUser struct {
+		UserID string `json:"user_id"`
+	}
+	c.json("POST", "/auth/v1/register", "", map[string]string{"device_id": "idle-device"}).
+		expect(t, http.StatusOK).decode(t, &idleUser)
+
+	messageID := c.send(sender, "hi.m4a", []byte("audio"), "1")
+	c.json("POST", "/api/v1/audio-messages/"+messageID+"/receipt", sender, nil).expect(t, http.StatusOK)
+	c.json("POST", "/api/v1/audio-messages/"+messageID+"/receipt", admin, nil).expect(t, http.StatusOK)
+
+	fullyReceived := func() int {
+		t.Helper()
+		messages, err := c.queries.GetOldOrFullyReceivedMessages(ctx)
+		if err != nil {
+			t.Fatalf("failed to list fully received messages: %v", err)
+		}
+		return len(messages)
+	}
+	if n := fullyReceived(); n != 0 {
+		t.Fatalf("expected the message to wait for Idle, got %d fully received", n)
+	}
+
+	if _, err := c.sqlDB.ExecContext(ctx, "UPDATE users SET last_active = ? WHERE id = ?", time.Now().UTC().AddDate(0, 0, -60), idleUser.UserID); err != nil {
+		t.Fatalf("failed to backdate last_active: %v", err)
+	}
+	if err := users.NewTaskManager(c.queries, 30*24*time.Hour, audit.New(c.queries, nil)).DeactivateIdleUsers(ctx); err != nil {
+		t.Fatalf("failed to deactivate idle users: %v", err)
+	}
+	if user, _ := c.queries.GetUser(ctx, idleUser.UserID); user.Status != string(users.UserStatusInactive) {
+		t.Fatalf("expected Idle to be inactive, got %q", user.Status)
+	}
+	if n := fullyReceived(); n != 1 {
+		t.Errorf("expected inactive users not to hold back the message, got %d fully received", n)
+	}
+
+	c.json("GET", "/api/v1/me", idle, nil).expect(t, http.StatusOK)
+	if user, _ := c.queries.GetUser(ctx, idleUser.UserID); user.Status != string(users.UserStatusActive) {
+		t.Errorf("expected Idle to be reactivated by their next request, got %q", user.Status)
+	}
+
+	c.json("PUT", "/admin/v1/users/"+idleUser.UserID+"/status", admin, map[string]string{"status": "suspended"}).expect(t, http.StatusOK)
+	expectCode(t, c.json("GET", "/api/v1/me", idle, nil).expect(t, http.StatusForbidden), apierror.CodeUserSuspended)
+	c.json("PUT", "/admin/v1/users/"+idleUser.UserID+"/status", admin, map[string]string{"status": "active"}).expect(t, http.StatusOK)
+	c.json("GET", "/api/v1/me", idle, nil).expect(t, http.StatusOK)
+}
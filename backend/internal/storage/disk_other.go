@@ -0,0 +1,9 @@
+//go:build !unix
+
+package storage
+
+// FreeBytes is not implemented off Unix, where the low disk space guard is
+// skipped.
+func FreeBytes(path string) (int64, error) {
+	return 0, ErrFreeSpaceUnknown
+}
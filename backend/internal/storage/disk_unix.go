@@ -0,0 +1,15 @@
+//go:build unix
+
+package storage
+
+import "syscall"
+
+// FreeBytes returns the disk space available to the server on the file
+// system holding path.
+func FreeBytes(path string) (int64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
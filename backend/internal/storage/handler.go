@@ -0,0 +1,203 @@
+package storage
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"slices"
+
+	"github.com/alecdray/waffle-talkie/internal/apierror"
+	"github.com/alecdray/waffle-talkie/internal/auth"
+	"github.com/alecdray/waffle-talkie/internal/database"
+)
+
+// Handler reports storage usage.
+type Handler struct {
+	queries *database.Queries
+	guard   *Guard
+}
+
+func NewHandler(queries *database.Queries, guard *Guard) *Handler {
+	return &Handler{queries: queries, guard: guard}
+}
+
+func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /v1/me/usage", h.HandleGetUsage)
+}
+
+// RegisterAdminRoutes registers storage routes on the admin mux.
+func (h *Handler) RegisterAdminRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /v1/storage", h.HandleGetReport)
+}
+
+// Quota is a limit on stored audio. Fields are null when unlimited.
+type Quota struct {
+	Bytes   *int64 `json:"bytes"`
+	Seconds *int64 `json:"seconds"`
+}
+
+func quota(limits Limits) Quota {
+	var q Quota
+	if limits.Bytes > 0 {
+		q.Bytes = &limits.Bytes
+	}
+	if limits.Seconds > 0 {
+		q.Seconds = &limits.Seconds
+	}
+	return q
+}
+
+type UsageResponse struct {
+	Usage Usage `json:"usage"`
+	Quota Quota `json:"quota"`
+}
+
+// UserUsage is a user's audio as the quotas count it, from the sizes recorded
+// when files were written.
+type UserUsage struct {
+	UserID string `json:"user_id"`
+	Name   string `json:"name"`
+	Usage  Usage  `json:"usage"`
+	// MissingFiles counts files of held messages that are not on disk.
+	MissingFiles int64 `json:"missing_files"`
+}
+
+// DiskReport compares the audio directory with the files the database refers
+// to. Unreferenced files are left behind by failed uploads or cleanups.
+type DiskReport struct {
+	OnDiskBytes       int64 `json:"on_disk_bytes"`
+	ReferencedBytes   int64 `json:"referenced_bytes"`
+	UnreferencedFiles int64 `json:"unreferenced_files"`
+	UnreferencedBytes int64 `json:"unreferenced_bytes"`
+	MissingFiles      int64 `json:"missing_files"`
+	// FreeBytes is null where it cannot be measured.
+	FreeBytes    *int64 `json:"free_bytes"`
+	MinFreeBytes int64  `json:"min_free_bytes"`
+}
+
+type ReportResponse struct {
+	// Users are ordered by bytes stored, most first.
+	Users    []UserUsage   `json:"users"`
+	Instance UsageResponse `json:"instance"`
+	Disk     DiskReport    `json:"disk"`
+}
+
+// HandleGetUsage returns the caller's stored audio and quota.
+func (h *Handler) HandleGetUsage(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "User ID not found")
+		return
+	}
+
+	usage, err := h.guard.UserUsage(r.Context(), userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to measure usage", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve usage")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(UsageResponse{Usage: usage, Quota: quota(h.guard.quotas.User)})
+}
+
+// HandleGetReport returns every user's stored audio and the instance's, as
+// the quotas count them, and how the audio directory compares with the
+// database.
+func (h *Handler) HandleGetReport(w http.ResponseWriter, r *http.Request) {
+	resp, err := h.report(r)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to build storage report", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve storage report")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (h *Handler) report(r *http.Request) (ReportResponse, error) {
+	ctx := r.Context()
+	users, err := h.queries.ListUsers(ctx)
+	if err != nil {
+		return ReportResponse{}, err
+	}
+	files, err := h.queries.ListStoredAudioFiles(ctx)
+	if err != nil {
+		return ReportResponse{}, err
+	}
+	compilationPaths, err := h.queries.ListCompilationFilePaths(ctx)
+	if err != nil {
+		return ReportResponse{}, err
+	}
+
+	byUser := make(map[string]*UserUsage, len(users))
+	resp := ReportResponse{Users: make([]UserUsage, 0, len(users))}
+	for _, user := range users {
+		byUser[user.ID] = &UserUsage{UserID: user.ID, Name: user.Name}
+	}
+
+	referenced := make(map[string]bool)
+	for _, file := range files {
+		usage, ok := byUser[file.SenderUserID]
+		if !ok {
+			// Left by a deleted account until cleanup removes it.
+			usage = &UserUsage{UserID: file.SenderUserID}
+			byUser[file.SenderUserID] = usage
+		}
+		missing := missingFiles(file)
+		usage.Usage.Bytes += file.Size
+		usage.Usage.Seconds += file.Duration
+		usage.Usage.Messages++
+		usage.MissingFiles += int64(missing)
+		resp.Disk.MissingFiles += int64(missing)
+		for _, path := range messagePaths(file) {
+			referenced[filepath.Clean(path)] = true
+		}
+	}
+	for _, path := range compilationPaths {
+		referenced[filepath.Clean(path)] = true
+	}
+
+	found := make(map[string]bool, len(referenced))
+	err = walkFiles(h.guard.audioDirectory, func(path string, size int64) {
+		resp.Disk.OnDiskBytes += size
+		if referenced[filepath.Clean(path)] {
+			found[filepath.Clean(path)] = true
+			resp.Disk.ReferencedBytes += size
+		} else {
+			resp.Disk.UnreferencedFiles++
+			resp.Disk.UnreferencedBytes += size
+		}
+	})
+	if err != nil {
+		return ReportResponse{}, err
+	}
+	for _, path := range compilationPaths {
+		if !found[filepath.Clean(path)] {
+			resp.Disk.MissingFiles++
+		}
+	}
+
+	if resp.Instance.Usage, err = h.guard.InstanceUsage(ctx); err != nil {
+		return ReportResponse{}, err
+	}
+	resp.Instance.Quota = quota(h.guard.quotas.Instance)
+	resp.Disk.MinFreeBytes = h.guard.quotas.MinFreeBytes
+	if free, err := FreeBytes(h.guard.audioDirectory); err == nil {
+		resp.Disk.FreeBytes = &free
+	} else if !errors.Is(err, ErrFreeSpaceUnknown) {
+		return ReportResponse{}, err
+	}
+
+	for _, usage := range byUser {
+		resp.Users = append(resp.Users, *usage)
+	}
+	slices.SortFunc(resp.Users, func(a, b UserUsage) int {
+		return cmp.Or(cmp.Compare(b.Usage.Bytes, a.Usage.Bytes), cmp.Compare(a.Name, b.Name), cmp.Compare(a.UserID, b.UserID))
+	})
+	return resp, nil
+}
@@ -0,0 +1,271 @@
+// Package storage measures the disk space taken by audio and enforces quotas
+// on it, so one user or a full disk cannot take the server down.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/alecdray/waffle-talkie/internal/database"
+)
+
+// Limits caps stored audio. Zero fields are unlimited.
+type Limits struct {
+	Bytes   int64
+	Seconds int64
+}
+
+// exceeded reports whether storing bytes and seconds more on top of usage
+// would go over the limits.
+func (l Limits) exceeded(usage Usage, bytes, seconds int64) bool {
+	return (l.Bytes > 0 && usage.Bytes+bytes > l.Bytes) ||
+		(l.Seconds > 0 && usage.Seconds+seconds > l.Seconds)
+}
+
+// Quotas configures the Guard.
+type Quotas struct {
+	// User limits the audio of each sender's held messages. Compilation
+	// clips are left out: they are copies the sender cannot remove, and
+	// count toward the instance limit instead.
+	User Limits
+	// Instance limits every stored file: messages' files, including those
+	// awaiting cleanup, clips and compilations. Files the database does not
+	// know of, left by a crash, are not counted; the storage report lists
+	// them.
+	Instance Limits
+	// MinFreeBytes is the free disk space uploads must leave; zero disables
+	// the check.
+	MinFreeBytes int64
+}
+
+// Usage is the audio stored for a user or the whole instance.
+type Usage struct {
+	Bytes    int64 `json:"bytes"`
+	Seconds  int64 `json:"seconds"`
+	Messages int64 `json:"messages"`
+}
+
+var (
+	ErrUserQuota     = errors.New("upload would exceed your storage quota")
+	ErrInstanceQuota = errors.New("upload would exceed the server's storage quota")
+	ErrLowDisk       = errors.New("server is low on disk space")
+
+	// ErrFreeSpaceUnknown is returned by FreeBytes where it cannot be measured.
+	ErrFreeSpaceUnknown = errors.New("free disk space cannot be measured on this platform")
+)
+
+// Guard checks uploads against the quotas.
+type Guard struct {
+	queries        *database.Queries
+	audioDirectory string
+	quotas         Quotas
+
+	// mu serializes checks, so concurrent uploads cannot each pass against
+	// the same usage. Uploads that passed but whose messages are not stored
+	// yet are counted in reserved and reservedByUser.
+	mu             sync.Mutex
+	reserved       Usage
+	reservedByUser map[string]Usage
+}
+
+func NewGuard(queries *database.Queries, audioDirectory string, quotas Quotas) *Guard {
+	return &Guard{
+		queries:        queries,
+		audioDirectory: audioDirectory,
+		quotas:         quotas,
+		reservedByUser: make(map[string]Usage),
+	}
+}
+
+// Reservation holds room under the quotas for an upload until its message
+// is stored.
+type Reservation struct {
+	guard  *Guard
+	userID string
+	upload Usage
+	done   bool
+}
+
+// Reserve returns ErrLowDisk, ErrUserQuota or ErrInstanceQuota if storing an
+// upload of bytes and seconds from userID would break the quotas. Otherwise
+// the upload counts toward later checks until the reservation is committed
+// or released.
+func (g *Guard) Reserve(ctx context.Context, userID string, bytes, seconds int64) (*Reservation, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if err := g.check(ctx, userID, bytes, seconds); err != nil {
+		return nil, err
+	}
+
+	r := &Reservation{guard: g, userID: userID, upload: Usage{Bytes: bytes, Seconds: seconds, Messages: 1}}
+	g.reserved = g.reserved.add(r.upload, 1)
+	g.reservedByUser[userID] = g.reservedByUser[userID].add(r.upload, 1)
+	return r, nil
+}
+
+// Commit runs store, which should store the upload's message, and releases
+// the reservation. No check runs in between, so the upload is never counted
+// both as reserved and as stored.
+func (r *Reservation) Commit(store func() error) error {
+	r.guard.mu.Lock()
+	defer r.guard.mu.Unlock()
+	defer r.release()
+	return store()
+}
+
+// Release gives up the reservation of an upload that failed. It does nothing
+// once the reservation is committed or released.
+func (r *Reservation) Release() {
+	r.guard.mu.Lock()
+	defer r.guard.mu.Unlock()
+	r.release()
+}
+
+// release must be called with the guard's mu held.
+func (r *Reservation) release() {
+	if r.done {
+		return
+	}
+	r.done = true
+	g := r.guard
+	g.reserved = g.reserved.add(r.upload, -1)
+	if left := g.reservedByUser[r.userID].add(r.upload, -1); left.Messages > 0 {
+		g.reservedByUser[r.userID] = left
+	} else {
+		delete(g.reservedByUser, r.userID)
+	}
+}
+
+// add returns u plus sign times v.
+func (u Usage) add(v Usage, sign int64) Usage {
+	return Usage{
+		Bytes:    u.Bytes + sign*v.Bytes,
+		Seconds:  u.Seconds + sign*v.Seconds,
+		Messages: u.Messages + sign*v.Messages,
+	}
+}
+
+// check tests an upload against the quotas, counting reserved uploads. Usage
+// is read from sizes recorded in the database, so nothing is measured on disk
+// but the free space. The files of reserved uploads are counted twice toward
+// the free disk space while they are written, which errs on the side of
+// refusing. g.mu must be held.
+func (g *Guard) check(ctx context.Context, userID string, bytes, seconds int64) error {
+	if g.quotas.MinFreeBytes > 0 {
+		free, err := FreeBytes(g.audioDirectory)
+		if errors.Is(err, ErrFreeSpaceUnknown) {
+			// Nothing to check on this platform.
+		} else if err != nil {
+			return fmt.Errorf("failed to measure free disk space: %w", err)
+		} else if free-g.reserved.Bytes-bytes < g.quotas.MinFreeBytes {
+			return ErrLowDisk
+		}
+	}
+
+	if g.quotas.User != (Limits{}) {
+		usage, err := g.UserUsage(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if g.quotas.User.exceeded(usage.add(g.reservedByUser[userID], 1), bytes, seconds) {
+			return ErrUserQuota
+		}
+	}
+
+	if g.quotas.Instance != (Limits{}) {
+		usage, err := g.InstanceUsage(ctx)
+		if err != nil {
+			return err
+		}
+		if g.quotas.Instance.exceeded(usage.add(g.reserved, 1), bytes, seconds) {
+			return ErrInstanceQuota
+		}
+	}
+	return nil
+}
+
+// UserUsage returns the audio held for userID's messages: their files still
+// on disk, whether or not everyone has heard them. Compilation clips of their
+// messages are not counted; see Quotas.User.
+func (g *Guard) UserUsage(ctx context.Context, userID string) (Usage, error) {
+	usage, err := g.queries.GetUserStorageUsage(ctx, userID)
+	if err != nil {
+		return Usage{}, fmt.Errorf("failed to sum stored audio: %w", err)
+	}
+	return Usage(usage), nil
+}
+
+// InstanceUsage returns the bytes of every stored file and the length of
+// every held message.
+func (g *Guard) InstanceUsage(ctx context.Context) (Usage, error) {
+	usage, err := g.queries.GetInstanceStorageUsage(ctx)
+	if err != nil {
+		return Usage{}, fmt.Errorf("failed to sum stored audio: %w", err)
+	}
+	bytes, err := g.queries.GetStoredBytes(ctx)
+	if err != nil {
+		return Usage{}, fmt.Errorf("failed to get stored bytes: %w", err)
+	}
+	return Usage{Bytes: bytes, Seconds: usage.Seconds, Messages: usage.Messages}, nil
+}
+
+// missingFiles returns how many of a message's recording and playback
+// rendition are missing from disk.
+func missingFiles(file database.ListStoredAudioFilesRow) (missing int) {
+	for _, path := range messagePaths(file) {
+		if _, err := os.Stat(path); err != nil {
+			if !os.IsNotExist(err) {
+				slog.Error("failed to stat audio file", "path", path, "error", err)
+			}
+			missing++
+		}
+	}
+	return missing
+}
+
+// messagePaths returns the files of a message, which share a path when it is
+// played back as recorded.
+func messagePaths(file database.ListStoredAudioFilesRow) []string {
+	if file.PlaybackPath.Valid && file.PlaybackPath.String != file.FilePath {
+		return []string{file.FilePath, file.PlaybackPath.String}
+	}
+	return []string{file.FilePath}
+}
+
+// DirectorySize returns the total size of the files under dir.
+func DirectorySize(dir string) (int64, error) {
+	var total int64
+	err := walkFiles(dir, func(path string, size int64) {
+		total += size
+	})
+	return total, err
+}
+
+// walkFiles calls fn with the path and size of every file under dir. A
+// missing dir has no files.
+func walkFiles(dir string, fn func(path string, size int64)) error {
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if os.IsNotExist(err) {
+			// Removed by cleanup since it was listed.
+			return nil
+		} else if err != nil {
+			return err
+		}
+		fn(path, info.Size())
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
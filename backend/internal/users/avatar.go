@@ -0,0 +1,194 @@
+package users
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/alecdray/waffle-talkie/internal/apierror"
+)
+
+// AvatarSizes are the square sizes, in pixels, every avatar is stored at.
+var AvatarSizes = []int{64, 256}
+
+const (
+	defaultAvatarSize = 256
+	// maxAvatarDimension bounds the decoded image so a small, highly
+	// compressed upload cannot expand into gigabytes of pixels.
+	maxAvatarDimension = 4096
+)
+
+var ErrInvalidImage = errors.New("invalid image")
+
+// AvatarURL returns the URL clients fetch an avatar from. The version changes
+// with every upload, so responses can be cached for a long time.
+func AvatarURL(userID string, updatedAt time.Time) string {
+	return fmt.Sprintf("/api/v1/users/%s/avatar?v=%d", userID, updatedAt.Unix())
+}
+
+func avatarPath(avatarDirectory, userID string, size int) string {
+	return filepath.Join(avatarDirectory, fmt.Sprintf("%s_%d.jpg", userID, size))
+}
+
+// SaveAvatar decodes a JPEG, PNG or GIF image, crops it to a centered square
+// and stores it at each of AvatarSizes. It returns ErrInvalidImage for data
+// that is not a supported image or is too large.
+func SaveAvatar(avatarDirectory, userID string, data []byte) error {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidImage, err)
+	}
+	if config.Width > maxAvatarDimension || config.Height > maxAvatarDimension {
+		return fmt.Errorf("%w: %dx%d exceeds %dx%d", ErrInvalidImage, config.Width, config.Height, maxAvatarDimension, maxAvatarDimension)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidImage, err)
+	}
+	square := cropSquare(img)
+
+	if err := os.MkdirAll(avatarDirectory, 0755); err != nil {
+		return fmt.Errorf("failed to create avatar directory: %w", err)
+	}
+	for _, size := range AvatarSizes {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, resize(square, size), &jpeg.Options{Quality: 85}); err != nil {
+			return fmt.Errorf("failed to encode avatar: %w", err)
+		}
+		// Write then rename so a concurrent download never sees a partial file.
+		path := avatarPath(avatarDirectory, userID, size)
+		tmp := path + ".tmp"
+		if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+			return fmt.Errorf("failed to write avatar: %w", err)
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			return fmt.Errorf("failed to store avatar: %w", err)
+		}
+	}
+	return nil
+}
+
+// RemoveAvatar deletes every stored size of a user's avatar.
+func RemoveAvatar(avatarDirectory, userID string) error {
+	for _, size := range AvatarSizes {
+		if err := os.Remove(avatarPath(avatarDirectory, userID, size)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// cropSquare draws the centered square of img onto an opaque white RGBA
+// canvas, flattening any transparency since JPEG has none.
+func cropSquare(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	side := min(b.Dx(), b.Dy())
+	origin := image.Pt(b.Min.X+(b.Dx()-side)/2, b.Min.Y+(b.Dy()-side)/2)
+
+	dst := image.NewRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, origin, draw.Over)
+	return dst
+}
+
+// resize scales a square image to size x size by averaging the source pixels
+// that fall under each destination pixel.
+func resize(src *image.RGBA, size int) *image.RGBA {
+	side := src.Bounds().Dx()
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := range size {
+		y0 := y * side / size
+		y1 := max((y+1)*side/size, y0+1)
+		for x := range size {
+			x0 := x * side / size
+			x1 := max((x+1)*side/size, x0+1)
+
+			var r, g, b, n int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					r += int(row[sx*4])
+					g += int(row[sx*4+1])
+					b += int(row[sx*4+2])
+					n++
+				}
+			}
+			i := y*dst.Stride + x*4
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(b / n)
+			dst.Pix[i+3] = 0xff
+		}
+	}
+	return dst
+}
+
+// HandleGetAvatar serves a user's avatar at the requested size (64 or 256,
+// default 256) with caching headers.
+func (h *Handler) HandleGetAvatar(w http.ResponseWriter, r *http.Request) {
+	size := defaultAvatarSize
+	if s := r.URL.Query().Get("size"); s != "" {
+		parsed, err := strconv.Atoi(s)
+		if err != nil || !validAvatarSize(parsed) {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "size must be 64 or 256")
+			return
+		}
+		size = parsed
+	}
+
+	user, err := h.queries.GetUser(r.Context(), r.PathValue("id"))
+	if err == sql.ErrNoRows {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeUserNotFound, "User not found")
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get user", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Internal server error")
+		return
+	}
+	if !user.AvatarUpdatedAt.Valid {
+		apierror.Write(w, http.StatusNotFound, apierror.CodeAvatarNotFound, "User has no avatar")
+		return
+	}
+
+	f, err := os.Open(avatarPath(h.avatarDirectory, user.ID, size))
+	if os.IsNotExist(err) {
+		slog.ErrorContext(r.Context(), "avatar file not found", "target_user_id", user.ID, "size", size)
+		apierror.Write(w, http.StatusNotFound, apierror.CodeAvatarNotFound, "Avatar file not found")
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to open avatar", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Internal server error")
+		return
+	}
+	defer f.Close()
+
+	// Avatar URLs change with every upload, so a stale cached copy is never
+	// shown under the current URL.
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	w.Header().Set("ETag", fmt.Sprintf(`"%s-%d-%d"`, user.ID, user.AvatarUpdatedAt.Time.Unix(), size))
+	http.ServeContent(w, r, "", user.AvatarUpdatedAt.Time, f)
+}
+
+func validAvatarSize(size int) bool {
+	for _, s := range AvatarSizes {
+		if s == size {
+			return true
+		}
+	}
+	return false
+}
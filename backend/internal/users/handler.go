@@ -1,28 +1,44 @@
 package users
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
 	"log/slog"
 	"net/http"
+	"time"
 
+	"github.com/alecdray/waffle-talkie/internal/apierror"
 	"github.com/alecdray/waffle-talkie/internal/database"
+	"github.com/alecdray/waffle-talkie/internal/routes"
 )
 
-// Handler manages audio message endpoints.
+// Handler manages user directory and profile endpoints.
 type Handler struct {
-	queries *database.Queries
+	queries         *database.Queries
+	avatarDirectory string
+	presence        *Presence
+	userID          func(context.Context) (string, bool)
 }
 
-// NewHandler creates an audio handler with database access and storage path.
-func NewHandler(queries *database.Queries) *Handler {
+// NewHandler creates a users handler with database access and avatar storage
+// path. userID returns the authenticated user's ID from a request context.
+func NewHandler(queries *database.Queries, avatarDirectory string, presence *Presence, userID func(context.Context) (string, bool)) *Handler {
 	return &Handler{
-		queries: queries,
+		queries:         queries,
+		avatarDirectory: avatarDirectory,
+		presence:        presence,
+		userID:          userID,
 	}
 }
 
 // RegisterRoutes registers the user-related routes with the provided ServeMux.
 func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
-	mux.HandleFunc("/users", h.HandleGetUsers)
+	mux.HandleFunc("GET /v1/users", h.HandleGetUsers)
+	mux.HandleFunc("GET /v1/users/{id}/avatar", h.HandleGetAvatar)
+
+	// Deprecated unversioned route kept for older app builds.
+	mux.Handle("GET /users", routes.Deprecated("/api/v1/users", h.HandleGetUsers))
 }
 
 type UserRole string
@@ -36,35 +52,135 @@ func (role UserRole) IsAdmin() bool {
 	return role == UserRoleAdmin
 }
 
+// UserStatus tracks whether a user takes part in the group. Only active users
+// count as recipients when deciding whether a message has been fully received.
+type UserStatus string
+
+const (
+	UserStatusActive UserStatus = "active"
+	// UserStatusInactive is set by the inactivity task and cleared on the
+	// user's next authenticated request.
+	UserStatusInactive UserStatus = "inactive"
+	// UserStatusSuspended is set by an admin and blocks the user from signing in.
+	UserStatusSuspended UserStatus = "suspended"
+)
+
+// User is the public view of a user shown to other users.
 type User struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
+	ID         string  `json:"id"`
+	Name       string  `json:"name"`
+	AvatarURL  *string `json:"avatar_url"`
+	StatusText *string `json:"status_text"`
+	Timezone   *string `json:"timezone"`
+}
+
+// NewUser converts a database user to its public view.
+func NewUser(user database.User) User {
+	resp := User{
+		ID:   user.ID,
+		Name: user.Name,
+	}
+	if user.AvatarUpdatedAt.Valid {
+		url := AvatarURL(user.ID, user.AvatarUpdatedAt.Time)
+		resp.AvatarURL = &url
+	}
+	if user.StatusText.Valid {
+		resp.StatusText = &user.StatusText.String
+	}
+	if user.Timezone.Valid {
+		resp.Timezone = &user.Timezone.String
+	}
+	return resp
 }
 
+// DirectoryUser is a user as listed in the directory, with their activity.
+type DirectoryUser struct {
+	User
+	Role     UserRole   `json:"role"`
+	Status   UserStatus `json:"status"`
+	Approved bool       `json:"approved"`
+	// LastActive is the time of the user's most recent authenticated request.
+	LastActive *time.Time `json:"last_active"`
+	// MessagesThisWeek counts the messages the user sent in the last 7 days.
+	MessagesThisWeek int64 `json:"messages_this_week"`
+	Online           bool  `json:"online"`
+}
+
+type UsersResponse struct {
+	Users []DirectoryUser `json:"users"`
+}
+
+// HandleGetUsers lists approved users. Admins can pass include=pending to
+// also list users awaiting approval.
 func (h *Handler) HandleGetUsers(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	includePending := false
+	switch r.URL.Query().Get("include") {
+	case "":
+	case "pending":
+		includePending = true
+	default:
+		apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "include must be pending")
 		return
 	}
 
+	if includePending {
+		userID, ok := h.userID(r.Context())
+		if !ok {
+			apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorized, "User ID not found")
+			return
+		}
+		requester, err := h.queries.GetUser(r.Context(), userID)
+		if err != nil && err != sql.ErrNoRows {
+			slog.ErrorContext(r.Context(), "failed to get user", "error", err)
+			apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Internal server error")
+			return
+		}
+		if !UserRole(requester.Role).IsAdmin() {
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Only admins can list pending users")
+			return
+		}
+	}
+
 	dbUsers, err := h.queries.ListUsers(r.Context())
 	if err != nil {
-		slog.Error("failed to list users", "error", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "failed to list users", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Internal server error")
 		return
 	}
 
-	users := make([]User, len(dbUsers))
-	for i, user := range dbUsers {
-		users[i] = User{
-			ID:   user.ID,
-			Name: user.Name,
+	now := time.Now().UTC()
+	counts, err := h.queries.CountAudioMessagesBySenderSince(r.Context(), now.AddDate(0, 0, -7))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to count messages", "error", err)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Internal server error")
+		return
+	}
+	sent := make(map[string]int64, len(counts))
+	for _, c := range counts {
+		sent[c.SenderUserID] = c.MessageCount
+	}
+
+	users := make([]DirectoryUser, 0, len(dbUsers))
+	for _, user := range dbUsers {
+		if !user.Approved && !includePending {
+			continue
+		}
+		entry := DirectoryUser{
+			User:             NewUser(user),
+			Role:             UserRole(user.Role),
+			Status:           UserStatus(user.Status),
+			Approved:         user.Approved,
+			MessagesThisWeek: sent[user.ID],
+			Online:           h.presence.Online(user.ID, user.LastActive.Time, now),
+		}
+		if user.LastActive.Valid {
+			entry.LastActive = &user.LastActive.Time
 		}
+		users = append(users, entry)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]any{
-		"users": users,
+	json.NewEncoder(w).Encode(UsersResponse{
+		Users: users,
 	})
 }
@@ -0,0 +1,56 @@
+package users
+
+import (
+	"sync"
+	"time"
+)
+
+// onlineWindow is how recently a user must have made a request to be shown
+// as online.
+const onlineWindow = 5 * time.Minute
+
+// Presence counts the streaming connections each user has open, so users
+// stay online for as long as a long-running request lasts.
+type Presence struct {
+	mu      sync.Mutex
+	streams map[string]int
+}
+
+func NewPresence() *Presence {
+	return &Presence{streams: make(map[string]int)}
+}
+
+// StreamOpened records an open stream for the user. Call the returned
+// function when the stream closes.
+func (p *Presence) StreamOpened(userID string) (closed func()) {
+	p.mu.Lock()
+	p.streams[userID]++
+	p.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			if p.streams[userID]--; p.streams[userID] <= 0 {
+				delete(p.streams, userID)
+			}
+		})
+	}
+}
+
+// Streaming reports whether the user has any stream open.
+func (p *Presence) Streaming(userID string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.streams[userID] > 0
+}
+
+// Online reports whether a user counts as online: active within the last
+// onlineWindow or holding a stream open.
+func (p *Presence) Online(userID string, lastActive time.Time, now time.Time) bool {
+	if !lastActive.IsZero() && now.Sub(lastActive) < onlineWindow {
+		return true
+	}
+	return p.Streaming(userID)
+}
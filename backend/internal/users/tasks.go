@@ -0,0 +1,75 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/alecdray/waffle-talkie/internal/audit"
+	"github.com/alecdray/waffle-talkie/internal/database"
+)
+
+type TaskManager struct {
+	queries             *database.Queries
+	inactivityThreshold time.Duration
+	audit               *audit.Logger
+}
+
+// NewTaskManager creates the user background tasks. A zero
+// inactivityThreshold never marks users inactive.
+func NewTaskManager(queries *database.Queries, inactivityThreshold time.Duration, auditLog *audit.Logger) *TaskManager {
+	return &TaskManager{
+		queries:             queries,
+		inactivityThreshold: inactivityThreshold,
+		audit:               auditLog,
+	}
+}
+
+func (tm *TaskManager) Start(ctx context.Context) error {
+	if tm.inactivityThreshold <= 0 {
+		return nil
+	}
+
+	slog.Info("starting user tasks", "inactivity_threshold", tm.inactivityThreshold)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Hour):
+				if err := tm.DeactivateIdleUsers(ctx); err != nil {
+					slog.Error("failed to deactivate idle users", "error", err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// DeactivateIdleUsers marks approved users inactive once they have made no
+// request for longer than the threshold, so they stop holding back messages
+// that everyone else has received.
+func (tm *TaskManager) DeactivateIdleUsers(ctx context.Context) error {
+	cutoff := time.Now().UTC().Add(-tm.inactivityThreshold)
+	deactivated, err := tm.queries.DeactivateIdleUsers(ctx, sql.NullTime{Time: cutoff, Valid: true})
+	if err != nil {
+		return fmt.Errorf("failed to deactivate idle users: %w", err)
+	}
+
+	for _, user := range deactivated {
+		slog.Info("user marked inactive", "target_user_id", user.ID)
+		detail := map[string]any{}
+		if user.LastActive.Valid {
+			detail["last_active"] = user.LastActive.Time
+		}
+		tm.audit.RecordContext(ctx, audit.Event{
+			Action:     audit.ActionUserDeactivated,
+			TargetType: audit.TargetUser,
+			TargetID:   user.ID,
+			Detail:     detail,
+		})
+	}
+	return nil
+}
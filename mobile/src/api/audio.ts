@@ -19,7 +19,7 @@ export class AudioClient {
 
     const audioBlob = {
       uri: audioUri,
-      type: "audio/m4a",
+      type: "audio/mp4",
       name: "audio.m4a",
     } as any;
 
@@ -27,7 +27,7 @@ export class AudioClient {
     formData.append("duration", duration.toString());
 
     const response = await this.api.fetchJson<UploadAudioResponse>(
-      "/api/audio-messages/upload",
+      "/api/v1/audio-messages",
       {
         method: "POST",
         body: formData,
@@ -39,7 +39,7 @@ export class AudioClient {
 
   getMessages = async (): Promise<AudioMessage[]> => {
     const response = await this.api.fetchJson<MessagesResponse>(
-      "/api/audio-messages",
+      "/api/v1/audio-messages",
       {
         method: "GET",
       },
@@ -49,11 +49,13 @@ export class AudioClient {
   };
 
   downloadAudio = async (messageId: string, file: File): Promise<string> => {
-    const downloadUrl = `${API_URL}/api/audio-messages/download?id=${messageId}`;
+    const downloadUrl = `${API_URL}/api/v1/audio-messages/${messageId}`;
 
     const downloadedFile = await File.downloadFileAsync(downloadUrl, file, {
       headers: {
         Authorization: `Bearer ${this.api.token}`,
+        // Saved as .m4a; the server picks the playback rendition in that format.
+        Accept: "audio/mp4",
       },
     });
 
@@ -64,10 +66,9 @@ export class AudioClient {
     messageId: string,
   ): Promise<MarkReceivedResponse> => {
     const response = await this.api.fetchJson<MarkReceivedResponse>(
-      "/api/audio-messages/received",
+      `/api/v1/audio-messages/${messageId}/receipt`,
       {
         method: "POST",
-        body: JSON.stringify({ message_id: messageId }),
       },
     );
 
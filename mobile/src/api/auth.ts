@@ -11,7 +11,7 @@ export class AuthClient {
 
   registerUser = async (data: RegisterRequest): Promise<RegisterResponse> => {
     const response = await this.api.fetchJson<RegisterResponse>(
-      "/auth/register",
+      "/auth/v1/register",
       {
         method: "POST",
         body: JSON.stringify(data),
@@ -22,7 +22,7 @@ export class AuthClient {
   };
 
   loginUser = async (data: LoginRequest): Promise<LoginResponse> => {
-    const response = await this.api.fetchJson<LoginResponse>("/auth/login", {
+    const response = await this.api.fetchJson<LoginResponse>("/auth/v1/login", {
       method: "POST",
       body: JSON.stringify(data),
     });
@@ -3,6 +3,46 @@ import { AuthClient } from "./auth";
 import { API_URL, createHeaders } from "./config";
 import { UsersClient } from "./users";
 
+// Error codes returned by the backend in `{"error": {"code", "message"}}`.
+// See the error code list in backend/README.md. Kept in sync with
+// backend/internal/apierror, which its tests check.
+export type ApiErrorCode =
+  | "bad_request"
+  | "invalid_body"
+  | "method_not_allowed"
+  | "not_found"
+  | "payload_too_large"
+  | "not_acceptable"
+  | "invalid_image"
+  | "rate_limited"
+  | "internal_error"
+  | "email_unavailable"
+  | "unauthorized"
+  | "token_expired"
+  | "token_invalid"
+  | "token_revoked"
+  | "device_not_registered"
+  | "not_approved"
+  | "user_suspended"
+  | "forbidden"
+  | "confirmation_invalid"
+  | "link_invalid"
+  | "invite_required"
+  | "invite_invalid"
+  | "pending_limit_reached"
+  | "user_not_found"
+  | "message_not_found"
+  | "audio_file_not_found"
+  | "invite_not_found"
+  | "avatar_not_found"
+  | "feed_not_found"
+  | "compilation_not_found"
+  | "message_not_ready"
+  | "transcription_unavailable"
+  | "undo_unavailable"
+  | "quota_exceeded"
+  | "insufficient_storage";
+
 export class ClientError extends Error {
   status?: number;
   json?: Record<string, unknown>;
@@ -26,6 +66,11 @@ export class ClientError extends Error {
     return this;
   }
 
+  get code(): ApiErrorCode | undefined {
+    const error = this.json?.error as { code?: ApiErrorCode } | undefined;
+    return error?.code;
+  }
+
   isUnauthorized(): boolean {
     return this.status === 401;
   }
@@ -34,8 +79,12 @@ export class ClientError extends Error {
     return this.status === 403;
   }
 
+  // Revoked tokens are handled like expired ones: the user has to log in again.
   isTokenExpired(): boolean {
-    return this.isUnauthorized() && this.json?.error === "expired token";
+    return (
+      this.isUnauthorized() &&
+      (this.code === "token_expired" || this.code === "token_revoked")
+    );
   }
 
   static isClientError(error: unknown): error is ClientError {
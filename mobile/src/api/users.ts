@@ -5,7 +5,7 @@ export class UsersClient {
   constructor(private api: ApiClient) {}
 
   getUsers = async (): Promise<UsersResponse> => {
-    const response = await this.api.fetchJson<UsersResponse>("/api/users", {
+    const response = await this.api.fetchJson<UsersResponse>("/api/v1/users", {
       method: "GET",
     });
 
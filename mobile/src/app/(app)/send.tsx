@@ -61,7 +61,8 @@ export default function Send() {
 
     try {
       setIsUploading(true);
-      const duration = Math.floor(recorderState.durationMillis / 1000);
+      // The server requires at least a second.
+      const duration = Math.max(1, Math.ceil(recorderState.durationMillis / 1000));
       const api = await getClient();
       await api.audio.uploadAudio(audioRecorder.uri, duration);
 
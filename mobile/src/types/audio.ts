@@ -1,3 +1,22 @@
+import { User } from "./users";
+
+/** Recipients only see ready messages; senders see their own in every state. */
+export type ProcessingStatus = "processing" | "ready" | "failed";
+
+/** A phrase spoken between two offsets, in milliseconds, into the audio. */
+export interface TranscriptSegment {
+  start_ms: number;
+  end_ms: number;
+  text: string;
+}
+
+export interface Transcript {
+  /** The segments' text joined by spaces. */
+  text: string;
+  segments: TranscriptSegment[];
+  created_at: string;
+}
+
 export interface AudioMessage {
   id: string;
   sender_user_id: string;
@@ -5,20 +24,57 @@ export interface AudioMessage {
   duration: number;
   created_at: string;
   deleted_at: string | null;
+  /** Null if the sender's account no longer exists. */
+  sender: User | null;
+  /** 100 levels from 0 to 255; null until generated or if undecodable. */
+  peaks: number[] | null;
+  processing_status: ProcessingStatus;
+  /** Null until transcribed, or if transcription is disabled or failed. */
+  transcript: Transcript | null;
+  /** Null unless the sender gave one. */
+  title: string | null;
+  /** May span lines; null unless the sender gave one. */
+  caption: string | null;
+  /** When the sender last changed the title or caption. */
+  edited_at: string | null;
+  /** Who unsent the message; null for listed messages. */
+  deleted_by_user_id: string | null;
+  purged_at: string | null;
 }
 
 export interface UploadAudioRequest {
   audio: File | Blob;
   duration: number;
+  /** At most 100 characters. */
+  title?: string;
+  /** At most 1000 characters. */
+  caption?: string;
+}
+
+/** Omitted fields are kept; empty strings clear them. */
+export interface UpdateAudioMessageRequest {
+  title?: string;
+  caption?: string;
 }
 
 export interface UploadAudioResponse {
   message_id: string;
+  /** processing while the message is hidden from recipients. */
+  processing_status: "processing" | "ready";
   message: string;
 }
 
 export interface MessagesResponse {
   messages: AudioMessage[];
+  /** IDs of messages unsent recently; drop any copies of them. */
+  retracted: string[];
+}
+
+export interface UnsendResponse {
+  message_id: string;
+  /** Until when POST /v1/audio-messages/{id}/restore can undo the unsend. */
+  undo_until: string | null;
+  message: string;
 }
 
 export interface MarkReceivedRequest {
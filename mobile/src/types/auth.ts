@@ -10,6 +10,7 @@ export interface UserAuth {
 export interface RegisterRequest {
   name: string;
   device_id: string;
+  invite_code?: string;
 }
 
 export interface RegisterResponse {
@@ -0,0 +1,28 @@
+/** A run of messages from one sender; each lasts until the next begins. */
+export interface CompilationChapter {
+  /** The sender's name when the compilation was built. */
+  title: string;
+  sender_user_id: string;
+  start_ms: number;
+  end_ms: number;
+  message_count: number;
+}
+
+/** A week's messages stitched into one episode. */
+export interface Compilation {
+  /** The Wednesday the week starts on, as YYYY-MM-DD in UTC. */
+  week: string;
+  starts_at: string;
+  ends_at: string;
+  duration_ms: number;
+  message_count: number;
+  /** Type of the audio at /v1/compilations/{week}/audio. */
+  content_type: string;
+  created_at: string;
+  chapters: CompilationChapter[];
+}
+
+export interface CompilationsResponse {
+  /** Newest first. */
+  compilations: Compilation[];
+}
@@ -0,0 +1,15 @@
+export type EmailDigest = "daily" | "weekly" | "off";
+
+export interface EmailSettings {
+  /** null when no address has been added. */
+  address: string | null;
+  /** Digests are only sent once the address is verified. */
+  verified: boolean;
+  digest: EmailDigest;
+  last_digest_at: string | null;
+}
+
+export interface UpdateEmailSettingsRequest {
+  address: string;
+  digest: EmailDigest;
+}
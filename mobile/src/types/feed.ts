@@ -0,0 +1,22 @@
+export interface FeedSettings {
+  enabled: boolean;
+  /** Whether downloading an episode marks the message received. */
+  mark_received: boolean;
+  created_at: string | null;
+  last_fetched_at: string | null;
+}
+
+export interface CreateFeedRequest {
+  mark_received?: boolean;
+}
+
+export interface CreateFeedResponse {
+  /** Secret feed URL; the server cannot show it again. */
+  url: string;
+  mark_received: boolean;
+  created_at: string;
+}
+
+export interface UpdateFeedRequest {
+  mark_received: boolean;
+}
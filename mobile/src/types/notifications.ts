@@ -0,0 +1,22 @@
+export type NotificationMode = "all" | "digest" | "none";
+
+export interface QuietHours {
+  /** 24-hour "HH:MM" in the user's timezone. */
+  start: string;
+  /** Before start when the window spans midnight. */
+  end: string;
+}
+
+export interface NotificationSettings {
+  mode: NotificationMode;
+  quiet_hours: QuietHours | null;
+  /** Zone quiet hours are evaluated in; UTC if the profile has none. */
+  timezone: string;
+  muted_user_ids: string[];
+}
+
+export interface UpdateNotificationSettingsRequest {
+  mode: NotificationMode;
+  /** null turns quiet hours off. */
+  quiet_hours: QuietHours | null;
+}
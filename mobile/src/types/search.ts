@@ -0,0 +1,30 @@
+/** A piece of a snippet; match marks the words that matched the query. */
+export interface SnippetPart {
+  text: string;
+  match: boolean;
+}
+
+/** A stretch of the playback audio, in milliseconds from its start. */
+export interface TranscriptOffset {
+  start_ms: number;
+  end_ms: number;
+}
+
+export interface SearchResult {
+  message_id: string;
+  sender_user_id: string;
+  /** Empty if the sender's account no longer exists. */
+  sender_name: string;
+  created_at: string;
+  duration: number;
+  /** Where the snippet is from. */
+  field: "transcript" | "note" | "sender_name" | "sent_on";
+  snippet: SnippetPart[];
+  /** Transcript segments containing a search term. */
+  matches: TranscriptOffset[];
+}
+
+export interface SearchResponse {
+  /** Best first. */
+  results: SearchResult[];
+}
@@ -0,0 +1,19 @@
+/** Audio stored on the server. */
+export interface StorageUsage {
+  bytes: number;
+  /** Total length of the messages. */
+  seconds: number;
+  messages: number;
+}
+
+/** A limit on stored audio; fields are null when unlimited. */
+export interface StorageQuota {
+  bytes: number | null;
+  seconds: number | null;
+}
+
+/** Returned by /v1/me/usage. Uploads past the quota fail with `quota_exceeded`. */
+export interface UsageResponse {
+  usage: StorageUsage;
+  quota: StorageQuota;
+}
@@ -1,8 +1,38 @@
 export interface User {
   id: string;
   name: string;
+  /** Versioned avatar URL relative to the server, null if the user has none. */
+  avatar_url: string | null;
+  status_text: string | null;
+  /** IANA time zone name. */
+  timezone: string | null;
+}
+
+export interface Profile extends User {
+  role: "admin" | "user";
+}
+
+export interface UpdateProfileRequest {
+  name?: string;
+  /** An empty string clears the timezone. */
+  timezone?: string;
+  /** An empty string clears the status line. */
+  status_text?: string;
+}
+
+export type UserStatus = "active" | "inactive" | "suspended";
+
+export interface DirectoryUser extends User {
+  role: "admin" | "user";
+  status: UserStatus;
+  /** Always true unless pending users were requested. */
+  approved: boolean;
+  last_active: string | null;
+  /** Messages sent in the last 7 days. */
+  messages_this_week: number;
+  online: boolean;
 }
 
 export interface UsersResponse {
-  users: User[];
+  users: DirectoryUser[];
 }